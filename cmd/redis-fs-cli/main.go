@@ -2,19 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/fatih/color"
-	"github.com/redis/go-redis/v9"
 	"github.com/rowantrollope/redis-fs-cli/internal/cli"
 	"github.com/rowantrollope/redis-fs-cli/internal/cmd"
 	"github.com/rowantrollope/redis-fs-cli/internal/config"
-	"github.com/rowantrollope/redis-fs-cli/internal/fs"
-	"github.com/rowantrollope/redis-fs-cli/internal/embedding"
 	"github.com/rowantrollope/redis-fs-cli/internal/output"
-	"github.com/rowantrollope/redis-fs-cli/internal/search"
+	"github.com/rowantrollope/redis-fs-cli/pkg/redisfs"
 	flag "github.com/spf13/pflag"
 )
 
@@ -57,7 +55,11 @@ func run() int {
 
 	// Connect to Redis
 	ctx := context.Background()
-	rdb := redis.NewClient(cfg.RedisOptions())
+	rdb, err := cfg.NewRedisClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 2
+	}
 
 	if err := rdb.Ping(ctx).Err(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: cannot connect to Redis at %s: %s\n", cfg.Addr(), err)
@@ -65,42 +67,74 @@ func run() int {
 	}
 	defer rdb.Close()
 
+	umask, err := redisfs.ParseUmask(cfg.Umask)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 2
+	}
+	uid, gid := cfg.Owner()
+
 	// Detect search capability
-	cfg.SearchAvailable = search.DetectSearch(ctx, rdb)
-
-	// Create FS client
-	fsClient := fs.NewClient(rdb, cfg.Volume)
-
-	// Wire search indexer if available
-	if cfg.SearchAvailable {
-		indexer := search.NewIndexer(rdb, cfg.Volume)
-		if cfg.EmbeddingAPIKey != "" {
-			embCfg := &embedding.Config{
-				APIKey:  cfg.EmbeddingAPIKey,
-				BaseURL: cfg.EmbeddingAPIURL,
-				Model:   cfg.EmbeddingModel,
-				Dim:     cfg.EmbeddingDim,
-			}
-			indexer.SetEmbedder(embedding.NewClient(embCfg), cfg.EmbeddingDim)
+	cfg.SearchAvailable = redisfs.DetectSearch(ctx, rdb)
+
+	// Open the volume through the public library API, so the CLI and
+	// library behave identically
+	opts := redisfs.Options{
+		Volume:    cfg.Volume,
+		HashTags:  cfg.UseHashTags(),
+		ChunkSize: cfg.ChunkSize,
+		Search:    cfg.SearchAvailable,
+		Identity:  redisfs.Identity{UID: uid, GID: gid},
+
+		Events:       cfg.Events,
+		EventsMaxLen: cfg.EventsMaxLen,
+	}
+	if cfg.ChunkSize == 0 {
+		opts.ChunkSize = -1
+	}
+	if cfg.EmbeddingAPIKey != "" {
+		opts.Embedding = &redisfs.EmbeddingConfig{
+			APIKey:  cfg.EmbeddingAPIKey,
+			BaseURL: cfg.EmbeddingAPIURL,
+			Model:   cfg.EmbeddingModel,
+			Dim:     cfg.EmbeddingDim,
 		}
-		fsClient.SetObserver(indexer)
 	}
-
-	// Auto-init volume root
-	if err := fsClient.Init(ctx); err != nil {
+	fsClient, err := redisfs.New(ctx, rdb, opts)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to initialize volume: %s\n", err)
 		return 1
 	}
+	fsClient.SetUmask(umask)
 
 	// Create router
 	router := cmd.NewRouter(fsClient, cfg, formatter)
 
+	// Serve read-only commands from replicas
+	if cfg.ReplicaReads {
+		replicas, err := cfg.NewReplicaClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return 2
+		}
+		defer replicas.Close()
+
+		readerOpts := opts
+		readerOpts.ReadOnly = true
+		reader, err := redisfs.New(ctx, replicas, readerOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return 1
+		}
+		router.SetReader(reader)
+	}
+
 	// Single-command mode
 	if len(cfg.Args) > 0 {
 		line := strings.Join(cfg.Args, " ")
 		if err := router.Execute(ctx, line); err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", err)
-			return 1
+			return exitCode(err)
 		}
 		return 0
 	}
@@ -113,3 +147,29 @@ func run() int {
 	}
 	return 0
 }
+
+// exitCode maps a command error to the process exit status, so scripts can
+// tell common failures apart. 1 is any other error, 2 a usage or
+// configuration error.
+func exitCode(err error) int {
+	codes := []struct {
+		err  error
+		code int
+	}{
+		{redisfs.ErrNotExist, 3},
+		{redisfs.ErrExist, 4},
+		{redisfs.ErrPermission, 5},
+		{redisfs.ErrNotPermitted, 5},
+		{redisfs.ErrReadOnly, 5},
+		{redisfs.ErrNotDir, 6},
+		{redisfs.ErrIsDir, 7},
+		{redisfs.ErrNotEmpty, 8},
+		{redisfs.ErrLoop, 9},
+	}
+	for _, c := range codes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return 1
+}
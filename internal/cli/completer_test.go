@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/rowantrollope/redis-fs-cli/internal/cmd"
+	"github.com/rowantrollope/redis-fs-cli/internal/config"
+	"github.com/rowantrollope/redis-fs-cli/internal/fs"
+	"github.com/rowantrollope/redis-fs-cli/internal/output"
+)
+
+func TestCompletePath(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.DefaultConfig()
+	client := fs.NewClientWithBackend(fs.NewMemoryBackend(), cfg.Volume)
+	client.Init(ctx)
+	client.Mkdir(ctx, "/docs", false)
+	client.WriteFile(ctx, "/docs/readme", "")
+	client.WriteFile(ctx, "/data", "")
+
+	router := cmd.NewRouter(client, cfg, output.NewFormatter(false, false))
+	c := NewCompleter(router, client)
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"cat d", []string{"ata ", "ocs/"}},
+		{"cat /docs/r", []string{"eadme "}},
+		{"cat /nope/", nil},
+	}
+	for _, tt := range tests {
+		got, _ := c.Do([]rune(tt.line), len(tt.line))
+		var suffixes []string
+		for _, s := range got {
+			suffixes = append(suffixes, string(s))
+		}
+		sort.Strings(suffixes)
+		if !slices.Equal(suffixes, tt.want) {
+			t.Errorf("Do(%q) = %q, want %q", tt.line, suffixes, tt.want)
+		}
+	}
+}
@@ -48,6 +48,12 @@ func (r *REPL) Run(ctx context.Context) error {
 	}
 	defer rl.Close()
 
+	// Confirmations are read through readline, which owns the terminal
+	r.Router.Prompt = func(prompt string) (string, error) {
+		rl.SetPrompt(prompt)
+		return rl.Readline()
+	}
+
 	for {
 		// Update prompt each iteration (cwd may have changed)
 		rl.SetPrompt(BuildPrompt(r.Router.State.Volume, r.Router.State.Cwd, r.Config.ShouldColor()))
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rowantrollope/redis-fs-cli/internal/fs"
+	flag "github.com/spf13/pflag"
+)
+
+// archiveFormat returns the format named by --format, or else the one the
+// extension of file implies. Standard output and input default to tar.
+func archiveFormat(format, file string) (fs.ArchiveFormat, error) {
+	if format != "" {
+		return fs.ParseArchiveFormat(format)
+	}
+	lower := strings.ToLower(file)
+	switch {
+	case file == "-", strings.HasSuffix(lower, ".tar"):
+		return fs.FormatTar, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return fs.FormatTarGz, nil
+	case strings.HasSuffix(lower, ".zip"):
+		return fs.FormatZip, nil
+	}
+	return "", fmt.Errorf("%s: cannot tell the archive format (use --format tar|tar.gz|zip)", file)
+}
+
+// sniffArchiveFormat recognizes gzip and zip archives by their magic
+// number; anything else is taken for tar.
+func sniffArchiveFormat(head []byte) fs.ArchiveFormat {
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return fs.FormatTarGz
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return fs.FormatZip
+	}
+	return fs.FormatTar
+}
+
+func (r *Router) handleExport(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fset.StringP("format", "f", "", "Archive format: tar, tar.gz or zip")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 2 {
+		return fmt.Errorf("export: usage: export [--format tar|tar.gz|zip] <path> <local-file|->")
+	}
+	path := r.ResolvePath(fset.Arg(0))
+	file := fset.Arg(1)
+	f, err := archiveFormat(*format, file)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+
+	if file == "-" {
+		w := bufio.NewWriter(r.Formatter.Writer)
+		if err := r.Reader.ExportArchive(ctx, path, w, f); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	out, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	w := bufio.NewWriter(out)
+	err = r.Reader.ExportArchive(ctx, path, w, f)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := out.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("export: %w", cerr)
+	}
+	if err != nil {
+		// Leave no truncated archive behind
+		os.Remove(file)
+		return err
+	}
+	return nil
+}
+
+func (r *Router) handleImport(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fset.StringP("format", "f", "", "Archive format: tar, tar.gz or zip")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() < 1 || fset.NArg() > 2 {
+		return fmt.Errorf("import: usage: import [--format tar|tar.gz|zip] <archive|-> [path]")
+	}
+	file := fset.Arg(0)
+	path := r.ResolvePath(fset.Arg(1))
+
+	var (
+		archive io.ReaderAt
+		size    int64
+	)
+	if file == "-" {
+		// Zip needs random access, so standard input is read in full
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("import: %w", err)
+		}
+		archive, size = bytes.NewReader(data), int64(len(data))
+	} else {
+		in, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("import: %w", err)
+		}
+		defer in.Close()
+		info, err := in.Stat()
+		if err != nil {
+			return fmt.Errorf("import: %w", err)
+		}
+		archive, size = in, info.Size()
+	}
+
+	var f fs.ArchiveFormat
+	if *format != "" {
+		var err error
+		if f, err = fs.ParseArchiveFormat(*format); err != nil {
+			return fmt.Errorf("import: %w", err)
+		}
+	} else {
+		head := make([]byte, 4)
+		n, _ := archive.ReadAt(head, 0)
+		f = sniffArchiveFormat(head[:n])
+	}
+	return r.Client.ImportArchive(ctx, archive, size, path, f)
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
 )
 
 func (r *Router) handleCat(ctx context.Context, args []string) error {
@@ -12,15 +13,28 @@ func (r *Router) handleCat(ctx context.Context, args []string) error {
 
 	for _, arg := range args {
 		path := r.ResolvePath(arg)
-		content, err := r.Client.ReadFile(ctx, path)
+		w := &lastByteWriter{w: r.Formatter.Writer}
+		n, err := r.Reader.ReadFileTo(ctx, path, w)
 		if err != nil {
 			return err
 		}
-		r.Formatter.Printf("%s", content)
 		// Add newline if content doesn't end with one
-		if len(content) > 0 && content[len(content)-1] != '\n' {
+		if n > 0 && w.last != '\n' {
 			r.Formatter.Println()
 		}
 	}
 	return nil
 }
+
+// lastByteWriter remembers the last byte written through it.
+type lastByteWriter struct {
+	w    io.Writer
+	last byte
+}
+
+func (lw *lastByteWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		lw.last = p[len(p)-1]
+	}
+	return lw.w.Write(p)
+}
@@ -22,20 +22,18 @@ func (r *Router) handleCd(ctx context.Context, args []string) error {
 
 	target = fs.NormalizePath(target)
 
-	isDir, err := r.Client.IsDir(ctx, target)
+	meta, err := r.Client.StatFollow(ctx, target)
 	if err != nil {
 		return err
 	}
-	if !isDir {
-		// Check if it exists but is not a dir
-		exists, err := r.Client.Exists(ctx, target)
-		if err != nil {
-			return err
-		}
-		if exists {
-			return fmt.Errorf("cd: %s: Not a directory", target)
-		}
-		return fmt.Errorf("cd: %s: No such file or directory", target)
+	if meta == nil {
+		return &fs.PathError{Op: "cd", Path: target, Err: fs.ErrNotExist}
+	}
+	if meta.Type != fs.TypeDir {
+		return &fs.PathError{Op: "cd", Path: target, Err: fs.ErrNotDir}
+	}
+	if !r.Client.Identity().Can(meta, fs.AccessExec) {
+		return &fs.PathError{Op: "cd", Path: target, Err: fs.ErrPermission}
 	}
 
 	r.State.PrevDir = r.State.Cwd
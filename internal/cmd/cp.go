@@ -18,11 +18,27 @@ func (r *Router) handleCp(ctx context.Context, args []string) error {
 		return fmt.Errorf("cp: missing operand")
 	}
 
-	src := r.ResolvePath(fs.Arg(0))
-	dst := r.ResolvePath(fs.Arg(1))
+	srcLoc, err := parseLocation(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("cp: %w", err)
+	}
+	dstLoc, err := parseLocation(fs.Arg(1))
+	if err != nil {
+		return fmt.Errorf("cp: %w", err)
+	}
+	from, src, closeFrom, err := r.open(ctx, "cp", srcLoc)
+	if err != nil {
+		return err
+	}
+	defer closeFrom()
+	to, dst, closeTo, err := r.open(ctx, "cp", dstLoc)
+	if err != nil {
+		return err
+	}
+	defer closeTo()
 
 	if *recursive {
-		return r.Client.CopyRecursive(ctx, src, dst)
+		return from.CopyRecursiveTo(ctx, src, to, dst)
 	}
-	return r.Client.CopyFile(ctx, src, dst)
+	return from.CopyTo(ctx, src, to, dst)
 }
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// maxDiffCells bounds the LCS table; larger inputs are diffed as one
+// replacement after trimming their common prefix and suffix.
+const maxDiffCells = 4 << 20
+
+// diffLine is one line of an edit script: ' ' kept, '-' removed, '+' added.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns the differences between a and b in unified format,
+// or "" when they are equal.
+func unifiedDiff(aName, bName, a, b string) string {
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var sb strings.Builder
+	aLine, bLine := 1, 1 // line numbers at edits[i]
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			aLine, bLine = aLine+1, bLine+1
+			i++
+			continue
+		}
+
+		// A hunk runs from diffContext lines before the change to
+		// diffContext lines after the last change closer than twice that.
+		start := max(i-diffContext, 0)
+		end := i
+		for j := i; j < len(edits); j++ {
+			if edits[j].op != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end = min(end+diffContext, len(edits))
+
+		aStart, bStart := aLine-(i-start), bLine-(i-start)
+		var aLen, bLen int
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				aLen++
+			}
+			if e.op != '-' {
+				bLen++
+			}
+		}
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for _, e := range edits[start:end] {
+			sb.WriteByte(e.op)
+			sb.WriteString(e.text)
+			sb.WriteByte('\n')
+		}
+
+		for _, e := range edits[i:end] {
+			if e.op != '+' {
+				aLine++
+			}
+			if e.op != '-' {
+				bLine++
+			}
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+// hunkRange formats the start,length of a hunk side; an empty side names
+// the line before it, as diff -u does.
+func hunkRange(start, n int) string {
+	if n == 0 {
+		start--
+	}
+	if n == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, n)
+}
+
+// splitLines splits content into lines without their newlines.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines returns an edit script turning a into b, using a longest
+// common subsequence.
+func diffLines(a, b []string) []diffLine {
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var edits []diffLine
+	for _, l := range a[:prefix] {
+		edits = append(edits, diffLine{' ', l})
+	}
+	edits = append(edits, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		edits = append(edits, diffLine{' ', l})
+	}
+	return edits
+}
+
+func diffMiddle(a, b []string) []diffLine {
+	var edits []diffLine
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, l := range a {
+			edits = append(edits, diffLine{'-', l})
+		}
+		for _, l := range b {
+			edits = append(edits, diffLine{'+', l})
+		}
+		return edits
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, diffLine{' ', a[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, diffLine{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, diffLine{'+', b[j]})
+	}
+	return edits
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	flag "github.com/spf13/pflag"
+)
+
+func (r *Router) handleDu(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("du", flag.ContinueOnError)
+	all := fset.BoolP("all", "a", false, "Show files as well as directories")
+	summarize := fset.BoolP("summarize", "s", false, "Show only a total for each argument")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if *all && *summarize {
+		return fmt.Errorf("du: cannot both summarize and show all entries")
+	}
+
+	paths := fset.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	roots := make(map[string]bool)
+	for i, p := range paths {
+		paths[i] = r.ResolvePath(p)
+		roots[paths[i]] = true
+	}
+
+	entries, err := r.Reader.DiskUsage(ctx, paths...)
+	if err != nil {
+		return err
+	}
+
+	var result []map[string]interface{}
+	for _, e := range entries {
+		// Arguments are always shown, like du(1)
+		show := roots[e.Path] || (!*summarize && (e.Dir || *all))
+		if !show {
+			continue
+		}
+		if r.Formatter.JSON {
+			result = append(result, map[string]interface{}{
+				"path": e.Path,
+				"size": e.Size,
+			})
+			continue
+		}
+		fmt.Fprintf(r.Formatter.Writer, "%d\t%s\n", e.Size, e.Path)
+	}
+
+	if r.Formatter.JSON {
+		return r.Formatter.PrintJSON(result)
+	}
+	return nil
+}
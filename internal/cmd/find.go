@@ -3,14 +3,15 @@ package cmd
 import (
 	"context"
 	"fmt"
+
+	"github.com/rowantrollope/redis-fs-cli/internal/fs"
 )
 
 func (r *Router) handleFind(ctx context.Context, args []string) error {
 	// find uses POSIX-style -name and -type flags (single dash, not pflag-compatible)
 	// Parse manually.
 	path := "."
-	namePattern := ""
-	typeFilter := ""
+	var opts fs.FindOptions
 
 	i := 0
 	for i < len(args) {
@@ -20,13 +21,21 @@ func (r *Router) handleFind(ctx context.Context, args []string) error {
 			if i >= len(args) {
 				return fmt.Errorf("find: -name requires an argument")
 			}
-			namePattern = args[i]
+			opts.Name = args[i]
 		case "-type":
 			i++
 			if i >= len(args) {
 				return fmt.Errorf("find: -type requires an argument")
 			}
-			typeFilter = args[i]
+			opts.Type = args[i]
+		case "-tag", "--tag":
+			i++
+			if i >= len(args) {
+				return fmt.Errorf("find: %s requires an argument", args[i-1])
+			}
+			opts.Tags = append(opts.Tags, args[i])
+		case "-L":
+			opts.Follow = true
 		default:
 			if args[i][0] != '-' && path == "." {
 				path = args[i]
@@ -39,7 +48,7 @@ func (r *Router) handleFind(ctx context.Context, args []string) error {
 
 	path = r.ResolvePath(path)
 
-	entries, err := r.Client.Find(ctx, path, namePattern, typeFilter)
+	entries, err := r.Reader.FindWith(ctx, path, opts)
 	if err != nil {
 		return err
 	}
@@ -51,6 +60,9 @@ func (r *Router) handleFind(ctx context.Context, args []string) error {
 				"path": e.Path,
 				"type": string(e.Meta.Type),
 			}
+			if len(e.Meta.Tags) > 0 {
+				entry["tags"] = e.Meta.Tags
+			}
 			result = append(result, entry)
 		}
 		return r.Formatter.PrintJSON(result)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/rowantrollope/redis-fs-cli/internal/fs"
@@ -17,12 +18,13 @@ func (r *Router) handleGrep(ctx context.Context, args []string) error {
 	ignoreCase := fset.BoolP("ignore-case", "i", false, "Case insensitive matching")
 	lineNumbers := fset.BoolP("line-number", "n", false, "Show line numbers")
 	noIndex := fset.Bool("no-index", false, "Force scan-based search (skip index)")
+	tags := fset.StringArray("tag", nil, "Only search files with this tag (repeatable)")
 	if err := fset.Parse(args); err != nil {
 		return err
 	}
 
 	if fset.NArg() < 2 {
-		return fmt.Errorf("grep: usage: grep [-r] [-i] [-n] [--no-index] pattern path")
+		return fmt.Errorf("grep: usage: grep [-r] [-i] [-n] [--no-index] [--tag tag]... pattern path")
 	}
 
 	pattern := fset.Arg(0)
@@ -37,17 +39,17 @@ func (r *Router) handleGrep(ctx context.Context, args []string) error {
 		return fmt.Errorf("grep: invalid pattern: %s", err)
 	}
 
-	meta, err := r.Client.Stat(ctx, path)
+	meta, err := r.Reader.Stat(ctx, path)
 	if err != nil {
 		return err
 	}
 	if meta == nil {
-		return fmt.Errorf("grep: %s: No such file or directory", path)
+		return &fs.PathError{Op: "grep", Path: path, Err: fs.ErrNotExist}
 	}
 
 	// Try index-accelerated path for recursive directory grep
 	if meta.Type == fs.TypeDir && *recursive && !*noIndex {
-		if r.tryIndexedGrep(ctx, re, fset.Arg(0), path, *lineNumbers, *ignoreCase) {
+		if r.tryIndexedGrep(ctx, re, fset.Arg(0), path, *tags, *lineNumbers, *ignoreCase) {
 			return nil
 		}
 	}
@@ -55,16 +57,22 @@ func (r *Router) handleGrep(ctx context.Context, args []string) error {
 	// Fall back to scan-based grep
 	if meta.Type == fs.TypeDir {
 		if !*recursive {
-			return fmt.Errorf("grep: %s: Is a directory", path)
+			return &fs.PathError{Op: "grep", Path: path, Err: fs.ErrIsDir}
 		}
-		return r.grepDir(ctx, re, path, *lineNumbers)
+		return r.grepDir(ctx, re, path, *tags, *lineNumbers)
 	}
 
+	for _, tag := range *tags {
+		if !slices.Contains(meta.Tags, tag) {
+			return nil
+		}
+	}
 	return r.grepFile(ctx, re, path, "", *lineNumbers)
 }
 
-// tryIndexedGrep attempts to use FT.SEARCH for grep. Returns true if successful.
-func (r *Router) tryIndexedGrep(ctx context.Context, re *regexp.Regexp, rawPattern, dirPath string, lineNumbers, ignoreCase bool) bool {
+// tryIndexedGrep attempts to use FT.SEARCH for grep, searching only files
+// with every tag in tags. Returns true if successful.
+func (r *Router) tryIndexedGrep(ctx context.Context, re *regexp.Regexp, rawPattern, dirPath string, tags []string, lineNumbers, ignoreCase bool) bool {
 	if !r.Config.SearchAvailable {
 		return false
 	}
@@ -74,13 +82,13 @@ func (r *Router) tryIndexedGrep(ctx context.Context, re *regexp.Regexp, rawPatte
 		return false
 	}
 
-	mgr := search.NewIndexManager(r.Client.Redis(), r.State.Volume)
+	mgr := r.indexManager()
 	exists, err := mgr.IndexExists(ctx)
 	if err != nil || !exists {
 		return false
 	}
 
-	results, err := search.SearchFullText(ctx, r.Client.Redis(), mgr.IndexName(), rawPattern, dirPath, 10000)
+	results, err := search.SearchFullText(ctx, r.Client.Redis(), mgr.IndexName(), rawPattern, dirPath, 10000, tags...)
 	if err != nil {
 		return false
 	}
@@ -104,7 +112,7 @@ func (r *Router) tryIndexedGrep(ctx context.Context, re *regexp.Regexp, rawPatte
 }
 
 func (r *Router) grepFile(ctx context.Context, re *regexp.Regexp, path, prefix string, lineNumbers bool) error {
-	content, err := r.Client.ReadFile(ctx, path)
+	content, err := r.Reader.ReadFile(ctx, path)
 	if err != nil {
 		return err
 	}
@@ -126,8 +134,8 @@ func (r *Router) grepFile(ctx context.Context, re *regexp.Regexp, path, prefix s
 	return nil
 }
 
-func (r *Router) grepDir(ctx context.Context, re *regexp.Regexp, dirPath string, lineNumbers bool) error {
-	entries, err := r.Client.Find(ctx, dirPath, "", "f")
+func (r *Router) grepDir(ctx context.Context, re *regexp.Regexp, dirPath string, tags []string, lineNumbers bool) error {
+	entries, err := r.Reader.FindWith(ctx, dirPath, fs.FindOptions{Type: "f", Tags: tags})
 	if err != nil {
 		return err
 	}
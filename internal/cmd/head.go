@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// headBlock is the read size used when scanning for line boundaries.
+const headBlock = 64 * 1024
+
+func (r *Router) handleHead(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("head", flag.ContinueOnError)
+	lines := fset.IntP("lines", "n", 10, "Print the first N lines")
+	bytes := fset.Int64P("bytes", "c", -1, "Print the first N bytes")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() == 0 {
+		return fmt.Errorf("head: missing file operand")
+	}
+
+	for i, arg := range fset.Args() {
+		if fset.NArg() > 1 {
+			if i > 0 {
+				r.Formatter.Println()
+			}
+			r.Formatter.Printf("==> %s <==\n", arg)
+		}
+		path := r.ResolvePath(arg)
+
+		if *bytes >= 0 {
+			data, err := r.Reader.ReadAt(ctx, path, 0, *bytes)
+			if err != nil {
+				return err
+			}
+			r.Formatter.Printf("%s", data)
+			continue
+		}
+
+		// Read forward block by block until enough lines are seen
+		var out strings.Builder
+		remaining := *lines
+		for offset := int64(0); remaining > 0; offset += headBlock {
+			block, err := r.Reader.ReadAt(ctx, path, offset, headBlock)
+			if err != nil {
+				return err
+			}
+			if block == "" {
+				break
+			}
+			for remaining > 0 && block != "" {
+				idx := strings.IndexByte(block, '\n')
+				if idx < 0 {
+					out.WriteString(block)
+					break
+				}
+				out.WriteString(block[:idx+1])
+				block = block[idx+1:]
+				remaining--
+			}
+		}
+		r.Formatter.Printf("%s", out.String())
+	}
+	return nil
+}
+
+func (r *Router) handleTail(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("tail", flag.ContinueOnError)
+	lines := fset.IntP("lines", "n", 10, "Print the last N lines")
+	bytes := fset.Int64P("bytes", "c", -1, "Print the last N bytes")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() == 0 {
+		return fmt.Errorf("tail: missing file operand")
+	}
+
+	for i, arg := range fset.Args() {
+		if fset.NArg() > 1 {
+			if i > 0 {
+				r.Formatter.Println()
+			}
+			r.Formatter.Printf("==> %s <==\n", arg)
+		}
+		path := r.ResolvePath(arg)
+
+		meta, err := r.Reader.StatFile(ctx, path)
+		if err != nil {
+			return err
+		}
+		size := meta.Size
+
+		if *bytes >= 0 {
+			start := max(size-*bytes, 0)
+			data, err := r.Reader.ReadAt(ctx, path, start, size-start)
+			if err != nil {
+				return err
+			}
+			r.Formatter.Printf("%s", data)
+			continue
+		}
+
+		// Read backward block by block until enough lines are seen. A final
+		// newline terminates the last line rather than starting a new one.
+		var tail string
+		for start := size; start > 0; {
+			from := max(start-headBlock, 0)
+			block, err := r.Reader.ReadAt(ctx, path, from, start-from)
+			if err != nil {
+				return err
+			}
+			tail = block + tail
+			start = from
+			if strings.Count(strings.TrimSuffix(tail, "\n"), "\n") >= *lines {
+				break
+			}
+		}
+		body := strings.TrimSuffix(tail, "\n")
+		parts := strings.Split(body, "\n")
+		if len(parts) > *lines {
+			parts = parts[len(parts)-*lines:]
+		}
+		if *lines > 0 && body != "" {
+			out := strings.Join(parts, "\n")
+			if strings.HasSuffix(tail, "\n") {
+				out += "\n"
+			}
+			r.Formatter.Printf("%s", out)
+		}
+	}
+	return nil
+}
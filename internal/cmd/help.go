@@ -3,32 +3,57 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"strings"
 )
 
 var commandHelp = map[string]string{
-	"ls":            "ls [path] [-l] [-a]       List directory contents",
+	"ls":            "ls [path] [-l] [-a] [-L]  List directory contents",
 	"pwd":           "pwd                       Print working directory",
 	"cd":            "cd [path]                 Change directory (cd - for previous)",
 	"mkdir":         "mkdir [-p] path           Create directory (-p for parents)",
 	"rmdir":         "rmdir path                Remove empty directory",
 	"touch":         "touch path                Create file or update timestamps",
 	"cat":           "cat path                  Display file contents",
+	"head":          "head [-n N] [-c N] path   Display the first lines or bytes of a file",
+	"tail":          "tail [-n N] [-c N] path   Display the last lines or bytes of a file",
 	"echo":          "echo \"text\" > path        Write to file (> or >> for append)",
+	"write":         "write [--offset N] path data  Write data at a byte offset",
 	"rm":            "rm [-r] [-f] path         Remove file or directory",
-	"cp":            "cp [-r] src dst           Copy file or directory",
-	"mv":            "mv src dst                Move/rename file or directory",
+	"cp":            "cp [-r] src dst           Copy file or directory (vol:/path, redis://host/vol:/path)",
+	"mv":            "mv src dst                Move/rename file or directory (vol:/path, redis://host/vol:/path)",
+	"fs put":        "fs put [-r] [-q] local [path]  Copy a local file or directory into the volume (alias upload)",
+	"fs get":        "fs get [-r] [-q] path [local]  Copy a file or directory to the local disk (alias download)",
+	"upload":        "upload [-r] [-q] local [path]  Alias of fs put",
+	"download":      "download [-r] [-q] path [local]  Alias of fs get",
+	"export":        "export [--format F] path file  Archive a tree to tar, tar.gz or zip (- for stdout)",
+	"import":        "import [--format F] file [path]  Extract a tar, tar.gz or zip archive (- for stdin)",
+	"fs sync":       "fs sync [-n] [-c] [--delete] [--exclude pat] [--pull] [-w] local path  Mirror a local directory into a volume",
 	"stat":          "stat path                 Display file metadata",
-	"find":          "find [path] [-name pat] [-type f|d|l]  Find files",
-	"grep":          "grep [-r] [-i] [-n] [--no-index] pattern path  Search file contents",
-	"ln":            "ln -s target link         Create symbolic link",
+	"find":          "find [path] [-L] [-name pat] [-type f|d|l] [-tag tag]...  Find files",
+	"grep":          "grep [-r] [-i] [-n] [--no-index] [--tag tag]... pattern path  Search file contents",
+	"ln":            "ln [-s] target link       Create a hard or symbolic link",
+	"readlink":      "readlink [-f] path        Print a symlink's target",
+	"realpath":      "realpath path...          Print the path with all symlinks resolved",
 	"chmod":         "chmod mode path           Change file mode",
 	"chown":         "chown uid:gid path        Change file owner",
+	"getfattr":      "getfattr [-d] [-n name] path  Show extended attributes",
+	"setfattr":      "setfattr -n name [-v value] path | -x name path  Set or remove an extended attribute",
+	"listxattr":     "listxattr path            List extended attribute names",
+	"tag":           "tag add|rm path tag... | tag ls [path]  Manage file tags",
+	"id":            "id                        Show the session user and group",
+	"su":            "su [uid[:gid]]            Switch the session user (root without args)",
+	"umask":         "umask [mode]              Show or set the mask for new entries",
 	"tree":          "tree [path] [-L depth]    Display directory tree",
-	"vol":           "vol list|switch|create|info  Volume management",
+	"du":            "du [-a|-s] [path...]      Show disk usage in bytes",
+	"versioning":    "versioning [-n N] [--max-age age] [--off|--clear] [dir]  Show or set file versioning",
+	"history":       "history [restore] path[@rev]  List the revisions of a file, or restore one",
+	"show":          "show path@rev             Display a revision of a file",
+	"diff":          "diff path@rev1 [rev2]     Compare a revision with another or the current file",
+	"vol":           "vol list|switch|create|clone|rename|delete|info|describe|snapshot  Volume management",
 	"init":          "init                      Initialize volume root",
 	"index":         "index status|create|drop|info  Manage search index",
 	"reindex":       "reindex [path] [--drop] [--status]  Build/rebuild search index",
-	"vector-search": "vector-search [--top N] [--filter text] \"query\" [path]  Hybrid vector search",
+	"vector-search": "vector-search [--top N] [--filter text] [--tag tag]... \"query\" [path]  Hybrid vector search",
 	"help":          "help [command]            Show this help",
 	"clear":         "clear                     Clear the terminal",
 	"exit":          "exit / quit               Exit the REPL",
@@ -36,7 +61,7 @@ var commandHelp = map[string]string{
 
 func (r *Router) handleHelp(ctx context.Context, args []string) error {
 	if len(args) > 0 {
-		cmd := args[0]
+		cmd := strings.Join(args, " ")
 		if help, ok := commandHelp[cmd]; ok {
 			fmt.Fprintln(r.Formatter.Writer, help)
 		} else {
@@ -48,8 +73,18 @@ func (r *Router) handleHelp(ctx context.Context, args []string) error {
 	fmt.Fprintln(r.Formatter.Writer, "redis-fs-cli — POSIX-like filesystem on Redis")
 	fmt.Fprintln(r.Formatter.Writer, "")
 	fmt.Fprintln(r.Formatter.Writer, "Filesystem commands:")
-	for _, cmd := range []string{"ls", "pwd", "cd", "mkdir", "rmdir", "touch", "cat", "echo",
-		"rm", "cp", "mv", "stat", "find", "grep", "ln", "chmod", "chown", "tree"} {
+	for _, cmd := range []string{"ls", "pwd", "cd", "mkdir", "rmdir", "touch", "cat", "head", "tail", "echo",
+		"write", "rm", "cp", "mv", "fs put", "fs get", "export", "import", "fs sync", "stat", "find", "grep", "ln", "readlink", "realpath", "chmod", "chown", "getfattr", "setfattr", "listxattr", "tag", "tree", "du"} {
+		fmt.Fprintf(r.Formatter.Writer, "  %s\n", commandHelp[cmd])
+	}
+	fmt.Fprintln(r.Formatter.Writer, "")
+	fmt.Fprintln(r.Formatter.Writer, "Version commands:")
+	for _, cmd := range []string{"versioning", "history", "show", "diff"} {
+		fmt.Fprintf(r.Formatter.Writer, "  %s\n", commandHelp[cmd])
+	}
+	fmt.Fprintln(r.Formatter.Writer, "")
+	fmt.Fprintln(r.Formatter.Writer, "Session commands:")
+	for _, cmd := range []string{"id", "su", "umask"} {
 		fmt.Fprintf(r.Formatter.Writer, "  %s\n", commandHelp[cmd])
 	}
 	fmt.Fprintln(r.Formatter.Writer, "")
@@ -67,6 +102,7 @@ func (r *Router) handleHelp(ctx context.Context, args []string) error {
 	fmt.Fprintf(r.Formatter.Writer, "  %s\n", commandHelp["clear"])
 	fmt.Fprintf(r.Formatter.Writer, "  %s\n", commandHelp["exit"])
 	fmt.Fprintln(r.Formatter.Writer, "")
-	fmt.Fprintln(r.Formatter.Writer, "Any unrecognized command is passed through to redis-cli.")
+	fmt.Fprintln(r.Formatter.Writer, "Any unrecognized command is passed through to redis-cli. Commands named")
+	fmt.Fprintln(r.Formatter.Writer, "like a Redis command take an fs prefix.")
 	return nil
 }
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rowantrollope/redis-fs-cli/internal/fs"
+	flag "github.com/spf13/pflag"
+)
+
+// defaultKeep is the number of revisions versioning keeps when enabled
+// without -n.
+const defaultKeep = 10
+
+func (r *Router) handleVersioning(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("versioning", flag.ContinueOnError)
+	keep := fset.IntP("keep", "n", defaultKeep, "Revisions to keep per file")
+	maxAge := fset.String("max-age", "", "Drop revisions older than this (e.g. 12h, 30d)")
+	off := fset.Bool("off", false, "Turn versioning off below the directory")
+	inherit := fset.Bool("clear", false, "Remove the directory's own policy")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() > 1 {
+		return fmt.Errorf("versioning: usage: versioning [-n N] [--max-age age] [--off|--clear] [dir]")
+	}
+
+	if fset.NArg() == 0 && fset.NFlag() == 0 {
+		return r.versioningList(ctx)
+	}
+	dir := r.ResolvePath(fset.Arg(0))
+
+	switch {
+	case *inherit:
+		return r.Client.ClearVersioning(ctx, dir)
+	case *off:
+		return r.Client.SetVersioning(ctx, dir, fs.VersionPolicy{})
+	case fset.Changed("keep") || fset.Changed("max-age"):
+		if *keep < 1 {
+			return fmt.Errorf("versioning: -n must be at least 1")
+		}
+		p := fs.VersionPolicy{Keep: *keep}
+		if *maxAge != "" {
+			age, err := parseAge(*maxAge)
+			if err != nil {
+				return fmt.Errorf("versioning: %w", err)
+			}
+			p.MaxAge = age
+		}
+		return r.Client.SetVersioning(ctx, dir, p)
+	}
+
+	p, from, err := r.Reader.VersioningFor(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if r.Formatter.JSON {
+		return r.Formatter.PrintJSON(policyJSON(from, p))
+	}
+	if p.Keep == 0 {
+		fmt.Fprintln(r.Formatter.Writer, "off")
+		return nil
+	}
+	fmt.Fprintf(r.Formatter.Writer, "%s (set on %s)\n", describePolicy(p), from)
+	return nil
+}
+
+func (r *Router) versioningList(ctx context.Context) error {
+	policies, err := r.Reader.VersioningPolicies(ctx)
+	if err != nil {
+		return err
+	}
+	dirs := make([]string, 0, len(policies))
+	for dir := range policies {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	if r.Formatter.JSON {
+		result := []map[string]interface{}{}
+		for _, dir := range dirs {
+			result = append(result, policyJSON(dir, policies[dir]))
+		}
+		return r.Formatter.PrintJSON(result)
+	}
+	for _, dir := range dirs {
+		p := policies[dir]
+		if p.Keep == 0 {
+			fmt.Fprintf(r.Formatter.Writer, "%s\toff\n", dir)
+			continue
+		}
+		fmt.Fprintf(r.Formatter.Writer, "%s\t%s\n", dir, describePolicy(p))
+	}
+	return nil
+}
+
+func policyJSON(dir string, p fs.VersionPolicy) map[string]interface{} {
+	return map[string]interface{}{
+		"dir":     dir,
+		"keep":    p.Keep,
+		"max_age": int64(p.MaxAge / time.Second),
+	}
+}
+
+func describePolicy(p fs.VersionPolicy) string {
+	s := fmt.Sprintf("keep %d", p.Keep)
+	if p.MaxAge > 0 {
+		s += ", max age " + formatAge(p.MaxAge)
+	}
+	return s
+}
+
+// parseAge parses a duration as time.ParseDuration does, also accepting
+// whole days (30d) and weeks (2w).
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.Atoi(n)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid age '%s'", s)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age '%s'", s)
+	}
+	return d, nil
+}
+
+func formatAge(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+// handleHistory lists the revisions of a file, or with the restore
+// subcommand makes one of them current again. It is a subcommand so that
+// RESTORE still reaches Redis.
+func (r *Router) handleHistory(ctx context.Context, args []string) error {
+	if len(args) > 0 && args[0] == "restore" {
+		return r.historyRestore(ctx, args[1:])
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("history: usage: history path | history restore path@rev")
+	}
+	versions, err := r.Reader.History(ctx, r.ResolvePath(args[0]))
+	if err != nil {
+		return err
+	}
+
+	if r.Formatter.JSON {
+		result := []map[string]interface{}{}
+		for _, v := range versions {
+			result = append(result, map[string]interface{}{
+				"rev":    v.Rev,
+				"time":   v.Time,
+				"size":   v.Size,
+				"author": v.Author,
+				"op":     v.Op,
+			})
+		}
+		return r.Formatter.PrintJSON(result)
+	}
+	for _, v := range versions {
+		fmt.Fprintf(r.Formatter.Writer, "%4d  %s  %6s  %-6s %s\n",
+			v.Rev, fs.FormatTime(v.Time), fs.FormatSize(v.Size), v.Author, v.Op)
+	}
+	return nil
+}
+
+func (r *Router) handleShow(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("show: usage: show path@rev")
+	}
+	path, rev, err := parseRevision("show", args[0])
+	if err != nil {
+		return err
+	}
+	content, err := r.Reader.ReadVersion(ctx, r.ResolvePath(path), rev)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(r.Formatter.Writer, content)
+	return nil
+}
+
+func (r *Router) historyRestore(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("history restore: usage: history restore path@rev")
+	}
+	path, rev, err := parseRevision("history restore", args[0])
+	if err != nil {
+		return err
+	}
+	return r.Client.RestoreVersion(ctx, r.ResolvePath(path), rev)
+}
+
+// handleDiff compares revision rev1 of a file with revision rev2, or with
+// the file's current content when rev2 is omitted.
+func (r *Router) handleDiff(ctx context.Context, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("diff: usage: diff path@rev1 [rev2]")
+	}
+	path, rev1, err := parseRevision("diff", args[0])
+	if err != nil {
+		return err
+	}
+	path = r.ResolvePath(path)
+
+	old, err := r.Reader.ReadVersion(ctx, path, rev1)
+	if err != nil {
+		return err
+	}
+	newName := path
+	var cur string
+	if len(args) == 2 {
+		rev2, err := strconv.ParseInt(strings.TrimPrefix(args[1], "@"), 10, 64)
+		if err != nil || rev2 < 1 {
+			return fmt.Errorf("diff: invalid revision '%s'", args[1])
+		}
+		if cur, err = r.Reader.ReadVersion(ctx, path, rev2); err != nil {
+			return err
+		}
+		newName = fmt.Sprintf("%s@%d", path, rev2)
+	} else if cur, err = r.Reader.ReadFile(ctx, path); err != nil {
+		return err
+	}
+
+	fmt.Fprint(r.Formatter.Writer, unifiedDiff(fmt.Sprintf("%s@%d", path, rev1), newName, old, cur))
+	return nil
+}
+
+// parseRevision splits a path@rev argument.
+func parseRevision(op, arg string) (string, int64, error) {
+	i := strings.LastIndex(arg, "@")
+	if i < 0 {
+		return "", 0, fmt.Errorf("%s: missing revision in '%s' (use path@rev)", op, arg)
+	}
+	rev, err := strconv.ParseInt(arg[i+1:], 10, 64)
+	if err != nil || rev < 1 {
+		return "", 0, fmt.Errorf("%s: invalid revision '%s'", op, arg[i+1:])
+	}
+	return arg[:i], rev, nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rowantrollope/redis-fs-cli/internal/fs"
+)
+
+func (r *Router) handleID(ctx context.Context, args []string) error {
+	id := r.Client.Identity()
+	if r.Formatter.JSON {
+		return r.Formatter.PrintJSON(map[string]int{
+			"uid": id.UID,
+			"gid": id.GID,
+		})
+	}
+	r.Formatter.Println(id.String())
+	return nil
+}
+
+// handleSu switches the session identity. Without an argument it returns
+// to root; a bare uid also uses it as the gid.
+func (r *Router) handleSu(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("su: usage: su [uid[:gid]]")
+	}
+	id := fs.Superuser
+	if len(args) == 1 {
+		var err error
+		if id, err = parseIdentity(args[0]); err != nil {
+			return err
+		}
+	}
+	r.setIdentity(id)
+	return nil
+}
+
+func parseIdentity(s string) (fs.Identity, error) {
+	uidStr, gidStr, hasGID := strings.Cut(s, ":")
+	if !hasGID {
+		gidStr = uidStr
+	}
+	uid, err := strconv.Atoi(uidStr)
+	if err != nil || uid < 0 {
+		return fs.Identity{}, fmt.Errorf("su: invalid user id '%s'", uidStr)
+	}
+	gid, err := strconv.Atoi(gidStr)
+	if err != nil || gid < 0 {
+		return fs.Identity{}, fmt.Errorf("su: invalid group id '%s'", gidStr)
+	}
+	return fs.Identity{UID: uid, GID: gid}, nil
+}
+
+func (r *Router) handleUmask(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		r.Formatter.Printf("%04o\n", uint32(r.Client.Umask()))
+		return nil
+	}
+	mask, err := fs.ParseUmask(args[0])
+	if err != nil {
+		return err
+	}
+	r.Client.SetUmask(mask)
+	return nil
+}
@@ -16,7 +16,7 @@ func (r *Router) handleIndex(ctx context.Context, args []string) error {
 		return fmt.Errorf("index: usage: index <status|create|drop|info>")
 	}
 
-	mgr := search.NewIndexManager(r.Client.Redis(), r.State.Volume)
+	mgr := r.indexManager()
 
 	switch args[0] {
 	case "status":
@@ -32,6 +32,25 @@ func (r *Router) handleIndex(ctx context.Context, args []string) error {
 	}
 }
 
+// indexManager returns an IndexManager for the current volume.
+func (r *Router) indexManager() *search.IndexManager {
+	return r.indexManagerFor(r.State.Volume)
+}
+
+// indexManagerFor returns an IndexManager for volume.
+func (r *Router) indexManagerFor(volume string) *search.IndexManager {
+	mgr := search.NewIndexManager(r.Client.Redis(), volume)
+	mgr.SetHashTags(r.Client.HashTags())
+	return mgr
+}
+
+// newIndexer returns an Indexer for the current volume.
+func (r *Router) newIndexer() *search.Indexer {
+	indexer := search.NewIndexer(r.Client.Redis(), r.State.Volume)
+	indexer.SetHashTags(r.Client.HashTags())
+	return indexer
+}
+
 func (r *Router) indexStatus(ctx context.Context, mgr *search.IndexManager) error {
 	exists, err := mgr.IndexExists(ctx)
 	if err != nil {
@@ -14,10 +14,6 @@ func (r *Router) handleLn(ctx context.Context, args []string) error {
 		return err
 	}
 
-	if !*symbolic {
-		return fmt.Errorf("ln: hard links not supported; use ln -s")
-	}
-
 	if fs.NArg() < 2 {
 		return fmt.Errorf("ln: missing operand")
 	}
@@ -25,5 +21,8 @@ func (r *Router) handleLn(ctx context.Context, args []string) error {
 	target := fs.Arg(0)
 	linkPath := r.ResolvePath(fs.Arg(1))
 
+	if !*symbolic {
+		return r.Client.Link(ctx, r.ResolvePath(target), linkPath)
+	}
 	return r.Client.Symlink(ctx, target, linkPath)
 }
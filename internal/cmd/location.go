@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rowantrollope/redis-fs-cli/internal/events"
+	"github.com/rowantrollope/redis-fs-cli/internal/fs"
+	"github.com/rowantrollope/redis-fs-cli/internal/search"
+)
+
+// location is a cp or mv operand: a path on the session's volume, a path
+// on another volume (vol:/path) or a path on a volume of another server
+// (redis://host[:port][/db]/vol:/path).
+type location struct {
+	server string // URL of the other server, without the volume
+	volume string // empty for the session's volume
+	path   string
+}
+
+// parseLocation splits a cp or mv operand into a location. A volume prefix
+// is only recognized before an absolute path, so relative paths that
+// contain a colon keep working.
+func parseLocation(arg string) (location, error) {
+	for _, scheme := range []string{"redis://", "rediss://"} {
+		if strings.HasPrefix(arg, scheme) {
+			return parseServerLocation(arg, scheme)
+		}
+	}
+	if i := strings.Index(arg, ":/"); i > 0 && !strings.Contains(arg[:i], "/") {
+		return location{volume: arg[:i], path: arg[i+1:]}, nil
+	}
+	return location{path: arg}, nil
+}
+
+// parseServerLocation parses redis://[user:password@]host[:port][/db]/vol:/path.
+func parseServerLocation(arg, scheme string) (location, error) {
+	rest := strings.TrimPrefix(arg, scheme)
+	slash := strings.Index(rest, "/")
+	colon := strings.Index(rest, ":/")
+	if slash < 0 || colon < slash {
+		return location{}, fmt.Errorf("%s: expected %shost[:port][/db]/volume:/path", arg, scheme)
+	}
+	server := scheme + rest[:slash]
+	segments := strings.Split(rest[slash+1:colon], "/")
+	switch len(segments) {
+	case 1:
+	case 2:
+		if _, err := strconv.Atoi(segments[0]); err != nil {
+			return location{}, fmt.Errorf("%s: invalid database number '%s'", arg, segments[0])
+		}
+		server += "/" + segments[0]
+	default:
+		return location{}, fmt.Errorf("%s: expected %shost[:port][/db]/volume:/path", arg, scheme)
+	}
+	volume := segments[len(segments)-1]
+	if volume == "" {
+		return location{}, fmt.Errorf("%s: missing volume name", arg)
+	}
+	return location{server: server, volume: volume, path: rest[colon+1:]}, nil
+}
+
+// local reports whether the location is on the session's volume.
+func (l location) local(session string) bool {
+	return l.server == "" && (l.volume == "" || l.volume == session)
+}
+
+// open returns a client on the volume of loc and the absolute path loc
+// names there. Relative paths are resolved against the working directory
+// on the session's volume and against the root elsewhere. The volume must
+// exist. close releases the connection to another server.
+func (r *Router) open(ctx context.Context, op string, loc location) (c *fs.Client, path string, close func(), err error) {
+	close = func() {}
+	if loc.local(r.State.Volume) {
+		return r.Client, r.ResolvePath(loc.path), close, nil
+	}
+	path = fs.ResolvePath("/", loc.path)
+
+	rdb := r.Client.Redis()
+	indexed := r.Config.SearchAvailable
+	if loc.server != "" {
+		// Without the credentials the URL may hold
+		addr := loc.server
+		if u, err := url.Parse(loc.server); err == nil {
+			addr = u.Host
+		}
+		remote, err := r.Config.ServerClient(loc.server)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("%s: %s: %w", op, addr, err)
+		}
+		if err := remote.Ping(ctx).Err(); err != nil {
+			remote.Close()
+			return nil, "", nil, fmt.Errorf("%s: cannot connect to %s: %w", op, addr, err)
+		}
+		rdb = remote
+		indexed = search.DetectSearch(ctx, remote)
+		close = func() { remote.Close() }
+		c = fs.NewClient(remote, loc.volume)
+	} else {
+		c = fs.NewClientWithBackend(r.Client.Backend(), loc.volume)
+	}
+	c.SetHashTags(r.Client.HashTags())
+	c.SetIdentity(r.Client.Identity())
+	c.SetUmask(r.Client.Umask())
+	c.SetChunkSize(r.Client.ChunkSize())
+	r.observe(c, rdb, loc.volume, indexed)
+
+	exists, err := c.VolumeExists(ctx)
+	if err == nil && !exists {
+		err = fmt.Errorf("%s: volume '%s' does not exist", op, loc.volume)
+	}
+	if err == nil {
+		// Migrates volumes still on the legacy layout
+		err = c.Init(ctx)
+	}
+	if err != nil {
+		close()
+		return nil, "", nil, err
+	}
+	return c, path, close, nil
+}
+
+// observe attaches to c, a client of another volume or server, the search
+// indexer and event stream the main client has, unless c is a snapshot.
+func (r *Router) observe(c *fs.Client, rdb redis.UniversalClient, volume string, indexed bool) {
+	if c.IsSnapshot() {
+		return
+	}
+	if indexed {
+		indexer := search.NewIndexer(rdb, volume)
+		indexer.SetHashTags(c.HashTags())
+		c.AddObserver(indexer)
+	}
+	if r.Config.Events && rdb != nil {
+		stream := events.NewStream(rdb, volume)
+		stream.SetHashTags(c.HashTags())
+		stream.SetMaxLen(r.Config.EventsMaxLen)
+		c.AddObserver(stream)
+	}
+}
@@ -3,34 +3,44 @@ package cmd
 import (
 	"context"
 
+	"github.com/rowantrollope/redis-fs-cli/internal/fs"
 	flag "github.com/spf13/pflag"
 )
 
 func (r *Router) handleLs(ctx context.Context, args []string) error {
-	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
-	long := fs.BoolP("long", "l", false, "Long listing format")
-	all := fs.BoolP("all", "a", false, "Show hidden entries")
-	if err := fs.Parse(args); err != nil {
+	fset := flag.NewFlagSet("ls", flag.ContinueOnError)
+	long := fset.BoolP("long", "l", false, "Long listing format")
+	all := fset.BoolP("all", "a", false, "Show hidden entries")
+	deref := fset.BoolP("dereference", "L", false, "Show the entries symlinks point to")
+	if err := fset.Parse(args); err != nil {
 		return err
 	}
 
 	path := "."
-	if fs.NArg() > 0 {
-		path = fs.Arg(0)
+	if fset.NArg() > 0 {
+		path = fset.Arg(0)
 	}
 	path = r.ResolvePath(path)
 
-	if *long {
-		entries, err := r.Client.ReadDirWithMeta(ctx, path)
-		if err != nil {
-			return err
+	entries, err := r.Reader.ReadDirWithMeta(ctx, path)
+	if err != nil {
+		return err
+	}
+	if *deref {
+		// Broken links are listed as links
+		for i, e := range entries {
+			if e.Meta == nil || e.Meta.Type != fs.TypeSymlink {
+				continue
+			}
+			if meta, err := r.Reader.StatFollow(ctx, fs.JoinPath(path, e.Name)); err == nil && meta != nil {
+				entries[i].Meta = meta
+			}
 		}
+	}
+
+	if *long {
 		r.Formatter.PrintLsLong(entries, *all)
 	} else {
-		entries, err := r.Client.ReadDirWithMeta(ctx, path)
-		if err != nil {
-			return err
-		}
 		r.Formatter.PrintLs(entries, *all)
 	}
 	return nil
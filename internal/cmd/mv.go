@@ -10,8 +10,24 @@ func (r *Router) handleMv(ctx context.Context, args []string) error {
 		return fmt.Errorf("mv: missing operand")
 	}
 
-	src := r.ResolvePath(args[0])
-	dst := r.ResolvePath(args[1])
+	srcLoc, err := parseLocation(args[0])
+	if err != nil {
+		return fmt.Errorf("mv: %w", err)
+	}
+	dstLoc, err := parseLocation(args[1])
+	if err != nil {
+		return fmt.Errorf("mv: %w", err)
+	}
+	from, src, closeFrom, err := r.open(ctx, "mv", srcLoc)
+	if err != nil {
+		return err
+	}
+	defer closeFrom()
+	to, dst, closeTo, err := r.open(ctx, "mv", dstLoc)
+	if err != nil {
+		return err
+	}
+	defer closeTo()
 
-	return r.Client.Move(ctx, src, dst)
+	return from.MoveTo(ctx, src, to, dst)
 }
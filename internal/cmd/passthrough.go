@@ -15,7 +15,10 @@ func (r *Router) handlePassthrough(ctx context.Context, tokens []string) error {
 		return fmt.Errorf("redis-cli not found on PATH (exit code 127)")
 	}
 
-	args := r.Config.RedisCLIArgs()
+	args, err := r.Config.RedisCLIArgs(ctx)
+	if err != nil {
+		return err
+	}
 	args = append(args, tokens...)
 
 	cmd := exec.CommandContext(ctx, redisCLI, args...)
@@ -40,7 +43,10 @@ func (r *Router) handlePassthroughRaw(ctx context.Context, tokens []string) (str
 		return "", fmt.Errorf("redis-cli not found on PATH")
 	}
 
-	args := r.Config.RedisCLIArgs()
+	args, err := r.Config.RedisCLIArgs(ctx)
+	if err != nil {
+		return "", err
+	}
 	args = append(args, tokens...)
 
 	cmd := exec.CommandContext(ctx, redisCLI, args...)
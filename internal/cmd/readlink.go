@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	flag "github.com/spf13/pflag"
+)
+
+func (r *Router) handleReadlink(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("readlink", flag.ContinueOnError)
+	canonicalize := fset.BoolP("canonicalize", "f", false, "Resolve every link in the path, like realpath")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 1 {
+		return fmt.Errorf("readlink: usage: readlink [-f] path")
+	}
+
+	path := r.ResolvePath(fset.Arg(0))
+	var target string
+	var err error
+	if *canonicalize {
+		target, err = r.Reader.Realpath(ctx, path)
+	} else {
+		target, err = r.Reader.Readlink(ctx, path)
+	}
+	if err != nil {
+		return err
+	}
+	r.Formatter.Println(target)
+	return nil
+}
+
+func (r *Router) handleRealpath(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("realpath: usage: realpath path...")
+	}
+	for _, arg := range args {
+		resolved, err := r.Reader.Realpath(ctx, r.ResolvePath(arg))
+		if err != nil {
+			return err
+		}
+		r.Formatter.Println(resolved)
+	}
+	return nil
+}
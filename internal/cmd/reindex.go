@@ -21,14 +21,10 @@ func (r *Router) handleReindex(ctx context.Context, args []string) error {
 		return err
 	}
 
-	indexer := search.NewIndexer(r.Client.Redis(), r.State.Volume)
+	indexer := r.newIndexer()
 
 	// Configure embedding client if API key is set
-	withVector := r.Config.EmbeddingAPIKey != ""
-	dim := r.Config.EmbeddingDim
-	if dim == 0 {
-		dim = 1536
-	}
+	withVector, dim := r.indexSchema()
 
 	if withVector {
 		embCfg := &embedding.Config{
@@ -74,6 +70,16 @@ func (r *Router) handleReindex(ctx context.Context, args []string) error {
 	return nil
 }
 
+// indexSchema reports whether indexes are created with a vector field, and
+// of which dimension: they are when an embedding API key is configured.
+func (r *Router) indexSchema() (withVector bool, dim int) {
+	dim = r.Config.EmbeddingDim
+	if dim == 0 {
+		dim = 1536
+	}
+	return r.Config.EmbeddingAPIKey != "", dim
+}
+
 func (r *Router) reindexStatus(ctx context.Context, indexer *search.Indexer) error {
 	mgr := indexer.Manager()
 	exists, err := mgr.IndexExists(ctx)
@@ -114,6 +120,10 @@ func (r *Router) makeFileWalker() search.FileWalker {
 
 		var files []search.FileEntry
 		for _, entry := range entries {
+			// Chunked files are too large to index
+			if entry.Meta.Chunks > 0 {
+				continue
+			}
 			content, err := r.Client.ReadFile(ctx, entry.Path)
 			if err != nil {
 				continue
@@ -123,6 +133,7 @@ func (r *Router) makeFileWalker() search.FileWalker {
 				Content: content,
 				MTime:   entry.Meta.MTime,
 				Size:    entry.Meta.Size,
+				Tags:    entry.Meta.Tags,
 			})
 		}
 		return files, nil
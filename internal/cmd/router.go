@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/rowantrollope/redis-fs-cli/internal/config"
@@ -20,10 +22,17 @@ type State struct {
 // Router dispatches commands to the appropriate handler.
 type Router struct {
 	Client    *fs.Client
+	Reader    *fs.Client // read-only commands; a replica client or Client itself
 	Config    *config.Config
 	Formatter *output.Formatter
 	State     *State
-	handlers  map[string]Handler
+	// Prompt shows a prompt and reads a line of input, for commands that
+	// ask for confirmation. Standard input is read when nil.
+	Prompt   func(prompt string) (string, error)
+	handlers map[string]Handler
+	// fsHandlers are the commands run under fs, whose names are Redis
+	// commands and pass through at the top level
+	fsHandlers map[string]Handler
 }
 
 // Handler is a function that handles a command.
@@ -33,13 +42,15 @@ type Handler func(ctx context.Context, args []string) error
 func NewRouter(client *fs.Client, cfg *config.Config, formatter *output.Formatter) *Router {
 	r := &Router{
 		Client:    client,
+		Reader:    client,
 		Config:    cfg,
 		Formatter: formatter,
 		State: &State{
 			Cwd:    "/",
 			Volume: cfg.Volume,
 		},
-		handlers: make(map[string]Handler),
+		handlers:   make(map[string]Handler),
+		fsHandlers: make(map[string]Handler),
 	}
 	r.registerHandlers()
 	return r
@@ -53,17 +64,38 @@ func (r *Router) registerHandlers() {
 	r.handlers["rmdir"] = r.handleRmdir
 	r.handlers["touch"] = r.handleTouch
 	r.handlers["cat"] = r.handleCat
+	r.handlers["head"] = r.handleHead
+	r.handlers["tail"] = r.handleTail
+	r.handlers["write"] = r.handleWrite
 	r.handlers["echo"] = r.handleEcho
 	r.handlers["rm"] = r.handleRm
 	r.handlers["cp"] = r.handleCp
 	r.handlers["mv"] = r.handleMv
+	r.handlers["upload"] = r.handlePut
+	r.handlers["download"] = r.handleGet
+	r.handlers["export"] = r.handleExport
+	r.handlers["import"] = r.handleImport
 	r.handlers["stat"] = r.handleStat
 	r.handlers["find"] = r.handleFind
 	r.handlers["grep"] = r.handleGrep
 	r.handlers["ln"] = r.handleLn
+	r.handlers["readlink"] = r.handleReadlink
+	r.handlers["realpath"] = r.handleRealpath
 	r.handlers["chmod"] = r.handleChmod
 	r.handlers["chown"] = r.handleChown
+	r.handlers["getfattr"] = r.handleGetfattr
+	r.handlers["setfattr"] = r.handleSetfattr
+	r.handlers["listxattr"] = r.handleListxattr
+	r.handlers["tag"] = r.handleTag
+	r.handlers["id"] = r.handleID
+	r.handlers["su"] = r.handleSu
+	r.handlers["umask"] = r.handleUmask
 	r.handlers["tree"] = r.handleTree
+	r.handlers["du"] = r.handleDu
+	r.handlers["versioning"] = r.handleVersioning
+	r.handlers["history"] = r.handleHistory
+	r.handlers["show"] = r.handleShow
+	r.handlers["diff"] = r.handleDiff
 	r.handlers["vol"] = r.handleVol
 	r.handlers["init"] = r.handleInit
 	r.handlers["help"] = r.handleHelp
@@ -71,6 +103,11 @@ func (r *Router) registerHandlers() {
 	r.handlers["index"] = r.handleIndex
 	r.handlers["reindex"] = r.handleReindex
 	r.handlers["vector-search"] = r.handleVectorSearch
+	r.handlers["fs"] = r.handleFS
+
+	r.fsHandlers["put"] = r.handlePut
+	r.fsHandlers["get"] = r.handleGet
+	r.fsHandlers["sync"] = r.handleSync
 }
 
 // Execute runs a parsed command line.
@@ -105,6 +142,62 @@ func (r *Router) Execute(ctx context.Context, line string) error {
 	return r.handlePassthrough(ctx, tokens)
 }
 
+// handleFS runs the commands whose names are also Redis commands, such as
+// fs get and fs sync; without the fs prefix those pass through to Redis.
+// fs put runs here too, to pair with fs get.
+func (r *Router) handleFS(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("fs: usage: fs put|get|sync ...")
+	}
+	handler, ok := r.fsHandlers[strings.ToLower(args[0])]
+	if !ok {
+		return fmt.Errorf("fs: unknown command: %s", args[0])
+	}
+	return handler(ctx, args[1:])
+}
+
+// SetReader routes read-only commands (ls, cat, find, tree, stat, grep)
+// through a separate client, typically connected to replicas.
+func (r *Router) SetReader(reader *fs.Client) {
+	r.Reader = reader
+}
+
+// setVolume switches the active volume on both clients.
+func (r *Router) setVolume(volume string) {
+	r.Client.SetVolume(volume)
+	r.Reader.SetVolume(volume)
+}
+
+// confirm asks a yes/no question, defaulting to no.
+func (r *Router) confirm(question string) bool {
+	prompt := r.Prompt
+	if prompt == nil {
+		prompt = stdinPrompt
+	}
+	answer, err := prompt(question + " [y/N] ")
+	if err != nil && answer == "" {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// stdinPrompt prints prompt to standard error and reads a line from
+// standard input.
+func stdinPrompt(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	return bufio.NewReader(os.Stdin).ReadString('\n')
+}
+
+// setIdentity switches the session user on both clients.
+func (r *Router) setIdentity(id fs.Identity) {
+	r.Client.SetIdentity(id)
+	r.Reader.SetIdentity(id)
+}
+
 // IsBuiltin returns true if the command is a built-in FS command.
 func (r *Router) IsBuiltin(cmd string) bool {
 	_, ok := r.handlers[strings.ToLower(cmd)]
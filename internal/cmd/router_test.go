@@ -0,0 +1,773 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rowantrollope/redis-fs-cli/internal/config"
+	"github.com/rowantrollope/redis-fs-cli/internal/fs"
+	"github.com/rowantrollope/redis-fs-cli/internal/output"
+)
+
+// newTestRouter returns a router on an in-memory volume, writing output to out.
+func newTestRouter(t *testing.T, out *bytes.Buffer) *Router {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Volume = "test"
+	client := fs.NewClientWithBackend(fs.NewMemoryBackend(), cfg.Volume)
+	if err := client.Init(context.Background()); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	formatter := output.NewFormatter(false, false)
+	formatter.Writer = out
+	return NewRouter(client, cfg, formatter)
+}
+
+func TestRouterCommands(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	r := newTestRouter(t, &out)
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"mkdir -p /docs/notes", ""},
+		{"cd /docs", ""},
+		{"echo hello > notes/a.txt", ""},
+		{"echo world >> notes/a.txt", ""},
+		{"cat notes/a.txt", "helloworld\n"},
+		{"cp notes/a.txt b.txt", ""},
+		{"mv b.txt c.txt", ""},
+		{"ls", "c.txt\nnotes\n"},
+		{"find / -name a.*", "/docs/notes/a.txt\n"},
+		{"grep -r world /docs/notes", "/docs/notes/a.txt:helloworld\n"},
+		{"head -c 5 c.txt", "hello"},
+		{"ln -s docs/notes /n", ""},
+		{"readlink /n", "docs/notes\n"},
+		{"cd /n", ""},
+		{"realpath a.txt", "/docs/notes/a.txt\n"},
+		{"cd /docs", ""},
+		{"rm -r notes", ""},
+		{"pwd", "/docs\n"},
+	}
+
+	for _, tt := range tests {
+		out.Reset()
+		if err := r.Execute(ctx, tt.line); err != nil {
+			t.Fatalf("%s: %v", tt.line, err)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s: output %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestRouterPassthrough(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	r := newTestRouter(t, &out)
+	// With no redis-cli to run, a command that passes through says so
+	t.Setenv("PATH", "")
+
+	for _, cmd := range []string{"sync", "SYNC", "psync", "get", "set", "keys", "del", "info", "ping", "monitor", "type", "scan"} {
+		if r.IsBuiltin(cmd) {
+			t.Errorf("%s is a built-in command, want it passed through", cmd)
+		}
+		if err := r.Execute(ctx, cmd+" a b"); err == nil || !strings.Contains(err.Error(), "redis-cli not found") {
+			t.Errorf("%s: err = %v, want it passed through to redis-cli", cmd, err)
+		}
+	}
+	if err := r.Execute(ctx, "fs sync"); err == nil || !strings.Contains(err.Error(), "usage: fs sync") {
+		t.Errorf("fs sync without arguments = %v, want its usage", err)
+	}
+	if err := r.Execute(ctx, "fs frobnicate"); err == nil || strings.Contains(err.Error(), "redis-cli") {
+		t.Errorf("fs with an unknown command = %v, want an error of fs", err)
+	}
+}
+
+func TestGrepTags(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	r := newTestRouter(t, &out)
+	r.Client.Mkdir(ctx, "/docs", false)
+	r.Client.WriteFile(ctx, "/docs/a.md", "revenue up")
+	r.Client.WriteFile(ctx, "/docs/b.md", "revenue down")
+	r.Client.AddTags(ctx, "/docs/a.md", "q3", "final")
+	r.Client.AddTags(ctx, "/docs/b.md", "q3")
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"grep -r --tag q3 revenue /docs", "/docs/a.md:revenue up\n/docs/b.md:revenue down\n"},
+		{"grep -r --tag q3 --tag final revenue /docs", "/docs/a.md:revenue up\n"},
+		{"grep --tag final revenue /docs/b.md", ""},
+		{"grep --tag final revenue /docs/a.md", "revenue up\n"},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		if err := r.Execute(ctx, tt.line); err != nil {
+			t.Fatalf("%s: %v", tt.line, err)
+		}
+		// Files are searched in directory order, which is not sorted
+		lines := strings.SplitAfter(out.String(), "\n")
+		sort.Strings(lines)
+		if got := strings.Join(lines, ""); got != tt.want {
+			t.Errorf("%s: output %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestRangeCommands(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	r := newTestRouter(t, &out)
+	r.Client.SetChunkSize(4)
+	r.Client.WriteFile(ctx, "/f", "one\ntwo\nthree\n")
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"head -c 6 /f", "one\ntw"},
+		{"tail -c 6 /f", "three\n"},
+		{"tail -c 100 /f", "one\ntwo\nthree\n"},
+		{"head -n 2 /f", "one\ntwo\n"},
+		{"tail -n 2 /f", "two\nthree\n"},
+		{"write --offset 4 /f TWO", ""},
+		{"cat /f", "one\nTWO\nthree\n"},
+		{"write -o 16 /f end", ""},
+		{"tail -c 5 /f", "\x00\x00end"},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		if err := r.Execute(ctx, tt.line); err != nil {
+			t.Fatalf("%s: %v", tt.line, err)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s: output %q, want %q", tt.line, got, tt.want)
+		}
+	}
+	if err := r.Execute(ctx, "write --offset -1 /f x"); err == nil {
+		t.Error("write at a negative offset: want error")
+	}
+}
+
+func TestFileWalker(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	r := newTestRouter(t, &out)
+	r.Client.SetChunkSize(8)
+	r.Client.Mkdir(ctx, "/d", false)
+	r.Client.WriteFile(ctx, "/d/small", "tiny")
+	r.Client.WriteFile(ctx, "/d/large", strings.Repeat("x", 20))
+
+	files, err := r.makeFileWalker()(ctx, "/")
+	if err != nil {
+		t.Fatalf("walker: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != "/d/small" || files[0].Content != "tiny" {
+		t.Errorf("walker = %+v, want only /d/small", files)
+	}
+}
+
+func TestSessionIdentity(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	r := newTestRouter(t, &out)
+
+	for _, line := range []string{"mkdir /home", "chown 1000:1000 /home", "su 1000", "umask 027", "touch /home/f"} {
+		if err := r.Execute(ctx, line); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+	}
+	out.Reset()
+	r.Execute(ctx, "id")
+	if got := out.String(); got != "uid=1000 gid=1000\n" {
+		t.Errorf("id = %q", got)
+	}
+	if meta, _ := r.Client.Stat(ctx, "/home/f"); meta.Mode != "0640" || meta.UID != "1000" {
+		t.Errorf("touch made mode %s uid %s, want 0640 1000", meta.Mode, meta.UID)
+	}
+	if err := r.Execute(ctx, "mkdir /etc"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("mkdir /etc as 1000 = %v, want ErrPermission", err)
+	}
+	if err := r.Execute(ctx, "su"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Execute(ctx, "mkdir /etc"); err != nil {
+		t.Errorf("mkdir /etc as root: %v", err)
+	}
+}
+
+func TestVersionCommands(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	r := newTestRouter(t, &out)
+
+	for _, line := range []string{
+		"versioning -n 5 --max-age 30d /",
+		"echo one > /f",
+		"echo two > /f",
+		"rm /f",
+	} {
+		if err := r.Execute(ctx, line); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+	}
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"versioning", "/\tkeep 5, max age 30d\n"},
+		{"show /f@1", "one"},
+		{"diff /f@1 2", "--- /f@1\n+++ /f@2\n@@ -1 +1 @@\n-one\n+two\n"},
+		{"history restore /f@1", ""},
+		{"cat /f", "one\n"},
+		{"diff /f@4", ""},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		if err := r.Execute(ctx, tt.line); err != nil {
+			t.Fatalf("%s: %v", tt.line, err)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s: output %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	out.Reset()
+	r.Execute(ctx, "history /f")
+	if n := strings.Count(out.String(), "\n"); n != 4 || !strings.Contains(out.String(), " rm") {
+		t.Errorf("history = %q, want 4 revisions with the removal", out.String())
+	}
+	if err := r.Execute(ctx, "show /f@3"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("show of a removal = %v, want ErrNotExist", err)
+	}
+	// RESTORE belongs to Redis
+	if _, ok := r.handlers["restore"]; ok {
+		t.Error("restore is handled as a filesystem command")
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	want := "--- a\n+++ b\n" +
+		"@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n" +
+		"@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+13\n"
+	if got := unifiedDiff("a", "b", a, b); got != want {
+		t.Errorf("unifiedDiff =\n%s\nwant\n%s", got, want)
+	}
+	if got := unifiedDiff("a", "b", a, a); got != "" {
+		t.Errorf("diff of equal input = %q", got)
+	}
+	if got := unifiedDiff("a", "b", "", "x\n"); got != "--- a\n+++ b\n@@ -0,0 +1 @@\n+x\n" {
+		t.Errorf("diff from empty = %q", got)
+	}
+}
+
+func TestSnapshotCommands(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	r := newTestRouter(t, &out)
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"echo one > /f", ""},
+		{"vol snapshot create s1", "Snapshot 'test@s1' created\n"},
+		{"echo two > /f", ""},
+		{"vol switch test@s1", ""},
+		{"cat /f", "one\n"},
+		{"vol switch test", ""},
+		{"cat /f", "two\n"},
+		{"vol snapshot restore s1", "Volume 'test' restored from snapshot 's1'\n"},
+		{"cat /f", "one\n"},
+		{"vol snapshot delete s1", "Snapshot 's1' deleted\n"},
+		{"vol snapshot list", ""},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		if err := r.Execute(ctx, tt.line); err != nil {
+			t.Fatalf("%s: %v", tt.line, err)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s: output %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	if err := r.Execute(ctx, "vol snapshot create s2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Execute(ctx, "vol switch test@s2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Execute(ctx, "echo three > /f"); !errors.Is(err, fs.ErrReadOnly) {
+		t.Errorf("write to snapshot: err = %v, want ErrReadOnly", err)
+	}
+	if err := r.Execute(ctx, "vol create a@b"); err == nil {
+		t.Error("vol create a@b: want error")
+	}
+	if err := r.Execute(ctx, "vol create m*"); err == nil {
+		t.Error("vol create m*: want error")
+	}
+}
+
+func TestCloneCommands(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	r := newTestRouter(t, &out)
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"echo one > /f", ""},
+		{"echo more > /g", ""},
+		{"vol clone test staging", "Volume 'staging' cloned from 'test'\n"},
+		{"vol switch staging", ""},
+		{"echo two > /f", ""},
+		{"cat /f", "two\n"},
+		{"vol switch test", ""},
+		{"cat /f", "one\n"},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		if err := r.Execute(ctx, tt.line); err != nil {
+			t.Fatalf("%s: %v", tt.line, err)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s: output %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	if err := r.Execute(ctx, "vol clone test staging"); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("clone onto staging: err = %v, want ErrExist", err)
+	}
+
+	out.Reset()
+	r.Execute(ctx, "vol info")
+	if !strings.Contains(out.String(), "Clones:      staging\n") {
+		t.Errorf("vol info = %q, want the clone listed", out.String())
+	}
+	out.Reset()
+	r.Execute(ctx, "vol info staging")
+	if !strings.Contains(out.String(), "Origin:      test\nShared:      1 of 2 files, 4 of 7 bytes (57%)\n") {
+		t.Errorf("vol info staging = %q, want 1 of 2 files shared", out.String())
+	}
+}
+
+func TestVolumeLifecycle(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	r := newTestRouter(t, &out)
+	answer := "n"
+	r.Prompt = func(prompt string) (string, error) { return answer + "\n", nil }
+
+	for _, line := range []string{
+		"mkdir /d",
+		"echo hello > /d/a",
+		"ln -s d/a /l",
+		"vol describe Scratch space",
+		"vol clone test other",
+		"vol rename test main",
+	} {
+		if err := r.Execute(ctx, line); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+	}
+	if r.State.Volume != "main" {
+		t.Errorf("volume after renaming the active one = %q, want main", r.State.Volume)
+	}
+
+	out.Reset()
+	r.Execute(ctx, "vol info")
+	for _, want := range []string{
+		"Volume:      main\n",
+		"Description: Scratch space\n",
+		"Entries:     1 files, 2 directories, 1 symlinks\n",
+		"Size:        5 bytes\n",
+		"Clones:      other\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("vol info = %q, want %q", out.String(), want)
+		}
+	}
+
+	if err := r.Execute(ctx, "vol delete main"); err == nil {
+		t.Error("deleting the active volume: want error")
+	}
+	if err := r.Execute(ctx, "vol delete other"); err == nil {
+		t.Error("vol delete without confirmation: want error")
+	}
+	answer = "y"
+	if err := r.Execute(ctx, "vol delete other"); err != nil {
+		t.Fatalf("vol delete: %v", err)
+	}
+	out.Reset()
+	r.Execute(ctx, "vol list")
+	if out.String() != "* main\n" {
+		t.Errorf("vol list = %q, want only main", out.String())
+	}
+	if err := r.Execute(ctx, "cat /d/a"); err != nil {
+		t.Errorf("cat after deleting the clone: %v", err)
+	}
+}
+
+func TestCrossVolumeCopy(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	r := newTestRouter(t, &out)
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"vol create staging", "Volume 'staging' created and active\n"},
+		{"mkdir -p /site/css", ""},
+		{"echo body > /site/index.html", ""},
+		{"echo red > /site/css/a.css", ""},
+		{"vol switch test", ""},
+		{"cp staging:/site/index.html /", ""},
+		{"cat index.html", "body\n"},
+		{"cp -r staging:/site test:/www", ""},
+		{"cat /www/css/a.css", "red\n"},
+		{"mv /index.html staging:/site/old.html", ""},
+		{"ls /", "www\n"},
+		{"mv staging:/site/css /", ""},
+		{"ls /", "css\nwww\n"},
+		{"vol switch staging", ""},
+		{"ls /site", "index.html\nold.html\n"},
+		{"vol switch test", ""},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		if err := r.Execute(ctx, tt.line); err != nil {
+			t.Fatalf("%s: %v", tt.line, err)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s: output %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	if err := r.Execute(ctx, "cp /www/css/a.css nosuch:/"); err == nil || !strings.Contains(err.Error(), "volume 'nosuch' does not exist") {
+		t.Errorf("cp to a missing volume: err = %v", err)
+	}
+	if err := r.Execute(ctx, "mv /www test@none:/"); err == nil {
+		t.Error("mv into a missing snapshot succeeded")
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want location
+	}{
+		{"a.txt", location{path: "a.txt"}},
+		{"dir/a:b", location{path: "dir/a:b"}},
+		{"a:b", location{path: "a:b"}},
+		{"staging:/a", location{volume: "staging", path: "/a"}},
+		{"main@s1:/a", location{volume: "main@s1", path: "/a"}},
+		{"redis://backup/main:/a", location{server: "redis://backup", volume: "main", path: "/a"}},
+		{"redis://:pw@backup:6380/2/main:/", location{server: "redis://:pw@backup:6380/2", volume: "main", path: "/"}},
+		{"rediss://backup/main:/a/b", location{server: "rediss://backup", volume: "main", path: "/a/b"}},
+	}
+	for _, tt := range tests {
+		got, err := parseLocation(tt.arg)
+		if err != nil || got != tt.want {
+			t.Errorf("parseLocation(%q) = %+v, %v, want %+v", tt.arg, got, err, tt.want)
+		}
+	}
+	for _, arg := range []string{"redis://backup", "redis://backup/x/main:/a", "redis://backup/:/a", "redis://backup/1/2/main:/a"} {
+		if _, err := parseLocation(arg); err == nil {
+			t.Errorf("parseLocation(%q) succeeded", arg)
+		}
+	}
+}
+
+func TestPutGet(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	r := newTestRouter(t, &out)
+	r.Client.SetChunkSize(8)
+
+	src := t.TempDir()
+	binary := "\x00\x01line\r\n\xff\xfe" + strings.Repeat("z", 20)
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	os.MkdirAll(filepath.Join(src, "site", "css"), 0755)
+	os.WriteFile(filepath.Join(src, "site", "logo.bin"), []byte(binary), 0640)
+	os.WriteFile(filepath.Join(src, "site", "css", "a.css"), []byte("red\n"), 0644)
+	os.Symlink("logo.bin", filepath.Join(src, "site", "link"))
+	os.Chtimes(filepath.Join(src, "site", "logo.bin"), mtime, mtime)
+	os.Chtimes(filepath.Join(src, "site", "css"), mtime, mtime)
+
+	if err := r.Execute(ctx, "fs put -r -q "+filepath.Join(src, "site")+" /"); err != nil {
+		t.Fatalf("fs put: %v", err)
+	}
+	if got, _ := r.Client.ReadFile(ctx, "/site/logo.bin"); got != binary {
+		t.Errorf("uploaded content = %q, want %q", got, binary)
+	}
+	meta, _ := r.Client.Stat(ctx, "/site/logo.bin")
+	if meta == nil || meta.Mode != "0640" || meta.MTime != mtime.Unix() || meta.Chunks == 0 {
+		t.Errorf("uploaded meta = %+v, want mode 0640, mtime %d, chunked", meta, mtime.Unix())
+	}
+	if meta, _ := r.Client.Stat(ctx, "/site/css"); meta == nil || meta.MTime != mtime.Unix() {
+		t.Errorf("uploaded directory = %+v, want mtime %d", meta, mtime.Unix())
+	}
+	if target, _ := r.Client.Readlink(ctx, "/site/link"); target != "logo.bin" {
+		t.Errorf("uploaded link -> %q, want logo.bin", target)
+	}
+
+	dst := t.TempDir()
+	if err := r.Execute(ctx, "fs get -r -q /site "+dst); err != nil {
+		t.Fatalf("fs get: %v", err)
+	}
+	logo := filepath.Join(dst, "site", "logo.bin")
+	if got, _ := os.ReadFile(logo); string(got) != binary {
+		t.Errorf("downloaded content = %q, want %q", got, binary)
+	}
+	if info, err := os.Stat(logo); err != nil || info.Mode().Perm() != 0640 || !info.ModTime().Equal(mtime) {
+		t.Errorf("downloaded file = %v, %v, want mode 0640 and mtime %v", info, err, mtime)
+	}
+	if target, _ := os.Readlink(filepath.Join(dst, "site", "link")); target != "logo.bin" {
+		t.Errorf("downloaded link -> %q, want logo.bin", target)
+	}
+
+	// A single file, into an existing directory and over an existing file,
+	// through the aliases
+	if err := r.Execute(ctx, "download /site/css/a.css "+dst); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dst, "a.css")); string(got) != "red\n" {
+		t.Errorf("a.css = %q", got)
+	}
+	if err := r.Execute(ctx, "upload "+filepath.Join(dst, "a.css")+" /site/logo.bin"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if got, _ := r.Client.ReadFile(ctx, "/site/logo.bin"); got != "red\n" {
+		t.Errorf("overwritten logo.bin = %q, want red", got)
+	}
+	if err := r.Execute(ctx, "fs get /site "+dst); !errors.Is(err, fs.ErrIsDir) {
+		t.Errorf("fs get of a directory without -r: err = %v, want ErrIsDir", err)
+	}
+
+	// GET is the Redis command without the fs prefix
+	if r.IsBuiltin("get") {
+		t.Error("get is a filesystem command, hiding Redis GET")
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	r := newTestRouter(t, &out)
+	r.Client.Mkdir(ctx, "/docs/sub", true)
+	r.Client.WriteFile(ctx, "/docs/sub/a.txt", "alpha")
+	r.Client.Symlink(ctx, "sub/a.txt", "/docs/link")
+
+	dir := t.TempDir()
+	for _, name := range []string{"docs.tar", "docs.tgz", "docs.zip"} {
+		file := filepath.Join(dir, name)
+		if err := r.Execute(ctx, "export /docs "+file); err != nil {
+			t.Fatalf("export %s: %v", name, err)
+		}
+		// The format is recognized from the content, not the name
+		plain := filepath.Join(dir, "archive")
+		os.Rename(file, plain)
+		if err := r.Execute(ctx, "import "+plain+" /"+name); err != nil {
+			t.Fatalf("import %s: %v", name, err)
+		}
+		if got, _ := r.Client.ReadFile(ctx, "/"+name+"/docs/sub/a.txt"); got != "alpha" {
+			t.Errorf("%s: a.txt = %q, want alpha", name, got)
+		}
+		if target, _ := r.Client.Readlink(ctx, "/"+name+"/docs/link"); target != "sub/a.txt" {
+			t.Errorf("%s: link -> %q, want sub/a.txt", name, target)
+		}
+	}
+
+	// Standard output defaults to tar
+	out.Reset()
+	if err := r.Execute(ctx, "export /docs -"); err != nil {
+		t.Fatalf("export to stdout: %v", err)
+	}
+	hdr, err := tar.NewReader(&out).Next()
+	if err != nil || hdr.Name != "docs/" {
+		t.Errorf("first entry = %v, %v, want docs/", hdr, err)
+	}
+
+	if err := r.Execute(ctx, "export /docs "+filepath.Join(dir, "docs.rar")); err == nil {
+		t.Error("export with an unknown extension succeeded")
+	}
+	if err := r.Execute(ctx, "export /missing "+filepath.Join(dir, "missing.tar")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("export of a missing path: err = %v, want ErrNotExist", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing.tar")); !os.IsNotExist(err) {
+		t.Error("failed export left its archive behind")
+	}
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	r := newTestRouter(t, &out)
+
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "conf", "d"), 0755)
+	os.MkdirAll(filepath.Join(src, ".git"), 0755)
+	os.WriteFile(filepath.Join(src, "conf", "app.yml"), []byte("port: 80\n"), 0640)
+	os.WriteFile(filepath.Join(src, "conf", "d", "x.yml"), []byte("x\n"), 0644)
+	os.WriteFile(filepath.Join(src, ".git", "HEAD"), []byte("ref\n"), 0644)
+	os.Symlink("app.yml", filepath.Join(src, "conf", "current"))
+
+	sync := func(args string) string {
+		t.Helper()
+		out.Reset()
+		if err := r.Execute(ctx, "fs sync "+args); err != nil {
+			t.Fatalf("fs sync %s: %v", args, err)
+		}
+		return out.String()
+	}
+
+	if got := sync("-n --exclude .git " + src + " /mirror"); !strings.Contains(got, "conf/app.yml") || !strings.Contains(got, "(dry run)") {
+		t.Errorf("dry run output = %q", got)
+	}
+	if ok, _ := r.Client.Exists(ctx, "/mirror"); ok {
+		t.Error("dry run created the destination")
+	}
+
+	sync("--exclude .git " + src + " /mirror")
+	if got, _ := r.Client.ReadFile(ctx, "/mirror/conf/app.yml"); got != "port: 80\n" {
+		t.Errorf("app.yml = %q", got)
+	}
+	if meta, _ := r.Client.Stat(ctx, "/mirror/conf/app.yml"); meta == nil || meta.Mode != "0640" {
+		t.Errorf("app.yml meta = %+v, want mode 0640", meta)
+	}
+	if target, _ := r.Client.Readlink(ctx, "/mirror/conf/current"); target != "app.yml" {
+		t.Errorf("current -> %q, want app.yml", target)
+	}
+	if ok, _ := r.Client.Exists(ctx, "/mirror/.git"); ok {
+		t.Error("excluded .git was synced")
+	}
+	if got := sync("--exclude .git " + src + " /mirror"); got != "" {
+		t.Errorf("second sync changed %q, want nothing", got)
+	}
+
+	// Same size and mtime: only a checksum tells the change apart
+	app := filepath.Join(src, "conf", "app.yml")
+	info, _ := os.Stat(app)
+	os.WriteFile(app, []byte("port: 81\n"), 0640)
+	os.Chtimes(app, info.ModTime(), info.ModTime())
+	if got := sync("--exclude .git " + src + " /mirror"); got != "" {
+		t.Errorf("sync without checksums changed %q, want nothing", got)
+	}
+	if got := sync("-c --exclude .git " + src + " /mirror"); !strings.Contains(got, "conf/app.yml") {
+		t.Errorf("checksum sync output = %q, want conf/app.yml", got)
+	}
+	if got, _ := r.Client.ReadFile(ctx, "/mirror/conf/app.yml"); got != "port: 81\n" {
+		t.Errorf("app.yml after checksum sync = %q", got)
+	}
+
+	// Extra entries stay unless --delete, which leaves excluded ones alone
+	r.Client.WriteFile(ctx, "/mirror/conf/extra", "x")
+	r.Client.WriteFile(ctx, "/mirror/keep.tmp", "x")
+	os.RemoveAll(filepath.Join(src, "conf", "d"))
+	sync("--exclude .git " + src + " /mirror")
+	if ok, _ := r.Client.Exists(ctx, "/mirror/conf/extra"); !ok {
+		t.Error("sync without --delete removed an extra file")
+	}
+	if got := sync("--delete --exclude .git --exclude *.tmp " + src + " /mirror"); !strings.Contains(got, "deleting conf/d") {
+		t.Errorf("delete output = %q", got)
+	}
+	for path, want := range map[string]bool{"/mirror/conf/extra": false, "/mirror/conf/d": false, "/mirror/keep.tmp": true} {
+		if ok, _ := r.Client.Exists(ctx, path); ok != want {
+			t.Errorf("%s exists = %v, want %v", path, ok, want)
+		}
+	}
+
+	// And back to the local disk
+	dst := filepath.Join(t.TempDir(), "pulled")
+	sync("--pull " + dst + " /mirror/conf")
+	if got, _ := os.ReadFile(filepath.Join(dst, "app.yml")); string(got) != "port: 81\n" {
+		t.Errorf("pulled app.yml = %q", got)
+	}
+	if info, err := os.Stat(filepath.Join(dst, "app.yml")); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("pulled app.yml = %v, %v, want mode 0640", info, err)
+	}
+	if got := sync("--pull " + dst + " /mirror/conf"); got != "" {
+		t.Errorf("second pull changed %q, want nothing", got)
+	}
+
+	if err := r.Execute(ctx, "fs sync --watch --pull "+dst+" /mirror"); err == nil {
+		t.Error("fs sync --watch --pull succeeded")
+	}
+}
+
+// xaddRecorder is a go-redis hook that records the arguments of every
+// command instead of sending it.
+type xaddRecorder struct {
+	cmds []string
+}
+
+func (x *xaddRecorder) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (x *xaddRecorder) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		x.cmds = append(x.cmds, strings.TrimSuffix(fmt.Sprintln(cmd.Args()...), "\n"))
+		return nil
+	}
+}
+
+func (x *xaddRecorder) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestRouterObserveEvents(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	r := newTestRouter(t, &out)
+	rec := &xaddRecorder{}
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:0"})
+	rdb.AddHook(rec)
+
+	c := fs.NewClientWithBackend(fs.NewMemoryBackend(), "other")
+	if err := c.Init(ctx); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	r.observe(c, rdb, "other", false)
+	if err := c.Mkdir(ctx, "/d", false); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if len(rec.cmds) != 0 {
+		t.Fatalf("without --events sent %q", rec.cmds)
+	}
+
+	r.Config.Events = true
+	r.Config.EventsMaxLen = 42
+	c = fs.NewClientWithBackend(fs.NewMemoryBackend(), "other")
+	if err := c.Init(ctx); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	r.observe(c, rdb, "other", false)
+	if err := c.Mkdir(ctx, "/d", false); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if len(rec.cmds) != 1 || !strings.HasPrefix(rec.cmds[0], "xadd fs:other:events maxlen ~ 42 * op mkdir path /d ") {
+		t.Errorf("with --events sent %q, want an xadd of mkdir /d to fs:other:events", rec.cmds)
+	}
+}
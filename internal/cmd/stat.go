@@ -2,7 +2,10 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+
+	"github.com/rowantrollope/redis-fs-cli/internal/fs"
 )
 
 func (r *Router) handleStat(ctx context.Context, args []string) error {
@@ -12,14 +15,22 @@ func (r *Router) handleStat(ctx context.Context, args []string) error {
 
 	for _, arg := range args {
 		path := r.ResolvePath(arg)
-		meta, err := r.Client.Stat(ctx, path)
+		meta, err := r.Reader.Stat(ctx, path)
 		if err != nil {
 			return err
 		}
 		if meta == nil {
-			return fmt.Errorf("stat: cannot stat '%s': No such file or directory", path)
+			return &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+		}
+		// Attributes need read access, unlike stat itself
+		var xattrs map[string]string
+		if r.Formatter.JSON {
+			xattrs, err = r.Reader.ListXattr(ctx, path)
+			if err != nil && !errors.Is(err, fs.ErrPermission) {
+				return err
+			}
 		}
-		r.Formatter.PrintStat(path, meta)
+		r.Formatter.PrintStat(path, meta, xattrs)
 	}
 	return nil
 }
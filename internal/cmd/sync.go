@@ -0,0 +1,522 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rowantrollope/redis-fs-cli/internal/fs"
+	flag "github.com/spf13/pflag"
+)
+
+// syncSettle is how long sync --watch waits for a burst of changes to end
+// before pushing them.
+const syncSettle = 200 * time.Millisecond
+
+// syncEntry is an entry of either side of a sync.
+type syncEntry struct {
+	typ    fs.EntryType
+	size   int64
+	mtime  int64
+	perm   os.FileMode
+	target string       // symlinks
+	info   os.FileInfo  // local entries
+	meta   *fs.Metadata // volume entries
+}
+
+// syncTree is one side of a sync: a local directory or a volume directory.
+// Paths are slash-separated and relative to the root of the tree.
+type syncTree interface {
+	// list returns the entries of the directory rel, or none when it does
+	// not exist.
+	list(ctx context.Context, rel string) (map[string]*syncEntry, error)
+	// sum returns a checksum of the content of the file rel.
+	sum(ctx context.Context, rel string) ([]byte, error)
+	mkdir(ctx context.Context, rel string) error
+	remove(ctx context.Context, rel string) error
+}
+
+type localTree struct {
+	root string
+}
+
+func (t localTree) path(rel string) string {
+	return filepath.Join(t.root, filepath.FromSlash(rel))
+}
+
+func (t localTree) list(ctx context.Context, rel string) (map[string]*syncEntry, error) {
+	dirents, err := os.ReadDir(t.path(rel))
+	if errors.Is(err, iofs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sync: %w", err)
+	}
+	entries := make(map[string]*syncEntry, len(dirents))
+	for _, d := range dirents {
+		info, err := d.Info()
+		if errors.Is(err, iofs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sync: %w", err)
+		}
+		e := &syncEntry{size: info.Size(), mtime: info.ModTime().Unix(), perm: info.Mode().Perm(), info: info}
+		switch {
+		case info.IsDir():
+			e.typ = fs.TypeDir
+		case info.Mode()&os.ModeSymlink != 0:
+			e.typ = fs.TypeSymlink
+			if e.target, err = os.Readlink(t.path(path.Join(rel, d.Name()))); err != nil {
+				return nil, fmt.Errorf("sync: %w", err)
+			}
+		case info.Mode().IsRegular():
+			e.typ = fs.TypeFile
+		default:
+			// Devices, sockets and pipes are not synced
+			continue
+		}
+		entries[d.Name()] = e
+	}
+	return entries, nil
+}
+
+func (t localTree) sum(ctx context.Context, rel string) ([]byte, error) {
+	f, err := os.Open(t.path(rel))
+	if err != nil {
+		return nil, fmt.Errorf("sync: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("sync: %w", err)
+	}
+	return h.Sum(nil), nil
+}
+
+func (t localTree) mkdir(ctx context.Context, rel string) error {
+	// Writable until the entries are in, whatever its own mode; the root
+	// keeps the one it is created with
+	perm := os.FileMode(0700)
+	if rel == "" {
+		perm = 0777
+	}
+	if err := os.MkdirAll(t.path(rel), perm); err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+	return nil
+}
+
+func (t localTree) remove(ctx context.Context, rel string) error {
+	if err := os.RemoveAll(t.path(rel)); err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+	return nil
+}
+
+type volumeTree struct {
+	c    *fs.Client
+	root string
+}
+
+func (t volumeTree) path(rel string) string {
+	return fs.JoinPath(t.root, rel)
+}
+
+func (t volumeTree) list(ctx context.Context, rel string) (map[string]*syncEntry, error) {
+	meta, err := t.c.Stat(ctx, t.path(rel))
+	if err != nil || meta == nil || meta.Type != fs.TypeDir {
+		return nil, err
+	}
+	dirents, err := t.c.ReadDirWithMeta(ctx, t.path(rel))
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*syncEntry, len(dirents))
+	for _, d := range dirents {
+		if d.Meta == nil {
+			continue
+		}
+		entries[d.Name] = &syncEntry{
+			typ:    d.Meta.Type,
+			size:   d.Meta.Size,
+			mtime:  d.Meta.MTime,
+			perm:   d.Meta.FileMode().Perm(),
+			target: d.Meta.LinkTarget,
+			meta:   d.Meta,
+		}
+	}
+	return entries, nil
+}
+
+func (t volumeTree) sum(ctx context.Context, rel string) ([]byte, error) {
+	h := sha256.New()
+	if _, err := t.c.ReadFileTo(ctx, t.path(rel), h); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func (t volumeTree) mkdir(ctx context.Context, rel string) error {
+	return t.c.Mkdir(ctx, t.path(rel), true)
+}
+
+func (t volumeTree) remove(ctx context.Context, rel string) error {
+	return t.c.RemoveRecursive(ctx, t.path(rel))
+}
+
+// syncer makes the tree dst a copy of src.
+type syncer struct {
+	src, dst syncTree
+	// copy transfers the file or symlink rel, with its mode and times
+	copy func(ctx context.Context, rel string, e *syncEntry) error
+	// attrs gives the entry rel of dst the mode and times of e
+	attrs func(ctx context.Context, rel string, e *syncEntry) error
+
+	delete   bool
+	dryRun   bool
+	checksum bool
+	exclude  []string
+	w        io.Writer // nil when quiet
+
+	transferred, deleted int
+}
+
+// excluded reports whether rel matches an exclude pattern. Patterns with a
+// slash match the whole relative path, others the last element.
+func (s *syncer) excluded(rel string) bool {
+	for _, pattern := range s.exclude {
+		pattern = strings.TrimSuffix(pattern, "/")
+		name := path.Base(rel)
+		if strings.Contains(pattern, "/") {
+			pattern, name = strings.TrimPrefix(pattern, "/"), rel
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *syncer) report(format string, args ...interface{}) {
+	if s.w != nil {
+		fmt.Fprintf(s.w, format, args...)
+	}
+}
+
+// run syncs the whole tree.
+func (s *syncer) run(ctx context.Context) error {
+	s.transferred, s.deleted = 0, 0
+	if !s.dryRun {
+		if err := s.dst.mkdir(ctx, ""); err != nil {
+			return err
+		}
+	}
+	_, err := s.dir(ctx, "")
+	return err
+}
+
+// dir syncs the directory rel, and reports whether it changed anything in
+// it.
+func (s *syncer) dir(ctx context.Context, rel string) (bool, error) {
+	src, err := s.src.list(ctx, rel)
+	if err != nil {
+		return false, err
+	}
+	dst, err := s.dst.list(ctx, rel)
+	if err != nil {
+		return false, err
+	}
+	names := make([]string, 0, len(src))
+	for name := range src {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	changed := false
+	for _, name := range names {
+		child := path.Join(rel, name)
+		if s.excluded(child) {
+			continue
+		}
+		se, de := src[name], dst[name]
+		if de != nil && de.typ != se.typ {
+			if err := s.remove(ctx, child); err != nil {
+				return false, err
+			}
+			de = nil
+		}
+		c, err := s.entry(ctx, child, se, de)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || c
+	}
+
+	if s.delete {
+		var extra []string
+		for name := range dst {
+			if src[name] == nil && !s.excluded(path.Join(rel, name)) {
+				extra = append(extra, name)
+			}
+		}
+		sort.Strings(extra)
+		for _, name := range extra {
+			if err := s.remove(ctx, path.Join(rel, name)); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// entry syncs the entry rel, se in the source and de, of the same type, or
+// nil, in the destination.
+func (s *syncer) entry(ctx context.Context, rel string, se, de *syncEntry) (bool, error) {
+	switch se.typ {
+	case fs.TypeDir:
+		if de == nil {
+			s.report("%s/\n", rel)
+			if !s.dryRun {
+				if err := s.dst.mkdir(ctx, rel); err != nil {
+					return false, err
+				}
+			}
+		}
+		changed, err := s.dir(ctx, rel)
+		if err != nil {
+			return false, err
+		}
+		// Set after the entries, whose changes touch the directory
+		if !s.dryRun && (de == nil || changed || de.perm != se.perm || de.mtime != se.mtime) {
+			if err := s.attrs(ctx, rel, se); err != nil {
+				return false, err
+			}
+		}
+		return de == nil || changed, nil
+
+	case fs.TypeSymlink:
+		if de != nil && de.target == se.target {
+			return false, nil
+		}
+		return true, s.transfer(ctx, rel, se)
+	}
+
+	if de == nil || de.size != se.size {
+		return true, s.transfer(ctx, rel, se)
+	}
+	if s.checksum {
+		a, err := s.src.sum(ctx, rel)
+		if err != nil {
+			return false, err
+		}
+		b, err := s.dst.sum(ctx, rel)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(a, b) {
+			return true, s.transfer(ctx, rel, se)
+		}
+	} else if de.mtime != se.mtime {
+		return true, s.transfer(ctx, rel, se)
+	}
+
+	// Same content; bring the mode and times over
+	if de.perm == se.perm && de.mtime == se.mtime {
+		return false, nil
+	}
+	s.report("%s\n", rel)
+	if !s.dryRun {
+		if err := s.attrs(ctx, rel, se); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (s *syncer) transfer(ctx context.Context, rel string, e *syncEntry) error {
+	s.report("%s\n", rel)
+	s.transferred++
+	if s.dryRun {
+		return nil
+	}
+	return s.copy(ctx, rel, e)
+}
+
+func (s *syncer) remove(ctx context.Context, rel string) error {
+	s.report("deleting %s\n", rel)
+	s.deleted++
+	if s.dryRun {
+		return nil
+	}
+	return s.dst.remove(ctx, rel)
+}
+
+func (r *Router) handleSync(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("sync", flag.ContinueOnError)
+	del := fset.Bool("delete", false, "Delete entries missing from the source")
+	dryRun := fset.BoolP("dry-run", "n", false, "Show what would change without changing it")
+	checksum := fset.BoolP("checksum", "c", false, "Compare content checksums instead of modification times")
+	exclude := fset.StringArray("exclude", nil, "Skip entries matching a pattern (repeatable)")
+	pull := fset.Bool("pull", false, "Sync the volume directory into the local directory")
+	watch := fset.BoolP("watch", "w", false, "Keep pushing local changes until interrupted")
+	quiet := fset.BoolP("quiet", "q", false, "Do not list changes")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 2 {
+		return fmt.Errorf("sync: usage: fs sync [-n] [-c] [--delete] [--exclude pattern]... [--pull] [-w] <local-dir> <remote-dir>")
+	}
+	for _, pattern := range *exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("sync: invalid exclude pattern '%s'", pattern)
+		}
+	}
+	if *watch && (*pull || *dryRun) {
+		return fmt.Errorf("sync: --watch only pushes local changes")
+	}
+
+	local := fset.Arg(0)
+	remote := r.ResolvePath(fset.Arg(1))
+	s := &syncer{delete: *del, dryRun: *dryRun, checksum: *checksum, exclude: *exclude}
+	if !*quiet {
+		s.w = r.Formatter.Writer
+	}
+	p := r.newProgress(false, true)
+	if *pull {
+		meta, err := r.Reader.StatFollow(ctx, remote)
+		if err != nil {
+			return err
+		}
+		if meta == nil || meta.Type != fs.TypeDir {
+			return fmt.Errorf("sync: %s: %w", remote, fs.ErrNotDir)
+		}
+		if remote, err = r.Reader.Realpath(ctx, remote); err != nil {
+			return err
+		}
+		src, dst := volumeTree{r.Reader, remote}, localTree{local}
+		s.src, s.dst = src, dst
+		s.copy = func(ctx context.Context, rel string, e *syncEntry) error {
+			return r.downloadEntry(ctx, src.path(rel), e.meta, dst.path(rel), p)
+		}
+		s.attrs = func(ctx context.Context, rel string, e *syncEntry) error {
+			return downloadAttrs(dst.path(rel), e.meta)
+		}
+	} else {
+		if info, err := os.Stat(local); err != nil {
+			return fmt.Errorf("sync: %w", err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("sync: %s: not a directory", local)
+		}
+		src, dst := localTree{local}, volumeTree{r.Client, remote}
+		s.src, s.dst = src, dst
+		s.copy = func(ctx context.Context, rel string, e *syncEntry) error {
+			return r.uploadEntry(ctx, src.path(rel), e.info, dst.path(rel), p)
+		}
+		s.attrs = func(ctx context.Context, rel string, e *syncEntry) error {
+			return r.uploadAttrs(ctx, dst.path(rel), e.info)
+		}
+	}
+
+	if err := r.syncPass(ctx, s); err != nil {
+		return err
+	}
+	if *watch {
+		return r.syncWatch(ctx, s, local)
+	}
+	return nil
+}
+
+// syncPass runs s once and summarizes the changes.
+func (r *Router) syncPass(ctx context.Context, s *syncer) error {
+	if err := s.run(ctx); err != nil {
+		return err
+	}
+	if s.w != nil && (s.transferred > 0 || s.deleted > 0 || s.dryRun) {
+		suffix := ""
+		if s.dryRun {
+			suffix = " (dry run)"
+		}
+		fmt.Fprintf(s.w, "%d transferred, %d deleted%s\n", s.transferred, s.deleted, suffix)
+	}
+	return nil
+}
+
+// syncWatch pushes the changes under the local directory local as they
+// happen, until interrupted. A failed pass is reported and retried on the
+// next change.
+func (r *Router) syncWatch(ctx context.Context, s *syncer, local string) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	w, err := newWatcher()
+	if err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+	defer w.Close()
+	r.Formatter.Errorf("Watching %s (Ctrl-C to stop)\n", local)
+
+	for {
+		// New directories are watched from the pass that copied them
+		if err := watchTree(w, local, s); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-w.changes:
+			if !ok {
+				return fmt.Errorf("sync: watching %s stopped", local)
+			}
+		}
+		settle := time.NewTimer(syncSettle)
+	settling:
+		for {
+			select {
+			case <-ctx.Done():
+				settle.Stop()
+				return nil
+			case <-w.changes:
+				settle.Reset(syncSettle)
+			case <-settle.C:
+				break settling
+			}
+		}
+		if err := r.syncPass(ctx, s); err != nil {
+			r.Formatter.Errorf("%v\n", err)
+		}
+	}
+}
+
+// watchTree watches every directory under local that s does not exclude.
+func watchTree(w *watcher, local string, s *syncer) error {
+	return filepath.WalkDir(local, func(p string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, iofs.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("sync: %w", err)
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if rel, _ := filepath.Rel(local, p); rel != "." && s.excluded(filepath.ToSlash(rel)) {
+			return filepath.SkipDir
+		}
+		if err := w.add(p); err != nil {
+			return fmt.Errorf("sync: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+func (r *Router) handleTag(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("tag: usage: tag add|rm|ls")
+	}
+
+	subcmd := strings.ToLower(args[0])
+	subargs := args[1:]
+
+	switch subcmd {
+	case "add":
+		if len(subargs) < 2 {
+			return fmt.Errorf("tag add: usage: tag add path tag...")
+		}
+		return r.Client.AddTags(ctx, r.ResolvePath(subargs[0]), subargs[1:]...)
+	case "rm":
+		if len(subargs) < 2 {
+			return fmt.Errorf("tag rm: usage: tag rm path tag...")
+		}
+		return r.Client.RemoveTags(ctx, r.ResolvePath(subargs[0]), subargs[1:]...)
+	case "ls":
+		if len(subargs) > 1 {
+			return fmt.Errorf("tag ls: usage: tag ls [path]")
+		}
+		path := ""
+		if len(subargs) == 1 {
+			path = subargs[0]
+		}
+		return r.tagList(ctx, r.ResolvePath(path))
+	default:
+		return fmt.Errorf("tag: unknown subcommand '%s'", subcmd)
+	}
+}
+
+func (r *Router) tagList(ctx context.Context, path string) error {
+	tags, err := r.Reader.Tags(ctx, path)
+	if err != nil {
+		return err
+	}
+	if r.Formatter.JSON {
+		if tags == nil {
+			tags = []string{}
+		}
+		return r.Formatter.PrintJSON(tags)
+	}
+	for _, t := range tags {
+		fmt.Fprintln(r.Formatter.Writer, t)
+	}
+	return nil
+}
@@ -19,7 +19,7 @@ func (r *Router) handleTree(ctx context.Context, args []string) error {
 	}
 	path = r.ResolvePath(path)
 
-	entry, dirCount, fileCount, err := r.Client.Tree(ctx, path, *maxDepth)
+	entry, dirCount, fileCount, err := r.Reader.Tree(ctx, path, *maxDepth)
 	if err != nil {
 		return err
 	}
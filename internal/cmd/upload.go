@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rowantrollope/redis-fs-cli/internal/fs"
+	flag "github.com/spf13/pflag"
+)
+
+// progress counts the files put or get transfers, and reports them as it
+// goes when w is set.
+type progress struct {
+	w     io.Writer
+	files int
+	bytes int64
+}
+
+func (p *progress) add(path string, n int64) {
+	p.files++
+	p.bytes += n
+	if p.w != nil {
+		fmt.Fprintf(p.w, "\r  %d files, %d bytes... %s", p.files, p.bytes, path)
+	}
+}
+
+func (p *progress) done() {
+	if p.w != nil {
+		fmt.Fprintf(p.w, "\n%d files, %d bytes\n", p.files, p.bytes)
+	}
+}
+
+// newProgress returns a progress reporting to standard error when tree is
+// set and quiet is not.
+func (r *Router) newProgress(tree, quiet bool) *progress {
+	p := &progress{}
+	if tree && !quiet {
+		p.w = r.Formatter.ErrWriter
+	}
+	return p
+}
+
+func (r *Router) handlePut(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("put", flag.ContinueOnError)
+	recursive := fset.BoolP("recursive", "r", false, "Upload directories recursively")
+	quiet := fset.BoolP("quiet", "q", false, "Do not show progress")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() < 1 || fset.NArg() > 2 {
+		return fmt.Errorf("put: usage: fs put [-r] [-q] <local> [remote]")
+	}
+
+	local := fset.Arg(0)
+	remote := r.ResolvePath(fset.Arg(1))
+	info, err := os.Lstat(local)
+	if err != nil {
+		return fmt.Errorf("put: %w", err)
+	}
+	if info.IsDir() && !*recursive {
+		return fmt.Errorf("put: %s: is a directory (use -r)", local)
+	}
+
+	// An existing directory receives the source under its own name
+	dir, err := r.Client.StatFollow(ctx, remote)
+	if err != nil {
+		return err
+	}
+	if dir != nil && dir.Type == fs.TypeDir {
+		remote = fs.JoinPath(remote, filepath.Base(local))
+	}
+
+	p := r.newProgress(*recursive, *quiet)
+	if info.IsDir() {
+		err = r.uploadTree(ctx, local, remote, p)
+	} else {
+		err = r.uploadEntry(ctx, local, info, remote, p)
+	}
+	p.done()
+	return err
+}
+
+// uploadTree uploads the local directory local to remote. Directory modes and
+// times are set last, deepest first, so adding the entries does not
+// change them.
+func (r *Router) uploadTree(ctx context.Context, local, remote string, p *progress) error {
+	type dir struct {
+		path string
+		info os.FileInfo
+	}
+	var dirs []dir
+	err := filepath.WalkDir(local, func(path string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("put: %w", err)
+		}
+		rel, err := filepath.Rel(local, path)
+		if err != nil {
+			return fmt.Errorf("put: %w", err)
+		}
+		target := fs.JoinPath(remote, filepath.ToSlash(rel))
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("put: %w", err)
+		}
+		if !d.IsDir() {
+			return r.uploadEntry(ctx, path, info, target, p)
+		}
+		if err := r.Client.Mkdir(ctx, target, true); err != nil {
+			return err
+		}
+		dirs = append(dirs, dir{target, info})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := r.uploadAttrs(ctx, dirs[i].path, dirs[i].info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadEntry uploads the local file or symlink local, described by info, to
+// remote, replacing what is there.
+func (r *Router) uploadEntry(ctx context.Context, local string, info os.FileInfo, remote string, p *progress) error {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(local)
+		if err != nil {
+			return fmt.Errorf("put: %w", err)
+		}
+		if meta, err := r.Client.Stat(ctx, remote); err != nil {
+			return err
+		} else if meta != nil && meta.Type != fs.TypeDir {
+			if err := r.Client.Remove(ctx, remote); err != nil {
+				return err
+			}
+		}
+		if err := r.Client.Symlink(ctx, target, remote); err != nil {
+			return err
+		}
+		p.add(remote, 0)
+		return nil
+	case !info.Mode().IsRegular():
+		r.Formatter.Errorf("put: %s: skipping special file\n", local)
+		return nil
+	}
+
+	src, err := os.Open(local)
+	if err != nil {
+		return fmt.Errorf("put: %w", err)
+	}
+	defer src.Close()
+	f, err := r.Client.OpenFile(ctx, remote, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, src)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := r.uploadAttrs(ctx, remote, info); err != nil {
+		return err
+	}
+	p.add(remote, n)
+	return nil
+}
+
+// uploadAttrs gives remote the permission bits and modification time of the
+// local entry described by info.
+func (r *Router) uploadAttrs(ctx context.Context, remote string, info os.FileInfo) error {
+	if err := r.Client.Chmod(ctx, remote, fmt.Sprintf("%04o", info.Mode().Perm())); err != nil {
+		return err
+	}
+	return r.Client.Chtimes(ctx, remote, info.ModTime(), info.ModTime())
+}
+
+func (r *Router) handleGet(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("get", flag.ContinueOnError)
+	recursive := fset.BoolP("recursive", "r", false, "Download directories recursively")
+	quiet := fset.BoolP("quiet", "q", false, "Do not show progress")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() < 1 || fset.NArg() > 2 {
+		return fmt.Errorf("get: usage: fs get [-r] [-q] <remote> [local]")
+	}
+
+	remote := r.ResolvePath(fset.Arg(0))
+	local := fset.Arg(1)
+	if local == "" {
+		local = "."
+	}
+	meta, err := r.Reader.StatFollow(ctx, remote)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		return fmt.Errorf("get: %s: %w", remote, fs.ErrNotExist)
+	}
+	if meta.Type == fs.TypeDir && !*recursive {
+		return fmt.Errorf("get: %s: %w (use -r)", remote, fs.ErrIsDir)
+	}
+	if remote, err = r.Reader.Realpath(ctx, remote); err != nil {
+		return err
+	}
+
+	// An existing directory receives the source under its own name
+	if info, err := os.Stat(local); err == nil && info.IsDir() && remote != "/" {
+		local = filepath.Join(local, fs.BaseName(remote))
+	}
+
+	p := r.newProgress(*recursive, *quiet)
+	err = r.downloadEntry(ctx, remote, meta, local, p)
+	p.done()
+	return err
+}
+
+// downloadEntry downloads the entry remote, whose metadata is meta, and
+// everything below it to local, replacing what is there.
+func (r *Router) downloadEntry(ctx context.Context, remote string, meta *fs.Metadata, local string, p *progress) error {
+	switch meta.Type {
+	case fs.TypeSymlink:
+		if info, err := os.Lstat(local); err == nil && !info.IsDir() {
+			if err := os.Remove(local); err != nil {
+				return fmt.Errorf("get: %w", err)
+			}
+		}
+		if err := os.Symlink(meta.LinkTarget, local); err != nil {
+			return fmt.Errorf("get: %w", err)
+		}
+		p.add(remote, 0)
+		return nil
+
+	case fs.TypeDir:
+		// Writable until the entries are in, whatever its own mode
+		if err := os.MkdirAll(local, 0700); err != nil {
+			return fmt.Errorf("get: %w", err)
+		}
+		entries, err := r.Reader.ReadDirWithMeta(ctx, remote)
+		if err != nil {
+			return err
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+		for _, e := range entries {
+			if e.Meta == nil {
+				continue
+			}
+			if err := r.downloadEntry(ctx, fs.JoinPath(remote, e.Name), e.Meta, filepath.Join(local, e.Name), p); err != nil {
+				return err
+			}
+		}
+		if remote == "/" {
+			// Merged into local, which keeps its own attributes
+			return nil
+		}
+		return downloadAttrs(local, meta)
+	}
+
+	f, err := os.OpenFile(local, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	n, err := r.Reader.ReadFileTo(ctx, remote, f)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("get: %w", cerr)
+	}
+	if err != nil {
+		return err
+	}
+	if err := downloadAttrs(local, meta); err != nil {
+		return err
+	}
+	p.add(remote, n)
+	return nil
+}
+
+// downloadAttrs gives the local file or directory local the permission bits and
+// times of meta.
+func downloadAttrs(local string, meta *fs.Metadata) error {
+	if err := os.Chmod(local, meta.FileMode().Perm()); err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	if err := os.Chtimes(local, time.Unix(meta.ATime, 0), time.Unix(meta.MTime, 0)); err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	return nil
+}
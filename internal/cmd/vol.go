@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"strings"
+
+	"github.com/rowantrollope/redis-fs-cli/internal/fs"
+	flag "github.com/spf13/pflag"
 )
 
 func (r *Router) handleVol(ctx context.Context, args []string) error {
 	if len(args) == 0 {
-		return fmt.Errorf("vol: usage: vol list|switch|create|info")
+		return fmt.Errorf("vol: usage: vol list|switch|create|clone|rename|delete|info|describe|snapshot")
 	}
 
 	subcmd := strings.ToLower(args[0])
@@ -27,8 +30,31 @@ func (r *Router) handleVol(ctx context.Context, args []string) error {
 			return fmt.Errorf("vol create: missing volume name")
 		}
 		return r.volCreate(ctx, subargs[0])
+	case "clone":
+		if len(subargs) != 2 {
+			return fmt.Errorf("vol clone: usage: vol clone <src> <dst>")
+		}
+		return r.volClone(ctx, subargs[0], subargs[1])
+	case "rename", "mv":
+		if len(subargs) != 2 {
+			return fmt.Errorf("vol rename: usage: vol rename <old> <new>")
+		}
+		return r.volRename(ctx, subargs[0], subargs[1])
+	case "delete", "rm":
+		return r.volDelete(ctx, subargs)
 	case "info":
-		return r.volInfo(ctx)
+		if len(subargs) > 1 {
+			return fmt.Errorf("vol info: usage: vol info [name]")
+		}
+		name := r.State.Volume
+		if len(subargs) == 1 {
+			name = subargs[0]
+		}
+		return r.volInfo(ctx, name)
+	case "describe":
+		return r.volDescribe(ctx, subargs)
+	case "snapshot":
+		return r.volSnapshot(ctx, subargs)
 	default:
 		return fmt.Errorf("vol: unknown subcommand '%s'", subcmd)
 	}
@@ -56,17 +82,23 @@ func (r *Router) volList(ctx context.Context) error {
 
 func (r *Router) volSwitch(ctx context.Context, name string) error {
 	// Verify volume root exists
-	r.Client.SetVolume(name)
-	exists, err := r.Client.Exists(ctx, "/")
+	r.setVolume(name)
+	exists, err := r.Client.VolumeExists(ctx)
 	if err != nil {
-		r.Client.SetVolume(r.State.Volume)
+		r.setVolume(r.State.Volume)
 		return err
 	}
 	if !exists {
-		r.Client.SetVolume(r.State.Volume)
+		r.setVolume(r.State.Volume)
 		return fmt.Errorf("vol switch: volume '%s' does not exist (use 'vol create %s')", name, name)
 	}
 
+	// Migrates volumes still on the legacy layout
+	if err := r.Client.Init(ctx); err != nil {
+		r.setVolume(r.State.Volume)
+		return err
+	}
+
 	r.State.Volume = name
 	r.State.Cwd = "/"
 	r.State.PrevDir = ""
@@ -74,13 +106,19 @@ func (r *Router) volSwitch(ctx context.Context, name string) error {
 }
 
 func (r *Router) volCreate(ctx context.Context, name string) error {
+	if strings.Contains(name, "@") {
+		return fmt.Errorf("vol create: '@' is reserved for snapshots (use 'vol snapshot create')")
+	}
+	if !fs.ValidVolumeName(name) {
+		return fmt.Errorf("vol create: invalid volume name '%s' (no spaces or any of :{}*?[]\\/)", name)
+	}
 	// Save current volume
 	prev := r.Client.Volume
-	r.Client.SetVolume(name)
+	r.setVolume(name)
 
 	err := r.Client.Init(ctx)
 	if err != nil {
-		r.Client.SetVolume(prev)
+		r.setVolume(prev)
 		return err
 	}
 
@@ -93,15 +131,298 @@ func (r *Router) volCreate(ctx context.Context, name string) error {
 	return nil
 }
 
-func (r *Router) volInfo(ctx context.Context) error {
+// onVolume runs fn with the client on volume name, migrating it first if
+// it is still on the legacy layout, and then goes back to the session's
+// volume.
+func (r *Router) onVolume(ctx context.Context, op, name string, fn func() error) error {
+	defer func() { r.setVolume(r.State.Volume) }()
+	r.setVolume(name)
+	exists, err := r.Client.VolumeExists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%s: volume '%s' does not exist", op, name)
+	}
+	if err := r.Client.Init(ctx); err != nil {
+		return err
+	}
+	return fn()
+}
+
+func (r *Router) volClone(ctx context.Context, src, dst string) error {
+	err := r.onVolume(ctx, "vol clone", src, func() error {
+		return r.Client.CloneVolume(ctx, dst)
+	})
+	if err != nil {
+		return err
+	}
+	r.Formatter.Printf("Volume '%s' cloned from '%s'\n", dst, src)
+	return nil
+}
+
+func (r *Router) volRename(ctx context.Context, from, to string) error {
+	if strings.Contains(from, "@") || strings.Contains(to, "@") {
+		return fmt.Errorf("vol rename: snapshots cannot be renamed")
+	}
+	err := r.onVolume(ctx, "vol rename", from, func() error {
+		// The search index follows the keys it indexes
+		indexed := false
+		if r.Config.SearchAvailable {
+			mgr := r.indexManagerFor(from)
+			exists, err := mgr.IndexExists(ctx)
+			if err != nil {
+				return err
+			}
+			if exists {
+				if err := mgr.DropIndex(ctx); err != nil {
+					return err
+				}
+				indexed = true
+			}
+		}
+		if err := r.Client.RenameVolume(ctx, to); err != nil {
+			return err
+		}
+		if from == r.State.Volume {
+			r.State.Volume = to
+		}
+		if indexed {
+			withVector, dim := r.indexSchema()
+			return r.indexManagerFor(to).CreateIndex(ctx, withVector, dim)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.Formatter.Printf("Volume '%s' renamed to '%s'\n", from, to)
+	return nil
+}
+
+func (r *Router) volDelete(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("vol delete", flag.ContinueOnError)
+	force := fset.BoolP("force", "f", false, "Do not ask for confirmation")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 1 {
+		return fmt.Errorf("vol delete: usage: vol delete [-f] <name>")
+	}
+	name := fset.Arg(0)
+	if strings.Contains(name, "@") {
+		return fmt.Errorf("vol delete: '%s' is a snapshot (use 'vol snapshot delete')", name)
+	}
+	if name == r.State.Volume {
+		return fmt.Errorf("vol delete: '%s' is the active volume (switch to another volume first)", name)
+	}
+
+	err := r.onVolume(ctx, "vol delete", name, func() error {
+		if !*force && !r.confirm(fmt.Sprintf("Delete volume '%s' with all its files and snapshots?", name)) {
+			return fmt.Errorf("vol delete: aborted")
+		}
+		if err := r.Client.DeleteVolume(ctx); err != nil {
+			return err
+		}
+		if !r.Config.SearchAvailable {
+			return nil
+		}
+		mgr := r.indexManagerFor(name)
+		exists, err := mgr.IndexExists(ctx)
+		if err != nil || !exists {
+			return err
+		}
+		return mgr.DropIndex(ctx)
+	})
+	if err != nil {
+		return err
+	}
+	r.Formatter.Printf("Volume '%s' deleted\n", name)
+	return nil
+}
+
+func (r *Router) volDescribe(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("vol describe", flag.ContinueOnError)
+	clearDesc := fset.Bool("clear", false, "Remove the description")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	description := strings.Join(fset.Args(), " ")
+	if description == "" && !*clearDesc {
+		return fmt.Errorf("vol describe: usage: vol describe <text>|--clear")
+	}
+	return r.Client.SetDescription(ctx, description)
+}
+
+func (r *Router) volInfo(ctx context.Context, name string) error {
+	var info *fs.VolumeInfo
+	var clones []string
+	var snaps []fs.Snapshot
+	err := r.onVolume(ctx, "vol info", name, func() error {
+		var err error
+		if info, err = r.Client.VolumeInfo(ctx); err != nil {
+			return err
+		}
+		if clones, err = r.Client.Clones(ctx); err != nil {
+			return err
+		}
+		if !r.Client.IsSnapshot() {
+			snaps, err = r.Client.Snapshots(ctx)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if r.Formatter.JSON {
+		result := map[string]interface{}{
+			"volume":    info.Name,
+			"created":   info.Created,
+			"files":     info.Files,
+			"dirs":      info.Dirs,
+			"symlinks":  info.Symlinks,
+			"bytes":     info.Bytes,
+			"keys":      info.Keys,
+			"memory":    info.Memory,
+			"snapshots": len(snaps),
+		}
+		if name == r.State.Volume {
+			result["cwd"] = r.State.Cwd
+		}
+		if info.Description != "" {
+			result["description"] = info.Description
+		}
+		if info.Origin != "" {
+			result["clone_of"] = info.Origin
+			result["shared_files"] = info.SharedFiles
+			result["shared_bytes"] = info.SharedBytes
+		}
+		if len(clones) > 0 {
+			result["clones"] = clones
+		}
+		return r.Formatter.PrintJSON(result)
+	}
+
+	w := r.Formatter.Writer
+	fmt.Fprintf(w, "Volume:      %s\n", info.Name)
+	if info.Description != "" {
+		fmt.Fprintf(w, "Description: %s\n", info.Description)
+	}
+	if name == r.State.Volume {
+		fmt.Fprintf(w, "CWD:         %s\n", r.State.Cwd)
+	}
+	fmt.Fprintf(w, "Created:     %s\n", fs.FormatTime(info.Created))
+	fmt.Fprintf(w, "Entries:     %d files, %d directories, %d symlinks\n", info.Files, info.Dirs, info.Symlinks)
+	fmt.Fprintf(w, "Size:        %d bytes\n", info.Bytes)
+	fmt.Fprintf(w, "Memory:      %d bytes in %d keys\n", info.Memory, info.Keys)
+	if info.Origin != "" {
+		fmt.Fprintf(w, "Origin:      %s\n", info.Origin)
+		fmt.Fprintf(w, "Shared:      %d of %d files, %d of %d bytes (%s)\n",
+			info.SharedFiles, info.Files, info.SharedBytes, info.Bytes, percent(info.SharedBytes, info.Bytes))
+	}
+	if len(clones) > 0 {
+		fmt.Fprintf(w, "Clones:      %s\n", strings.Join(clones, ", "))
+	}
+	if len(snaps) > 0 {
+		fmt.Fprintf(w, "Snapshots:   %d\n", len(snaps))
+	}
+	return nil
+}
+
+// percent formats n as a percentage of total.
+func percent(n, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d%%", n*100/total)
+}
+
+func (r *Router) volSnapshot(ctx context.Context, args []string) error {
+	const usage = "vol snapshot: usage: vol snapshot create [name]|list|delete <name>|restore <name>"
+	if len(args) == 0 {
+		return fmt.Errorf(usage)
+	}
+
+	subcmd := strings.ToLower(args[0])
+	subargs := args[1:]
+
+	switch subcmd {
+	case "create":
+		if len(subargs) > 1 {
+			return fmt.Errorf(usage)
+		}
+		name := ""
+		if len(subargs) == 1 {
+			name = subargs[0]
+		}
+		snap, err := r.Client.CreateSnapshot(ctx, name)
+		if err != nil {
+			return err
+		}
+		if r.Formatter.JSON {
+			return r.Formatter.PrintJSON(snapshotJSON(*snap))
+		}
+		r.Formatter.Printf("Snapshot '%s' created\n", snap.Volume)
+		return nil
+	case "list", "ls":
+		return r.volSnapshotList(ctx)
+	case "delete", "rm":
+		if len(subargs) != 1 {
+			return fmt.Errorf("vol snapshot delete: missing snapshot name")
+		}
+		if err := r.Client.DeleteSnapshot(ctx, subargs[0]); err != nil {
+			return err
+		}
+		r.Formatter.Printf("Snapshot '%s' deleted\n", subargs[0])
+		return nil
+	case "restore":
+		if len(subargs) != 1 {
+			return fmt.Errorf("vol snapshot restore: missing snapshot name")
+		}
+		if err := r.Client.RestoreSnapshot(ctx, subargs[0]); err != nil {
+			return err
+		}
+		// The working directory may be gone
+		if _, err := r.Client.Stat(ctx, r.State.Cwd); err != nil {
+			r.State.Cwd = "/"
+			r.State.PrevDir = ""
+		}
+		r.Formatter.Printf("Volume '%s' restored from snapshot '%s'\n", r.State.Volume, subargs[0])
+		return nil
+	default:
+		return fmt.Errorf("vol snapshot: unknown subcommand '%s'", subcmd)
+	}
+}
+
+func (r *Router) volSnapshotList(ctx context.Context) error {
+	snaps, err := r.Client.Snapshots(ctx)
+	if err != nil {
+		return err
+	}
+
 	if r.Formatter.JSON {
-		return r.Formatter.PrintJSON(map[string]string{
-			"volume": r.State.Volume,
-			"cwd":    r.State.Cwd,
-		})
+		result := []map[string]interface{}{}
+		for _, s := range snaps {
+			result = append(result, snapshotJSON(s))
+		}
+		return r.Formatter.PrintJSON(result)
 	}
 
-	r.Formatter.Printf("Volume: %s\n", r.State.Volume)
-	r.Formatter.Printf("CWD:    %s\n", r.State.Cwd)
+	for _, s := range snaps {
+		marker := "  "
+		if s.Volume == r.State.Volume {
+			marker = "* "
+		}
+		fmt.Fprintf(r.Formatter.Writer, "%s%s\t%s\t%s\n", marker, s.Name, fs.FormatTime(s.Created), s.Volume)
+	}
 	return nil
 }
+
+func snapshotJSON(s fs.Snapshot) map[string]interface{} {
+	return map[string]interface{}{
+		"name":    s.Name,
+		"volume":  s.Volume,
+		"created": s.Created,
+	}
+}
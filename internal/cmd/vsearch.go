@@ -22,12 +22,13 @@ func (r *Router) handleVectorSearch(ctx context.Context, args []string) error {
 	fset := flag.NewFlagSet("vector-search", flag.ContinueOnError)
 	topK := fset.Int("top", 10, "Number of results to return")
 	textFilter := fset.String("filter", "", "Full-text filter to narrow results")
+	tags := fset.StringArray("tag", nil, "Only match files with this tag (repeatable)")
 	if err := fset.Parse(args); err != nil {
 		return err
 	}
 
 	if fset.NArg() < 1 {
-		return fmt.Errorf("vector-search: usage: vector-search [--top N] [--filter text] \"query\" [path]")
+		return fmt.Errorf("vector-search: usage: vector-search [--top N] [--filter text] [--tag tag]... \"query\" [path]")
 	}
 
 	query := fset.Arg(0)
@@ -37,7 +38,7 @@ func (r *Router) handleVectorSearch(ctx context.Context, args []string) error {
 	}
 
 	// Check index exists
-	mgr := search.NewIndexManager(r.Client.Redis(), r.State.Volume)
+	mgr := r.indexManager()
 	exists, err := mgr.IndexExists(ctx)
 	if err != nil {
 		return err
@@ -65,6 +66,7 @@ func (r *Router) handleVectorSearch(ctx context.Context, args []string) error {
 		QueryVector: queryVec,
 		TextFilter:  *textFilter,
 		DirFilter:   dirFilter,
+		Tags:        *tags,
 		TopK:        *topK,
 	}
 
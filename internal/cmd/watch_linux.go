@@ -0,0 +1,57 @@
+//go:build linux
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+const watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE |
+	syscall.IN_ATTRIB | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// watcher signals changes in the directories it watches, through inotify.
+// Events are coalesced: a receive from changes means something changed
+// since the last one. changes is closed when watching fails.
+type watcher struct {
+	fd      int
+	f       *os.File
+	changes chan struct{}
+}
+
+func newWatcher() (*watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	// Non-blocking, so reads go through the poller and Close ends them
+	w := &watcher{fd: fd, f: os.NewFile(uintptr(fd), "inotify"), changes: make(chan struct{}, 1)}
+	go w.read()
+	return w, nil
+}
+
+// add watches the directory dir; adding it again is harmless.
+func (w *watcher) add(dir string) error {
+	if _, err := syscall.InotifyAddWatch(w.fd, dir, watchMask); err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	return nil
+}
+
+func (w *watcher) read() {
+	defer close(w.changes)
+	buf := make([]byte, 64*1024)
+	for {
+		if _, err := w.f.Read(buf); err != nil {
+			return
+		}
+		select {
+		case w.changes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *watcher) Close() error {
+	return w.f.Close()
+}
@@ -0,0 +1,45 @@
+//go:build !linux
+
+package cmd
+
+import "time"
+
+// watchPoll is how often sync --watch rescans where inotify is not
+// available.
+const watchPoll = 2 * time.Second
+
+// watcher signals a possible change every watchPoll, for a rescan; see
+// watch_linux.go for the inotify watcher.
+type watcher struct {
+	ticker  *time.Ticker
+	done    chan struct{}
+	changes chan struct{}
+}
+
+func newWatcher() (*watcher, error) {
+	w := &watcher{ticker: time.NewTicker(watchPoll), done: make(chan struct{}), changes: make(chan struct{}, 1)}
+	go func() {
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-w.ticker.C:
+				select {
+				case w.changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return w, nil
+}
+
+func (w *watcher) add(dir string) error {
+	return nil
+}
+
+func (w *watcher) Close() error {
+	w.ticker.Stop()
+	close(w.done)
+	return nil
+}
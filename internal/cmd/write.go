@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+func (r *Router) handleWrite(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("write", flag.ContinueOnError)
+	offset := fset.Int64P("offset", "o", 0, "Byte offset to write at")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() < 2 {
+		return fmt.Errorf("write: usage: write [--offset N] path data...")
+	}
+
+	path := r.ResolvePath(fset.Arg(0))
+	data := strings.Join(fset.Args()[1:], " ")
+	return r.Client.WriteAt(ctx, path, *offset, data)
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	flag "github.com/spf13/pflag"
+)
+
+func (r *Router) handleGetfattr(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("getfattr", flag.ContinueOnError)
+	name := fset.StringP("name", "n", "", "Print only the named attribute")
+	fset.BoolP("dump", "d", false, "Print all attributes (the default)")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() == 0 {
+		return fmt.Errorf("getfattr: usage: getfattr [-d] [-n name] path...")
+	}
+
+	result := make(map[string]map[string]string)
+	for _, arg := range fset.Args() {
+		path := r.ResolvePath(arg)
+		var attrs map[string]string
+		if *name != "" {
+			value, err := r.Reader.GetXattr(ctx, path, *name)
+			if err != nil {
+				return err
+			}
+			attrs = map[string]string{*name: value}
+		} else {
+			var err error
+			if attrs, err = r.Reader.ListXattr(ctx, path); err != nil {
+				return err
+			}
+		}
+
+		if r.Formatter.JSON {
+			result[path] = attrs
+			continue
+		}
+		if len(attrs) == 0 {
+			continue
+		}
+		// Same layout as getfattr(1)
+		fmt.Fprintf(r.Formatter.Writer, "# file: %s\n", path)
+		for _, n := range sortedKeys(attrs) {
+			fmt.Fprintf(r.Formatter.Writer, "%s=%s\n", n, strconv.Quote(attrs[n]))
+		}
+		fmt.Fprintln(r.Formatter.Writer)
+	}
+
+	if r.Formatter.JSON {
+		return r.Formatter.PrintJSON(result)
+	}
+	return nil
+}
+
+func (r *Router) handleSetfattr(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("setfattr", flag.ContinueOnError)
+	name := fset.StringP("name", "n", "", "Attribute to set")
+	value := fset.StringP("value", "v", "", "Value to set")
+	remove := fset.StringP("remove", "x", "", "Attribute to remove")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() == 0 || (*name == "") == (*remove == "") {
+		return fmt.Errorf("setfattr: usage: setfattr -n name [-v value] path... | setfattr -x name path...")
+	}
+
+	for _, arg := range fset.Args() {
+		path := r.ResolvePath(arg)
+		var err error
+		if *remove != "" {
+			err = r.Client.RemoveXattr(ctx, path, *remove)
+		} else {
+			err = r.Client.SetXattr(ctx, path, *name, *value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Router) handleListxattr(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("listxattr: usage: listxattr path")
+	}
+	attrs, err := r.Reader.ListXattr(ctx, r.ResolvePath(args[0]))
+	if err != nil {
+		return err
+	}
+
+	names := sortedKeys(attrs)
+	if r.Formatter.JSON {
+		if names == nil {
+			names = []string{}
+		}
+		return r.Formatter.PrintJSON(names)
+	}
+	for _, n := range names {
+		fmt.Fprintln(r.Formatter.Writer, n)
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,10 +1,13 @@
 package config
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/redis/go-redis/v9"
 	flag "github.com/spf13/pflag"
@@ -19,20 +22,36 @@ type Config struct {
 	DB       int
 	URI      string
 
+	Cluster  bool // connect to a Redis Cluster; Host/Port/URI is a seed node
+	HashTags bool // use fs:{vol}: keys so a volume lives in one cluster slot
+
+	SentinelMaster   string   // master name; enables Sentinel mode
+	SentinelAddrs    []string // sentinel host:port list
+	SentinelUsername string
+	SentinelPassword string
+	ReplicaReads     bool // route read-only commands to replicas
+
 	TLS    bool
 	CACert string
 	Cert   string
 	Key    string
 
-	Volume  string
-	JSON    bool
-	NoColor bool
-	Color   bool
+	Volume    string
+	ChunkSize int64  // files larger than this are stored in chunks; 0 disables
+	UID       int    // session user for permission checks; 0 is root
+	GID       int    // session group; -1 means the same as UID
+	Umask     string // octal bits cleared from the mode of new entries
+	JSON      bool
+	NoColor   bool
+	Color     bool
+
+	Events       bool  // publish mutations to fs:<vol>:events
+	EventsMaxLen int64 // about how many events the stream keeps
 
 	HistoryFile string
 
 	// Search / indexing
-	SearchAvailable bool   // set at startup, not a flag
+	SearchAvailable bool // set at startup, not a flag
 	EmbeddingAPIKey string
 	EmbeddingAPIURL string
 	EmbeddingModel  string
@@ -59,6 +78,7 @@ func DefaultConfig() *Config {
 	if env := os.Getenv("REDISCLI_AUTH"); env != "" {
 		password = env
 	}
+	sentinelPassword := os.Getenv("REDIS_SENTINEL_PASSWORD")
 
 	embeddingKey := os.Getenv("EMBEDDING_API_KEY")
 	embeddingURL := os.Getenv("EMBEDDING_API_URL")
@@ -77,16 +97,21 @@ func DefaultConfig() *Config {
 	}
 
 	return &Config{
-		Host:            "127.0.0.1",
-		Port:            6379,
-		DB:              0,
-		Password:        password,
-		Volume:          volume,
-		HistoryFile:     histFile,
-		EmbeddingAPIKey: embeddingKey,
-		EmbeddingAPIURL: embeddingURL,
-		EmbeddingModel:  embeddingModel,
-		EmbeddingDim:    embeddingDim,
+		Host:             "127.0.0.1",
+		Port:             6379,
+		DB:               0,
+		Password:         password,
+		SentinelPassword: sentinelPassword,
+		Volume:           volume,
+		ChunkSize:        1 << 20,
+		GID:              -1,
+		Umask:            "0022",
+		EventsMaxLen:     10000,
+		HistoryFile:      histFile,
+		EmbeddingAPIKey:  embeddingKey,
+		EmbeddingAPIURL:  embeddingURL,
+		EmbeddingModel:   embeddingModel,
+		EmbeddingDim:     embeddingDim,
 	}
 }
 
@@ -98,6 +123,13 @@ func (c *Config) RegisterFlags(fs *flag.FlagSet) {
 	fs.StringVarP(&c.Password, "password", "a", c.Password, "Password")
 	fs.IntVarP(&c.DB, "db", "n", c.DB, "Database number")
 	fs.StringVarP(&c.URI, "uri", "u", c.URI, "Server URI (redis://...)")
+	fs.BoolVarP(&c.Cluster, "cluster", "c", false, "Connect to a Redis Cluster (implies --hash-tags)")
+	fs.BoolVar(&c.HashTags, "hash-tags", false, "Use hash-tagged keys (fs:{vol}:...)")
+	fs.StringVar(&c.SentinelMaster, "sentinel-master", "", "Sentinel master name")
+	fs.StringSliceVar(&c.SentinelAddrs, "sentinel-addr", nil, "Sentinel address host:port (repeatable)")
+	fs.StringVar(&c.SentinelUsername, "sentinel-user", "", "Sentinel ACL username")
+	fs.StringVar(&c.SentinelPassword, "sentinel-password", c.SentinelPassword, "Sentinel password")
+	fs.BoolVar(&c.ReplicaReads, "replica-reads", false, "Serve ls, cat, find, tree, stat and grep from replicas")
 
 	fs.BoolVar(&c.TLS, "tls", false, "Enable TLS")
 	fs.StringVar(&c.CACert, "cacert", "", "CA certificate file")
@@ -108,6 +140,12 @@ func (c *Config) RegisterFlags(fs *flag.FlagSet) {
 	fs.BoolVar(&c.NoColor, "no-color", false, "Disable colors")
 	fs.BoolVar(&c.Color, "color", false, "Force colors")
 	fs.StringVar(&c.Volume, "volume", c.Volume, "Filesystem volume name")
+	fs.Int64Var(&c.ChunkSize, "chunk-size", c.ChunkSize, "Store files larger than this many bytes in chunks of this size (0 disables)")
+	fs.IntVar(&c.UID, "uid", c.UID, "User id for permission checks (0 is root)")
+	fs.IntVar(&c.GID, "gid", c.GID, "Group id for permission checks (default: same as --uid)")
+	fs.StringVar(&c.Umask, "umask", c.Umask, "Octal umask for new files and directories")
+	fs.BoolVar(&c.Events, "events", false, "Publish changes to the volume's stream fs:<vol>:events")
+	fs.Int64Var(&c.EventsMaxLen, "events-maxlen", c.EventsMaxLen, "Approximate number of events the stream keeps")
 
 	fs.StringVar(&c.EmbeddingAPIKey, "embedding-api-key", c.EmbeddingAPIKey, "API key for embedding model")
 	fs.StringVar(&c.EmbeddingAPIURL, "embedding-api-url", c.EmbeddingAPIURL, "Base URL for embedding API")
@@ -148,10 +186,155 @@ func (c *Config) RedisOptions() *redis.Options {
 	return opts
 }
 
+// ClusterOptions builds go-redis ClusterOptions, using the configured
+// server as the seed node.
+func (c *Config) ClusterOptions() *redis.ClusterOptions {
+	opts := c.RedisOptions()
+	return &redis.ClusterOptions{
+		Addrs:     []string{opts.Addr},
+		Username:  opts.Username,
+		Password:  opts.Password,
+		TLSConfig: opts.TLSConfig,
+	}
+}
+
+// FailoverOptions builds go-redis FailoverOptions for Sentinel mode. The
+// master's password, DB and TLS settings come from the regular flags.
+func (c *Config) FailoverOptions() *redis.FailoverOptions {
+	opts := c.RedisOptions()
+	return &redis.FailoverOptions{
+		MasterName:       c.SentinelMaster,
+		SentinelAddrs:    c.SentinelAddrs,
+		SentinelUsername: c.SentinelUsername,
+		SentinelPassword: c.SentinelPassword,
+		Username:         opts.Username,
+		Password:         opts.Password,
+		DB:               opts.DB,
+		TLSConfig:        opts.TLSConfig,
+	}
+}
+
+// NewRedisClient connects using the configured topology.
+func (c *Config) NewRedisClient() (redis.UniversalClient, error) {
+	if err := c.validateTopology(); err != nil {
+		return nil, err
+	}
+	if c.Cluster {
+		return redis.NewClusterClient(c.ClusterOptions()), nil
+	}
+	if c.SentinelMaster != "" {
+		return redis.NewFailoverClient(c.FailoverOptions()), nil
+	}
+	return redis.NewClient(c.RedisOptions()), nil
+}
+
+// ServerClient connects to the server of a redis:// or rediss:// URL with
+// the topology of the session: under --cluster, the server is taken for a
+// seed node of another cluster.
+func (c *Config) ServerClient(uri string) (redis.UniversalClient, error) {
+	opts, err := redis.ParseURL(uri)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Cluster {
+		return redis.NewClient(opts), nil
+	}
+	if opts.DB != 0 {
+		return nil, fmt.Errorf("a database number is not supported with --cluster")
+	}
+	return redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs:     []string{opts.Addr},
+		Username:  opts.Username,
+		Password:  opts.Password,
+		TLSConfig: opts.TLSConfig,
+	}), nil
+}
+
+// NewReplicaClient connects a client that serves commands from replicas.
+// Only meaningful with --replica-reads under Sentinel or Cluster.
+func (c *Config) NewReplicaClient() (redis.UniversalClient, error) {
+	if err := c.validateTopology(); err != nil {
+		return nil, err
+	}
+	if c.Cluster {
+		opts := c.ClusterOptions()
+		opts.ReadOnly = true
+		return redis.NewClusterClient(opts), nil
+	}
+	if c.SentinelMaster != "" {
+		opts := c.FailoverOptions()
+		opts.ReplicaOnly = true
+		return redis.NewFailoverClient(opts), nil
+	}
+	return nil, fmt.Errorf("--replica-reads requires --sentinel-master or --cluster")
+}
+
+func (c *Config) validateTopology() error {
+	if c.Cluster && c.SentinelMaster != "" {
+		return fmt.Errorf("--cluster and --sentinel-master are mutually exclusive")
+	}
+	if c.Cluster && c.DB != 0 {
+		return fmt.Errorf("--db is not supported with --cluster")
+	}
+	if c.SentinelMaster != "" && len(c.SentinelAddrs) == 0 {
+		return fmt.Errorf("--sentinel-master requires at least one --sentinel-addr")
+	}
+	return nil
+}
+
+// MasterAddr asks the sentinels for the current master address. The
+// sentinels are reached with the sentinel credentials and, as in
+// FailoverOptions, the TLS settings of the master.
+func (c *Config) MasterAddr(ctx context.Context) (string, error) {
+	tlsConfig := c.RedisOptions().TLSConfig
+	var lastErr error
+	for _, addr := range c.SentinelAddrs {
+		sentinel := redis.NewSentinelClient(&redis.Options{
+			Addr:      addr,
+			Username:  c.SentinelUsername,
+			Password:  c.SentinelPassword,
+			TLSConfig: tlsConfig,
+		})
+		hostPort, err := sentinel.GetMasterAddrByName(ctx, c.SentinelMaster).Result()
+		sentinel.Close()
+		if err == nil && len(hostPort) == 2 {
+			return net.JoinHostPort(hostPort[0], hostPort[1]), nil
+		}
+		lastErr = err
+	}
+	return "", fmt.Errorf("sentinel: cannot resolve master '%s': %v", c.SentinelMaster, lastErr)
+}
+
+// UseHashTags reports whether keys should carry a per-volume hash tag.
+// Always true on a cluster, where a volume's keys must share a slot.
+func (c *Config) UseHashTags() bool {
+	return c.HashTags || c.Cluster
+}
+
+// Owner returns the session uid and gid, defaulting the gid to the uid.
+func (c *Config) Owner() (uid, gid int) {
+	if c.GID < 0 {
+		return c.UID, c.UID
+	}
+	return c.UID, c.GID
+}
+
 // RedisCLIArgs returns the connection arguments to pass to redis-cli for passthrough.
-func (c *Config) RedisCLIArgs() []string {
+// Under Sentinel the current master is looked up on every call, so
+// passthrough follows failovers.
+func (c *Config) RedisCLIArgs(ctx context.Context) ([]string, error) {
 	var args []string
-	if c.URI != "" {
+	if c.Cluster {
+		args = append(args, "-c")
+	}
+	if c.SentinelMaster != "" {
+		addr, err := c.MasterAddr(ctx)
+		if err != nil {
+			return nil, err
+		}
+		host, port, _ := net.SplitHostPort(addr)
+		args = append(args, "-h", host, "-p", port)
+	} else if c.URI != "" {
 		args = append(args, "-u", c.URI)
 	} else {
 		if c.Socket != "" {
@@ -183,11 +366,14 @@ func (c *Config) RedisCLIArgs() []string {
 			args = append(args, "--key", c.Key)
 		}
 	}
-	return args
+	return args, nil
 }
 
 // Addr returns a display-friendly connection address.
 func (c *Config) Addr() string {
+	if c.SentinelMaster != "" {
+		return fmt.Sprintf("%s (sentinel %s)", c.SentinelMaster, strings.Join(c.SentinelAddrs, ","))
+	}
 	if c.Socket != "" {
 		return c.Socket
 	}
@@ -0,0 +1,139 @@
+// Package events publishes filesystem mutations to a Redis stream per
+// volume, so other services can follow the changes.
+package events
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rowantrollope/redis-fs-cli/internal/fs"
+)
+
+// DefaultMaxLen is the default number of events a volume's stream keeps.
+const DefaultMaxLen = 10000
+
+// Stream appends an entry to the stream fs:<volume>:events for every
+// mutation it is notified of. Each entry has the fields
+//
+//	op     write, remove, move, mkdir, rmdir, symlink, link, chmod, chown
+//	       or tags
+//	path   the path changed; for a move, the new path
+//	actor  uid:gid of the user who made the change
+//	time   milliseconds since the epoch
+//
+// and, depending on op, size (write), from (move), target (symlink; for
+// link, the existing path), mode (chmod), uid and gid (chown) or tags
+// (tags, comma-separated). The stream is capped at about maxLen entries,
+// trimmed the approximate way, which is cheaper. It implements
+// fs.FileObserver, fs.TagObserver, fs.VolumeObserver and
+// fs.IdentityObserver.
+type Stream struct {
+	rdb    redis.UniversalClient
+	keys   *fs.KeyGen
+	maxLen int64
+	actor  string
+}
+
+// NewStream creates a Stream for the given volume.
+func NewStream(rdb redis.UniversalClient, volume string) *Stream {
+	return &Stream{
+		rdb:    rdb,
+		keys:   fs.NewKeyGen(volume),
+		maxLen: DefaultMaxLen,
+		actor:  "0:0",
+	}
+}
+
+// SetVolume switches the stream to another volume's.
+func (s *Stream) SetVolume(volume string) {
+	s.keys = &fs.KeyGen{Volume: volume, HashTag: s.keys.HashTag}
+}
+
+// SetHashTags switches the stream key to the cluster hash tag layout.
+func (s *Stream) SetHashTags(enabled bool) {
+	s.keys = &fs.KeyGen{Volume: s.keys.Volume, HashTag: enabled}
+}
+
+// SetMaxLen sets about how many events the stream keeps; zero or less
+// keeps DefaultMaxLen.
+func (s *Stream) SetMaxLen(n int64) {
+	if n <= 0 {
+		n = DefaultMaxLen
+	}
+	s.maxLen = n
+}
+
+// SetIdentity sets the user recorded as the actor of later events.
+func (s *Stream) SetIdentity(id fs.Identity) {
+	s.actor = strconv.Itoa(id.UID) + ":" + strconv.Itoa(id.GID)
+}
+
+// Key returns the stream key of the current volume.
+func (s *Stream) Key() string {
+	return s.keys.Events()
+}
+
+func (s *Stream) OnFileWrite(ctx context.Context, path, content string) error {
+	return s.add(ctx, "write", path, "size", strconv.Itoa(len(content)))
+}
+
+func (s *Stream) OnChunkedWrite(ctx context.Context, path string, size int64) error {
+	return s.add(ctx, "write", path, "size", strconv.FormatInt(size, 10))
+}
+
+func (s *Stream) OnFileRemove(ctx context.Context, path string) error {
+	return s.add(ctx, "remove", path)
+}
+
+func (s *Stream) OnFileMove(ctx context.Context, oldPath, newPath string) error {
+	return s.add(ctx, "move", newPath, "from", oldPath)
+}
+
+func (s *Stream) OnMkdir(ctx context.Context, path string) error {
+	return s.add(ctx, "mkdir", path)
+}
+
+func (s *Stream) OnRmdir(ctx context.Context, path string) error {
+	return s.add(ctx, "rmdir", path)
+}
+
+func (s *Stream) OnSymlink(ctx context.Context, path, target string) error {
+	return s.add(ctx, "symlink", path, "target", target)
+}
+
+func (s *Stream) OnLink(ctx context.Context, oldPath, newPath string) error {
+	return s.add(ctx, "link", newPath, "target", oldPath)
+}
+
+func (s *Stream) OnChmod(ctx context.Context, path, mode string) error {
+	return s.add(ctx, "chmod", path, "mode", mode)
+}
+
+func (s *Stream) OnChown(ctx context.Context, path, uid, gid string) error {
+	return s.add(ctx, "chown", path, "uid", uid, "gid", gid)
+}
+
+func (s *Stream) OnTagsChange(ctx context.Context, path string, tags []string) error {
+	return s.add(ctx, "tags", path, "tags", strings.Join(tags, ","))
+}
+
+// add appends an event with the common fields and extra, a list of field
+// names and values.
+func (s *Stream) add(ctx context.Context, op, path string, extra ...string) error {
+	return s.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.Key(),
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: Fields(op, path, s.actor, time.Now(), extra...),
+	}).Err()
+}
+
+// Fields returns the field names and values of an event, in stream order.
+func Fields(op, path, actor string, at time.Time, extra ...string) []string {
+	fields := []string{"op", op, "path", path}
+	fields = append(fields, extra...)
+	return append(fields, "actor", actor, "time", strconv.FormatInt(at.UnixMilli(), 10))
+}
@@ -0,0 +1,133 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rowantrollope/redis-fs-cli/internal/fs"
+)
+
+func TestFields(t *testing.T) {
+	at := time.UnixMilli(1700000000123)
+	got := Fields("move", "/b", "5:6", at, "from", "/a")
+	want := []string{"op", "move", "path", "/b", "from", "/a", "actor", "5:6", "time", "1700000000123"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Fields = %q, want %q", got, want)
+	}
+}
+
+func TestStreamKey(t *testing.T) {
+	s := NewStream(nil, "main")
+	if got := s.Key(); got != "fs:main:events" {
+		t.Errorf("Key = %q", got)
+	}
+	s.SetHashTags(true)
+	s.SetVolume("work")
+	if got := s.Key(); got != "fs:{work}:events" {
+		t.Errorf("Key after switch = %q", got)
+	}
+	s.SetIdentity(fs.Identity{UID: 1000, GID: 100})
+	if s.actor != "1000:100" {
+		t.Errorf("actor = %q", s.actor)
+	}
+}
+
+// recorder is a go-redis hook that records the arguments of every command
+// instead of sending it, answering XADD with an entry id.
+type recorder struct {
+	cmds [][]string
+}
+
+func (r *recorder) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (r *recorder) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		var args []string
+		for _, arg := range cmd.Args() {
+			args = append(args, fmt.Sprint(arg))
+		}
+		r.cmds = append(r.cmds, args)
+		if c, ok := cmd.(*redis.StringCmd); ok {
+			c.SetVal("1-0")
+		}
+		return nil
+	}
+}
+
+func (r *recorder) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+// newRecordedStream returns a Stream for volume main on a client that
+// records its commands.
+func newRecordedStream() (*Stream, *recorder) {
+	rec := &recorder{}
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:0"})
+	rdb.AddHook(rec)
+	return NewStream(rdb, "main"), rec
+}
+
+func TestStreamObserver(t *testing.T) {
+	ctx := context.Background()
+	c := fs.NewClientWithBackend(fs.NewMemoryBackend(), "main")
+	if err := c.Init(ctx); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	c.SetChunkSize(4)
+	stream, rec := newRecordedStream()
+	stream.SetMaxLen(500)
+	c.AddObserver(stream)
+	c.SetIdentity(fs.Identity{UID: 0, GID: 0})
+
+	c.Mkdir(ctx, "/d", false)
+	c.WriteFile(ctx, "/d/big", "0123456789")
+	c.Chmod(ctx, "/d/big", "600")
+	c.Chown(ctx, "/d/big", "7:8")
+	c.Symlink(ctx, "big", "/d/sym")
+	c.Link(ctx, "/d/big", "/d/hard")
+	c.Remove(ctx, "/d/sym")
+	c.Remove(ctx, "/d/hard")
+	c.Remove(ctx, "/d/big")
+	c.Rmdir(ctx, "/d")
+
+	want := [][]string{
+		{"mkdir", "/d"},
+		{"write", "/d/big", "size", "10"},
+		{"chmod", "/d/big", "mode", "600"},
+		{"chown", "/d/big", "uid", "7", "gid", "8"},
+		{"symlink", "/d/sym", "target", "big"},
+		{"link", "/d/hard", "target", "/d/big"},
+		{"remove", "/d/sym"},
+		{"remove", "/d/hard"},
+		{"remove", "/d/big"},
+		{"rmdir", "/d"},
+	}
+	if len(rec.cmds) != len(want) {
+		t.Fatalf("sent %d commands, want %d: %q", len(rec.cmds), len(want), rec.cmds)
+	}
+	for i, args := range rec.cmds {
+		// xadd key maxlen ~ n * field value ...
+		head := []string{"xadd", "fs:main:events", "maxlen", "~", "500", "*"}
+		if len(args) < len(head) || !slices.Equal(args[:len(head)], head) {
+			t.Errorf("command %d = %q, want it to start with %q", i, args, head)
+			continue
+		}
+		fields := args[len(head):]
+		got := []string{fields[1], fields[3]}
+		for j := 4; j+1 < len(fields) && fields[j] != "actor"; j += 2 {
+			got = append(got, fields[j], fields[j+1])
+		}
+		if !slices.Equal(got, want[i]) {
+			t.Errorf("event %d = %q, want %q", i, got, want[i])
+		}
+		if !slices.Contains(fields, "actor") {
+			t.Errorf("event %d = %q, want an actor", i, fields)
+		}
+	}
+}
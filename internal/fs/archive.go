@@ -0,0 +1,699 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Archives carry each entry's type, mode, owner, times, extended attributes
+// and tags. Tar archives use the PAX format: extended attributes are
+// SCHILY.xattr.<name> records, as written by GNU tar and bsdtar, and tags a
+// REDISFS.tags record. Zip archives keep the owner in an Info-ZIP Unix extra
+// field, and the extended attributes and tags, as JSON, in an extra field of
+// their own. Hard links are stored as links in tar archives and as copies in
+// zip archives.
+
+// ArchiveFormat is the format of an archive for ExportArchive and
+// ImportArchive.
+type ArchiveFormat string
+
+const (
+	FormatTar   ArchiveFormat = "tar"
+	FormatTarGz ArchiveFormat = "tar.gz"
+	FormatZip   ArchiveFormat = "zip"
+)
+
+// ParseArchiveFormat parses an archive format name; "tgz" is accepted for
+// tar.gz.
+func ParseArchiveFormat(s string) (ArchiveFormat, error) {
+	switch strings.ToLower(s) {
+	case "tar":
+		return FormatTar, nil
+	case "tar.gz", "tgz":
+		return FormatTarGz, nil
+	case "zip":
+		return FormatZip, nil
+	}
+	return "", fmt.Errorf("unknown archive format '%s' (use tar, tar.gz or zip)", s)
+}
+
+const (
+	paxXattrPrefix = "SCHILY.xattr."
+	paxTags        = "REDISFS.tags"
+
+	zipUnixExtra  = 0x7875 // Info-ZIP new Unix extra field: uid and gid
+	zipAttrsExtra = 0x7266 // extended attributes and tags, as JSON
+)
+
+// archiveEntry is an entry read from or written to an archive.
+type archiveEntry struct {
+	name     string // slash-separated, relative to the archive root
+	typ      EntryType
+	hardlink string // for a hard link, the name of the entry it links to
+	target   string // for a symlink
+	size     int64
+	mode     int64 // permission and setuid, setgid and sticky bits
+	uid, gid int
+	atime    time.Time
+	mtime    time.Time
+	xattrs   map[string]string
+	tags     []string
+}
+
+// zipAttrs is the JSON of the zipAttrsExtra field.
+type zipAttrs struct {
+	Xattrs map[string]string `json:"xattrs,omitempty"`
+	Tags   []string          `json:"tags,omitempty"`
+}
+
+// --- Export ---
+
+// archiveWriter writes entries in one archive format. create returns the
+// writer the content of a regular file goes to.
+type archiveWriter interface {
+	create(e *archiveEntry) (io.Writer, error)
+	Close() error
+}
+
+// ExportArchive writes root and everything below it to w as an archive.
+// Entries are named relative to the parent of root, so the archive of
+// /docs holds docs/ and docs/...; that of / holds the entries of the root.
+// Reading content does not update access times.
+func (c *Client) ExportArchive(ctx context.Context, root string, w io.Writer, format ArchiveFormat) error {
+	root, err := c.canonical(ctx, root)
+	if err != nil {
+		return err
+	}
+	meta, err := c.Stat(ctx, root)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		return pathErr("export", root, ErrNotExist)
+	}
+
+	var aw archiveWriter
+	switch format {
+	case FormatTar:
+		aw = &tarWriter{tw: tar.NewWriter(w)}
+	case FormatTarGz:
+		gz := gzip.NewWriter(w)
+		aw = &tarWriter{tw: tar.NewWriter(gz), gz: gz}
+	case FormatZip:
+		aw = &zipWriter{zw: zip.NewWriter(w)}
+	default:
+		return pathErr("export", root, ErrInvalid)
+	}
+
+	x := &exporter{c: c, aw: aw, links: map[string]string{}, zip: format == FormatZip}
+	if root == "/" {
+		err = x.children(ctx, root, meta, "")
+	} else {
+		err = x.entry(ctx, root, meta, BaseName(root))
+	}
+	if cerr := aw.Close(); err == nil && cerr != nil {
+		err = pathErr("export", root, cerr)
+	}
+	return err
+}
+
+// exporter walks a tree into an archiveWriter.
+type exporter struct {
+	c     *Client
+	aw    archiveWriter
+	links map[string]string // inode -> name of the first link to it
+	zip   bool
+}
+
+// entry writes the entry at p, named name in the archive, and its children.
+func (x *exporter) entry(ctx context.Context, p string, meta *Metadata, name string) error {
+	c := x.c
+	if meta.Type == TypeFile {
+		if err := c.access("export", p, meta, AccessRead); err != nil {
+			return err
+		}
+	}
+	mode, _ := strconv.ParseInt(meta.Mode, 8, 64)
+	uid, _ := strconv.Atoi(meta.UID)
+	gid, _ := strconv.Atoi(meta.GID)
+	xattrs, err := c.store.HGetAll(ctx, c.keys.Xattr(meta.Ino))
+	if err != nil {
+		return pathErr("export", p, err)
+	}
+	e := &archiveEntry{
+		name:   name,
+		typ:    meta.Type,
+		target: meta.LinkTarget,
+		size:   meta.Size,
+		mode:   mode & 07777,
+		uid:    uid,
+		gid:    gid,
+		atime:  time.Unix(meta.ATime, 0),
+		mtime:  time.Unix(meta.MTime, 0),
+		xattrs: xattrs,
+		tags:   meta.Tags,
+	}
+	if meta.Type == TypeFile && meta.Nlink > 1 && !x.zip {
+		if first, ok := x.links[meta.Ino]; ok {
+			e.hardlink = first
+		} else {
+			x.links[meta.Ino] = name
+		}
+	}
+
+	w, err := x.aw.create(e)
+	if err != nil {
+		return pathErr("export", p, err)
+	}
+	switch {
+	case meta.Type == TypeDir:
+		return x.children(ctx, p, meta, name)
+	case meta.Type == TypeFile && e.hardlink == "":
+		if _, err := c.streamContent(ctx, meta, w); err != nil {
+			return pathErr("export", p, err)
+		}
+	}
+	return nil
+}
+
+// children writes the entries of the directory dir, sorted by name.
+func (x *exporter) children(ctx context.Context, dir string, meta *Metadata, name string) error {
+	c := x.c
+	if err := c.access("export", dir, meta, AccessRead|AccessExec); err != nil {
+		return err
+	}
+	entries, err := c.readDirIno(ctx, meta.Ino)
+	if err != nil {
+		return pathErr("export", dir, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	for _, e := range entries {
+		if e.Meta == nil {
+			continue
+		}
+		if err := x.entry(ctx, JoinPath(dir, e.Name), e.Meta, path.Join(name, e.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type tarWriter struct {
+	tw *tar.Writer
+	gz *gzip.Writer // nil for an uncompressed archive
+}
+
+func (t *tarWriter) create(e *archiveEntry) (io.Writer, error) {
+	hdr := &tar.Header{
+		Name:       e.name,
+		Mode:       e.mode,
+		Uid:        e.uid,
+		Gid:        e.gid,
+		ModTime:    e.mtime,
+		AccessTime: e.atime,
+		Format:     tar.FormatPAX,
+	}
+	switch {
+	case e.typ == TypeDir:
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	case e.typ == TypeSymlink:
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = e.target
+	case e.hardlink != "":
+		hdr.Typeflag = tar.TypeLink
+		hdr.Linkname = e.hardlink
+	default:
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = e.size
+	}
+	if len(e.xattrs) > 0 || len(e.tags) > 0 {
+		hdr.PAXRecords = map[string]string{}
+		for k, v := range e.xattrs {
+			hdr.PAXRecords[paxXattrPrefix+k] = v
+		}
+		if len(e.tags) > 0 {
+			hdr.PAXRecords[paxTags] = strings.Join(e.tags, ",")
+		}
+	}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	return t.tw, nil
+}
+
+func (t *tarWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	if t.gz != nil {
+		return t.gz.Close()
+	}
+	return nil
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipWriter) create(e *archiveEntry) (io.Writer, error) {
+	fh := &zip.FileHeader{
+		Name:     e.name,
+		Method:   zip.Deflate,
+		Modified: e.mtime,
+	}
+	mode := unixMode(e.mode)
+	switch e.typ {
+	case TypeDir:
+		fh.Name += "/"
+		fh.Method = zip.Store
+		mode |= os.ModeDir
+	case TypeSymlink:
+		mode |= os.ModeSymlink
+	}
+	fh.SetMode(mode)
+
+	// Info-ZIP Unix extra field, version 1, with 4-byte ids
+	unix := []byte{1, 4, 0, 0, 0, 0, 4, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(unix[2:], uint32(e.uid))
+	binary.LittleEndian.PutUint32(unix[7:], uint32(e.gid))
+	fh.Extra = appendExtra(nil, zipUnixExtra, unix)
+	if len(e.xattrs) > 0 || len(e.tags) > 0 {
+		attrs, err := json.Marshal(zipAttrs{Xattrs: e.xattrs, Tags: e.tags})
+		if err != nil {
+			return nil, err
+		}
+		if len(attrs) > 0xffff {
+			return nil, fmt.Errorf("extended attributes of %s too large for zip", e.name)
+		}
+		fh.Extra = appendExtra(fh.Extra, zipAttrsExtra, attrs)
+	}
+
+	w, err := z.zw.CreateHeader(fh)
+	if err != nil {
+		return nil, err
+	}
+	if e.typ == TypeSymlink {
+		// Zip keeps the target as the content of the link
+		if _, err := io.WriteString(w, e.target); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (z *zipWriter) Close() error {
+	return z.zw.Close()
+}
+
+// appendExtra appends a zip extra field to extra.
+func appendExtra(extra []byte, id uint16, data []byte) []byte {
+	extra = binary.LittleEndian.AppendUint16(extra, id)
+	extra = binary.LittleEndian.AppendUint16(extra, uint16(len(data)))
+	return append(extra, data...)
+}
+
+// unixMode converts permission and setuid, setgid and sticky bits to an
+// os.FileMode.
+func unixMode(bits int64) os.FileMode {
+	mode := os.FileMode(bits) & os.ModePerm
+	if bits&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// modeBits is the inverse of unixMode.
+func modeBits(mode os.FileMode) int64 {
+	bits := int64(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return bits
+}
+
+// --- Import ---
+
+// archiveReader reads the entries of an archive in one format. next
+// returns io.EOF after the last entry; the reader it returns yields the
+// content of a regular file.
+type archiveReader interface {
+	next() (*archiveEntry, io.Reader, error)
+}
+
+// ImportArchive extracts the archive in r, of the given size, below the
+// directory root, creating it if needed. Existing files are overwritten.
+// Entries get the mode, times, extended attributes and tags the archive
+// records; their owner too when the client is root, and the client's user
+// otherwise, as with tar(1). Entries other than files, directories and
+// links are skipped, as are names that would escape root.
+func (c *Client) ImportArchive(ctx context.Context, r io.ReaderAt, size int64, root string, format ArchiveFormat) error {
+	root = NormalizePath(root)
+	var ar archiveReader
+	switch format {
+	case FormatTar:
+		ar = &tarReader{tr: tar.NewReader(io.NewSectionReader(r, 0, size))}
+	case FormatTarGz:
+		gz, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return pathErr("import", root, err)
+		}
+		defer gz.Close()
+		ar = &tarReader{tr: tar.NewReader(gz)}
+	case FormatZip:
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return pathErr("import", root, err)
+		}
+		ar = &zipReader{files: zr.File}
+	default:
+		return pathErr("import", root, ErrInvalid)
+	}
+
+	if err := c.Mkdir(ctx, root, true); err != nil {
+		return err
+	}
+	// Directory attributes are applied last, deepest first, so adding their
+	// entries does not change them
+	var dirs []*archiveEntry
+	for {
+		e, content, err := ar.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return pathErr("import", root, err)
+		}
+		name, ok := archivePath(e.name)
+		if !ok {
+			continue
+		}
+		p := JoinPath(root, name)
+		if err := c.importEntry(ctx, root, p, e, content); err != nil {
+			return err
+		}
+		if e.typ == TypeDir {
+			e.name = p
+			dirs = append(dirs, e)
+			continue
+		}
+		if err := c.restoreAttrs(ctx, p, e); err != nil {
+			return err
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := c.restoreAttrs(ctx, dirs[i].name, dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archivePath cleans an archive entry name into a path relative to the
+// extraction root. It reports false for the root itself and for names that
+// leave it.
+func archivePath(name string) (string, bool) {
+	name = strings.TrimSuffix(name, "/")
+	if name == "" || path.IsAbs(name) {
+		return "", false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+	name = path.Clean(name)
+	return name, name != "."
+}
+
+// importEntry creates the entry e at p, replacing a file or link there.
+func (c *Client) importEntry(ctx context.Context, root, p string, e *archiveEntry, content io.Reader) error {
+	if err := c.Mkdir(ctx, ParentPath(p), true); err != nil {
+		return err
+	}
+	if e.typ == TypeDir {
+		return c.Mkdir(ctx, p, true)
+	}
+
+	existing, err := c.Stat(ctx, p)
+	if err != nil {
+		return err
+	}
+	if existing != nil && (e.typ != TypeFile || e.hardlink != "" || existing.Type == TypeSymlink) {
+		if existing.Type == TypeDir {
+			return pathErr("import", p, ErrIsDir)
+		}
+		if err := c.Remove(ctx, p); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case e.typ == TypeSymlink:
+		return c.Symlink(ctx, e.target, p)
+	case e.hardlink != "":
+		name, ok := archivePath(e.hardlink)
+		if !ok {
+			return pathErr("import", p, ErrInvalid)
+		}
+		return c.Link(ctx, JoinPath(root, name), p)
+	}
+
+	f, err := c.OpenFile(ctx, p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return pathErr("import", p, err)
+	}
+	return nil
+}
+
+// restoreAttrs gives the entry at p, without following a symlink, the
+// attributes e records.
+func (c *Client) restoreAttrs(ctx context.Context, p string, e *archiveEntry) error {
+	meta, err := c.Stat(ctx, p)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		return pathErr("import", p, ErrNotExist)
+	}
+	if !c.id.owns(meta) {
+		return pathErr("import", p, ErrPermission)
+	}
+
+	fields := map[string]string{
+		"mode":  fmt.Sprintf("%04o", e.mode),
+		"atime": strconv.FormatInt(e.atime.Unix(), 10),
+		"mtime": strconv.FormatInt(e.mtime.Unix(), 10),
+	}
+	if meta.Type == TypeSymlink {
+		fields["mode"] = meta.Mode
+	}
+	if c.id.IsRoot() {
+		fields["uid"] = strconv.Itoa(e.uid)
+		fields["gid"] = strconv.Itoa(e.gid)
+	}
+	if len(e.tags) > 0 {
+		fields["tags"] = strings.Join(e.tags, ",")
+	}
+	err = c.store.Tx(ctx, func(tx Writer) {
+		tx.HSet(c.keys.Meta(meta.Ino), fields)
+		if len(e.tags) == 0 {
+			tx.HDel(c.keys.Meta(meta.Ino), "tags")
+		}
+		tx.Del(c.keys.Xattr(meta.Ino))
+		tx.HSet(c.keys.Xattr(meta.Ino), e.xattrs)
+	})
+	if err != nil {
+		return pathErr("import", p, err)
+	}
+	if len(e.tags) > 0 || len(meta.Tags) > 0 {
+		c.notifyTags(ctx, p, e.tags)
+	}
+	return nil
+}
+
+type tarReader struct {
+	tr *tar.Reader
+}
+
+func (t *tarReader) next() (*archiveEntry, io.Reader, error) {
+	for {
+		hdr, err := t.tr.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		e := &archiveEntry{
+			name:  hdr.Name,
+			size:  hdr.Size,
+			mode:  hdr.Mode & 07777,
+			uid:   hdr.Uid,
+			gid:   hdr.Gid,
+			mtime: hdr.ModTime,
+			atime: hdr.AccessTime,
+		}
+		if e.atime.IsZero() {
+			e.atime = e.mtime
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			e.typ = TypeDir
+		case tar.TypeReg, tar.TypeRegA:
+			e.typ = TypeFile
+		case tar.TypeSymlink:
+			e.typ = TypeSymlink
+			e.target = hdr.Linkname
+		case tar.TypeLink:
+			e.typ = TypeFile
+			e.hardlink = hdr.Linkname
+		default:
+			continue
+		}
+		for k, v := range hdr.PAXRecords {
+			switch {
+			case strings.HasPrefix(k, paxXattrPrefix):
+				if e.xattrs == nil {
+					e.xattrs = map[string]string{}
+				}
+				e.xattrs[strings.TrimPrefix(k, paxXattrPrefix)] = v
+			case k == paxTags && v != "":
+				e.tags = strings.Split(v, ",")
+			}
+		}
+		return e, t.tr, nil
+	}
+}
+
+type zipReader struct {
+	files []*zip.File
+	open  io.Closer // content of the previous entry
+}
+
+func (z *zipReader) next() (*archiveEntry, io.Reader, error) {
+	if z.open != nil {
+		z.open.Close()
+		z.open = nil
+	}
+	for len(z.files) > 0 {
+		f := z.files[0]
+		z.files = z.files[1:]
+		mode := f.Mode()
+		e := &archiveEntry{
+			name:  f.Name,
+			size:  int64(f.UncompressedSize64),
+			mode:  modeBits(mode),
+			mtime: f.Modified,
+			atime: f.Modified,
+		}
+		switch {
+		case mode.IsDir():
+			e.typ = TypeDir
+		case mode&os.ModeSymlink != 0:
+			e.typ = TypeSymlink
+		case mode.IsRegular():
+			e.typ = TypeFile
+		default:
+			continue
+		}
+		if err := parseZipExtra(f.Extra, e); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		if e.typ == TypeSymlink {
+			target, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+			e.target = string(target)
+			return e, nil, nil
+		}
+		z.open = rc
+		return e, rc, nil
+	}
+	return nil, nil, io.EOF
+}
+
+// parseZipExtra reads the owner, extended attributes and tags of e from
+// the extra fields of a zip entry.
+func parseZipExtra(extra []byte, e *archiveEntry) error {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		n := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+n {
+			break
+		}
+		data := extra[4 : 4+n]
+		extra = extra[4+n:]
+		switch id {
+		case zipUnixExtra:
+			if len(data) < 2 || data[0] != 1 {
+				continue
+			}
+			uid, rest, ok := zipUnixID(data[1:])
+			if !ok {
+				continue
+			}
+			gid, _, ok := zipUnixID(rest)
+			if !ok {
+				continue
+			}
+			e.uid, e.gid = uid, gid
+		case zipAttrsExtra:
+			var attrs zipAttrs
+			if err := json.Unmarshal(data, &attrs); err != nil {
+				return err
+			}
+			e.xattrs, e.tags = attrs.Xattrs, attrs.Tags
+		}
+	}
+	return nil
+}
+
+// zipUnixID reads a size-prefixed little-endian id of the Info-ZIP Unix
+// extra field.
+func zipUnixID(data []byte) (int, []byte, bool) {
+	if len(data) < 1 || len(data) < 1+int(data[0]) || data[0] > 8 {
+		return 0, nil, false
+	}
+	n := int(data[0])
+	var id uint64
+	for i := n - 1; i >= 0; i-- {
+		id = id<<8 | uint64(data[1+i])
+	}
+	return int(id), data[1+n:], true
+}
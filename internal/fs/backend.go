@@ -0,0 +1,83 @@
+package fs
+
+import (
+	"context"
+)
+
+// Backend is the key-value store a Client keeps its volumes in. It models
+// the subset of Redis the filesystem needs: string keys holding strings or
+// string-to-string hashes, addressed by the names KeyGen produces.
+//
+// Reads of a missing key or field return the zero value rather than an
+// error. Call runs one of the filesystem primitives of the functions
+// library (fs_link, fs_hardlink, fs_write, fs_unlink, fs_rename) atomically, reporting
+// failures as *Errno; fs_if runs one of them only while a hash field holds
+// a given value, as TxIf does for transactions.
+type Backend interface {
+	Get(ctx context.Context, key string) (string, error)
+	// GetRange returns the bytes [start, end] of a string, as GETRANGE.
+	GetRange(ctx context.Context, key string, start, end int64) (string, error)
+	HGet(ctx context.Context, key, field string) (string, error)
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	HKeys(ctx context.Context, key string) ([]string, error)
+	HLen(ctx context.Context, key string) (int64, error)
+	HExists(ctx context.Context, key, field string) (bool, error)
+	SMembers(ctx context.Context, key string) ([]string, error)
+	// Exists returns how many of keys exist.
+	Exists(ctx context.Context, keys ...string) (int64, error)
+
+	// HGetAllMulti and GetRangeMulti batch many reads into one round trip.
+	HGetAllMulti(ctx context.Context, keys []string) ([]map[string]string, error)
+	GetRangeMulti(ctx context.Context, ranges []KeyRange) ([]string, error)
+	// MemoryUsage returns how many bytes of memory keys take up, as the sum
+	// of MEMORY USAGE.
+	MemoryUsage(ctx context.Context, keys []string) (int64, error)
+
+	Set(ctx context.Context, key, value string) error
+	// Append and SetRange return the new length of the string.
+	Append(ctx context.Context, key, value string) (int64, error)
+	SetRange(ctx context.Context, key string, offset int64, value string) (int64, error)
+	HSet(ctx context.Context, key string, fields map[string]string) error
+	HSetNX(ctx context.Context, key, field, value string) (bool, error)
+	HDel(ctx context.Context, key string, fields ...string) error
+	Del(ctx context.Context, keys ...string) error
+	Incr(ctx context.Context, key string) (int64, error)
+	// Rename moves key, of any type, to newkey. It fails with ErrExist when
+	// newkey exists and with ErrNotExist when key does not.
+	Rename(ctx context.Context, key, newkey string) error
+
+	// Tx applies the writes queued by fn atomically.
+	Tx(ctx context.Context, fn func(w Writer)) error
+	// TxIf is Tx, applied only if field of the hash key still holds value,
+	// "" standing for a missing field, when the transaction runs. Otherwise
+	// nothing is written and it fails with EAGAIN.
+	TxIf(ctx context.Context, key, field, value string, fn func(w Writer)) error
+	// Pipeline applies the writes queued by fn in one round trip, without
+	// atomicity guarantees.
+	Pipeline(ctx context.Context, fn func(w Writer)) error
+
+	// Scan calls fn with each batch of keys matching a glob pattern.
+	Scan(ctx context.Context, pattern string, fn func(keys []string) error) error
+
+	// LoadFunctions installs the functions library, returning an error when
+	// Call is unavailable.
+	LoadFunctions(ctx context.Context, library string) error
+	Call(ctx context.Context, fn string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// Writer queues write commands for Backend.Tx and Backend.Pipeline.
+type Writer interface {
+	Set(key, value string)
+	SetRange(key string, offset int64, value string)
+	Append(key, value string)
+	HSet(key string, fields map[string]string)
+	HSetNX(key, field, value string)
+	HDel(key string, fields ...string)
+	Del(keys ...string)
+}
+
+// KeyRange is a byte range [Start, End] of a string key.
+type KeyRange struct {
+	Key        string
+	Start, End int64
+}
@@ -0,0 +1,630 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MemoryBackend keeps volumes in process memory. It has the same semantics
+// as RedisBackend, including atomic transactions and the functions library
+// primitives, which makes it suitable for tests and for embedding a
+// throwaway filesystem. It is safe for concurrent use.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	strings map[string]string
+	hashes  map[string]map[string]string
+	// sets only hold the directories of the legacy layout, which the
+	// backend keeps so migrations run against it too
+	sets map[string][]string
+}
+
+// NewMemoryBackend returns an empty in-memory backend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		strings: make(map[string]string),
+		hashes:  make(map[string]map[string]string),
+		sets:    make(map[string][]string),
+	}
+}
+
+var _ Backend = (*MemoryBackend)(nil)
+
+func (m *MemoryBackend) Get(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.strings[key], nil
+}
+
+func (m *MemoryBackend) GetRange(ctx context.Context, key string, start, end int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.getRange(key, start, end), nil
+}
+
+func (m *MemoryBackend) HGet(ctx context.Context, key, field string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hashes[key][field], nil
+}
+
+func (m *MemoryBackend) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hgetAll(key), nil
+}
+
+func (m *MemoryBackend) HKeys(ctx context.Context, key string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fields := make([]string, 0, len(m.hashes[key]))
+	for f := range m.hashes[key] {
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func (m *MemoryBackend) HLen(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.hashes[key])), nil
+}
+
+func (m *MemoryBackend) HExists(ctx context.Context, key, field string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.hashes[key][field]
+	return ok, nil
+}
+
+func (m *MemoryBackend) SMembers(ctx context.Context, key string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.sets[key]...), nil
+}
+
+func (m *MemoryBackend) Exists(ctx context.Context, keys ...string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, key := range keys {
+		if m.exists(key) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryBackend) HGetAllMulti(ctx context.Context, keys []string) ([]map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]map[string]string, len(keys))
+	for i, key := range keys {
+		out[i] = m.hgetAll(key)
+	}
+	return out, nil
+}
+
+func (m *MemoryBackend) GetRangeMulti(ctx context.Context, ranges []KeyRange) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]string, len(ranges))
+	for i, r := range ranges {
+		out[i] = m.getRange(r.Key, r.Start, r.End)
+	}
+	return out, nil
+}
+
+// MemoryUsage counts the bytes of the names and values of keys.
+func (m *MemoryBackend) MemoryUsage(ctx context.Context, keys []string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var total int64
+	for _, key := range keys {
+		if v, ok := m.strings[key]; ok {
+			total += int64(len(key) + len(v))
+		}
+		if h, ok := m.hashes[key]; ok {
+			total += int64(len(key))
+			for f, v := range h {
+				total += int64(len(f) + len(v))
+			}
+		}
+	}
+	return total, nil
+}
+
+func (m *MemoryBackend) Set(ctx context.Context, key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(key, value)
+	return nil
+}
+
+func (m *MemoryBackend) Append(ctx context.Context, key, value string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.append(key, value), nil
+}
+
+func (m *MemoryBackend) SetRange(ctx context.Context, key string, offset int64, value string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setRange(key, offset, value), nil
+}
+
+func (m *MemoryBackend) HSet(ctx context.Context, key string, fields map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hset(key, fields)
+	return nil
+}
+
+func (m *MemoryBackend) HSetNX(ctx context.Context, key, field, value string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hsetNX(key, field, value), nil
+}
+
+func (m *MemoryBackend) HDel(ctx context.Context, key string, fields ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hdel(key, fields...)
+	return nil
+}
+
+func (m *MemoryBackend) Del(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.del(keys...)
+	return nil
+}
+
+func (m *MemoryBackend) Incr(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := strconv.ParseInt(m.strings[key], 10, 64)
+	if err != nil && m.strings[key] != "" {
+		return 0, fmt.Errorf("ERR value is not an integer or out of range")
+	}
+	n++
+	m.set(key, strconv.FormatInt(n, 10))
+	return n, nil
+}
+
+func (m *MemoryBackend) Rename(ctx context.Context, key, newkey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.exists(key) {
+		return ErrNotExist
+	}
+	if m.exists(newkey) {
+		return ErrExist
+	}
+	if v, ok := m.strings[key]; ok {
+		m.strings[newkey] = v
+	}
+	if h, ok := m.hashes[key]; ok {
+		m.hashes[newkey] = h
+	}
+	if s, ok := m.sets[key]; ok {
+		m.sets[newkey] = s
+	}
+	m.del(key)
+	return nil
+}
+
+// Tx applies the queued writes under the backend's lock, so no reader sees
+// them half done.
+func (m *MemoryBackend) Tx(ctx context.Context, fn func(w Writer)) error {
+	var w memoryWriter
+	fn(&w)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, op := range w.ops {
+		op(m)
+	}
+	return nil
+}
+
+func (m *MemoryBackend) TxIf(ctx context.Context, key, field, value string, fn func(w Writer)) error {
+	var w memoryWriter
+	fn(&w)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.hashes[key][field] != value {
+		return errAgain
+	}
+	for _, op := range w.ops {
+		op(m)
+	}
+	return nil
+}
+
+// Pipeline is the same as Tx.
+func (m *MemoryBackend) Pipeline(ctx context.Context, fn func(w Writer)) error {
+	return m.Tx(ctx, fn)
+}
+
+// memoryWriter records writes to apply later with the lock held.
+type memoryWriter struct {
+	ops []func(m *MemoryBackend)
+}
+
+func (w *memoryWriter) Set(key, value string) {
+	w.ops = append(w.ops, func(m *MemoryBackend) { m.set(key, value) })
+}
+
+func (w *memoryWriter) SetRange(key string, offset int64, value string) {
+	w.ops = append(w.ops, func(m *MemoryBackend) { m.setRange(key, offset, value) })
+}
+
+func (w *memoryWriter) Append(key, value string) {
+	w.ops = append(w.ops, func(m *MemoryBackend) { m.append(key, value) })
+}
+
+func (w *memoryWriter) HSet(key string, fields map[string]string) {
+	w.ops = append(w.ops, func(m *MemoryBackend) { m.hset(key, fields) })
+}
+
+func (w *memoryWriter) HSetNX(key, field, value string) {
+	w.ops = append(w.ops, func(m *MemoryBackend) { m.hsetNX(key, field, value) })
+}
+
+func (w *memoryWriter) HDel(key string, fields ...string) {
+	w.ops = append(w.ops, func(m *MemoryBackend) { m.hdel(key, fields...) })
+}
+
+func (w *memoryWriter) Del(keys ...string) {
+	w.ops = append(w.ops, func(m *MemoryBackend) { m.del(keys...) })
+}
+
+// Scan calls fn once with every matching key, in sorted order.
+func (m *MemoryBackend) Scan(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	m.mu.Lock()
+	var keys []string
+	for key := range m.strings {
+		if globMatch(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range m.hashes {
+		if globMatch(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range m.sets {
+		if globMatch(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	m.mu.Unlock()
+
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+	return fn(keys)
+}
+
+// LoadFunctions always succeeds: the library's functions are built in.
+func (m *MemoryBackend) LoadFunctions(ctx context.Context, library string) error {
+	return nil
+}
+
+// Call runs a Go implementation of a functions library primitive. Keys and
+// arguments are the same as for the Lua version in redisfs.lua.
+func (m *MemoryBackend) Call(ctx context.Context, fn string, keys []string, args ...interface{}) (interface{}, error) {
+	argv := make([]string, len(args))
+	for i, a := range args {
+		argv[i] = fmt.Sprint(a)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.call(fn, keys, argv)
+}
+
+func (m *MemoryBackend) call(fn string, keys, argv []string) (interface{}, error) {
+	switch fn {
+	case "fs_if":
+		if m.hashes[keys[0]][argv[0]] != argv[1] {
+			return nil, errAgain
+		}
+		return m.call(argv[2], keys[1:], argv[3:])
+	case "fs_link":
+		return m.fsLink(keys, argv)
+	case "fs_hardlink":
+		return m.fsHardlink(keys, argv)
+	case "fs_write":
+		return m.fsWrite(keys, argv)
+	case "fs_unlink":
+		return m.fsUnlink(keys, argv)
+	case "fs_rename":
+		return m.fsRename(keys, argv)
+	}
+	return nil, fmt.Errorf("ERR Function not found")
+}
+
+// entryIs reports whether dir maps name to ino, or has no name when ino is "".
+func (m *MemoryBackend) entryIs(dirKey, name, ino string) bool {
+	cur, ok := m.hashes[dirKey][name]
+	if ino == "" {
+		return !ok
+	}
+	return ok && cur == ino
+}
+
+func (m *MemoryBackend) fsLink(keys, args []string) (interface{}, error) {
+	ptype, ok := m.hashes[keys[0]]["type"]
+	if !ok {
+		return nil, ErrNotExist
+	}
+	if ptype != string(TypeDir) {
+		return nil, ErrNotDir
+	}
+	if _, ok := m.hashes[keys[1]][args[0]]; ok {
+		return nil, ErrExist
+	}
+
+	fields := make(map[string]string)
+	for i := 3; i+1 < len(args); i += 2 {
+		fields[args[i]] = args[i+1]
+	}
+	m.hset(keys[2], fields)
+	if len(keys) > 3 {
+		m.set(keys[3], args[2])
+	}
+	m.hset(keys[1], map[string]string{args[0]: args[1]})
+	return int64(1), nil
+}
+
+// dropLink removes one link to the inode whose meta is at metaKey,
+// reporting whether other links remain.
+func (m *MemoryBackend) dropLink(metaKey string) bool {
+	n, _ := strconv.ParseInt(m.hashes[metaKey]["nlink"], 10, 64)
+	if n > 1 {
+		m.hset(metaKey, map[string]string{"nlink": strconv.FormatInt(n-1, 10)})
+		return true
+	}
+	return false
+}
+
+func (m *MemoryBackend) fsHardlink(keys, args []string) (interface{}, error) {
+	ptype, ok := m.hashes[keys[0]]["type"]
+	if !ok {
+		return nil, ErrNotExist
+	}
+	if ptype != string(TypeDir) {
+		return nil, ErrNotDir
+	}
+	if _, ok := m.hashes[keys[1]][args[0]]; ok {
+		return nil, ErrExist
+	}
+	t, ok := m.hashes[keys[2]]["type"]
+	if !ok {
+		return nil, ErrNotExist
+	}
+	if t == string(TypeDir) {
+		return nil, ErrNotPermitted
+	}
+
+	n, _ := strconv.ParseInt(m.hashes[keys[2]]["nlink"], 10, 64)
+	if n < 1 {
+		n = 1
+	}
+	m.hset(keys[2], map[string]string{"nlink": strconv.FormatInt(n+1, 10)})
+	m.hset(keys[1], map[string]string{args[0]: args[1]})
+	return n + 1, nil
+}
+
+func (m *MemoryBackend) fsWrite(keys, args []string) (interface{}, error) {
+	if !m.entryIs(keys[0], args[0], args[1]) {
+		return nil, ErrStale
+	}
+	t, ok := m.hashes[keys[1]]["type"]
+	if !ok {
+		return nil, ErrStale
+	}
+	if t == string(TypeDir) {
+		return nil, ErrIsDir
+	}
+
+	switch args[2] {
+	case "append":
+		m.append(keys[2], args[3])
+	case "range":
+		offset, _ := strconv.ParseInt(args[5], 10, 64)
+		m.setRange(keys[2], offset, args[3])
+	default:
+		m.set(keys[2], args[3])
+	}
+	size := int64(len(m.strings[keys[2]]))
+	m.hset(keys[1], map[string]string{"size": strconv.FormatInt(size, 10), "mtime": args[4]})
+	return size, nil
+}
+
+func (m *MemoryBackend) fsUnlink(keys, args []string) (interface{}, error) {
+	if !m.entryIs(keys[0], args[0], args[1]) {
+		return nil, ErrNotExist
+	}
+	t := m.hashes[keys[1]]["type"]
+	if args[2] == "dir" {
+		if t != string(TypeDir) {
+			return nil, ErrNotDir
+		}
+		if len(m.hashes[keys[3]]) > 0 {
+			return nil, ErrNotEmpty
+		}
+	} else if t == string(TypeDir) {
+		return nil, ErrIsDir
+	}
+
+	m.hdel(keys[0], args[0])
+	if t != string(TypeDir) && m.dropLink(keys[1]) {
+		return int64(0), nil
+	}
+	m.del(keys[1], keys[2], keys[3], keys[4])
+	return int64(1), nil
+}
+
+func (m *MemoryBackend) fsRename(keys, args []string) (interface{}, error) {
+	if !m.entryIs(keys[0], args[0], args[1]) {
+		return nil, ErrNotExist
+	}
+	ptype, ok := m.hashes[keys[1]]["type"]
+	if !ok {
+		return nil, ErrNotExist
+	}
+	if ptype != string(TypeDir) {
+		return nil, ErrNotDir
+	}
+	if !m.entryIs(keys[2], args[2], args[3]) {
+		if args[3] == "" {
+			return nil, ErrExist
+		}
+		return nil, ErrStale
+	}
+	if args[3] == args[1] {
+		return int64(1), nil
+	}
+
+	kept := false
+	if args[3] != "" {
+		stype := m.hashes[keys[3]]["type"]
+		dtype := m.hashes[keys[4]]["type"]
+		if dtype == string(TypeDir) {
+			if stype != string(TypeDir) {
+				return nil, ErrIsDir
+			}
+			if len(m.hashes[keys[6]]) > 0 {
+				return nil, ErrNotEmpty
+			}
+		} else if stype == string(TypeDir) {
+			return nil, ErrNotDir
+		}
+		if kept = m.dropLink(keys[4]); !kept {
+			m.del(keys[4], keys[5], keys[6], keys[7])
+		}
+	}
+
+	m.hdel(keys[0], args[0])
+	m.hset(keys[2], map[string]string{args[2]: args[1]})
+	if kept {
+		return int64(0), nil
+	}
+	return int64(1), nil
+}
+
+// The helpers below expect the lock to be held.
+
+func (m *MemoryBackend) exists(key string) bool {
+	_, isString := m.strings[key]
+	_, isHash := m.hashes[key]
+	_, isSet := m.sets[key]
+	return isString || isHash || isSet
+}
+
+func (m *MemoryBackend) set(key, value string) {
+	delete(m.hashes, key)
+	m.strings[key] = value
+}
+
+func (m *MemoryBackend) append(key, value string) int64 {
+	m.strings[key] += value
+	return int64(len(m.strings[key]))
+}
+
+// setRange overwrites value at offset, zero-padding the string as needed.
+// Like SETRANGE, an empty value never creates the key.
+func (m *MemoryBackend) setRange(key string, offset int64, value string) int64 {
+	cur, ok := m.strings[key]
+	if value == "" {
+		return int64(len(cur))
+	}
+	if !ok {
+		delete(m.hashes, key)
+	}
+	if int64(len(cur)) < offset {
+		cur += strings.Repeat("\x00", int(offset-int64(len(cur))))
+	}
+	end := offset + int64(len(value))
+	if end < int64(len(cur)) {
+		cur = cur[:offset] + value + cur[end:]
+	} else {
+		cur = cur[:offset] + value
+	}
+	m.strings[key] = cur
+	return int64(len(cur))
+}
+
+// getRange returns bytes [start, end] with GETRANGE's handling of negative
+// and out-of-range indexes.
+func (m *MemoryBackend) getRange(key string, start, end int64) string {
+	s := m.strings[key]
+	n := int64(len(s))
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if end < 0 {
+		end = n + end
+	}
+	end = min(end, n-1)
+	if start > end || start >= n {
+		return ""
+	}
+	return s[start : end+1]
+}
+
+func (m *MemoryBackend) hgetAll(key string) map[string]string {
+	out := make(map[string]string, len(m.hashes[key]))
+	for f, v := range m.hashes[key] {
+		out[f] = v
+	}
+	return out
+}
+
+func (m *MemoryBackend) hset(key string, fields map[string]string) {
+	if len(fields) == 0 {
+		return
+	}
+	h, ok := m.hashes[key]
+	if !ok {
+		delete(m.strings, key)
+		h = make(map[string]string, len(fields))
+		m.hashes[key] = h
+	}
+	for f, v := range fields {
+		h[f] = v
+	}
+}
+
+func (m *MemoryBackend) hsetNX(key, field, value string) bool {
+	if _, ok := m.hashes[key][field]; ok {
+		return false
+	}
+	m.hset(key, map[string]string{field: value})
+	return true
+}
+
+// hdel removes fields, deleting the hash once it is empty as Redis does.
+func (m *MemoryBackend) hdel(key string, fields ...string) {
+	h := m.hashes[key]
+	for _, f := range fields {
+		delete(h, f)
+	}
+	if h != nil && len(h) == 0 {
+		delete(m.hashes, key)
+	}
+}
+
+func (m *MemoryBackend) del(keys ...string) {
+	for _, key := range keys {
+		delete(m.strings, key)
+		delete(m.hashes, key)
+		delete(m.sets, key)
+	}
+}
@@ -0,0 +1,369 @@
+package fs
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisBackend stores volumes in Redis through any go-redis client:
+// standalone, Sentinel or Cluster.
+type RedisBackend struct {
+	rdb redis.UniversalClient
+}
+
+// NewRedisBackend returns a Backend that talks to rdb.
+func NewRedisBackend(rdb redis.UniversalClient) *RedisBackend {
+	return &RedisBackend{rdb: rdb}
+}
+
+// Client returns the underlying go-redis client.
+func (b *RedisBackend) Client() redis.UniversalClient {
+	return b.rdb
+}
+
+// servers returns the address and database of the server b talks to, or
+// of the seed nodes of its cluster. It returns nil when unknown, as behind
+// Sentinel, where the master changes.
+func (b *RedisBackend) servers() []string {
+	switch rdb := b.rdb.(type) {
+	case *redis.Client:
+		opts := rdb.Options()
+		if opts.Addr == "FailoverClient" {
+			return nil
+		}
+		return []string{opts.Addr + "/" + strconv.Itoa(opts.DB)}
+	case *redis.ClusterClient:
+		var servers []string
+		for _, addr := range rdb.Options().Addrs {
+			servers = append(servers, addr+"/0")
+		}
+		return servers
+	}
+	return nil
+}
+
+// sameStore reports whether a and b keep their keys in the same place:
+// they are the same Backend, or RedisBackends connected to the same server
+// and database, or to the same cluster.
+func sameStore(a, b Backend) bool {
+	if a == b {
+		return true
+	}
+	ra, ok := a.(*RedisBackend)
+	if !ok {
+		return false
+	}
+	rb, ok := b.(*RedisBackend)
+	if !ok {
+		return false
+	}
+	if ra.rdb == rb.rdb {
+		return true
+	}
+	servers := rb.servers()
+	for _, server := range ra.servers() {
+		if slices.Contains(servers, server) {
+			return true
+		}
+	}
+	return false
+}
+
+// noNil maps redis.Nil, the reply for a missing key or field, to success.
+func noNil(err error) error {
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
+
+func (b *RedisBackend) Get(ctx context.Context, key string) (string, error) {
+	v, err := b.rdb.Get(ctx, key).Result()
+	return v, noNil(err)
+}
+
+func (b *RedisBackend) GetRange(ctx context.Context, key string, start, end int64) (string, error) {
+	v, err := b.rdb.GetRange(ctx, key, start, end).Result()
+	return v, noNil(err)
+}
+
+func (b *RedisBackend) HGet(ctx context.Context, key, field string) (string, error) {
+	v, err := b.rdb.HGet(ctx, key, field).Result()
+	return v, noNil(err)
+}
+
+func (b *RedisBackend) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return b.rdb.HGetAll(ctx, key).Result()
+}
+
+func (b *RedisBackend) HKeys(ctx context.Context, key string) ([]string, error) {
+	return b.rdb.HKeys(ctx, key).Result()
+}
+
+func (b *RedisBackend) HLen(ctx context.Context, key string) (int64, error) {
+	return b.rdb.HLen(ctx, key).Result()
+}
+
+func (b *RedisBackend) HExists(ctx context.Context, key, field string) (bool, error) {
+	return b.rdb.HExists(ctx, key, field).Result()
+}
+
+func (b *RedisBackend) SMembers(ctx context.Context, key string) ([]string, error) {
+	return b.rdb.SMembers(ctx, key).Result()
+}
+
+func (b *RedisBackend) Exists(ctx context.Context, keys ...string) (int64, error) {
+	return b.rdb.Exists(ctx, keys...).Result()
+}
+
+func (b *RedisBackend) HGetAllMulti(ctx context.Context, keys []string) ([]map[string]string, error) {
+	pipe := b.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.HGetAll(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); noNil(err) != nil {
+		return nil, err
+	}
+	out := make([]map[string]string, len(keys))
+	for i, cmd := range cmds {
+		out[i] = cmd.Val()
+	}
+	return out, nil
+}
+
+func (b *RedisBackend) GetRangeMulti(ctx context.Context, ranges []KeyRange) ([]string, error) {
+	pipe := b.rdb.Pipeline()
+	cmds := make([]*redis.StringCmd, len(ranges))
+	for i, r := range ranges {
+		cmds[i] = pipe.GetRange(ctx, r.Key, r.Start, r.End)
+	}
+	if _, err := pipe.Exec(ctx); noNil(err) != nil {
+		return nil, err
+	}
+	out := make([]string, len(ranges))
+	for i, cmd := range cmds {
+		out[i] = cmd.Val()
+	}
+	return out, nil
+}
+
+func (b *RedisBackend) MemoryUsage(ctx context.Context, keys []string) (int64, error) {
+	pipe := b.rdb.Pipeline()
+	cmds := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.MemoryUsage(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); noNil(err) != nil {
+		return 0, err
+	}
+	var total int64
+	for _, cmd := range cmds {
+		total += cmd.Val()
+	}
+	return total, nil
+}
+
+func (b *RedisBackend) Set(ctx context.Context, key, value string) error {
+	return b.rdb.Set(ctx, key, value, 0).Err()
+}
+
+func (b *RedisBackend) Append(ctx context.Context, key, value string) (int64, error) {
+	return b.rdb.Append(ctx, key, value).Result()
+}
+
+func (b *RedisBackend) SetRange(ctx context.Context, key string, offset int64, value string) (int64, error) {
+	return b.rdb.SetRange(ctx, key, offset, value).Result()
+}
+
+func (b *RedisBackend) HSet(ctx context.Context, key string, fields map[string]string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return b.rdb.HSet(ctx, key, fields).Err()
+}
+
+func (b *RedisBackend) HSetNX(ctx context.Context, key, field, value string) (bool, error) {
+	return b.rdb.HSetNX(ctx, key, field, value).Result()
+}
+
+func (b *RedisBackend) HDel(ctx context.Context, key string, fields ...string) error {
+	return b.rdb.HDel(ctx, key, fields...).Err()
+}
+
+// Del removes keys one DEL per key, so keys from different cluster slots
+// can be deleted in a single call.
+func (b *RedisBackend) Del(ctx context.Context, keys ...string) error {
+	return b.Pipeline(ctx, func(w Writer) { w.Del(keys...) })
+}
+
+func (b *RedisBackend) Incr(ctx context.Context, key string) (int64, error) {
+	return b.rdb.Incr(ctx, key).Result()
+}
+
+// Rename uses RENAMENX, or DUMP and RESTORE when the keys hash to
+// different cluster slots.
+func (b *RedisBackend) Rename(ctx context.Context, key, newkey string) error {
+	ok, err := b.rdb.RenameNX(ctx, key, newkey).Result()
+	switch {
+	case err != nil && strings.Contains(err.Error(), "no such key"):
+		return ErrNotExist
+	case err != nil && strings.HasPrefix(err.Error(), "CROSSSLOT"):
+		return b.move(ctx, key, newkey)
+	case err != nil:
+		return err
+	case !ok:
+		return ErrExist
+	}
+	return nil
+}
+
+// move moves key to newkey across cluster slots.
+func (b *RedisBackend) move(ctx context.Context, key, newkey string) error {
+	payload, err := b.rdb.Dump(ctx, key).Result()
+	if err == redis.Nil {
+		return ErrNotExist
+	}
+	if err != nil {
+		return err
+	}
+	if err := b.rdb.Restore(ctx, newkey, 0, payload).Err(); err != nil {
+		if strings.HasPrefix(err.Error(), "BUSYKEY") {
+			return ErrExist
+		}
+		return err
+	}
+	return b.rdb.Del(ctx, key).Err()
+}
+
+func (b *RedisBackend) Tx(ctx context.Context, fn func(w Writer)) error {
+	return b.exec(ctx, b.rdb.TxPipeline(), fn)
+}
+
+// TxIf watches key, checks the field and runs the transaction, which
+// fails if key changed since it was watched.
+func (b *RedisBackend) TxIf(ctx context.Context, key, field, value string, fn func(w Writer)) error {
+	err := b.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		cur, err := tx.HGet(ctx, key, field).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if cur != value {
+			return errAgain
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			fn(redisWriter{ctx: ctx, pipe: pipe})
+			return nil
+		})
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		return errAgain
+	}
+	return noNil(err)
+}
+
+func (b *RedisBackend) Pipeline(ctx context.Context, fn func(w Writer)) error {
+	return b.exec(ctx, b.rdb.Pipeline(), fn)
+}
+
+func (b *RedisBackend) exec(ctx context.Context, pipe redis.Pipeliner, fn func(w Writer)) error {
+	fn(redisWriter{ctx: ctx, pipe: pipe})
+	_, err := pipe.Exec(ctx)
+	return noNil(err)
+}
+
+// redisWriter queues commands on a go-redis pipeline.
+type redisWriter struct {
+	ctx  context.Context
+	pipe redis.Pipeliner
+}
+
+func (w redisWriter) Set(key, value string) { w.pipe.Set(w.ctx, key, value, 0) }
+func (w redisWriter) SetRange(key string, offset int64, value string) {
+	w.pipe.SetRange(w.ctx, key, offset, value)
+}
+func (w redisWriter) Append(key, value string) { w.pipe.Append(w.ctx, key, value) }
+func (w redisWriter) HSet(key string, fields map[string]string) {
+	if len(fields) > 0 {
+		w.pipe.HSet(w.ctx, key, fields)
+	}
+}
+func (w redisWriter) HSetNX(key, field, value string)   { w.pipe.HSetNX(w.ctx, key, field, value) }
+func (w redisWriter) HDel(key string, fields ...string) { w.pipe.HDel(w.ctx, key, fields...) }
+
+func (w redisWriter) Del(keys ...string) {
+	for _, key := range keys {
+		w.pipe.Del(w.ctx, key)
+	}
+}
+
+// Scan scans every master on a cluster, since a single SCAN only covers
+// one node.
+func (b *RedisBackend) Scan(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	cluster, ok := b.rdb.(*redis.ClusterClient)
+	if !ok {
+		return scanNode(ctx, b.rdb, pattern, fn)
+	}
+
+	var mu sync.Mutex
+	return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		return scanNode(ctx, node, pattern, func(keys []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return fn(keys)
+		})
+	})
+}
+
+func scanNode(ctx context.Context, rdb redis.Cmdable, pattern string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, nextCursor, err := rdb.Scan(ctx, cursor, pattern, 100).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		cursor = nextCursor
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// LoadFunctions loads the library with FUNCTION LOAD REPLACE. Functions
+// live per node, so a cluster needs the library on every master. Servers
+// older than Redis 7, or users without permission to load functions,
+// return an error.
+func (b *RedisBackend) LoadFunctions(ctx context.Context, library string) error {
+	if cluster, ok := b.rdb.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return node.FunctionLoadReplace(ctx, library).Err()
+		})
+	}
+	return b.rdb.FunctionLoadReplace(ctx, library).Err()
+}
+
+// Call runs FCALL, translating errno replies to the matching Errno.
+func (b *RedisBackend) Call(ctx context.Context, fn string, keys []string, args ...interface{}) (interface{}, error) {
+	res, err := b.rdb.FCall(ctx, fn, keys, args...).Result()
+	if err == nil || err == redis.Nil {
+		return res, nil
+	}
+	// The errno is the first word of the reply; some servers prefix "ERR".
+	code := strings.TrimPrefix(err.Error(), "ERR ")
+	code, _, _ = strings.Cut(code, " ")
+	if e, ok := errnos[code]; ok {
+		return nil, e
+	}
+	return nil, err
+}
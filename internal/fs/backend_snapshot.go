@@ -0,0 +1,683 @@
+package fs
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Snapshots and clones share file content with the volume they were taken
+// from copy-on-write. A Client never talks to its Backend directly: on a
+// live volume it goes through a cowBackend, and on a snapshot through a
+// snapshotBackend.
+//
+// Before the first write that would change or delete the content of an
+// inode, a cowBackend saves it into the newest snapshot and into every
+// clone still sharing it, and copies it in from the volume it was cloned
+// from when it shares it itself. Reads of content a clone shares go to the
+// volume it was cloned from, and so on up the chain of clones.
+//
+// A snapshotBackend is read-only, and looks up content the snapshot did
+// not save along the chain of newer snapshots and finally the live volume.
+//
+// The superblock of a volume that has snapshots or clones is marked with
+// shares=1, and its cow_gen field changes whenever one of them is created
+// or deleted. A cowBackend of a volume without the mark that is not a clone
+// either saves nothing, and reads cost nothing extra. Otherwise, content is
+// saved before, not in the same transaction as, the mutation changing it.
+// Either way, the mutation checks atomically, in a transaction watching
+// the superblock or inside fs_if, that cow_gen is still the one the
+// cowBackend went by, and is planned again under the new one if not: a
+// writer that stalls while a snapshot or clone is taken cannot change
+// content the snapshot or clone has not saved. Only a clone looks up where
+// the content it reads is held, once per inode and operation.
+//
+// A snapshot that saved an inode's content marks the inode's meta hash with
+// cow=1. Only the newest snapshot ever saves content: an older one still
+// sharing the inode reads it from a newer one, since the content cannot
+// have changed in between without being saved. A clone lists the inodes it
+// shares in its shared hash instead, so that inodes it creates later are
+// its own.
+
+// contentKey parses a data or chunk key of the volume k names, returning
+// the inode and the key name without the volume prefix.
+func (k *KeyGen) contentKey(key string) (ino, rest string, ok bool) {
+	rest, ok = strings.CutPrefix(key, k.Prefix())
+	if !ok {
+		return "", "", false
+	}
+	if id, found := strings.CutPrefix(rest, "data:"); found {
+		return id, rest, true
+	}
+	if id, found := strings.CutPrefix(rest, "chunk:"); found {
+		ino, _, ok = strings.Cut(id, ":")
+		return ino, rest, ok
+	}
+	return "", "", false
+}
+
+// copyContent copies the content of inode ino, whose metadata is meta,
+// from one volume to another.
+func copyContent(ctx context.Context, store Backend, from, to *KeyGen, ino string, meta *Metadata) error {
+	if meta.Chunks == 0 {
+		data, err := store.Get(ctx, from.Data(ino))
+		if err != nil {
+			return err
+		}
+		return store.Set(ctx, to.Data(ino), data)
+	}
+	id := chunkID(ino, meta.ChunkGen)
+	for i := int64(0); i < meta.Chunks; i++ {
+		data, err := store.Get(ctx, from.Chunk(id, i))
+		if err != nil {
+			return err
+		}
+		if err := store.Set(ctx, to.Chunk(id, i), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contentHolder returns the volume that holds the content inode ino had
+// when snapshot snaps[i] was taken: that snapshot or a newer one that saved
+// it, or else the live volume.
+func contentHolder(ctx context.Context, store Backend, live *KeyGen, snaps []Snapshot, i int, ino string) (*KeyGen, error) {
+	for ; i < len(snaps); i++ {
+		k := live.snapshot(snaps[i].Name)
+		cow, err := store.HGet(ctx, k.Meta(ino), "cow")
+		if err != nil {
+			return nil, err
+		}
+		if cow == "1" {
+			return k, nil
+		}
+	}
+	return live, nil
+}
+
+// sourceOf returns the volume holding the content of inode ino of the
+// volume k names: k itself, or the volume it was cloned from when it still
+// shares the inode, and so on.
+func sourceOf(ctx context.Context, store Backend, k *KeyGen, ino string) (*KeyGen, error) {
+	for {
+		shared, err := store.HExists(ctx, k.Shared(), ino)
+		if err != nil || !shared {
+			return k, err
+		}
+		origin, err := store.HGet(ctx, k.Super(), "clone_of")
+		if err != nil || origin == "" {
+			return k, err
+		}
+		k = k.volume(origin)
+	}
+}
+
+// --- Live volumes ---
+
+// cowLease is how long a cowBackend goes by the superblock it last read
+// before reading it again. Writes do not depend on it: they check cow_gen
+// as they are applied, and read the superblock again when it changed.
+var cowLease = time.Second
+
+// cowState is what the superblock of a live volume says about the content
+// it shares.
+type cowState struct {
+	shares  bool   // it has snapshots or clones
+	cloneOf string // the volume it was cloned from, if any
+	gen     string // cow_gen: changes with every snapshot or clone
+}
+
+// newCOWGen returns a new value for the cow_gen field of a superblock.
+func newCOWGen() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// cowBackend is the Backend of a live volume.
+type cowBackend struct {
+	Backend
+	keys *KeyGen
+
+	mu      sync.Mutex
+	state   cowState
+	expires time.Time
+}
+
+// load returns the sharing state of the volume, read from its superblock
+// at most once per cowLease.
+func (b *cowBackend) load(ctx context.Context) (cowState, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if time.Now().Before(b.expires) {
+		return b.state, nil
+	}
+	super, err := b.Backend.HGetAll(ctx, b.keys.Super())
+	if err != nil {
+		return cowState{}, err
+	}
+	b.state = cowState{shares: super["shares"] == "1", cloneOf: super["clone_of"], gen: super["cow_gen"]}
+	b.expires = time.Now().Add(cowLease)
+	return b.state, nil
+}
+
+// expire makes the next load read the superblock again.
+func (b *cowBackend) expire() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expires = time.Time{}
+}
+
+// cowOp caches what a cowBackend looked up for one operation of a Client,
+// such as writing all the chunks of a file, which would otherwise look it
+// up again for every chunk.
+type cowOp struct {
+	loaded    bool
+	gen       string // cow_gen the snapshots and clones were loaded under
+	snaps     []Snapshot
+	clones    []string
+	preserved map[string]bool    // inodes whose content is saved already
+	holders   map[string]*KeyGen // volume holding the content of each inode
+}
+
+// cowOps holds the cowOp of each cowBackend taking part in an operation.
+type cowOps map[*cowBackend]*cowOp
+
+type cowOpsKey struct{}
+
+// withCOWOp returns ctx carrying the caches of an operation, unless it
+// carries some already.
+func withCOWOp(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(cowOpsKey{}).(cowOps); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, cowOpsKey{}, cowOps{})
+}
+
+// op returns the cache of the operation ctx belongs to, or one for a
+// single call.
+func (b *cowBackend) op(ctx context.Context) *cowOp {
+	ops, _ := ctx.Value(cowOpsKey{}).(cowOps)
+	if op := ops[b]; op != nil {
+		return op
+	}
+	op := &cowOp{preserved: make(map[string]bool), holders: make(map[string]*KeyGen)}
+	if ops != nil {
+		ops[b] = op
+	}
+	return op
+}
+
+// holder returns the volume holding the content of inode ino: the volume
+// itself unless it is a clone still sharing the inode.
+func (b *cowBackend) holder(ctx context.Context, op *cowOp, ino string) (*KeyGen, error) {
+	if k, ok := op.holders[ino]; ok {
+		return k, nil
+	}
+	s, err := b.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	k := b.keys
+	if s.cloneOf != "" {
+		if k, err = sourceOf(ctx, b.Backend, b.keys, ino); err != nil {
+			return nil, err
+		}
+	}
+	op.holders[ino] = k
+	return k, nil
+}
+
+// touches reports whether any of keys is a content key of the volume.
+func (b *cowBackend) touches(keys []string) bool {
+	for _, key := range keys {
+		if _, _, ok := b.keys.contentKey(key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// guard makes a mutation that writes the content keys among writes and
+// deletes those among dels. It saves the content first, then has apply
+// make the mutation on the condition that cow_gen still is gen, the value
+// the content was saved under. When a snapshot or clone came or went in
+// between, apply fails with EAGAIN, and the content is saved again under
+// the new cow_gen and the mutation retried.
+func (b *cowBackend) guard(ctx context.Context, writes, dels []string, apply func(gen string) error) error {
+	for {
+		gen, err := b.preserve(ctx, writes, dels)
+		if err != nil {
+			return err
+		}
+		if err := apply(gen); err != errAgain {
+			return err
+		}
+		b.expire()
+	}
+}
+
+// txIf applies fn in a transaction conditional on cow_gen being gen.
+func (b *cowBackend) txIf(ctx context.Context, gen string, fn func(w Writer)) error {
+	return b.Backend.TxIf(ctx, b.keys.Super(), "cow_gen", gen, fn)
+}
+
+// preserve saves the content of the inodes whose content keys are among
+// writes and dels before they are changed or deleted: into the newest
+// snapshot and the clones that still share it, and into the volume itself
+// when it shares it with the volume it was cloned from. Content that is
+// only deleted is not copied into the volume itself. It returns the
+// cow_gen it went by.
+func (b *cowBackend) preserve(ctx context.Context, writes, dels []string) (string, error) {
+	rewrite := make(map[string]bool)
+	var inos []string
+	add := func(keys []string, write bool) {
+		for _, key := range keys {
+			ino, _, ok := b.keys.contentKey(key)
+			if !ok {
+				continue
+			}
+			if _, seen := rewrite[ino]; !seen {
+				inos = append(inos, ino)
+			}
+			rewrite[ino] = rewrite[ino] || write
+		}
+	}
+	add(writes, true)
+	add(dels, false)
+	s, err := b.load(ctx)
+	if err != nil || len(inos) == 0 || !s.shares && s.cloneOf == "" {
+		return s.gen, err
+	}
+	op := b.op(ctx)
+	if !op.loaded || op.gen != s.gen {
+		if op.snaps, err = loadSnapshots(ctx, b.Backend, b.keys); err != nil {
+			return "", err
+		}
+		if op.clones, err = b.Backend.HKeys(ctx, b.keys.Clones()); err != nil {
+			return "", err
+		}
+		op.loaded, op.gen = true, s.gen
+		// Saved, and looked up, under the old snapshots and clones
+		clear(op.preserved)
+		clear(op.holders)
+	}
+	for _, ino := range inos {
+		if op.preserved[ino] {
+			continue
+		}
+		if err := b.preserveInode(ctx, op, ino, rewrite[ino]); err != nil {
+			return "", err
+		}
+		op.preserved[ino] = true
+	}
+	return s.gen, nil
+}
+
+func (b *cowBackend) preserveInode(ctx context.Context, op *cowOp, ino string, rewrite bool) error {
+	src, err := b.holder(ctx, op, ino)
+	if err != nil {
+		return err
+	}
+
+	if len(op.snaps) > 0 {
+		newest := b.keys.snapshot(op.snaps[len(op.snaps)-1].Name)
+		m, err := b.Backend.HGetAll(ctx, newest.Meta(ino))
+		if err != nil {
+			return err
+		}
+		// Unless created after the snapshot, or already saved
+		if len(m) > 0 && m["cow"] != "1" {
+			if err := copyContent(ctx, b.Backend, src, newest, ino, MetaFromMap(m)); err != nil {
+				return err
+			}
+			if err := b.Backend.HSet(ctx, newest.Meta(ino), map[string]string{"cow": "1"}); err != nil {
+				return err
+			}
+		}
+	}
+
+	live := func() (*Metadata, error) {
+		m, err := b.Backend.HGetAll(ctx, b.keys.Meta(ino))
+		return MetaFromMap(m), err
+	}
+	for _, name := range op.clones {
+		clone := b.keys.volume(name)
+		shared, err := b.Backend.HExists(ctx, clone.Shared(), ino)
+		if err != nil {
+			return err
+		}
+		if !shared {
+			continue
+		}
+		meta, err := live()
+		if err != nil {
+			return err
+		}
+		if err := copyContent(ctx, b.Backend, src, clone, ino, meta); err != nil {
+			return err
+		}
+		if err := b.Backend.HDel(ctx, clone.Shared(), ino); err != nil {
+			return err
+		}
+	}
+
+	if src == b.keys {
+		return nil
+	}
+	if rewrite {
+		meta, err := live()
+		if err != nil {
+			return err
+		}
+		if err := copyContent(ctx, b.Backend, src, b.keys, ino, meta); err != nil {
+			return err
+		}
+	}
+	op.holders[ino] = b.keys
+	return b.Backend.HDel(ctx, b.keys.Shared(), ino)
+}
+
+// resolve returns the key to read in place of key: content keys of inodes
+// a clone shares are redirected to the volume holding the content.
+func (b *cowBackend) resolve(ctx context.Context, key string) (string, error) {
+	ino, rest, ok := b.keys.contentKey(key)
+	if !ok {
+		return key, nil
+	}
+	holder, err := b.holder(ctx, b.op(ctx), ino)
+	if err != nil {
+		return "", err
+	}
+	return holder.Prefix() + rest, nil
+}
+
+func (b *cowBackend) Get(ctx context.Context, key string) (string, error) {
+	key, err := b.resolve(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return b.Backend.Get(ctx, key)
+}
+
+func (b *cowBackend) GetRange(ctx context.Context, key string, start, end int64) (string, error) {
+	key, err := b.resolve(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return b.Backend.GetRange(ctx, key, start, end)
+}
+
+func (b *cowBackend) GetRangeMulti(ctx context.Context, ranges []KeyRange) ([]string, error) {
+	ctx = withCOWOp(ctx)
+	resolved := make([]KeyRange, len(ranges))
+	for i, r := range ranges {
+		key, err := b.resolve(ctx, r.Key)
+		if err != nil {
+			return nil, err
+		}
+		resolved[i] = KeyRange{Key: key, Start: r.Start, End: r.End}
+	}
+	return b.Backend.GetRangeMulti(ctx, resolved)
+}
+
+func (b *cowBackend) Set(ctx context.Context, key, value string) error {
+	if !b.touches([]string{key}) {
+		return b.Backend.Set(ctx, key, value)
+	}
+	return b.guard(ctx, []string{key}, nil, func(gen string) error {
+		return b.txIf(ctx, gen, func(w Writer) { w.Set(key, value) })
+	})
+}
+
+// Append and SetRange of content read the new length back with an empty
+// SETRANGE, which writes nothing, after the conditional transaction.
+func (b *cowBackend) Append(ctx context.Context, key, value string) (int64, error) {
+	if !b.touches([]string{key}) {
+		return b.Backend.Append(ctx, key, value)
+	}
+	err := b.guard(ctx, []string{key}, nil, func(gen string) error {
+		return b.txIf(ctx, gen, func(w Writer) { w.Append(key, value) })
+	})
+	if err != nil {
+		return 0, err
+	}
+	return b.Backend.SetRange(ctx, key, 0, "")
+}
+
+func (b *cowBackend) SetRange(ctx context.Context, key string, offset int64, value string) (int64, error) {
+	if !b.touches([]string{key}) {
+		return b.Backend.SetRange(ctx, key, offset, value)
+	}
+	err := b.guard(ctx, []string{key}, nil, func(gen string) error {
+		return b.txIf(ctx, gen, func(w Writer) { w.SetRange(key, offset, value) })
+	})
+	if err != nil {
+		return 0, err
+	}
+	return b.Backend.SetRange(ctx, key, 0, "")
+}
+
+func (b *cowBackend) Del(ctx context.Context, keys ...string) error {
+	if !b.touches(keys) {
+		return b.Backend.Del(ctx, keys...)
+	}
+	return b.guard(ctx, nil, keys, func(gen string) error {
+		return b.txIf(ctx, gen, func(w Writer) { w.Del(keys...) })
+	})
+}
+
+// Rename saves the content of key, but is not conditional on cow_gen: no
+// operation of a Client renames content keys through its store.
+func (b *cowBackend) Rename(ctx context.Context, key, newkey string) error {
+	if _, err := b.preserve(ctx, nil, []string{key}); err != nil {
+		return err
+	}
+	return b.Backend.Rename(ctx, key, newkey)
+}
+
+func (b *cowBackend) Tx(ctx context.Context, fn func(w Writer)) error {
+	var rec recordWriter
+	fn(&rec)
+	if !b.touches(rec.writes) && !b.touches(rec.dels) {
+		return b.Backend.Tx(ctx, rec.replay)
+	}
+	return b.guard(ctx, rec.writes, rec.dels, func(gen string) error {
+		return b.txIf(ctx, gen, rec.replay)
+	})
+}
+
+// Pipeline turns into a conditional transaction when it writes content.
+func (b *cowBackend) Pipeline(ctx context.Context, fn func(w Writer)) error {
+	var rec recordWriter
+	fn(&rec)
+	if !b.touches(rec.writes) && !b.touches(rec.dels) {
+		return b.Backend.Pipeline(ctx, rec.replay)
+	}
+	return b.guard(ctx, rec.writes, rec.dels, func(gen string) error {
+		return b.txIf(ctx, gen, rec.replay)
+	})
+}
+
+// Call runs functions that write content through fs_if.
+func (b *cowBackend) Call(ctx context.Context, fn string, keys []string, args ...interface{}) (interface{}, error) {
+	if !b.touches(keys) {
+		return b.Backend.Call(ctx, fn, keys, args...)
+	}
+	var res interface{}
+	err := b.guard(ctx, keys, nil, func(gen string) error {
+		var err error
+		res, err = b.Backend.Call(ctx, "fs_if", append([]string{b.keys.Super()}, keys...),
+			append([]interface{}{"cow_gen", gen, fn}, args...)...)
+		return err
+	})
+	return res, err
+}
+
+// recordWriter queues the writes of a Tx or Pipeline so the string keys
+// they write and delete are known before they are sent.
+type recordWriter struct {
+	ops    []func(w Writer)
+	writes []string
+	dels   []string
+}
+
+func (r *recordWriter) replay(w Writer) {
+	for _, op := range r.ops {
+		op(w)
+	}
+}
+
+func (r *recordWriter) Set(key, value string) {
+	r.writes = append(r.writes, key)
+	r.ops = append(r.ops, func(w Writer) { w.Set(key, value) })
+}
+
+func (r *recordWriter) SetRange(key string, offset int64, value string) {
+	r.writes = append(r.writes, key)
+	r.ops = append(r.ops, func(w Writer) { w.SetRange(key, offset, value) })
+}
+
+func (r *recordWriter) Append(key, value string) {
+	r.writes = append(r.writes, key)
+	r.ops = append(r.ops, func(w Writer) { w.Append(key, value) })
+}
+
+func (r *recordWriter) HSet(key string, fields map[string]string) {
+	r.ops = append(r.ops, func(w Writer) { w.HSet(key, fields) })
+}
+
+func (r *recordWriter) HSetNX(key, field, value string) {
+	r.ops = append(r.ops, func(w Writer) { w.HSetNX(key, field, value) })
+}
+
+func (r *recordWriter) HDel(key string, fields ...string) {
+	r.ops = append(r.ops, func(w Writer) { w.HDel(key, fields...) })
+}
+
+func (r *recordWriter) Del(keys ...string) {
+	r.dels = append(r.dels, keys...)
+	r.ops = append(r.ops, func(w Writer) { w.Del(keys...) })
+}
+
+// --- Snapshots ---
+
+// snapshotBackend is the read-only Backend of a snapshot volume.
+type snapshotBackend struct {
+	Backend
+	keys *KeyGen // the snapshot's
+	live *KeyGen
+	name string
+}
+
+// resolve returns the key to read in place of key: content keys of the
+// snapshot are redirected to the volume holding the content.
+func (b *snapshotBackend) resolve(ctx context.Context, key string, holders map[string]*KeyGen) (string, error) {
+	ino, rest, ok := b.keys.contentKey(key)
+	if !ok {
+		return key, nil
+	}
+	holder, ok := holders[ino]
+	if !ok {
+		snaps, err := loadSnapshots(ctx, b.Backend, b.live)
+		if err != nil {
+			return "", err
+		}
+		i := 0
+		for i < len(snaps) && snaps[i].Name != b.name {
+			i++
+		}
+		if i == len(snaps) {
+			// Deleted while in use; read what is left
+			holder = b.keys
+		} else if holder, err = contentHolder(ctx, b.Backend, b.live, snaps, i, ino); err != nil {
+			return "", err
+		}
+		holders[ino] = holder
+	}
+	return holder.Prefix() + rest, nil
+}
+
+func (b *snapshotBackend) Get(ctx context.Context, key string) (string, error) {
+	key, err := b.resolve(ctx, key, map[string]*KeyGen{})
+	if err != nil {
+		return "", err
+	}
+	return b.Backend.Get(ctx, key)
+}
+
+func (b *snapshotBackend) GetRange(ctx context.Context, key string, start, end int64) (string, error) {
+	key, err := b.resolve(ctx, key, map[string]*KeyGen{})
+	if err != nil {
+		return "", err
+	}
+	return b.Backend.GetRange(ctx, key, start, end)
+}
+
+func (b *snapshotBackend) GetRangeMulti(ctx context.Context, ranges []KeyRange) ([]string, error) {
+	holders := make(map[string]*KeyGen)
+	resolved := make([]KeyRange, len(ranges))
+	for i, r := range ranges {
+		key, err := b.resolve(ctx, r.Key, holders)
+		if err != nil {
+			return nil, err
+		}
+		resolved[i] = KeyRange{Key: key, Start: r.Start, End: r.End}
+	}
+	return b.Backend.GetRangeMulti(ctx, resolved)
+}
+
+func (b *snapshotBackend) Set(ctx context.Context, key, value string) error {
+	return ErrReadOnly
+}
+
+func (b *snapshotBackend) Append(ctx context.Context, key, value string) (int64, error) {
+	return 0, ErrReadOnly
+}
+
+func (b *snapshotBackend) SetRange(ctx context.Context, key string, offset int64, value string) (int64, error) {
+	return 0, ErrReadOnly
+}
+
+func (b *snapshotBackend) HSet(ctx context.Context, key string, fields map[string]string) error {
+	return ErrReadOnly
+}
+
+func (b *snapshotBackend) HSetNX(ctx context.Context, key, field, value string) (bool, error) {
+	return false, ErrReadOnly
+}
+
+func (b *snapshotBackend) HDel(ctx context.Context, key string, fields ...string) error {
+	return ErrReadOnly
+}
+
+func (b *snapshotBackend) Del(ctx context.Context, keys ...string) error {
+	return ErrReadOnly
+}
+
+func (b *snapshotBackend) Incr(ctx context.Context, key string) (int64, error) {
+	return 0, ErrReadOnly
+}
+
+func (b *snapshotBackend) Rename(ctx context.Context, key, newkey string) error {
+	return ErrReadOnly
+}
+
+func (b *snapshotBackend) Tx(ctx context.Context, fn func(w Writer)) error {
+	return ErrReadOnly
+}
+
+func (b *snapshotBackend) Pipeline(ctx context.Context, fn func(w Writer)) error {
+	return ErrReadOnly
+}
+
+func (b *snapshotBackend) Call(ctx context.Context, fn string, keys []string, args ...interface{}) (interface{}, error) {
+	return nil, ErrReadOnly
+}
+
+// snapshot returns the key generator of snapshot name of the volume k
+// names.
+func (k *KeyGen) snapshot(name string) *KeyGen {
+	return k.volume(SnapshotVolume(k.Volume, name))
+}
@@ -0,0 +1,237 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultChunkSize is the default chunking threshold: files larger than this
+// are stored as a sequence of chunks of this size instead of one string.
+const DefaultChunkSize int64 = 1 << 20
+
+// chunkBatch is the number of chunk commands sent per pipeline round trip.
+const chunkBatch = 8
+
+// Chunked files keep their content in fs:<vol>:chunk:<ino>:<n> keys and
+// record the chunk count and size in their metadata; their data key is
+// absent. An overwrite writes its chunks under a new generation,
+// fs:<vol>:chunk:<ino>:<gen>:<n>, switches the metadata to them in one
+// transaction and only then deletes the old chunks, so an interrupted
+// overwrite leaves the old content in place. Appends and range writes still
+// patch the current chunks before the metadata update.
+
+// chunkID returns the id the chunk keys of inode ino are named by in the
+// chunk generation gen.
+func chunkID(ino, gen string) string {
+	if gen == "" {
+		return ino
+	}
+	return ino + ":" + gen
+}
+
+// newChunkGen returns a new chunk generation.
+func newChunkGen() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// SetChunkSize sets the chunking threshold and the chunk size used for new
+// writes. Zero disables chunking. Existing files keep their own chunk size.
+func (c *Client) SetChunkSize(size int64) {
+	c.chunkSize = size
+}
+
+// ChunkSize returns the chunking threshold.
+func (c *Client) ChunkSize() int64 {
+	return c.chunkSize
+}
+
+// needsChunks reports whether content of the given size must be chunked.
+func (c *Client) needsChunks(size int64) bool {
+	return c.chunkSize > 0 && size > c.chunkSize
+}
+
+// writeChunks stores content as chunks of size cs under the chunk id id,
+// starting at chunk index first. Returns the number of chunks written. Each
+// chunk is its own SET, so no single command carries more than one chunk.
+func (c *Client) writeChunks(ctx context.Context, id string, first int64, content string, cs int64) (int64, error) {
+	ctx = withCOWOp(ctx)
+	var n int64
+	for off := int64(0); off < int64(len(content)); {
+		err := c.store.Pipeline(ctx, func(w Writer) {
+			for i := 0; i < chunkBatch && off < int64(len(content)); i++ {
+				end := min(off+cs, int64(len(content)))
+				w.Set(c.keys.Chunk(id, first+n), content[off:end])
+				off = end
+				n++
+			}
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// dropChunks deletes chunks [from, to) under the chunk id id.
+func (c *Client) dropChunks(ctx context.Context, id string, from, to int64) error {
+	ctx = withCOWOp(ctx)
+	if from >= to {
+		return nil
+	}
+	for ; from < to; from += 100 {
+		keys := make([]string, 0, min(to-from, 100))
+		for i := from; i < min(from+100, to); i++ {
+			keys = append(keys, c.keys.Chunk(id, i))
+		}
+		if err := c.store.Del(ctx, keys...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyChunks copies the chunks of src under the chunk id dst one chunk at
+// a time.
+func (c *Client) copyChunks(ctx context.Context, src *Metadata, dst string) error {
+	ctx = withCOWOp(ctx)
+	id := chunkID(src.Ino, src.ChunkGen)
+	for i := int64(0); i < src.Chunks; i++ {
+		data, err := c.store.Get(ctx, c.keys.Chunk(id, i))
+		if err != nil {
+			return err
+		}
+		if err := c.store.Set(ctx, c.keys.Chunk(dst, i), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamContent writes the content of the file inode to w, one chunk at a time.
+func (c *Client) streamContent(ctx context.Context, meta *Metadata, w io.Writer) (int64, error) {
+	ctx = withCOWOp(ctx)
+	if meta.Chunks == 0 {
+		data, err := c.store.Get(ctx, c.keys.Data(meta.Ino))
+		if err != nil {
+			return 0, err
+		}
+		n, err := io.WriteString(w, data)
+		return int64(n), err
+	}
+
+	var written int64
+	id := chunkID(meta.Ino, meta.ChunkGen)
+	for i := int64(0); i < meta.Chunks; i++ {
+		data, err := c.store.Get(ctx, c.keys.Chunk(id, i))
+		if err != nil {
+			return written, err
+		}
+		n, err := io.WriteString(w, data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// readContent returns the whole content of the file inode.
+func (c *Client) readContent(ctx context.Context, meta *Metadata) (string, error) {
+	var b strings.Builder
+	b.Grow(int(meta.Size))
+	if _, err := c.streamContent(ctx, meta, &b); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// overwriteChunked replaces the content of an existing file when either the
+// old or the new content is chunked.
+func (c *Client) overwriteChunked(ctx context.Context, meta *Metadata, content string) error {
+	ctx = withCOWOp(ctx)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	size := strconv.Itoa(len(content))
+	old := chunkID(meta.Ino, meta.ChunkGen)
+
+	if !c.needsChunks(int64(len(content))) {
+		// Shrinking back to a single data key
+		err := c.store.Tx(ctx, func(tx Writer) {
+			tx.Set(c.keys.Data(meta.Ino), content)
+			tx.HSet(c.keys.Meta(meta.Ino), map[string]string{"size": size, "mtime": now})
+			tx.HDel(c.keys.Meta(meta.Ino), "chunks", "chunk_size", "chunk_gen")
+		})
+		if err != nil {
+			return err
+		}
+		return c.dropChunks(ctx, old, 0, meta.Chunks)
+	}
+
+	gen := newChunkGen()
+	id := chunkID(meta.Ino, gen)
+	n, err := c.writeChunks(ctx, id, 0, content, c.chunkSize)
+	if err == nil {
+		err = c.store.Tx(ctx, func(tx Writer) {
+			tx.Del(c.keys.Data(meta.Ino))
+			tx.HSet(c.keys.Meta(meta.Ino), map[string]string{
+				"size": size, "mtime": now,
+				"chunks": strconv.FormatInt(n, 10), "chunk_size": strconv.FormatInt(c.chunkSize, 10),
+				"chunk_gen": gen,
+			})
+		})
+	}
+	if err != nil {
+		c.dropChunks(ctx, id, 0, chunkCount(int64(len(content)), c.chunkSize))
+		return err
+	}
+	return c.dropChunks(ctx, old, 0, meta.Chunks)
+}
+
+// appendChunked appends content to a file that is, or is about to become,
+// chunked. The tail chunk is filled first, then new chunks are added.
+func (c *Client) appendChunked(ctx context.Context, meta *Metadata, content string) error {
+	ctx = withCOWOp(ctx)
+	ino := meta.Ino
+	id := chunkID(ino, meta.ChunkGen)
+	chunks, cs, size := meta.Chunks, meta.ChunkSize, meta.Size
+
+	if chunks == 0 {
+		// Convert the single data key into chunks
+		data, err := c.store.Get(ctx, c.keys.Data(ino))
+		if err != nil {
+			return err
+		}
+		cs = c.chunkSize
+		if chunks, err = c.writeChunks(ctx, id, 0, data, cs); err != nil {
+			return err
+		}
+		size = int64(len(data))
+	}
+
+	rest := content
+	if chunks > 0 {
+		tail := size - (chunks-1)*cs
+		if room := cs - tail; room > 0 && len(rest) > 0 {
+			k := min(room, int64(len(rest)))
+			if _, err := c.store.Append(ctx, c.keys.Chunk(id, chunks-1), rest[:k]); err != nil {
+				return err
+			}
+			rest = rest[k:]
+		}
+	}
+	n, err := c.writeChunks(ctx, id, chunks, rest, cs)
+	if err != nil {
+		return err
+	}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	return c.store.Tx(ctx, func(tx Writer) {
+		tx.Del(c.keys.Data(ino))
+		tx.HSet(c.keys.Meta(ino), map[string]string{
+			"size": strconv.FormatInt(size+int64(len(content)), 10), "mtime": now,
+			"chunks": strconv.FormatInt(chunks+n, 10), "chunk_size": strconv.FormatInt(cs, 10),
+		})
+	})
+}
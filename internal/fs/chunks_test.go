@@ -0,0 +1,125 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"slices"
+	"testing"
+)
+
+// chunkContents returns the stored chunks of the file at path.
+func chunkContents(t *testing.T, c *Client, path string) []string {
+	t.Helper()
+	meta := mustStat(t, c, path)
+	var chunks []string
+	for i := int64(0); i < meta.Chunks; i++ {
+		data, err := c.store.Get(context.Background(), c.keys.Chunk(chunkID(meta.Ino, meta.ChunkGen), i))
+		if err != nil {
+			t.Fatalf("chunk %d of %s: %v", i, path, err)
+		}
+		chunks = append(chunks, data)
+	}
+	return chunks
+}
+
+func TestChunkThreshold(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.SetChunkSize(4)
+
+	c.WriteFile(ctx, "/f", "abcd")
+	if meta := mustStat(t, c, "/f"); meta.Chunks != 0 {
+		t.Errorf("file of the chunk size has %d chunks, want 0", meta.Chunks)
+	}
+
+	c.WriteFile(ctx, "/f", "abcdefghi")
+	meta := mustStat(t, c, "/f")
+	if meta.Chunks != 3 || meta.ChunkSize != 4 || meta.Size != 9 {
+		t.Errorf("meta = %+v, want 3 chunks of 4 and size 9", meta)
+	}
+	if got := chunkContents(t, c, "/f"); !slices.Equal(got, []string{"abcd", "efgh", "i"}) {
+		t.Errorf("chunks = %q", got)
+	}
+	if n, _ := c.store.Exists(ctx, c.keys.Data(meta.Ino)); n != 0 {
+		t.Error("chunked file kept its data key")
+	}
+
+	// Chunking disabled stores any size in one key
+	c.SetChunkSize(0)
+	c.WriteFile(ctx, "/g", "abcdefghi")
+	if meta := mustStat(t, c, "/g"); meta.Chunks != 0 {
+		t.Errorf("with chunking disabled: %d chunks, want 0", meta.Chunks)
+	}
+}
+
+func TestChunkedAppend(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.SetChunkSize(4)
+
+	// Growing past the threshold converts the data key into chunks
+	c.WriteFile(ctx, "/f", "abc")
+	c.AppendFile(ctx, "/f", "defghij")
+	if got := chunkContents(t, c, "/f"); !slices.Equal(got, []string{"abcd", "efgh", "ij"}) {
+		t.Errorf("after converting append: %q", got)
+	}
+
+	// The tail chunk is filled before a new one is added
+	c.AppendFile(ctx, "/f", "kl")
+	if got := chunkContents(t, c, "/f"); !slices.Equal(got, []string{"abcd", "efgh", "ijkl"}) {
+		t.Errorf("after filling the tail: %q", got)
+	}
+
+	// A file keeps the chunk size it was written with
+	c.SetChunkSize(8)
+	c.AppendFile(ctx, "/f", "mnopq")
+	if got := chunkContents(t, c, "/f"); !slices.Equal(got, []string{"abcd", "efgh", "ijkl", "mnop", "q"}) {
+		t.Errorf("after a chunk size change: %q", got)
+	}
+	if meta := mustStat(t, c, "/f"); meta.Size != 17 || meta.Chunks != 5 || meta.ChunkSize != 4 {
+		t.Errorf("meta = %+v, want size 17 in 5 chunks of 4", meta)
+	}
+}
+
+func TestChunkedCopyMove(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.SetChunkSize(4)
+	content := "0123456789"
+	c.WriteFile(ctx, "/a", content)
+
+	if err := c.CopyFile(ctx, "/a", "/b"); err != nil {
+		t.Fatalf("CopyFile: %v", err)
+	}
+	c.WriteFile(ctx, "/a", "changed content")
+	if got := chunkContents(t, c, "/b"); !slices.Equal(got, []string{"0123", "4567", "89"}) {
+		t.Errorf("copy chunks = %q", got)
+	}
+
+	if err := c.Move(ctx, "/b", "/c"); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if meta := mustStat(t, c, "/c"); meta.Chunks != 3 || meta.Size != 10 {
+		t.Errorf("moved meta = %+v, want 3 chunks and size 10", meta)
+	}
+
+	// Reads through a handle stream the chunks in order
+	f, err := c.Open(ctx, "/c")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != content {
+		t.Errorf("read = %q, want %q", data, content)
+	}
+
+	// Removing the last link drops the chunks
+	meta := mustStat(t, c, "/c")
+	if err := c.Remove(ctx, "/c"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if n, _ := c.store.Exists(ctx, c.keys.Chunk(chunkID(meta.Ino, meta.ChunkGen), 0)); n != 0 {
+		t.Error("Remove kept the chunks")
+	}
+}
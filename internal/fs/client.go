@@ -2,7 +2,10 @@ package fs
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -12,32 +15,91 @@ import (
 
 const maxSymlinkDepth = 40
 
-// Client provides filesystem operations backed by Redis.
+// Client provides filesystem operations on a volume kept in a Backend,
+// normally Redis.
 type Client struct {
-	rdb      *redis.Client
-	keys     *KeyGen
-	Volume   string
-	observer FileObserver
+	store     Backend // base, wrapped for the active volume; see bind
+	base      Backend
+	keys      *KeyGen
+	Volume    string
+	observers []FileObserver
+	functions bool // server-side functions library loaded
+	readOnly  bool // connected to a replica; never write
+	chunkSize int64
+	id        Identity    // user permission checks are made for
+	umask     os.FileMode // bits cleared from the mode of new entries
 }
 
-// NewClient creates a new filesystem client.
-func NewClient(rdb *redis.Client, volume string) *Client {
-	return &Client{
-		rdb:    rdb,
-		keys:   NewKeyGen(volume),
-		Volume: volume,
-	}
+// NewClient creates a new filesystem client on Redis. It accepts any
+// go-redis client: standalone, Sentinel or Cluster.
+func NewClient(rdb redis.UniversalClient, volume string) *Client {
+	return NewClientWithBackend(NewRedisBackend(rdb), volume)
+}
+
+// NewClientWithBackend creates a new filesystem client on any Backend.
+func NewClientWithBackend(store Backend, volume string) *Client {
+	c := &Client{
+		base:      store,
+		keys:      NewKeyGen(volume),
+		Volume:    volume,
+		chunkSize: DefaultChunkSize,
+		umask:     DefaultUmask,
+	}
+	c.bind()
+	return c
 }
 
-// SetVolume switches the active volume.
+// SetVolume switches the active volume. Observers that implement
+// VolumeObserver switch with it.
 func (c *Client) SetVolume(volume string) {
 	c.Volume = volume
-	c.keys = NewKeyGen(volume)
+	c.keys = &KeyGen{Volume: volume, HashTag: c.keys.HashTag}
+	c.bind()
+	for _, obs := range c.observers {
+		if vo, ok := obs.(VolumeObserver); ok {
+			vo.SetVolume(volume)
+		}
+	}
+}
+
+// HashTags reports whether the hash tag key layout is in use.
+func (c *Client) HashTags() bool {
+	return c.keys.HashTag
+}
+
+// SetHashTags enables the cluster hash tag key layout (fs:{vol}:...), which
+// keeps every key of a volume in one slot. Required on Redis Cluster.
+func (c *Client) SetHashTags(enabled bool) {
+	c.keys = &KeyGen{Volume: c.Volume, HashTag: enabled}
+	c.bind()
+}
+
+// SetReadOnly marks the client as connected to a read-only replica, so
+// reads skip side effects such as atime updates.
+func (c *Client) SetReadOnly(readOnly bool) {
+	c.readOnly = readOnly
 }
 
-// SetObserver registers a FileObserver for mutation notifications.
+// SetObserver registers a FileObserver for mutation notifications, in
+// place of any registered before. nil removes them all.
 func (c *Client) SetObserver(obs FileObserver) {
-	c.observer = obs
+	c.observers = nil
+	if obs != nil {
+		c.AddObserver(obs)
+	}
+}
+
+// AddObserver registers another FileObserver; each is notified in the
+// order they were added. It is told the client's volume and user if it
+// implements VolumeObserver or IdentityObserver.
+func (c *Client) AddObserver(obs FileObserver) {
+	if vo, ok := obs.(VolumeObserver); ok {
+		vo.SetVolume(c.Volume)
+	}
+	if ido, ok := obs.(IdentityObserver); ok {
+		ido.SetIdentity(c.id)
+	}
+	c.observers = append(c.observers, obs)
 }
 
 // Keys returns the key generator (for use by search indexing).
@@ -45,48 +107,148 @@ func (c *Client) Keys() *KeyGen {
 	return c.keys
 }
 
-// Redis returns the underlying Redis client.
-func (c *Client) Redis() *redis.Client {
-	return c.rdb
+// Backend returns the store the client operates on.
+func (c *Client) Backend() Backend {
+	return c.base
+}
+
+// Redis returns the underlying Redis client, or nil when the backend is
+// not Redis.
+func (c *Client) Redis() redis.UniversalClient {
+	if rb, ok := c.base.(*RedisBackend); ok {
+		return rb.Client()
+	}
+	return nil
 }
 
 // --- Init ---
 
 // Init bootstraps the volume root directory if it doesn't exist.
+// Volumes still using the path-keyed layout are migrated first. Init also
+// loads the server-side functions library when the server supports it.
 func (c *Client) Init(ctx context.Context) error {
-	metaKey := c.keys.Meta("/")
+	c.loadFunctions(ctx)
+	if c.IsSnapshot() {
+		// Complete when created, and read-only
+		exists, err := c.VolumeExists(ctx)
+		if err != nil {
+			return fmt.Errorf("init: %w", err)
+		}
+		if !exists {
+			return pathErr("snapshot", c.Volume, ErrNotExist)
+		}
+		return nil
+	}
+
+	if err := c.migrateLegacy(ctx); err != nil {
+		return fmt.Errorf("init: %w", err)
+	}
+
+	metaKey := c.keys.Meta(RootInode)
 	// Use HSETNX to make it idempotent
-	created, err := c.rdb.HSetNX(ctx, metaKey, "type", "dir").Result()
+	created, err := c.store.HSetNX(ctx, metaKey, "type", "dir")
 	if err != nil {
 		return fmt.Errorf("init: %w", err)
 	}
 	if created {
-		meta := NewDirMeta("0755")
-		_, err := c.rdb.HSet(ctx, metaKey, meta.ToMap()).Result()
-		if err != nil {
+		meta := c.own(NewDirMeta(c.createMode(0777)))
+		if err := c.store.HSet(ctx, metaKey, meta.ToMap()); err != nil {
 			return fmt.Errorf("init: %w", err)
 		}
 	}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	err = c.store.Pipeline(ctx, func(w Writer) {
+		w.HSetNX(c.keys.Super(), "layout", strconv.Itoa(LayoutVersion))
+		w.HSetNX(c.keys.Super(), "ctime", now)
+	})
+	if err != nil {
+		return fmt.Errorf("init: %w", err)
+	}
 	return nil
 }
 
+// VolumeExists reports whether the active volume has been initialized,
+// in either the current or the legacy path-keyed layout.
+func (c *Client) VolumeExists(ctx context.Context) (bool, error) {
+	n, err := c.store.Exists(ctx, c.keys.Super(), c.keys.legacyMeta("/"))
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// --- Inode resolution ---
+
+// lookup resolves a path to its inode id by walking directory entries from
+// the root. Returns "" if any component does not exist, and ErrPermission
+// if a directory on the way cannot be searched.
+func (c *Client) lookup(ctx context.Context, path string) (string, error) {
+	_, ino, err := c.walk(ctx, path, false, 0)
+	return ino, err
+}
+
+// lookupDir resolves a path, following a final symlink, and returns its
+// inode id if it is an existing directory, or "" otherwise.
+func (c *Client) lookupDir(ctx context.Context, path string) (string, error) {
+	_, ino, err := c.walk(ctx, path, true, 0)
+	if err != nil || ino == "" {
+		return "", err
+	}
+	t, err := c.store.HGet(ctx, c.keys.Meta(ino), "type")
+	if err != nil {
+		return "", err
+	}
+	if t != string(TypeDir) {
+		return "", nil
+	}
+	return ino, nil
+}
+
+// statIno loads the metadata of an inode. Returns nil, nil if not found.
+func (c *Client) statIno(ctx context.Context, ino string) (*Metadata, error) {
+	m, err := c.store.HGetAll(ctx, c.keys.Meta(ino))
+	if err != nil {
+		return nil, fmt.Errorf("stat: %w", err)
+	}
+	if len(m) == 0 {
+		return nil, nil
+	}
+	meta := MetaFromMap(m)
+	meta.Ino = ino
+	return meta, nil
+}
+
+// allocInode reserves a new, unused inode id for the volume.
+func (c *Client) allocInode(ctx context.Context) (string, error) {
+	n, err := c.store.Incr(ctx, c.keys.InodeCounter())
+	if err != nil {
+		return "", fmt.Errorf("alloc inode: %w", err)
+	}
+	return strconv.FormatInt(n, 10), nil
+}
+
 // --- Stat / Exists ---
 
 // Stat returns metadata for a path. Returns nil, nil if not found.
 func (c *Client) Stat(ctx context.Context, path string) (*Metadata, error) {
-	m, err := c.rdb.HGetAll(ctx, c.keys.Meta(path)).Result()
+	ino, err := c.lookup(ctx, path)
 	if err != nil {
-		return nil, fmt.Errorf("stat: %w", err)
+		return nil, pathErr("stat", path, err)
 	}
-	if len(m) == 0 {
+	if ino == "" {
 		return nil, nil
 	}
-	return MetaFromMap(m), nil
+	return c.statIno(ctx, ino)
 }
 
 // Exists checks if a path exists.
 func (c *Client) Exists(ctx context.Context, path string) (bool, error) {
-	n, err := c.rdb.Exists(ctx, c.keys.Meta(path)).Result()
+	ino, err := c.lookup(ctx, path)
+	if err != nil || ino == "" {
+		return false, err
+	}
+	n, err := c.store.Exists(ctx, c.keys.Meta(ino))
 	if err != nil {
 		return false, err
 	}
@@ -95,21 +257,29 @@ func (c *Client) Exists(ctx context.Context, path string) (bool, error) {
 
 // IsDir checks if the path is an existing directory.
 func (c *Client) IsDir(ctx context.Context, path string) (bool, error) {
-	t, err := c.rdb.HGet(ctx, c.keys.Meta(path), "type").Result()
-	if err == redis.Nil {
-		return false, nil
-	}
+	ino, err := c.lookupDir(ctx, path)
 	if err != nil {
 		return false, err
 	}
-	return t == string(TypeDir), nil
+	return ino != "", nil
 }
 
 // --- ReadDir ---
 
-// ReadDir returns the child entry names of a directory.
+// ReadDir returns the child entry names of a directory, following a
+// symlink to it.
 func (c *Client) ReadDir(ctx context.Context, path string) ([]string, error) {
-	members, err := c.rdb.SMembers(ctx, c.keys.Dir(path)).Result()
+	_, ino, err := c.walk(ctx, path, true, 0)
+	if err != nil {
+		return nil, pathErr("ls", path, err)
+	}
+	if ino == "" {
+		return nil, nil
+	}
+	if err := c.accessIno(ctx, "ls", path, ino, AccessRead); err != nil {
+		return nil, err
+	}
+	members, err := c.store.HKeys(ctx, c.keys.Dir(ino))
 	if err != nil {
 		return nil, fmt.Errorf("readdir: %w", err)
 	}
@@ -118,35 +288,50 @@ func (c *Client) ReadDir(ctx context.Context, path string) ([]string, error) {
 
 // ReadDirWithMeta returns child names with metadata (for ls -l).
 func (c *Client) ReadDirWithMeta(ctx context.Context, dirPath string) ([]DirEntry, error) {
-	children, err := c.ReadDir(ctx, dirPath)
+	_, ino, err := c.walk(ctx, dirPath, true, 0)
 	if err != nil {
+		return nil, pathErr("ls", dirPath, err)
+	}
+	if ino == "" {
+		return nil, nil
+	}
+	if err := c.accessIno(ctx, "ls", dirPath, ino, AccessRead); err != nil {
 		return nil, err
 	}
+	return c.readDirIno(ctx, ino)
+}
+
+// readDirIno lists a directory inode, loading each child's metadata.
+func (c *Client) readDirIno(ctx context.Context, ino string) ([]DirEntry, error) {
+	children, err := c.store.HGetAll(ctx, c.keys.Dir(ino))
+	if err != nil {
+		return nil, fmt.Errorf("readdir: %w", err)
+	}
 
 	if len(children) == 0 {
 		return nil, nil
 	}
 
-	// Pipeline HGETALL for all children
-	pipe := c.rdb.Pipeline()
-	cmds := make([]*redis.MapStringStringCmd, len(children))
-	for i, child := range children {
-		childPath := JoinPath(dirPath, child)
-		cmds[i] = pipe.HGetAll(ctx, c.keys.Meta(childPath))
+	// Fetch the metadata of all children in one round trip
+	names := make([]string, 0, len(children))
+	metaKeys := make([]string, 0, len(children))
+	for name, childIno := range children {
+		names = append(names, name)
+		metaKeys = append(metaKeys, c.keys.Meta(childIno))
 	}
-	_, err = pipe.Exec(ctx)
-	if err != nil && err != redis.Nil {
+	metas, err := c.store.HGetAllMulti(ctx, metaKeys)
+	if err != nil {
 		return nil, fmt.Errorf("readdir meta: %w", err)
 	}
 
 	entries := make([]DirEntry, 0, len(children))
-	for i, child := range children {
-		m, _ := cmds[i].Result()
-		meta := MetaFromMap(m)
-		entries = append(entries, DirEntry{
-			Name: child,
-			Meta: meta,
-		})
+	for i, name := range names {
+		entry := DirEntry{Name: name}
+		if m := metas[i]; len(m) > 0 {
+			entry.Meta = MetaFromMap(m)
+			entry.Meta.Ino = children[name]
+		}
+		entries = append(entries, entry)
 	}
 	return entries, nil
 }
@@ -171,60 +356,86 @@ func (c *Client) Mkdir(ctx context.Context, path string, parents bool) error {
 	}
 
 	// Check parent exists and is a directory
-	parent := ParentPath(path)
-	isDir, err := c.IsDir(ctx, parent)
+	parentIno, err := c.lookupDir(ctx, ParentPath(path))
 	if err != nil {
 		return err
 	}
-	if !isDir {
-		return fmt.Errorf("mkdir: cannot create directory '%s': No such file or directory", path)
+	if parentIno == "" {
+		return pathErr("mkdir", path, ErrNotExist)
 	}
 
 	// Check target doesn't already exist
-	exists, err := c.Exists(ctx, path)
+	exists, err := c.store.HExists(ctx, c.keys.Dir(parentIno), BaseName(path))
 	if err != nil {
 		return err
 	}
 	if exists {
-		return fmt.Errorf("mkdir: cannot create directory '%s': File exists", path)
+		return pathErr("mkdir", path, ErrExist)
 	}
 
-	return c.createDir(ctx, path)
+	_, err = c.createDir(ctx, parentIno, path)
+	return err
 }
 
 func (c *Client) mkdirParents(ctx context.Context, path string) error {
-	parts := strings.Split(path, "/")
+	parentIno := RootInode
 	current := ""
-	for _, part := range parts {
+	for _, part := range strings.Split(path, "/") {
 		if part == "" {
 			continue
 		}
 		current += "/" + part
-		exists, err := c.Exists(ctx, current)
+		if err := c.accessIno(ctx, "mkdir", current, parentIno, AccessExec); err != nil {
+			return err
+		}
+		ino, err := c.store.HGet(ctx, c.keys.Dir(parentIno), part)
 		if err != nil {
 			return err
 		}
-		if !exists {
-			if err := c.createDir(ctx, current); err != nil {
+		if ino == "" {
+			if ino, err = c.createDir(ctx, parentIno, current); err != nil {
+				return err
+			}
+		} else {
+			t, err := c.store.HGet(ctx, c.keys.Meta(ino), "type")
+			if err != nil {
 				return err
 			}
+			if t == string(TypeSymlink) {
+				// Carry on inside the link's target
+				if ino, err = c.lookupDir(ctx, current); err != nil {
+					return err
+				}
+				if ino != "" {
+					t = string(TypeDir)
+				}
+			}
+			if t != string(TypeDir) {
+				return pathErr("mkdir", path, ErrNotDir)
+			}
 		}
+		parentIno = ino
 	}
 	return nil
 }
 
-func (c *Client) createDir(ctx context.Context, path string) error {
-	parent, base := SplitPath(path)
-	meta := NewDirMeta("0755")
-
-	pipe := c.rdb.TxPipeline()
-	pipe.HSet(ctx, c.keys.Meta(path), meta.ToMap())
-	pipe.SAdd(ctx, c.keys.Dir(parent), base)
-	_, err := pipe.Exec(ctx)
+// createDir allocates a directory inode and links it into parentIno,
+// the inode of path's parent directory.
+func (c *Client) createDir(ctx context.Context, parentIno, path string) (string, error) {
+	if err := c.accessIno(ctx, "mkdir", path, parentIno, AccessWrite|AccessExec); err != nil {
+		return "", err
+	}
+	ino, err := c.allocInode(ctx)
 	if err != nil {
-		return fmt.Errorf("mkdir: %w", err)
+		return "", fmt.Errorf("mkdir: %w", err)
 	}
-	return nil
+	meta := c.own(NewDirMeta(c.createMode(0777)))
+
+	if err := c.link(ctx, parentIno, BaseName(path), ino, meta, nil); err != nil {
+		return "", pathErr("mkdir", path, err)
+	}
+	c.notifyMkdir(ctx, path)
+	return ino, nil
 }
 
 // --- Rmdir ---
@@ -233,35 +444,44 @@ func (c *Client) createDir(ctx context.Context, path string) error {
 func (c *Client) Rmdir(ctx context.Context, path string) error {
 	path = NormalizePath(path)
 	if path == "/" {
-		return fmt.Errorf("rmdir: cannot remove root directory")
+		return pathErr("rmdir", path, ErrBusy)
 	}
 
-	isDir, err := c.IsDir(ctx, path)
+	// A final symlink is not followed: rmdir of a link to a directory
+	// fails rather than removing the link's name with the target's inode
+	ino, err := c.lookup(ctx, path)
 	if err != nil {
 		return err
 	}
-	if !isDir {
-		return fmt.Errorf("rmdir: failed to remove '%s': Not a directory", path)
+	var meta *Metadata
+	if ino != "" {
+		if meta, err = c.statIno(ctx, ino); err != nil {
+			return err
+		}
+	}
+	if meta == nil || meta.Type != TypeDir {
+		return pathErr("rmdir", path, ErrNotDir)
 	}
 
-	count, err := c.rdb.SCard(ctx, c.keys.Dir(path)).Result()
+	count, err := c.store.HLen(ctx, c.keys.Dir(ino))
 	if err != nil {
 		return err
 	}
 	if count > 0 {
-		return fmt.Errorf("rmdir: failed to remove '%s': Directory not empty", path)
+		return pathErr("rmdir", path, ErrNotEmpty)
 	}
 
-	parent, base := SplitPath(path)
-	pipe := c.rdb.TxPipeline()
-	pipe.Del(ctx, c.keys.Meta(path))
-	pipe.Del(ctx, c.keys.Dir(path))
-	pipe.Del(ctx, c.keys.Xattr(path))
-	pipe.SRem(ctx, c.keys.Dir(parent), base)
-	_, err = pipe.Exec(ctx)
+	parentIno, err := c.lookup(ctx, ParentPath(path))
 	if err != nil {
-		return fmt.Errorf("rmdir: %w", err)
+		return err
+	}
+	if err := c.canUnlink(ctx, "rmdir", path, parentIno, meta); err != nil {
+		return err
 	}
+	if err := c.unlink(ctx, parentIno, BaseName(path), meta); err != nil {
+		return pathErr("rmdir", path, err)
+	}
+	c.notifyRmdir(ctx, path)
 	return nil
 }
 
@@ -269,8 +489,7 @@ func (c *Client) Rmdir(ctx context.Context, path string) error {
 
 // Touch creates a file or updates timestamps.
 func (c *Client) Touch(ctx context.Context, path string) error {
-	path = NormalizePath(path)
-	exists, err := c.Exists(ctx, path)
+	path, ino, err := c.walk(ctx, path, true, 0)
 	if err != nil {
 		return err
 	}
@@ -278,130 +497,257 @@ func (c *Client) Touch(ctx context.Context, path string) error {
 	now := time.Now().Unix()
 	nowStr := strconv.FormatInt(now, 10)
 
-	if exists {
-		_, err := c.rdb.HSet(ctx, c.keys.Meta(path), "mtime", nowStr, "atime", nowStr).Result()
-		return err
+	if ino != "" {
+		// Setting the times to now needs write access or ownership
+		if meta, err := c.statIno(ctx, ino); err != nil {
+			return err
+		} else if meta != nil && !c.id.owns(meta) {
+			if err := c.access("touch", path, meta, AccessWrite); err != nil {
+				return err
+			}
+		}
+		return c.store.HSet(ctx, c.keys.Meta(ino), map[string]string{"mtime": nowStr, "atime": nowStr})
 	}
 
 	// New file
-	parent := ParentPath(path)
-	isDir, err := c.IsDir(ctx, parent)
+	parentIno, err := c.lookupDir(ctx, ParentPath(path))
 	if err != nil {
 		return err
 	}
-	if !isDir {
-		return fmt.Errorf("touch: cannot touch '%s': No such file or directory", path)
+	if parentIno == "" {
+		return pathErr("touch", path, ErrNotExist)
+	}
+	if err := c.accessIno(ctx, "touch", path, parentIno, AccessWrite|AccessExec); err != nil {
+		return err
 	}
 
-	_, base := SplitPath(path)
-	meta := NewFileMeta("0644", 0)
-
-	pipe := c.rdb.TxPipeline()
-	pipe.Set(ctx, c.keys.Data(path), "", 0)
-	pipe.HSet(ctx, c.keys.Meta(path), meta.ToMap())
-	pipe.SAdd(ctx, c.keys.Dir(parent), base)
-	_, err = pipe.Exec(ctx)
+	ino, err = c.allocInode(ctx)
 	if err != nil {
 		return fmt.Errorf("touch: %w", err)
 	}
+	meta := c.own(NewFileMeta(c.createMode(0666), 0))
+
+	empty := ""
+	if err := c.link(ctx, parentIno, BaseName(path), ino, meta, &empty); err != nil {
+		return pathErr("touch", path, err)
+	}
+	c.notifyWrite(ctx, path, empty)
 	return nil
 }
 
+// Chtimes sets the access and modification times of path, following a
+// final symlink, like os.Chtimes. Setting other times than now is
+// restricted to the owner.
+func (c *Client) Chtimes(ctx context.Context, path string, atime, mtime time.Time) error {
+	path = NormalizePath(path)
+	meta, err := c.StatFollow(ctx, path)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		return pathErr("touch", path, ErrNotExist)
+	}
+	if !c.id.owns(meta) {
+		return pathErr("touch", path, ErrPermission)
+	}
+	return c.store.HSet(ctx, c.keys.Meta(meta.Ino), map[string]string{
+		"atime": strconv.FormatInt(atime.Unix(), 10),
+		"mtime": strconv.FormatInt(mtime.Unix(), 10),
+	})
+}
+
 // --- Cat (ReadFile) ---
 
 // ReadFile returns the content of a file.
 func (c *Client) ReadFile(ctx context.Context, path string) (string, error) {
+	meta, err := c.openFile(ctx, "cat", path)
+	if err != nil {
+		return "", err
+	}
+	if err := c.access("cat", path, meta, AccessRead); err != nil {
+		return "", err
+	}
+
+	data, err := c.readContent(ctx, meta)
+	if err != nil {
+		return "", pathErr("cat", path, err)
+	}
+	c.touchAtime(ctx, meta)
+	return data, nil
+}
+
+// ReadFileTo streams the content of a file to w chunk by chunk, so large
+// files are never held in memory at once. Returns the number of bytes written.
+func (c *Client) ReadFileTo(ctx context.Context, path string, w io.Writer) (int64, error) {
+	meta, err := c.openFile(ctx, "cat", path)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.access("cat", path, meta, AccessRead); err != nil {
+		return 0, err
+	}
+
+	n, err := c.streamContent(ctx, meta, w)
+	if err != nil {
+		return n, pathErr("cat", path, err)
+	}
+	c.touchAtime(ctx, meta)
+	return n, nil
+}
+
+// openFile resolves path, following symlinks, to the metadata of a file.
+// op prefixes error messages.
+func (c *Client) openFile(ctx context.Context, op, path string) (*Metadata, error) {
 	path = NormalizePath(path)
 
 	meta, err := c.Stat(ctx, path)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if meta == nil {
-		return "", fmt.Errorf("cat: %s: No such file or directory", path)
+		return nil, pathErr(op, path, ErrNotExist)
 	}
 	if meta.Type == TypeDir {
-		return "", fmt.Errorf("cat: %s: Is a directory", path)
+		return nil, pathErr(op, path, ErrIsDir)
 	}
 
 	// Follow symlinks
 	if meta.Type == TypeSymlink {
 		resolved, err := c.ResolveSymlink(ctx, path, 0)
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		meta, err = c.Stat(ctx, resolved)
+		if err != nil {
+			return nil, err
+		}
+		if meta == nil {
+			return nil, pathErr(op, path, ErrNotExist)
+		}
+		if meta.Type == TypeDir {
+			return nil, pathErr(op, path, ErrIsDir)
 		}
-		path = resolved
 	}
+	return meta, nil
+}
 
-	data, err := c.rdb.Get(ctx, c.keys.Data(path)).Result()
-	if err == redis.Nil {
-		return "", nil
-	}
-	if err != nil {
-		return "", fmt.Errorf("cat: %w", err)
-	}
+// StatFile returns the metadata of the regular file at path, following symlinks.
+func (c *Client) StatFile(ctx context.Context, path string) (*Metadata, error) {
+	return c.openFile(ctx, "stat", path)
+}
 
-	// Update atime
+// touchAtime records a read access, unless connected to a replica.
+func (c *Client) touchAtime(ctx context.Context, meta *Metadata) {
+	if c.readOnly || c.IsSnapshot() {
+		return
+	}
 	now := strconv.FormatInt(time.Now().Unix(), 10)
-	c.rdb.HSet(ctx, c.keys.Meta(path), "atime", now)
-
-	return data, nil
+	c.store.HSet(ctx, c.keys.Meta(meta.Ino), map[string]string{"atime": now})
 }
 
 // --- WriteFile (echo >) ---
 
 // WriteFile sets file content (truncate/overwrite).
 func (c *Client) WriteFile(ctx context.Context, path, content string) error {
-	path = NormalizePath(path)
+	return c.writeFile(ctx, path, content, "write")
+}
 
-	exists, err := c.Exists(ctx, path)
+// writeFile is WriteFile, recording the write as op when the file is
+// versioned.
+func (c *Client) writeFile(ctx context.Context, path, content, op string) error {
+	path, err := c.ResolveSymlink(ctx, path, 0)
 	if err != nil {
 		return err
 	}
 
-	now := strconv.FormatInt(time.Now().Unix(), 10)
-	size := strconv.Itoa(len(content))
+	meta, err := c.Stat(ctx, path)
+	if err != nil {
+		return err
+	}
+	policy, err := c.versioning(ctx, path)
+	if err != nil {
+		return pathErr("echo", path, err)
+	}
+	if err := c.seedHistory(ctx, path, meta, policy); err != nil {
+		return pathErr("echo", path, err)
+	}
+	if err := c.replaceContent(ctx, path, meta, content); err != nil {
+		return err
+	}
+	if err := c.recordVersion(ctx, path, op, &content, policy); err != nil {
+		return pathErr("echo", path, err)
+	}
+	return nil
+}
 
-	if exists {
-		meta, err := c.Stat(ctx, path)
-		if err != nil {
+// replaceContent writes content to the file at path, whose current entry
+// is meta, creating it when meta is nil.
+func (c *Client) replaceContent(ctx context.Context, path string, meta *Metadata, content string) error {
+	if meta != nil {
+		if meta.Type == TypeDir {
+			return pathErr("echo", path, ErrIsDir)
+		}
+		if err := c.access("echo", path, meta, AccessWrite); err != nil {
 			return err
 		}
-		if meta != nil && meta.Type == TypeDir {
-			return fmt.Errorf("echo: %s: Is a directory", path)
+		if meta.Chunks > 0 || c.needsChunks(int64(len(content))) {
+			if err := c.overwriteChunked(ctx, meta, content); err != nil {
+				return pathErr("echo", path, err)
+			}
+			if c.needsChunks(int64(len(content))) {
+				c.notifyChunked(ctx, path)
+			} else {
+				c.notifyWrite(ctx, path, content)
+			}
+			return nil
 		}
-		pipe := c.rdb.TxPipeline()
-		pipe.Set(ctx, c.keys.Data(path), content, 0)
-		pipe.HSet(ctx, c.keys.Meta(path), "size", size, "mtime", now)
-		_, err = pipe.Exec(ctx)
+		parentIno, err := c.lookup(ctx, ParentPath(path))
 		if err != nil {
 			return err
 		}
+		if _, err := c.writeData(ctx, parentIno, BaseName(path), meta.Ino, content, false); err != nil {
+			return pathErr("echo", path, err)
+		}
 		c.notifyWrite(ctx, path, content)
 		return nil
 	}
 
 	// New file
-	parent := ParentPath(path)
-	isDir, err := c.IsDir(ctx, parent)
+	parentIno, err := c.lookupDir(ctx, ParentPath(path))
 	if err != nil {
 		return err
 	}
-	if !isDir {
-		return fmt.Errorf("echo: %s: No such file or directory", ParentPath(path))
+	if parentIno == "" {
+		return pathErr("echo", path, ErrNotExist)
+	}
+	if err := c.accessIno(ctx, "echo", path, parentIno, AccessWrite|AccessExec); err != nil {
+		return err
 	}
 
-	_, base := SplitPath(path)
-	meta := NewFileMeta("0644", int64(len(content)))
-
-	pipe := c.rdb.TxPipeline()
-	pipe.Set(ctx, c.keys.Data(path), content, 0)
-	pipe.HSet(ctx, c.keys.Meta(path), meta.ToMap())
-	pipe.SAdd(ctx, c.keys.Dir(parent), base)
-	_, err = pipe.Exec(ctx)
+	ino, err := c.allocInode(ctx)
 	if err != nil {
 		return fmt.Errorf("echo: %w", err)
 	}
+	newMeta := c.own(NewFileMeta(c.createMode(0666), int64(len(content))))
+
+	if c.needsChunks(newMeta.Size) {
+		// Chunks are written first; they stay invisible until the entry is linked
+		n, err := c.writeChunks(ctx, ino, 0, content, c.chunkSize)
+		if err != nil {
+			return pathErr("echo", path, err)
+		}
+		newMeta.Chunks, newMeta.ChunkSize = n, c.chunkSize
+		if err := c.link(ctx, parentIno, BaseName(path), ino, newMeta, nil); err != nil {
+			c.dropChunks(ctx, ino, 0, n)
+			return pathErr("echo", path, err)
+		}
+		c.notifyChunked(ctx, path)
+		return nil
+	}
+
+	if err := c.link(ctx, parentIno, BaseName(path), ino, newMeta, &content); err != nil {
+		return pathErr("echo", path, err)
+	}
 	c.notifyWrite(ctx, path, content)
 	return nil
 }
@@ -410,44 +756,51 @@ func (c *Client) WriteFile(ctx context.Context, path, content string) error {
 
 // AppendFile appends content to a file.
 func (c *Client) AppendFile(ctx context.Context, path, content string) error {
-	path = NormalizePath(path)
-
-	exists, err := c.Exists(ctx, path)
+	path, err := c.ResolveSymlink(ctx, path, 0)
 	if err != nil {
 		return err
 	}
 
-	if !exists {
-		return c.WriteFile(ctx, path, content)
-	}
-
 	meta, err := c.Stat(ctx, path)
 	if err != nil {
 		return err
 	}
-	if meta != nil && meta.Type == TypeDir {
-		return fmt.Errorf("echo: %s: Is a directory", path)
-	}
 
-	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if meta == nil {
+		return c.WriteFile(ctx, path, content)
+	}
+	if meta.Type == TypeDir {
+		return pathErr("echo", path, ErrIsDir)
+	}
+	if err := c.access("echo", path, meta, AccessWrite); err != nil {
+		return err
+	}
+	return c.versionedWrite(ctx, "append", path, meta, func() error {
+		return c.appendContent(ctx, path, meta, content)
+	})
+}
 
-	pipe := c.rdb.TxPipeline()
-	pipe.Append(ctx, c.keys.Data(path), content)
-	strlenCmd := pipe.StrLen(ctx, c.keys.Data(path))
-	_, err = pipe.Exec(ctx)
-	if err != nil {
-		return fmt.Errorf("echo: %w", err)
+// appendContent appends content to the file at path, whose entry is meta.
+func (c *Client) appendContent(ctx context.Context, path string, meta *Metadata, content string) error {
+	if meta.Chunks > 0 || c.needsChunks(meta.Size+int64(len(content))) {
+		if err := c.appendChunked(ctx, meta, content); err != nil {
+			return pathErr("echo", path, err)
+		}
+		c.notifyChunked(ctx, path)
+		return nil
 	}
 
-	newSize := strconv.FormatInt(strlenCmd.Val(), 10)
-	_, err = c.rdb.HSet(ctx, c.keys.Meta(path), "size", newSize, "mtime", now).Result()
+	parentIno, err := c.lookup(ctx, ParentPath(path))
 	if err != nil {
 		return err
 	}
+	if _, err := c.writeData(ctx, parentIno, BaseName(path), meta.Ino, content, true); err != nil {
+		return pathErr("echo", path, err)
+	}
 
 	// Re-index with full content
-	if c.observer != nil {
-		fullContent, readErr := c.rdb.Get(ctx, c.keys.Data(path)).Result()
+	if len(c.observers) > 0 {
+		fullContent, readErr := c.store.Get(ctx, c.keys.Data(meta.Ino))
 		if readErr == nil {
 			c.notifyWrite(ctx, path, fullContent)
 		}
@@ -461,7 +814,7 @@ func (c *Client) AppendFile(ctx context.Context, path, content string) error {
 func (c *Client) Remove(ctx context.Context, path string) error {
 	path = NormalizePath(path)
 	if path == "/" {
-		return fmt.Errorf("rm: cannot remove root directory")
+		return pathErr("rm", path, ErrBusy)
 	}
 
 	meta, err := c.Stat(ctx, path)
@@ -469,23 +822,45 @@ func (c *Client) Remove(ctx context.Context, path string) error {
 		return err
 	}
 	if meta == nil {
-		return fmt.Errorf("rm: cannot remove '%s': No such file or directory", path)
+		return pathErr("rm", path, ErrNotExist)
 	}
 	if meta.Type == TypeDir {
-		return fmt.Errorf("rm: cannot remove '%s': Is a directory", path)
+		return pathErr("rm", path, ErrIsDir)
+	}
+
+	parentIno, err := c.lookup(ctx, ParentPath(path))
+	if err != nil {
+		return err
+	}
+	if err := c.canUnlink(ctx, "rm", path, parentIno, meta); err != nil {
+		return err
 	}
 
-	parent, base := SplitPath(path)
-	pipe := c.rdb.TxPipeline()
-	pipe.Del(ctx, c.keys.Meta(path))
-	pipe.Del(ctx, c.keys.Data(path))
-	pipe.Del(ctx, c.keys.Xattr(path))
-	pipe.SRem(ctx, c.keys.Dir(parent), base)
-	_, err = pipe.Exec(ctx)
+	policies, err := c.VersioningPolicies(ctx)
 	if err != nil {
-		return fmt.Errorf("rm: %w", err)
+		return pathErr("rm", path, err)
+	}
+	return c.removeFile(ctx, parentIno, path, meta, policies)
+}
+
+// removeFile unlinks the file meta at path from parentIno, recording the
+// removal when the file is versioned under policies.
+func (c *Client) removeFile(ctx context.Context, parentIno, path string, meta *Metadata, policies map[string]VersionPolicy) error {
+	var policy *VersionPolicy
+	if len(policies) > 0 && meta.Type == TypeFile {
+		path, _ = c.canonical(ctx, path)
+		policy = enabledPolicy(policies, path)
+	}
+	if err := c.seedHistory(ctx, path, meta, policy); err != nil {
+		return pathErr("rm", path, err)
+	}
+	if err := c.unlink(ctx, parentIno, BaseName(path), meta); err != nil {
+		return pathErr("rm", path, err)
 	}
 	c.notifyRemove(ctx, path)
+	if err := c.recordVersion(ctx, path, "rm", nil, policy); err != nil {
+		return pathErr("rm", path, err)
+	}
 	return nil
 }
 
@@ -493,7 +868,7 @@ func (c *Client) Remove(ctx context.Context, path string) error {
 func (c *Client) RemoveRecursive(ctx context.Context, path string) error {
 	path = NormalizePath(path)
 	if path == "/" {
-		return fmt.Errorf("rm: cannot remove root directory")
+		return pathErr("rm", path, ErrBusy)
 	}
 
 	meta, err := c.Stat(ctx, path)
@@ -501,129 +876,312 @@ func (c *Client) RemoveRecursive(ctx context.Context, path string) error {
 		return err
 	}
 	if meta == nil {
-		return fmt.Errorf("rm: cannot remove '%s': No such file or directory", path)
+		return pathErr("rm", path, ErrNotExist)
 	}
 
 	if meta.Type != TypeDir {
 		return c.Remove(ctx, path)
 	}
 
+	parentIno, err := c.lookup(ctx, ParentPath(path))
+	if err != nil {
+		return err
+	}
+	if err := c.canUnlink(ctx, "rm", path, parentIno, meta); err != nil {
+		return err
+	}
+
+	policies, err := c.VersioningPolicies(ctx)
+	if err != nil {
+		return pathErr("rm", path, err)
+	}
+
 	// DFS traversal
-	children, err := c.ReadDir(ctx, path)
+	if err := c.removeChildren(ctx, path, meta.Ino, policies); err != nil {
+		return err
+	}
+
+	// Remove the directory itself
+	if err := c.unlink(ctx, parentIno, BaseName(path), meta); err != nil {
+		return pathErr("rm", path, err)
+	}
+	c.notifyRmdir(ctx, path)
+	return nil
+}
+
+// removeChildren deletes every descendant of the directory inode dirIno,
+// recording the removal of files versioned under policies.
+func (c *Client) removeChildren(ctx context.Context, dirPath, dirIno string, policies map[string]VersionPolicy) error {
+	if err := c.accessIno(ctx, "rm", dirPath, dirIno, AccessRead|AccessWrite|AccessExec); err != nil {
+		return err
+	}
+	children, err := c.readDirIno(ctx, dirIno)
 	if err != nil {
 		return err
 	}
 	for _, child := range children {
-		childPath := JoinPath(path, child)
-		if err := c.RemoveRecursive(ctx, childPath); err != nil {
+		childPath := JoinPath(dirPath, child.Name)
+		if child.Meta == nil {
+			// Dangling entry: drop the name only
+			c.store.HDel(ctx, c.keys.Dir(dirIno), child.Name)
+			continue
+		}
+		if err := c.canUnlink(ctx, "rm", childPath, dirIno, child.Meta); err != nil {
 			return err
 		}
+		if child.Meta.Type == TypeDir {
+			if err := c.removeChildren(ctx, childPath, child.Meta.Ino, policies); err != nil {
+				return err
+			}
+		}
+		if child.Meta.Type == TypeFile {
+			if err := c.removeFile(ctx, dirIno, childPath, child.Meta, policies); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.unlink(ctx, dirIno, child.Name, child.Meta); err != nil {
+			return pathErr("rm", childPath, err)
+		}
+		if child.Meta.Type == TypeDir {
+			c.notifyRmdir(ctx, childPath)
+		} else {
+			c.notifyRemove(ctx, childPath)
+		}
 	}
-
-	// Remove the directory itself
-	parent, base := SplitPath(path)
-	pipe := c.rdb.TxPipeline()
-	pipe.Del(ctx, c.keys.Meta(path))
-	pipe.Del(ctx, c.keys.Dir(path))
-	pipe.Del(ctx, c.keys.Xattr(path))
-	pipe.SRem(ctx, c.keys.Dir(parent), base)
-	_, err = pipe.Exec(ctx)
-	return err
+	return nil
 }
 
 // --- Copy ---
 
+// destination resolves the target of cp or mv: when dst is, or links to,
+// an existing directory, src goes inside it under its own name. Returns
+// the target path and the entry already there, if any.
+func (c *Client) destination(ctx context.Context, src, dst string) (string, *Metadata, error) {
+	dir, err := c.StatFollow(ctx, dst)
+	if err != nil {
+		return "", nil, err
+	}
+	if dir != nil && dir.Type == TypeDir {
+		if dst, err = c.ResolveSymlink(ctx, dst, 0); err != nil {
+			return "", nil, err
+		}
+		dst = JoinPath(dst, BaseName(src))
+	}
+	meta, err := c.Stat(ctx, dst)
+	return dst, meta, err
+}
+
 // CopyFile copies a single file.
 func (c *Client) CopyFile(ctx context.Context, src, dst string) error {
 	src = NormalizePath(src)
 	dst = NormalizePath(dst)
 
-	// Check if dst is an existing directory
-	dstMeta, err := c.Stat(ctx, dst)
+	dst, dstMeta, err := c.destination(ctx, src, dst)
 	if err != nil {
 		return err
 	}
-	if dstMeta != nil && dstMeta.Type == TypeDir {
-		dst = JoinPath(dst, BaseName(src))
-	}
 
 	srcMeta, err := c.Stat(ctx, src)
 	if err != nil {
 		return err
 	}
 	if srcMeta == nil {
-		return fmt.Errorf("cp: cannot stat '%s': No such file or directory", src)
+		return pathErr("cp", src, ErrNotExist)
 	}
 	if srcMeta.Type == TypeDir {
-		return fmt.Errorf("cp: -r not specified; omitting directory '%s'", src)
+		return pathErr("cp", src, ErrIsDir)
 	}
-
-	data, err := c.rdb.Get(ctx, c.keys.Data(src)).Result()
-	if err != nil && err != redis.Nil {
-		return fmt.Errorf("cp: %w", err)
+	if dstMeta != nil && dstMeta.Type == TypeDir {
+		return pathErr("cp", dst, ErrIsDir)
+	}
+	// src and dst are the same file, possibly through a hard link
+	if dstMeta != nil && dstMeta.Ino == srcMeta.Ino {
+		return pathErr("cp", dst, ErrInvalid)
+	}
+	if err := c.access("cp", src, srcMeta, AccessRead); err != nil {
+		return err
 	}
 
-	dstParent := ParentPath(dst)
-	isDir, err := c.IsDir(ctx, dstParent)
+	dstParentIno, err := c.lookupDir(ctx, ParentPath(dst))
 	if err != nil {
 		return err
 	}
-	if !isDir {
-		return fmt.Errorf("cp: cannot create '%s': No such file or directory", dst)
+	if dstParentIno == "" {
+		return pathErr("cp", dst, ErrNotExist)
+	}
+	if dstMeta != nil {
+		err = c.access("cp", dst, dstMeta, AccessWrite)
+	} else {
+		err = c.accessIno(ctx, "cp", dst, dstParentIno, AccessWrite|AccessExec)
+	}
+	if err != nil {
+		return err
 	}
 
+	return c.versionedWrite(ctx, "cp", dst, dstMeta, func() error {
+		return c.copyInto(ctx, srcMeta, dstParentIno, dst, dstMeta)
+	})
+}
+
+// copyInto copies the file srcMeta to dst, creating it in dstParentIno or
+// overwriting dstMeta in place.
+func (c *Client) copyInto(ctx context.Context, srcMeta *Metadata, dstParentIno, dst string, dstMeta *Metadata) error {
+	// The copy belongs to the caller, as with cp without -p
 	now := time.Now().Unix()
 	nowStr := strconv.FormatInt(now, 10)
 	newMeta := *srcMeta
+	c.own(&newMeta)
+	newMeta.Mode = c.createMode(srcMeta.FileMode())
 	newMeta.CTime = now
 	newMeta.MTime = now
 	newMeta.ATime = now
+	// An overwritten destination keeps its own links
+	newMeta.Nlink = 1
+	if dstMeta != nil {
+		newMeta.Nlink = dstMeta.Nlink
+	}
 
-	_, dstBase := SplitPath(dst)
-	pipe := c.rdb.TxPipeline()
-	pipe.Set(ctx, c.keys.Data(dst), data, 0)
-	pipe.HSet(ctx, c.keys.Meta(dst), newMeta.ToMap())
-	pipe.SAdd(ctx, c.keys.Dir(dstParent), dstBase)
-	// Update src atime
-	pipe.HSet(ctx, c.keys.Meta(src), "atime", nowStr)
-	_, err = pipe.Exec(ctx)
+	if srcMeta.Chunks > 0 {
+		if err := c.copyChunked(ctx, srcMeta, &newMeta, dstParentIno, dst, dstMeta); err != nil {
+			return err
+		}
+		c.store.HSet(ctx, c.keys.Meta(srcMeta.Ino), map[string]string{"atime": nowStr})
+		c.notifyChunked(ctx, dst)
+		return nil
+	}
+
+	data, err := c.store.Get(ctx, c.keys.Data(srcMeta.Ino))
 	if err != nil {
 		return fmt.Errorf("cp: %w", err)
 	}
+
+	if dstMeta == nil {
+		dstIno, err := c.allocInode(ctx)
+		if err != nil {
+			return fmt.Errorf("cp: %w", err)
+		}
+		if err := c.link(ctx, dstParentIno, BaseName(dst), dstIno, &newMeta, &data); err != nil {
+			return pathErr("cp", dst, err)
+		}
+		if err := c.copyXattrs(ctx, srcMeta.Ino, dstIno); err != nil {
+			return pathErr("cp", dst, err)
+		}
+	} else {
+		// Overwrite an existing destination in place, keeping its inode
+		err := c.store.Tx(ctx, func(tx Writer) {
+			tx.Del(c.keys.Meta(dstMeta.Ino))
+			tx.Set(c.keys.Data(dstMeta.Ino), data)
+			tx.HSet(c.keys.Meta(dstMeta.Ino), newMeta.ToMap())
+		})
+		if err != nil {
+			return fmt.Errorf("cp: %w", err)
+		}
+		c.dropChunks(ctx, chunkID(dstMeta.Ino, dstMeta.ChunkGen), 0, dstMeta.Chunks)
+		if err := c.copyXattrs(ctx, srcMeta.Ino, dstMeta.Ino); err != nil {
+			return pathErr("cp", dst, err)
+		}
+	}
+
+	// Update src atime
+	c.store.HSet(ctx, c.keys.Meta(srcMeta.Ino), map[string]string{"atime": nowStr})
 	c.notifyWrite(ctx, dst, data)
+	if len(newMeta.Tags) > 0 || (dstMeta != nil && len(dstMeta.Tags) > 0) {
+		c.notifyTags(ctx, dst, newMeta.Tags)
+	}
+	return nil
+}
+
+// copyChunked copies a chunked source file chunk by chunk to dst, creating
+// it in dstParentIno or overwriting dstMeta in place.
+func (c *Client) copyChunked(ctx context.Context, srcMeta, newMeta *Metadata, dstParentIno, dst string, dstMeta *Metadata) error {
+	if dstMeta == nil {
+		newMeta.ChunkGen = ""
+		dstIno, err := c.allocInode(ctx)
+		if err != nil {
+			return fmt.Errorf("cp: %w", err)
+		}
+		if err := c.copyChunks(ctx, srcMeta, dstIno); err != nil {
+			c.dropChunks(ctx, dstIno, 0, srcMeta.Chunks)
+			return fmt.Errorf("cp: %w", err)
+		}
+		if err := c.link(ctx, dstParentIno, BaseName(dst), dstIno, newMeta, nil); err != nil {
+			c.dropChunks(ctx, dstIno, 0, srcMeta.Chunks)
+			return pathErr("cp", dst, err)
+		}
+		return c.copyXattrs(ctx, srcMeta.Ino, dstIno)
+	}
+
+	// Into a new chunk generation: the destination keeps its content until
+	// the metadata switches to the copy
+	newMeta.ChunkGen = newChunkGen()
+	id := chunkID(dstMeta.Ino, newMeta.ChunkGen)
+	err := c.copyChunks(ctx, srcMeta, id)
+	if err == nil {
+		err = c.store.Tx(ctx, func(tx Writer) {
+			tx.Del(c.keys.Meta(dstMeta.Ino), c.keys.Data(dstMeta.Ino))
+			tx.HSet(c.keys.Meta(dstMeta.Ino), newMeta.ToMap())
+		})
+	}
+	if err != nil {
+		c.dropChunks(ctx, id, 0, srcMeta.Chunks)
+		return fmt.Errorf("cp: %w", err)
+	}
+	if err := c.dropChunks(ctx, chunkID(dstMeta.Ino, dstMeta.ChunkGen), 0, dstMeta.Chunks); err != nil {
+		return fmt.Errorf("cp: %w", err)
+	}
+	if err := c.copyXattrs(ctx, srcMeta.Ino, dstMeta.Ino); err != nil {
+		return pathErr("cp", dst, err)
+	}
 	return nil
 }
 
 // CopyRecursive copies a file or directory recursively.
 func (c *Client) CopyRecursive(ctx context.Context, src, dst string) error {
-	src = NormalizePath(src)
-	dst = NormalizePath(dst)
+	src, err := c.canonical(ctx, src)
+	if err != nil {
+		return err
+	}
+	if dst, err = c.canonical(ctx, dst); err != nil {
+		return err
+	}
 
 	srcMeta, err := c.Stat(ctx, src)
 	if err != nil {
 		return err
 	}
 	if srcMeta == nil {
-		return fmt.Errorf("cp: cannot stat '%s': No such file or directory", src)
+		return pathErr("cp", src, ErrNotExist)
 	}
 
-	// Check if dst is an existing directory
-	dstMeta, err := c.Stat(ctx, dst)
-	if err != nil {
+	if dst, _, err = c.destination(ctx, src, dst); err != nil {
 		return err
 	}
-	if dstMeta != nil && dstMeta.Type == TypeDir {
-		dst = JoinPath(dst, BaseName(src))
-	}
 
 	if srcMeta.Type != TypeDir {
 		return c.CopyFile(ctx, src, dst)
 	}
 
+	if dst == src || strings.HasPrefix(dst, src+"/") {
+		return pathErr("cp", dst, ErrInvalid)
+	}
+
 	// Create destination directory
 	if err := c.Mkdir(ctx, dst, true); err != nil {
 		return err
 	}
+	dstIno, err := c.lookup(ctx, dst)
+	if err != nil {
+		return err
+	}
+	if err := c.copyXattrs(ctx, srcMeta.Ino, dstIno); err != nil {
+		return pathErr("cp", dst, err)
+	}
+	if len(srcMeta.Tags) > 0 {
+		if err := c.store.HSet(ctx, c.keys.Meta(dstIno), map[string]string{"tags": strings.Join(srcMeta.Tags, ",")}); err != nil {
+			return pathErr("cp", dst, err)
+		}
+	}
 
 	// Recursively copy children
 	children, err := c.ReadDir(ctx, src)
@@ -642,70 +1200,114 @@ func (c *Client) CopyRecursive(ctx context.Context, src, dst string) error {
 
 // --- Move ---
 
-// Move moves/renames a file or directory.
+// Move moves/renames a file or directory. Only the two parent directory
+// entries change, so renaming a directory costs the same as renaming a file.
 func (c *Client) Move(ctx context.Context, src, dst string) error {
-	src = NormalizePath(src)
-	dst = NormalizePath(dst)
+	src, err := c.canonical(ctx, src)
+	if err != nil {
+		return err
+	}
+	if dst, err = c.canonical(ctx, dst); err != nil {
+		return err
+	}
 
 	srcMeta, err := c.Stat(ctx, src)
 	if err != nil {
 		return err
 	}
 	if srcMeta == nil {
-		return fmt.Errorf("mv: cannot stat '%s': No such file or directory", src)
+		return pathErr("mv", src, ErrNotExist)
+	}
+	if src == "/" {
+		return pathErr("mv", src, ErrBusy)
 	}
 
-	// Check if dst is an existing directory
-	dstMeta, err := c.Stat(ctx, dst)
+	dst, dstMeta, err := c.destination(ctx, src, dst)
 	if err != nil {
 		return err
 	}
-	if dstMeta != nil && dstMeta.Type == TypeDir {
-		dst = JoinPath(dst, BaseName(src))
+	// Two links to the same file: nothing to do, as with rename(2)
+	if dst == src || (dstMeta != nil && dstMeta.Ino == srcMeta.Ino) {
+		return nil
 	}
 
-	dstParent := ParentPath(dst)
-	isDir, err := c.IsDir(ctx, dstParent)
+	dstParentIno, err := c.lookupDir(ctx, ParentPath(dst))
 	if err != nil {
 		return err
 	}
-	if !isDir {
-		return fmt.Errorf("mv: cannot move '%s' to '%s': No such file or directory", src, dst)
+	if dstParentIno == "" {
+		return pathErr("mv", dst, ErrNotExist)
 	}
 
-	if srcMeta.Type == TypeDir {
-		return c.moveDir(ctx, src, dst)
+	if srcMeta.Type == TypeDir && strings.HasPrefix(dst, src+"/") {
+		return pathErr("mv", dst, ErrInvalid)
 	}
 
-	return c.moveFile(ctx, src, dst)
-}
-
-func (c *Client) moveFile(ctx context.Context, src, dst string) error {
-	srcParent, srcBase := SplitPath(src)
-	dstParent, dstBase := SplitPath(dst)
+	// An existing destination is replaced, as with rename(2)
+	if dstMeta != nil {
+		if dstMeta.Type == TypeDir && srcMeta.Type != TypeDir {
+			return pathErr("mv", dst, ErrIsDir)
+		}
+		if dstMeta.Type != TypeDir && srcMeta.Type == TypeDir {
+			return pathErr("mv", dst, ErrNotDir)
+		}
+		if dstMeta.Type == TypeDir {
+			n, err := c.store.HLen(ctx, c.keys.Dir(dstMeta.Ino))
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				return pathErr("mv", dst, ErrNotEmpty)
+			}
+		}
+	}
 
-	pipe := c.rdb.TxPipeline()
-	pipe.Rename(ctx, c.keys.Meta(src), c.keys.Meta(dst))
-	pipe.Rename(ctx, c.keys.Data(src), c.keys.Data(dst))
-	pipe.SRem(ctx, c.keys.Dir(srcParent), srcBase)
-	pipe.SAdd(ctx, c.keys.Dir(dstParent), dstBase)
-	_, err := pipe.Exec(ctx)
+	srcParentIno, err := c.lookup(ctx, ParentPath(src))
 	if err != nil {
-		return fmt.Errorf("mv: %w", err)
+		return err
+	}
+	if err := c.canUnlink(ctx, "mv", src, srcParentIno, srcMeta); err != nil {
+		return err
+	}
+	if dstMeta != nil {
+		err = c.canUnlink(ctx, "mv", dst, dstParentIno, dstMeta)
+	} else {
+		err = c.accessIno(ctx, "mv", dst, dstParentIno, AccessWrite|AccessExec)
+	}
+	if err != nil {
+		return err
 	}
 
-	// Best-effort rename xattr
-	c.rdb.Rename(ctx, c.keys.Xattr(src), c.keys.Xattr(dst))
-	c.notifyMove(ctx, src, dst)
-	return nil
-}
+	if srcMeta.Type != TypeDir {
+		// The file's content replaces what was at dst
+		return c.versionedWrite(ctx, "mv", dst, dstMeta, func() error {
+			err := c.rename(ctx, srcParentIno, BaseName(src), srcMeta, dstParentIno, BaseName(dst), dstMeta)
+			if err != nil {
+				return pathErr("mv", src, err)
+			}
+			c.notifyMove(ctx, src, dst)
+			return nil
+		})
+	}
 
-func (c *Client) moveDir(ctx context.Context, src, dst string) error {
-	// For directories, we need to recursively rename all children
-	if err := c.CopyRecursive(ctx, src, dst); err != nil {
-		return err
+	err = c.rename(ctx, srcParentIno, BaseName(src), srcMeta, dstParentIno, BaseName(dst), dstMeta)
+	if err != nil {
+		return pathErr("mv", src, err)
+	}
+
+	// Tell the observers about the directory and every file that moved
+	// with it
+	if len(c.observers) > 0 {
+		c.notifyMove(ctx, src, dst)
+		entries, err := c.Find(ctx, dst, "", "f")
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			c.notifyMove(ctx, src+strings.TrimPrefix(e.Path, dst), e.Path)
+		}
 	}
-	return c.RemoveRecursive(ctx, src)
+	return nil
 }
 
 // --- Symlink ---
@@ -719,84 +1321,121 @@ func (c *Client) Symlink(ctx context.Context, target, linkPath string) error {
 		return err
 	}
 	if exists {
-		return fmt.Errorf("ln: '%s': File exists", linkPath)
+		return pathErr("ln", linkPath, ErrExist)
 	}
 
-	parent := ParentPath(linkPath)
-	isDir, err := c.IsDir(ctx, parent)
+	parentIno, err := c.lookupDir(ctx, ParentPath(linkPath))
 	if err != nil {
 		return err
 	}
-	if !isDir {
-		return fmt.Errorf("ln: '%s': No such file or directory", linkPath)
+	if parentIno == "" {
+		return pathErr("ln", linkPath, ErrNotExist)
+	}
+	if err := c.accessIno(ctx, "ln", linkPath, parentIno, AccessWrite|AccessExec); err != nil {
+		return err
 	}
 
-	_, base := SplitPath(linkPath)
-	meta := NewSymlinkMeta(target)
-
-	pipe := c.rdb.TxPipeline()
-	pipe.HSet(ctx, c.keys.Meta(linkPath), meta.ToMap())
-	pipe.SAdd(ctx, c.keys.Dir(parent), base)
-	_, err = pipe.Exec(ctx)
+	ino, err := c.allocInode(ctx)
 	if err != nil {
 		return fmt.Errorf("ln: %w", err)
 	}
+	meta := c.own(NewSymlinkMeta(target))
+
+	if err := c.link(ctx, parentIno, BaseName(linkPath), ino, meta, nil); err != nil {
+		return pathErr("ln", linkPath, err)
+	}
+	c.notifySymlink(ctx, linkPath, target)
 	return nil
 }
 
-// ResolveSymlink follows symlinks to the final target.
-func (c *Client) ResolveSymlink(ctx context.Context, path string, depth int) (string, error) {
-	if depth >= maxSymlinkDepth {
-		return "", fmt.Errorf("too many levels of symbolic links: %s", path)
-	}
+// --- Link ---
 
-	meta, err := c.Stat(ctx, path)
+// Link creates newPath as a hard link to the file at oldPath: a second
+// directory entry for the same inode, sharing its content and metadata.
+// oldPath is not followed if it is a symlink. Directories cannot be linked.
+func (c *Client) Link(ctx context.Context, oldPath, newPath string) error {
+	oldPath = NormalizePath(oldPath)
+	newPath = NormalizePath(newPath)
+
+	meta, err := c.Stat(ctx, oldPath)
 	if err != nil {
-		return "", err
+		return err
 	}
 	if meta == nil {
-		return path, nil
+		return pathErr("ln", oldPath, ErrNotExist)
 	}
-	if meta.Type != TypeSymlink {
-		return path, nil
+	if meta.Type == TypeDir {
+		return pathErr("ln", oldPath, ErrNotPermitted)
 	}
 
-	target := meta.LinkTarget
-	if !strings.HasPrefix(target, "/") {
-		target = JoinPath(ParentPath(path), target)
+	exists, err := c.Exists(ctx, newPath)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return pathErr("ln", newPath, ErrExist)
 	}
 
-	return c.ResolveSymlink(ctx, target, depth+1)
+	parentIno, err := c.lookupDir(ctx, ParentPath(newPath))
+	if err != nil {
+		return err
+	}
+	if parentIno == "" {
+		return pathErr("ln", newPath, ErrNotExist)
+	}
+	if err := c.accessIno(ctx, "ln", newPath, parentIno, AccessWrite|AccessExec); err != nil {
+		return err
+	}
+
+	if err := c.hardlink(ctx, parentIno, BaseName(newPath), meta); err != nil {
+		return pathErr("ln", newPath, err)
+	}
+	c.notifyLink(ctx, oldPath, newPath)
+	return nil
+}
+
+// ResolveSymlink returns path with every symlink in it resolved, the final
+// one included. Unlike Realpath, the final entry need not exist. depth is
+// the number of links already followed to reach path.
+func (c *Client) ResolveSymlink(ctx context.Context, path string, depth int) (string, error) {
+	resolved, _, err := c.walk(ctx, path, true, depth)
+	return resolved, err
 }
 
 // --- Chmod / Chown ---
 
-// Chmod changes the mode of a path.
+// Chmod changes the mode of a path, following a final symlink.
 func (c *Client) Chmod(ctx context.Context, path, mode string) error {
 	path = NormalizePath(path)
-	exists, err := c.Exists(ctx, path)
+	meta, err := c.StatFollow(ctx, path)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("chmod: cannot access '%s': No such file or directory", path)
+	if meta == nil {
+		return pathErr("chmod", path, ErrNotExist)
 	}
-	_, err = c.rdb.HSet(ctx, c.keys.Meta(path), "mode", mode).Result()
-	return err
+	if !c.id.owns(meta) {
+		return pathErr("chmod", path, ErrPermission)
+	}
+	if err := c.store.HSet(ctx, c.keys.Meta(meta.Ino), map[string]string{"mode": mode}); err != nil {
+		return err
+	}
+	c.notifyChmod(ctx, path, mode)
+	return nil
 }
 
-// Chown changes the uid and/or gid of a path.
+// Chown changes the uid and/or gid of a path, following a final symlink.
 func (c *Client) Chown(ctx context.Context, path, owner string) error {
 	path = NormalizePath(path)
-	exists, err := c.Exists(ctx, path)
+	meta, err := c.StatFollow(ctx, path)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("chown: cannot access '%s': No such file or directory", path)
+	if meta == nil {
+		return pathErr("chown", path, ErrNotExist)
 	}
 
-	fields := map[string]interface{}{}
+	fields := map[string]string{}
 	parts := strings.SplitN(owner, ":", 2)
 	if parts[0] != "" {
 		fields["uid"] = parts[0]
@@ -806,11 +1445,35 @@ func (c *Client) Chown(ctx context.Context, path, owner string) error {
 	}
 
 	if len(fields) == 0 {
-		return fmt.Errorf("chown: invalid owner: '%s'", owner)
+		return pathErr("chown", owner, ErrInvalid)
 	}
 
-	_, err = c.rdb.HSet(ctx, c.keys.Meta(path), fields).Result()
-	return err
+	// Only root gives files away; an owner may only change the group to
+	// their own
+	if !c.id.IsRoot() {
+		if !c.id.owns(meta) {
+			return pathErr("chown", path, ErrPermission)
+		}
+		if uid, ok := fields["uid"]; ok && uid != meta.UID {
+			return pathErr("chown", path, ErrPermission)
+		}
+		if gid, ok := fields["gid"]; ok && gid != meta.GID && gid != strconv.Itoa(c.id.GID) {
+			return pathErr("chown", path, ErrPermission)
+		}
+	}
+
+	if err := c.store.HSet(ctx, c.keys.Meta(meta.Ino), fields); err != nil {
+		return err
+	}
+	uid, gid := meta.UID, meta.GID
+	if v, ok := fields["uid"]; ok {
+		uid = v
+	}
+	if v, ok := fields["gid"]; ok {
+		gid = v
+	}
+	c.notifyChown(ctx, path, uid, gid)
+	return nil
 }
 
 // --- Find ---
@@ -821,35 +1484,67 @@ type FindEntry struct {
 	Meta *Metadata
 }
 
+// FindOptions selects the entries FindWith returns.
+type FindOptions struct {
+	Name   string   // glob matched against the base name
+	Type   string   // "f", "d" or "l"
+	Tags   []string // tags every entry must carry
+	Follow bool     // follow symlinks, as find -L
+}
+
 // Find recursively walks the tree from root, optionally filtering by name glob and type.
+// Directories the client's identity cannot list are not descended into.
 func (c *Client) Find(ctx context.Context, root string, namePattern string, typeFilter string) ([]FindEntry, error) {
+	return c.FindWith(ctx, root, FindOptions{Name: namePattern, Type: typeFilter})
+}
+
+// FindWith is Find with the full set of options. With opts.Follow, each
+// symlink is reported as the entry it points to, under the link's path,
+// and directories are descended into through links; broken links stay
+// symlinks, and a link back to a directory being walked is not followed.
+func (c *Client) FindWith(ctx context.Context, root string, opts FindOptions) ([]FindEntry, error) {
 	root = NormalizePath(root)
+	meta, err := c.Stat(ctx, root)
+	if err != nil || meta == nil {
+		return nil, err
+	}
 	var results []FindEntry
-	err := c.findWalk(ctx, root, namePattern, typeFilter, &results)
+	err = c.findWalk(ctx, root, meta, opts, map[string]bool{}, &results)
 	return results, err
 }
 
-func (c *Client) findWalk(ctx context.Context, path, namePattern, typeFilter string, results *[]FindEntry) error {
-	meta, err := c.Stat(ctx, path)
-	if err != nil {
-		return err
-	}
-	if meta == nil {
-		return nil
+// findWalk visits path and its descendants. walking holds the directory
+// inodes between the root and path, for loop detection under Follow.
+func (c *Client) findWalk(ctx context.Context, path string, meta *Metadata, opts FindOptions, walking map[string]bool, results *[]FindEntry) error {
+	if opts.Follow && meta.Type == TypeSymlink {
+		target, err := c.StatFollow(ctx, path)
+		// Links that cannot be followed are reported as links
+		if err != nil && !errors.Is(err, ErrLoop) && !errors.Is(err, ErrPermission) {
+			return err
+		}
+		if target != nil {
+			meta = target
+		}
 	}
 
-	if matchesFind(path, meta, namePattern, typeFilter) {
+	if matchesFind(path, meta, opts.Name, opts.Type) && hasTags(meta, opts.Tags) {
 		*results = append(*results, FindEntry{Path: path, Meta: meta})
 	}
 
-	if meta.Type == TypeDir {
-		children, err := c.ReadDir(ctx, path)
+	// Directories the caller cannot list are reported but not descended into
+	if meta.Type == TypeDir && !walking[meta.Ino] && c.id.Can(meta, AccessRead|AccessExec) {
+		children, err := c.readDirIno(ctx, meta.Ino)
 		if err != nil {
 			return err
 		}
+		walking[meta.Ino] = true
+		defer delete(walking, meta.Ino)
 		for _, child := range children {
-			childPath := JoinPath(path, child)
-			if err := c.findWalk(ctx, childPath, namePattern, typeFilter, results); err != nil {
+			if child.Meta == nil {
+				continue
+			}
+			childPath := JoinPath(path, child.Name)
+			if err := c.findWalk(ctx, childPath, child.Meta, opts, walking, results); err != nil {
 				return err
 			}
 		}
@@ -884,7 +1579,7 @@ func matchesFind(path string, meta *Metadata, namePattern, typeFilter string) bo
 	return true
 }
 
-// matchGlob performs simple glob matching (supports *, ?).
+// matchGlob performs simple glob matching (supports *, ? and \ escapes).
 func matchGlob(pattern, name string) (bool, error) {
 	return globMatch(pattern, name), nil
 }
@@ -896,7 +1591,10 @@ func globMatch(pattern, name string) bool {
 	px, nx := 0, 0
 	starPx, starNx := -1, -1
 	for nx < len(name) {
-		if px < len(pattern) && (pattern[px] == '?' || pattern[px] == name[nx]) {
+		if px+1 < len(pattern) && pattern[px] == '\\' && pattern[px+1] == name[nx] {
+			px += 2
+			nx++
+		} else if px < len(pattern) && pattern[px] != '\\' && (pattern[px] == '?' || pattern[px] == name[nx]) {
 			px++
 			nx++
 		} else if px < len(pattern) && pattern[px] == '*' {
@@ -919,26 +1617,26 @@ func globMatch(pattern, name string) bool {
 
 // --- Volume ---
 
-// ListVolumes scans for volume root meta keys.
+// ListVolumes scans for volume superblocks and legacy root meta keys.
 func (c *Client) ListVolumes(ctx context.Context) ([]string, error) {
 	var volumes []string
-	var cursor uint64
-	for {
-		keys, nextCursor, err := c.rdb.Scan(ctx, cursor, VolumeRootPattern(), 100).Result()
+	seen := make(map[string]bool)
+	for _, pattern := range []string{VolumeRootPattern(), LegacyVolumeRootPattern()} {
+		err := c.store.Scan(ctx, pattern, func(keys []string) error {
+			for _, key := range keys {
+				vol := VolumeFromKey(key)
+				if vol == "" || seen[vol] || strings.Contains(vol, "@") {
+					// Snapshots are listed by Snapshots
+					continue
+				}
+				seen[vol] = true
+				volumes = append(volumes, vol)
+			}
+			return nil
+		})
 		if err != nil {
 			return nil, fmt.Errorf("vol list: %w", err)
 		}
-		for _, key := range keys {
-			// Extract volume name from fs:{vol}:meta:/
-			parts := strings.SplitN(key, ":", 4)
-			if len(parts) >= 3 {
-				volumes = append(volumes, parts[1])
-			}
-		}
-		cursor = nextCursor
-		if cursor == 0 {
-			break
-		}
 	}
 	return volumes, nil
 }
@@ -961,7 +1659,7 @@ func (c *Client) Tree(ctx context.Context, root string, maxDepth int) (*TreeEntr
 		return nil, 0, 0, err
 	}
 	if meta == nil {
-		return nil, 0, 0, fmt.Errorf("tree: '%s': No such file or directory", root)
+		return nil, 0, 0, pathErr("tree", root, ErrNotExist)
 	}
 
 	entry := &TreeEntry{
@@ -972,7 +1670,10 @@ func (c *Client) Tree(ctx context.Context, root string, maxDepth int) (*TreeEntr
 
 	dirCount, fileCount := 0, 0
 	if meta.Type == TypeDir {
-		if err := c.buildTree(ctx, root, entry, 1, maxDepth, &dirCount, &fileCount); err != nil {
+		if err := c.access("tree", root, meta, AccessRead|AccessExec); err != nil {
+			return nil, 0, 0, err
+		}
+		if err := c.buildTree(ctx, root, entry, meta.Ino, 1, maxDepth, &dirCount, &fileCount); err != nil {
 			return nil, 0, 0, err
 		}
 	} else {
@@ -982,35 +1683,35 @@ func (c *Client) Tree(ctx context.Context, root string, maxDepth int) (*TreeEntr
 	return entry, dirCount, fileCount, nil
 }
 
-func (c *Client) buildTree(ctx context.Context, path string, entry *TreeEntry, depth, maxDepth int, dirCount, fileCount *int) error {
+func (c *Client) buildTree(ctx context.Context, path string, entry *TreeEntry, ino string, depth, maxDepth int, dirCount, fileCount *int) error {
 	if maxDepth > 0 && depth > maxDepth {
 		return nil
 	}
 
-	children, err := c.ReadDir(ctx, path)
+	children, err := c.readDirIno(ctx, ino)
 	if err != nil {
 		return err
 	}
 
-	for _, childName := range children {
-		childPath := JoinPath(path, childName)
-		childMeta, err := c.Stat(ctx, childPath)
-		if err != nil {
-			return err
-		}
-		if childMeta == nil {
+	for _, child := range children {
+		if child.Meta == nil {
 			continue
 		}
+		childPath := JoinPath(path, child.Name)
 
 		childEntry := TreeEntry{
-			Name: childName,
+			Name: child.Name,
 			Path: childPath,
-			Type: childMeta.Type,
+			Type: child.Meta.Type,
 		}
 
-		if childMeta.Type == TypeDir {
+		if child.Meta.Type == TypeDir {
 			*dirCount++
-			if err := c.buildTree(ctx, childPath, &childEntry, depth+1, maxDepth, dirCount, fileCount); err != nil {
+			if !c.id.Can(child.Meta, AccessRead|AccessExec) {
+				entry.Children = append(entry.Children, childEntry)
+				continue
+			}
+			if err := c.buildTree(ctx, childPath, &childEntry, child.Meta.Ino, depth+1, maxDepth, dirCount, fileCount); err != nil {
 				return err
 			}
 		} else {
@@ -1034,19 +1735,116 @@ type GrepResult struct {
 // --- Observer helpers ---
 
 func (c *Client) notifyWrite(ctx context.Context, path, content string) {
-	if c.observer != nil {
-		c.observer.OnFileWrite(ctx, path, content)
+	if len(c.observers) == 0 {
+		return
+	}
+	path, _ = c.canonical(ctx, path)
+	for _, obs := range c.observers {
+		obs.OnFileWrite(ctx, path, content)
 	}
 }
 
 func (c *Client) notifyRemove(ctx context.Context, path string) {
-	if c.observer != nil {
-		c.observer.OnFileRemove(ctx, path)
+	if len(c.observers) == 0 {
+		return
+	}
+	path, _ = c.canonical(ctx, path)
+	for _, obs := range c.observers {
+		obs.OnFileRemove(ctx, path)
+	}
+}
+
+// notifyChunked reports a write to a chunked file. Chunked files are too
+// large to pass along, so observers only get the new size.
+func (c *Client) notifyChunked(ctx context.Context, path string) {
+	if len(c.observers) == 0 {
+		return
+	}
+	var size int64
+	if meta, err := c.Stat(ctx, path); err == nil && meta != nil {
+		size = meta.Size
+	}
+	path, _ = c.canonical(ctx, path)
+	for _, obs := range c.observers {
+		obs.OnChunkedWrite(ctx, path, size)
 	}
 }
 
 func (c *Client) notifyMove(ctx context.Context, oldPath, newPath string) {
-	if c.observer != nil {
-		c.observer.OnFileMove(ctx, oldPath, newPath)
+	for _, obs := range c.observers {
+		obs.OnFileMove(ctx, oldPath, newPath)
+	}
+}
+
+func (c *Client) notifyLink(ctx context.Context, oldPath, newPath string) {
+	if len(c.observers) == 0 {
+		return
+	}
+	oldPath, _ = c.canonical(ctx, oldPath)
+	newPath, _ = c.canonical(ctx, newPath)
+	for _, obs := range c.observers {
+		obs.OnLink(ctx, oldPath, newPath)
+	}
+}
+
+func (c *Client) notifyMkdir(ctx context.Context, path string) {
+	if len(c.observers) == 0 {
+		return
+	}
+	path, _ = c.canonical(ctx, path)
+	for _, obs := range c.observers {
+		obs.OnMkdir(ctx, path)
+	}
+}
+
+func (c *Client) notifyRmdir(ctx context.Context, path string) {
+	if len(c.observers) == 0 {
+		return
+	}
+	path, _ = c.canonical(ctx, path)
+	for _, obs := range c.observers {
+		obs.OnRmdir(ctx, path)
+	}
+}
+
+func (c *Client) notifySymlink(ctx context.Context, path, target string) {
+	if len(c.observers) == 0 {
+		return
+	}
+	path, _ = c.canonical(ctx, path)
+	for _, obs := range c.observers {
+		obs.OnSymlink(ctx, path, target)
+	}
+}
+
+func (c *Client) notifyChmod(ctx context.Context, path, mode string) {
+	if len(c.observers) == 0 {
+		return
+	}
+	path, _ = c.canonical(ctx, path)
+	for _, obs := range c.observers {
+		obs.OnChmod(ctx, path, mode)
+	}
+}
+
+func (c *Client) notifyChown(ctx context.Context, path, uid, gid string) {
+	if len(c.observers) == 0 {
+		return
+	}
+	path, _ = c.canonical(ctx, path)
+	for _, obs := range c.observers {
+		obs.OnChown(ctx, path, uid, gid)
+	}
+}
+
+func (c *Client) notifyTags(ctx context.Context, path string, tags []string) {
+	if len(c.observers) == 0 {
+		return
+	}
+	path, _ = c.canonical(ctx, path)
+	for _, obs := range c.observers {
+		if to, ok := obs.(TagObserver); ok {
+			to.OnTagsChange(ctx, path, tags)
+		}
 	}
 }
@@ -0,0 +1,1726 @@
+package fs
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestClient returns a client on a fresh, initialized in-memory volume.
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	c := NewClientWithBackend(NewMemoryBackend(), "test")
+	if err := c.Init(context.Background()); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	return c
+}
+
+func TestClientFileOps(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	if err := c.Mkdir(ctx, "/a/b", true); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if err := c.WriteFile(ctx, "/a/f", "hello"); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := c.AppendFile(ctx, "/a/f", " world"); err != nil {
+		t.Fatalf("AppendFile: %v", err)
+	}
+	if err := c.CopyFile(ctx, "/a/f", "/a/b"); err != nil {
+		t.Fatalf("CopyFile: %v", err)
+	}
+	if err := c.Move(ctx, "/a/b", "/c"); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+
+	got, err := c.ReadFile(ctx, "/c/f")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got != "hello world" {
+		t.Errorf("ReadFile = %q, want %q", got, "hello world")
+	}
+
+	meta, err := c.Stat(ctx, "/c/f")
+	if err != nil || meta == nil {
+		t.Fatalf("Stat = %v, %v", meta, err)
+	}
+	if meta.Size != int64(len("hello world")) {
+		t.Errorf("Size = %d, want %d", meta.Size, len("hello world"))
+	}
+
+	if err := c.RemoveRecursive(ctx, "/c"); err != nil {
+		t.Fatalf("RemoveRecursive: %v", err)
+	}
+	if ok, _ := c.Exists(ctx, "/c/f"); ok {
+		t.Error("/c/f still exists after rm -r")
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.Mkdir(ctx, "/d", false)
+	c.WriteFile(ctx, "/d/f", "x")
+	c.Symlink(ctx, "/l2", "/l1")
+	c.Symlink(ctx, "/l1", "/l2")
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"cat missing", func() error { _, err := c.ReadFile(ctx, "/nope"); return err }(), ErrNotExist},
+		{"cat dir", func() error { _, err := c.ReadFile(ctx, "/d"); return err }(), ErrIsDir},
+		{"mkdir exists", c.Mkdir(ctx, "/d", false), ErrExist},
+		{"mkdir under file", c.Mkdir(ctx, "/d/f/g", true), ErrNotDir},
+		{"rmdir not empty", c.Rmdir(ctx, "/d"), ErrNotEmpty},
+		{"rm dir", c.Remove(ctx, "/d"), ErrIsDir},
+		{"symlink loop", func() error { _, err := c.ReadFile(ctx, "/l1"); return err }(), ErrLoop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pe *PathError
+			if !errors.As(tt.err, &pe) {
+				t.Fatalf("err = %v, want a *PathError", tt.err)
+			}
+			if !errors.Is(tt.err, tt.want) {
+				t.Errorf("err = %v, want %v", tt.err, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkedFiles(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.SetChunkSize(4)
+
+	content := "0123456789abcdef"
+	if err := c.WriteFile(ctx, "/big", content); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := c.AppendFile(ctx, "/big", "XYZ"); err != nil {
+		t.Fatalf("AppendFile: %v", err)
+	}
+	content += "XYZ"
+	if err := c.WriteAt(ctx, "/big", 2, "--"); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	content = content[:2] + "--" + content[4:]
+	if err := c.WriteAt(ctx, "/big", int64(len(content))+2, "!"); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	content += "\x00\x00!"
+
+	got, err := c.ReadFile(ctx, "/big")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got != content {
+		t.Errorf("ReadFile = %q, want %q", got, content)
+	}
+	part, err := c.ReadAt(ctx, "/big", 3, 6)
+	if err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if want := content[3:9]; part != want {
+		t.Errorf("ReadAt = %q, want %q", part, want)
+	}
+
+	meta, _ := c.Stat(ctx, "/big")
+	if want := (int64(len(content)) + 3) / 4; meta.Chunks != want {
+		t.Errorf("Chunks = %d, want %d", meta.Chunks, want)
+	}
+
+	// Shrinking below the chunk size drops every chunk
+	if err := c.WriteFile(ctx, "/big", "abc"); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	var chunks []string
+	c.store.Scan(ctx, c.keys.Prefix()+"chunk:*", func(keys []string) error {
+		chunks = append(chunks, keys...)
+		return nil
+	})
+	if len(chunks) > 0 {
+		t.Errorf("chunks left after shrink: %v", chunks)
+	}
+}
+
+// failBackend fails every write to file content, which a volume makes
+// conditional on its copy-on-write generation, once ok more have run. A
+// negative ok never fails.
+type failBackend struct {
+	Backend
+	ok int
+}
+
+func (b *failBackend) TxIf(ctx context.Context, key, field, value string, fn func(w Writer)) error {
+	if b.ok == 0 {
+		return errors.New("connection lost")
+	}
+	b.ok--
+	return b.Backend.TxIf(ctx, key, field, value, fn)
+}
+
+func TestChunkedOverwriteInterrupted(t *testing.T) {
+	ctx := context.Background()
+	fb := &failBackend{Backend: NewMemoryBackend(), ok: -1}
+	c := NewClientWithBackend(fb, "test")
+	if err := c.Init(ctx); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	c.SetChunkSize(4)
+
+	old := strings.Repeat("o", 40)
+	c.WriteFile(ctx, "/big", old)
+	c.Link(ctx, "/big", "/link")
+	meta := mustStat(t, c, "/big")
+
+	// The first batch of 8 chunks is written, the second fails
+	fb.ok = 1
+	if err := c.WriteFile(ctx, "/big", strings.Repeat("n", 48)); err == nil {
+		t.Fatal("interrupted overwrite succeeded")
+	}
+	fb.ok = -1
+	if got, _ := c.ReadFile(ctx, "/big"); got != old {
+		t.Errorf("after interrupted overwrite = %q, want the old content", got)
+	}
+	if m := mustStat(t, c, "/big"); m.ChunkGen != meta.ChunkGen || m.Size != 40 {
+		t.Errorf("meta after interrupted overwrite = %+v, want %+v", m, meta)
+	}
+
+	// A complete overwrite switches to new chunk keys and drops the old ones
+	if err := c.WriteFile(ctx, "/big", strings.Repeat("n", 48)); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	m := mustStat(t, c, "/big")
+	if m.ChunkGen == "" || m.Chunks != 12 {
+		t.Errorf("meta after overwrite = %+v, want 12 chunks in a new generation", m)
+	}
+	if n, _ := c.store.Exists(ctx, c.keys.Chunk(meta.Ino, 0)); n != 0 {
+		t.Error("overwrite kept the old chunks")
+	}
+	if got, _ := c.ReadFile(ctx, "/link"); got != strings.Repeat("n", 48) {
+		t.Errorf("through the other link = %q", got)
+	}
+}
+
+func TestMemoryBackendFunctions(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryBackend()
+	m.HSet(ctx, "meta:0", map[string]string{"type": "dir"})
+	m.HSet(ctx, "meta:1", map[string]string{"type": "file"})
+	m.HSet(ctx, "dir:0", map[string]string{"f": "1"})
+
+	link := func(parentMeta, name string) error {
+		_, err := m.Call(ctx, "fs_link", []string{parentMeta, "dir:0", "meta:2"}, name, "2", "", "type", "file")
+		return err
+	}
+	if err := link("meta:0", "f"); err != ErrExist {
+		t.Errorf("fs_link over existing = %v, want ErrExist", err)
+	}
+	if err := link("meta:1", "g"); err != ErrNotDir {
+		t.Errorf("fs_link under file = %v, want ErrNotDir", err)
+	}
+	if err := link("meta:9", "g"); err != ErrNotExist {
+		t.Errorf("fs_link under missing = %v, want ErrNotExist", err)
+	}
+	if err := link("meta:0", "g"); err != nil {
+		t.Errorf("fs_link = %v", err)
+	}
+
+	_, err := m.Call(ctx, "fs_unlink", []string{"dir:0", "meta:0", "data:0", "dir:0", "xattr:0"}, "", "0", "dir")
+	if err != ErrNotExist {
+		t.Errorf("fs_unlink of root = %v, want ErrNotExist", err)
+	}
+}
+
+func TestMemoryBackendStrings(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryBackend()
+
+	if n, _ := m.SetRange(ctx, "k", 3, "ab"); n != 5 {
+		t.Errorf("SetRange = %d, want 5", n)
+	}
+	if n, _ := m.Append(ctx, "k", "c"); n != 6 {
+		t.Errorf("Append = %d, want 6", n)
+	}
+	tests := []struct {
+		start, end int64
+		want       string
+	}{
+		{0, -1, "\x00\x00\x00abc"},
+		{3, 4, "ab"},
+		{-2, -1, "bc"},
+		{4, 100, "bc"},
+		{5, 2, ""},
+		{10, 20, ""},
+	}
+	for _, tt := range tests {
+		if got, _ := m.GetRange(ctx, "k", tt.start, tt.end); got != tt.want {
+			t.Errorf("GetRange(%d, %d) = %q, want %q", tt.start, tt.end, got, tt.want)
+		}
+	}
+
+	m.HSet(ctx, "h", map[string]string{"a": "1"})
+	m.HDel(ctx, "h", "a")
+	if n, _ := m.Exists(ctx, "h", "k"); n != 1 {
+		t.Errorf("Exists = %d, want 1 (empty hash is deleted)", n)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.Mkdir(ctx, "/shared", false)
+	c.WriteFile(ctx, "/shared/ro", "read only")
+	c.Mkdir(ctx, "/private", false)
+	c.Chmod(ctx, "/private", "0700")
+	c.Mkdir(ctx, "/tmp", false)
+	c.Chmod(ctx, "/tmp", "1777")
+
+	alice := Identity{UID: 1000, GID: 1000}
+	bob := Identity{UID: 1001, GID: 1001}
+	c.SetIdentity(alice)
+
+	if _, err := c.ReadFile(ctx, "/shared/ro"); err != nil {
+		t.Errorf("read of 0644 file: %v", err)
+	}
+	denied := []struct {
+		name string
+		err  error
+	}{
+		{"write", c.WriteFile(ctx, "/shared/ro", "x")},
+		{"create", c.WriteFile(ctx, "/shared/new", "x")},
+		{"rm", c.Remove(ctx, "/shared/ro")},
+		{"mkdir", c.Mkdir(ctx, "/shared/d", false)},
+		{"traverse", func() error { _, err := c.Stat(ctx, "/private/x"); return err }()},
+		{"chmod", c.Chmod(ctx, "/shared/ro", "0666")},
+		{"chown", c.Chown(ctx, "/tmp", "1000")},
+		{"chtimes", c.Chtimes(ctx, "/tmp", time.Unix(0, 0), time.Unix(0, 0))},
+	}
+	for _, tt := range denied {
+		if !errors.Is(tt.err, ErrPermission) {
+			t.Errorf("%s = %v, want ErrPermission", tt.name, tt.err)
+		}
+	}
+
+	// New entries belong to the caller and honour the umask
+	c.SetUmask(0077)
+	if err := c.WriteFile(ctx, "/tmp/a", "alice"); err != nil {
+		t.Fatalf("create in sticky dir: %v", err)
+	}
+	meta, _ := c.Stat(ctx, "/tmp/a")
+	if meta.UID != "1000" || meta.GID != "1000" || meta.Mode != "0600" {
+		t.Errorf("new file uid=%s gid=%s mode=%s, want 1000 1000 0600", meta.UID, meta.GID, meta.Mode)
+	}
+	if err := c.Chtimes(ctx, "/tmp/a", time.Unix(100, 0), time.Unix(200, 0)); err != nil {
+		t.Errorf("owner chtimes: %v", err)
+	}
+	if meta, _ := c.Stat(ctx, "/tmp/a"); meta.ATime != 100 || meta.MTime != 200 {
+		t.Errorf("atime=%d mtime=%d, want 100 200", meta.ATime, meta.MTime)
+	}
+
+	// The sticky bit keeps bob from removing alice's file
+	c.SetIdentity(bob)
+	if _, err := c.ReadFile(ctx, "/tmp/a"); !errors.Is(err, ErrPermission) {
+		t.Errorf("read of 0600 file = %v, want ErrPermission", err)
+	}
+	if err := c.Remove(ctx, "/tmp/a"); !errors.Is(err, ErrPermission) {
+		t.Errorf("rm in sticky dir = %v, want ErrPermission", err)
+	}
+	c.SetIdentity(alice)
+	if err := c.Remove(ctx, "/tmp/a"); err != nil {
+		t.Errorf("owner rm in sticky dir: %v", err)
+	}
+
+	c.SetIdentity(Superuser)
+	if err := c.WriteFile(ctx, "/private/x", "root"); err != nil {
+		t.Errorf("root write: %v", err)
+	}
+}
+
+func TestXattrs(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.SetChunkSize(4)
+	c.Mkdir(ctx, "/d", false)
+	c.WriteFile(ctx, "/d/f", "small")
+	c.WriteFile(ctx, "/d/big", "chunked content")
+
+	for _, p := range []string{"/d", "/d/f", "/d/big"} {
+		if err := c.SetXattr(ctx, p, "user.origin", p); err != nil {
+			t.Fatalf("SetXattr(%s): %v", p, err)
+		}
+	}
+	c.SetXattr(ctx, "/d/f", "user.empty", "")
+
+	if v, err := c.GetXattr(ctx, "/d/f", "user.empty"); err != nil || v != "" {
+		t.Errorf("GetXattr(empty) = %q, %v", v, err)
+	}
+	if _, err := c.GetXattr(ctx, "/d/f", "user.none"); !errors.Is(err, ErrNoAttr) {
+		t.Errorf("GetXattr(missing) = %v, want ErrNoAttr", err)
+	}
+	if err := c.RemoveXattr(ctx, "/d/f", "user.empty"); err != nil {
+		t.Errorf("RemoveXattr: %v", err)
+	}
+	if err := c.RemoveXattr(ctx, "/d/f", "user.empty"); !errors.Is(err, ErrNoAttr) {
+		t.Errorf("second RemoveXattr = %v, want ErrNoAttr", err)
+	}
+
+	if err := c.CopyRecursive(ctx, "/d", "/e"); err != nil {
+		t.Fatalf("CopyRecursive: %v", err)
+	}
+	for _, p := range []string{"/d", "/d/f", "/d/big"} {
+		attrs, err := c.ListXattr(ctx, "/e"+p[2:])
+		if err != nil || len(attrs) != 1 || attrs["user.origin"] != p {
+			t.Errorf("ListXattr(/e%s) = %v, %v, want user.origin=%s", p[2:], attrs, err, p)
+		}
+	}
+
+	// Overwriting a file replaces its attributes with the source's
+	c.WriteFile(ctx, "/g", "g")
+	c.SetXattr(ctx, "/g", "user.stale", "1")
+	c.CopyFile(ctx, "/d/f", "/g")
+	if attrs, _ := c.ListXattr(ctx, "/g"); len(attrs) != 1 || attrs["user.origin"] != "/d/f" {
+		t.Errorf("attrs after overwrite = %v", attrs)
+	}
+
+	// Removing the file removes its attributes
+	meta, _ := c.Stat(ctx, "/g")
+	c.Remove(ctx, "/g")
+	if n, _ := c.store.Exists(ctx, c.keys.Xattr(meta.Ino)); n != 0 {
+		t.Error("xattr key left after rm")
+	}
+}
+
+func TestTags(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.Mkdir(ctx, "/d", false)
+	c.WriteFile(ctx, "/d/a", "a")
+	c.WriteFile(ctx, "/d/b", "b")
+
+	if err := c.AddTags(ctx, "/d/a", "review", "draft", "review"); err != nil {
+		t.Fatalf("AddTags: %v", err)
+	}
+	c.AddTags(ctx, "/d/b", "draft")
+	c.AddTags(ctx, "/d", "project")
+	if tags, err := c.Tags(ctx, "/d/a"); err != nil || !slices.Equal(tags, []string{"draft", "review"}) {
+		t.Errorf("Tags = %v, %v, want [draft review]", tags, err)
+	}
+	for _, bad := range []string{"", "a,b", " pad"} {
+		if err := c.AddTags(ctx, "/d/a", bad); !errors.Is(err, ErrInvalid) {
+			t.Errorf("AddTags(%q) = %v, want ErrInvalid", bad, err)
+		}
+	}
+
+	find := func(tags ...string) []string {
+		entries, err := c.FindWith(ctx, "/", FindOptions{Tags: tags})
+		if err != nil {
+			t.Fatalf("FindWith(%v): %v", tags, err)
+		}
+		var paths []string
+		for _, e := range entries {
+			paths = append(paths, e.Path)
+		}
+		slices.Sort(paths)
+		return paths
+	}
+	if got := find("draft"); !slices.Equal(got, []string{"/d/a", "/d/b"}) {
+		t.Errorf("find draft = %v", got)
+	}
+	if got := find("draft", "review"); !slices.Equal(got, []string{"/d/a"}) {
+		t.Errorf("find draft+review = %v", got)
+	}
+
+	// Tags travel with cp and mv
+	c.CopyRecursive(ctx, "/d", "/e")
+	c.Move(ctx, "/d/a", "/d/c")
+	for p, want := range map[string][]string{"/e": {"project"}, "/e/a": {"draft", "review"}, "/d/c": {"draft", "review"}} {
+		if tags, _ := c.Tags(ctx, p); !slices.Equal(tags, want) {
+			t.Errorf("Tags(%s) = %v, want %v", p, tags, want)
+		}
+	}
+
+	c.RemoveTags(ctx, "/d/c", "draft", "review", "absent")
+	if tags, _ := c.Tags(ctx, "/d/c"); len(tags) != 0 {
+		t.Errorf("Tags after RemoveTags = %v", tags)
+	}
+	if got := find("review"); !slices.Equal(got, []string{"/e/a"}) {
+		t.Errorf("find review = %v", got)
+	}
+}
+
+func TestHardLinks(t *testing.T) {
+	for _, functions := range []bool{true, false} {
+		t.Run(fmt.Sprintf("functions=%v", functions), func(t *testing.T) {
+			ctx := context.Background()
+			c := newTestClient(t)
+			c.functions = functions
+			c.SetChunkSize(4)
+			c.Mkdir(ctx, "/d", false)
+			c.WriteFile(ctx, "/d/a", "abc")
+			c.WriteFile(ctx, "/d/big", "chunked content")
+
+			if err := c.Link(ctx, "/d/a", "/b"); err != nil {
+				t.Fatalf("Link: %v", err)
+			}
+			c.Link(ctx, "/d/a", "/c")
+			c.Link(ctx, "/d/big", "/big")
+			if err := c.Link(ctx, "/d", "/e"); !errors.Is(err, ErrNotPermitted) {
+				t.Errorf("Link(dir) = %v, want ErrNotPermitted", err)
+			}
+			if err := c.Link(ctx, "/d/a", "/b"); !errors.Is(err, ErrExist) {
+				t.Errorf("Link(existing) = %v, want ErrExist", err)
+			}
+
+			a, _ := c.Stat(ctx, "/d/a")
+			b, _ := c.Stat(ctx, "/b")
+			if a.Ino != b.Ino || a.Nlink != 3 || b.Nlink != 3 {
+				t.Errorf("links: ino %s/%s, nlink %d/%d, want shared inode with 3 links", a.Ino, b.Ino, a.Nlink, b.Nlink)
+			}
+			c.AppendFile(ctx, "/b", "def")
+			if got, _ := c.ReadFile(ctx, "/d/a"); got != "abcdef" {
+				t.Errorf("content through other link = %q", got)
+			}
+
+			// Usage counts each inode once
+			entries, err := c.DiskUsage(ctx, "/")
+			if err != nil {
+				t.Fatalf("DiskUsage: %v", err)
+			}
+			if root := entries[len(entries)-1]; root.Path != "/" || root.Size != 6+15 {
+				t.Errorf("DiskUsage(/) total = %+v, want 21", root)
+			}
+
+			// Data survives until the last link goes
+			c.Remove(ctx, "/d/a")
+			// Renaming onto another link of the same file does nothing
+			c.Move(ctx, "/d/big", "/big")
+			if ok, _ := c.Exists(ctx, "/d/big"); !ok {
+				t.Error("rename onto own link removed the source")
+			}
+			if err := c.Move(ctx, "/c", "/b"); err != nil {
+				t.Fatalf("Move onto link: %v", err)
+			}
+			if b, _ = c.Stat(ctx, "/b"); b.Nlink != 2 {
+				t.Errorf("nlink after rm and mv = %d, want 2", b.Nlink)
+			}
+			c.Remove(ctx, "/b")
+			if got, _ := c.ReadFile(ctx, "/c"); got != "abcdef" {
+				t.Errorf("last link content = %q", got)
+			}
+			c.Remove(ctx, "/c")
+			if n, _ := c.store.Exists(ctx, c.keys.Meta(a.Ino), c.keys.Data(a.Ino)); n != 0 {
+				t.Error("inode keys left after last link removed")
+			}
+
+			big, _ := c.Stat(ctx, "/big")
+			c.Link(ctx, "/big", "/big2")
+			c.Remove(ctx, "/big")
+			c.Remove(ctx, "/d/big")
+			if got, _ := c.ReadFile(ctx, "/big2"); got != "chunked content" {
+				t.Errorf("chunked content after unlink = %q", got)
+			}
+			c.Remove(ctx, "/big2")
+			if n, _ := c.store.Exists(ctx, c.keys.Chunk(big.Ino, 0)); n != 0 {
+				t.Error("chunks left after last link removed")
+			}
+		})
+	}
+}
+
+func TestSymlinkResolution(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.Mkdir(ctx, "/real/sub", true)
+	c.WriteFile(ctx, "/real/sub/f", "data")
+	c.Symlink(ctx, "/real", "/abs")
+	c.Symlink(ctx, "../real/sub", "/real/rel")
+	c.Symlink(ctx, "/abs/sub/f", "/flink")
+	c.Symlink(ctx, "/loop2", "/loop1")
+	c.Symlink(ctx, "/loop1", "/loop2")
+
+	// Links in directory positions are followed
+	if got, err := c.ReadFile(ctx, "/abs/sub/f"); err != nil || got != "data" {
+		t.Errorf("ReadFile through dir link = %q, %v", got, err)
+	}
+	if got, err := c.ReadFile(ctx, "/abs/rel/f"); err != nil || got != "data" {
+		t.Errorf("ReadFile through two links = %q, %v", got, err)
+	}
+	if err := c.WriteFile(ctx, "/abs/sub/g", "new"); err != nil {
+		t.Fatalf("WriteFile through dir link: %v", err)
+	}
+	if names, _ := c.ReadDir(ctx, "/real/rel"); len(names) != 2 {
+		t.Errorf("ReadDir(link) = %v, want f and g", names)
+	}
+	if err := c.Mkdir(ctx, "/abs/sub/x/y", true); err != nil {
+		t.Errorf("Mkdir -p through link: %v", err)
+	}
+	if ok, _ := c.IsDir(ctx, "/real/sub/x/y"); !ok {
+		t.Error("Mkdir -p through link did not create /real/sub/x/y")
+	}
+
+	// A final link is followed by writes, not by Stat
+	c.WriteFile(ctx, "/flink", "changed")
+	if got, _ := c.ReadFile(ctx, "/real/sub/f"); got != "changed" {
+		t.Errorf("write through final link: target = %q", got)
+	}
+	if meta, _ := c.Stat(ctx, "/flink"); meta == nil || meta.Type != TypeSymlink {
+		t.Errorf("Stat(/flink) = %+v, want the link", meta)
+	}
+	if meta, _ := c.StatFollow(ctx, "/flink"); meta == nil || meta.Type != TypeFile {
+		t.Errorf("StatFollow(/flink) = %+v, want the file", meta)
+	}
+
+	if got, err := c.Realpath(ctx, "/abs/rel/f"); err != nil || got != "/real/sub/f" {
+		t.Errorf("Realpath = %q, %v", got, err)
+	}
+	if got, err := c.Readlink(ctx, "/abs/rel"); err != nil || got != "../real/sub" {
+		t.Errorf("Readlink = %q, %v", got, err)
+	}
+	if _, err := c.Readlink(ctx, "/real"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Readlink(dir) = %v, want ErrInvalid", err)
+	}
+	if _, err := c.Stat(ctx, "/loop1/x"); !errors.Is(err, ErrLoop) {
+		t.Errorf("Stat through loop = %v, want ErrLoop", err)
+	}
+	if _, err := c.Realpath(ctx, "/abs/none"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Realpath(missing) = %v, want ErrNotExist", err)
+	}
+
+	// Moving into a directory through its link is still a move into itself
+	if err := c.Move(ctx, "/real", "/abs/sub/inside"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Move into own link = %v, want ErrInvalid", err)
+	}
+
+	// find -L descends through links but not around loops
+	c.Symlink(ctx, "/real", "/real/sub/up")
+	entries, err := c.FindWith(ctx, "/abs", FindOptions{Name: "f", Follow: true})
+	if err != nil {
+		t.Fatalf("FindWith(Follow): %v", err)
+	}
+	var paths []string
+	for _, e := range entries {
+		paths = append(paths, e.Path)
+	}
+	slices.Sort(paths)
+	if want := []string{"/abs/rel/f", "/abs/sub/f"}; !slices.Equal(paths, want) {
+		t.Errorf("find -L = %v, want %v", paths, want)
+	}
+	if entries, _ := c.Find(ctx, "/abs", "f", ""); len(entries) != 0 {
+		t.Errorf("find without -L followed the root link: %v", entries)
+	}
+}
+
+func TestRmdirSymlink(t *testing.T) {
+	for _, functions := range []bool{true, false} {
+		t.Run(fmt.Sprintf("functions=%v", functions), func(t *testing.T) {
+			ctx := context.Background()
+			c := newTestClient(t)
+			c.functions = functions
+			c.Mkdir(ctx, "/d", false)
+			c.Symlink(ctx, "/d", "/l")
+
+			if err := c.Rmdir(ctx, "/l"); !errors.Is(err, ErrNotDir) {
+				t.Errorf("Rmdir(link to dir) = %v, want ErrNotDir", err)
+			}
+			names, _ := c.ReadDir(ctx, "/")
+			if slices.Sort(names); !slices.Equal(names, []string{"d", "l"}) {
+				t.Errorf("names after Rmdir(link) = %v, want [d l]", names)
+			}
+			if meta, _ := c.Stat(ctx, "/d"); meta == nil || meta.Type != TypeDir {
+				t.Errorf("Stat(/d) = %+v, want the directory", meta)
+			}
+			if err := c.Rmdir(ctx, "/d"); err != nil {
+				t.Errorf("Rmdir(/d): %v", err)
+			}
+		})
+	}
+}
+
+func TestVersionHistory(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.Mkdir(ctx, "/docs/tmp", true)
+	c.WriteFile(ctx, "/docs/a", "v0")
+	c.WriteFile(ctx, "/b", "unversioned")
+
+	if err := c.SetVersioning(ctx, "/docs", VersionPolicy{Keep: 3}); err != nil {
+		t.Fatalf("SetVersioning: %v", err)
+	}
+	c.SetVersioning(ctx, "/docs/tmp", VersionPolicy{})
+
+	// The content from before versioning was enabled is kept too
+	c.WriteFile(ctx, "/docs/a", "v1")
+	c.AppendFile(ctx, "/docs/a", "+")
+	versions, err := c.History(ctx, "/docs/a")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	var ops []string
+	for _, v := range versions {
+		ops = append(ops, v.Op)
+	}
+	if want := []string{"write", "write", "append"}; !slices.Equal(ops, want) {
+		t.Fatalf("history ops = %v, want %v", ops, want)
+	}
+	if got, _ := c.ReadVersion(ctx, "/docs/a", 1); got != "v0" {
+		t.Errorf("rev 1 = %q, want v0", got)
+	}
+	if got, _ := c.ReadVersion(ctx, "/docs/a", 3); got != "v1+" {
+		t.Errorf("rev 3 = %q, want v1+", got)
+	}
+
+	// Retention keeps the newest three
+	c.WriteFile(ctx, "/docs/a", "v2")
+	versions, _ = c.History(ctx, "/docs/a")
+	if len(versions) != 3 || versions[0].Rev != 2 || versions[2].Rev != 4 {
+		t.Errorf("after prune: %+v, want revs 2-4", versions)
+	}
+	if _, err := c.ReadVersion(ctx, "/docs/a", 1); !errors.Is(err, ErrNotExist) {
+		t.Errorf("pruned rev 1 = %v, want ErrNotExist", err)
+	}
+
+	// Removal is recorded, and the file can be brought back
+	if err := c.Remove(ctx, "/docs/a"); err != nil {
+		t.Fatal(err)
+	}
+	versions, _ = c.History(ctx, "/docs/a")
+	if last := versions[len(versions)-1]; !last.Deleted() {
+		t.Errorf("last revision after rm = %+v, want a removal", last)
+	}
+	if err := c.RestoreVersion(ctx, "/docs/a", 3); err != nil {
+		t.Fatalf("RestoreVersion: %v", err)
+	}
+	if got, _ := c.ReadFile(ctx, "/docs/a"); got != "v1+" {
+		t.Errorf("restored content = %q, want v1+", got)
+	}
+
+	// rm -r records the files it removes
+	c.Mkdir(ctx, "/docs/sub", false)
+	c.WriteFile(ctx, "/docs/sub/c", "c")
+	c.RemoveRecursive(ctx, "/docs/sub")
+	if versions, _ := c.History(ctx, "/docs/sub/c"); len(versions) != 2 || !versions[1].Deleted() {
+		t.Errorf("history after rm -r = %+v", versions)
+	}
+
+	// Files outside the policy, or below an override, have no history
+	c.WriteFile(ctx, "/b", "x")
+	c.WriteFile(ctx, "/docs/tmp/t", "x")
+	for _, p := range []string{"/b", "/docs/tmp/t"} {
+		if versions, _ := c.History(ctx, p); len(versions) != 0 {
+			t.Errorf("History(%s) = %+v, want none", p, versions)
+		}
+	}
+	if p, dir, _ := c.VersioningFor(ctx, "/docs/tmp/t"); p.Keep != 0 || dir != "/docs/tmp" {
+		t.Errorf("VersioningFor(/docs/tmp/t) = %+v from %q", p, dir)
+	}
+	c.ClearVersioning(ctx, "/docs/tmp")
+	if p, dir, _ := c.VersioningFor(ctx, "/docs/tmp/t"); p.Keep != 3 || dir != "/docs" {
+		t.Errorf("after clear: %+v from %q, want the /docs policy", p, dir)
+	}
+}
+
+func TestVersionMaxAge(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.WriteFile(ctx, "/old", "old")
+	// Back-date the file so its seeded revision is past the age limit
+	meta, _ := c.Stat(ctx, "/old")
+	c.store.HSet(ctx, c.keys.Meta(meta.Ino), map[string]string{"mtime": "1000"})
+
+	c.SetVersioning(ctx, "/", VersionPolicy{Keep: 10, MaxAge: time.Hour})
+	c.WriteFile(ctx, "/old", "new")
+	versions, _ := c.History(ctx, "/old")
+	if len(versions) != 1 || versions[0].Rev != 2 {
+		t.Errorf("history = %+v, want only rev 2", versions)
+	}
+}
+
+func TestVersionHistoryIdle(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.SetVersioning(ctx, "/", VersionPolicy{Keep: 10, MaxAge: time.Hour})
+	c.WriteFile(ctx, "/idle", "v1")
+	c.WriteFile(ctx, "/idle", "v2")
+	c.WriteFile(ctx, "/idle", "v3")
+	// Back-date the first two revisions past the age limit
+	for _, rev := range []string{"1", "2"} {
+		old := Version{Time: 1000, Size: 2, Author: "0", Op: "write"}
+		c.store.HSet(ctx, c.keys.History("/idle"), map[string]string{rev: old.encode()})
+	}
+
+	// Reading one revision expires the others, without another write
+	if _, err := c.ReadVersion(ctx, "/idle", 1); !errors.Is(err, ErrNotExist) {
+		t.Errorf("ReadVersion(expired) = %v, want ErrNotExist", err)
+	}
+	if n, _ := c.store.HLen(ctx, c.keys.History("/idle")); n != 1 {
+		t.Errorf("%d revisions left after a read, want 1", n)
+	}
+	if n, _ := c.store.Exists(ctx, c.keys.Revision("/idle", 2)); n != 0 {
+		t.Error("content of an expired revision kept")
+	}
+}
+
+func TestVersionHistoryWrites(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.SetChunkSize(4)
+	c.SetVersioning(ctx, "/", VersionPolicy{Keep: 20})
+	other := NewClientWithBackend(c.Backend(), "other")
+	other.Init(ctx)
+	c.WriteFile(ctx, "/src", "copied")
+	c.WriteFile(ctx, "/f", "abc")
+
+	c.WriteAt(ctx, "/f", 1, "X")
+	f, err := c.OpenFile(ctx, "/f", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	f.Write([]byte("+"))
+	f.Close()
+	c.CopyFile(ctx, "/src", "/f")
+	c.WriteFile(ctx, "/m", "moved")
+	c.Move(ctx, "/m", "/f")
+	other.WriteFile(ctx, "/o", "transferred")
+	other.CopyTo(ctx, "/o", c, "/f")
+
+	versions, err := c.History(ctx, "/f")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	want := []struct{ op, content string }{
+		{"write", "abc"},
+		{"write", "aXc"},
+		{"append", "aXc+"},
+		{"cp", "copied"},
+		{"mv", "moved"},
+		{"cp", "transferred"},
+	}
+	if len(versions) != len(want) {
+		t.Fatalf("history = %+v, want %d revisions", versions, len(want))
+	}
+	for i, v := range versions {
+		got, _ := c.ReadVersion(ctx, "/f", v.Rev)
+		if v.Op != want[i].op || got != want[i].content {
+			t.Errorf("rev %d = %s %q, want %s %q", v.Rev, v.Op, got, want[i].op, want[i].content)
+		}
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.SetChunkSize(8)
+	c.Mkdir(ctx, "/d", false)
+	c.WriteFile(ctx, "/d/x", "x0")
+	c.WriteFile(ctx, "/a", "a0")
+	c.WriteFile(ctx, "/big", "0123456789abcdef")
+	c.WriteFile(ctx, "/k", "k0")
+	c.SetXattr(ctx, "/a", "user.k", "v0")
+
+	if _, err := c.CreateSnapshot(ctx, "s1"); err != nil {
+		t.Fatalf("CreateSnapshot: %v", err)
+	}
+	if _, err := c.CreateSnapshot(ctx, "s1"); !errors.Is(err, ErrExist) {
+		t.Errorf("duplicate snapshot = %v, want ErrExist", err)
+	}
+	snap := NewClientWithBackend(c.Backend(), SnapshotVolume("test", "s1"))
+	snap.Init(ctx)
+	readAll := func(c *Client, path string) string {
+		t.Helper()
+		got, err := c.ReadFile(ctx, path)
+		if err != nil {
+			t.Fatalf("ReadFile(%s@%s): %v", path, c.Volume, err)
+		}
+		return got
+	}
+
+	// Content is shared until the live volume changes it
+	if n, _ := c.Backend().Exists(ctx, snap.keys.Data(mustStat(t, c, "/a").Ino)); n != 0 {
+		t.Error("snapshot copied unchanged content")
+	}
+	c.WriteFile(ctx, "/a", "a1")
+	c.AppendFile(ctx, "/big", "!")
+	c.Remove(ctx, "/d/x")
+	c.WriteFile(ctx, "/new", "n")
+	c.SetXattr(ctx, "/a", "user.k", "v1")
+
+	if got := readAll(snap, "/a"); got != "a0" {
+		t.Errorf("snapshot /a = %q, want a0", got)
+	}
+	if got := readAll(snap, "/big"); got != "0123456789abcdef" {
+		t.Errorf("snapshot /big = %q", got)
+	}
+	if got := readAll(snap, "/d/x"); got != "x0" {
+		t.Errorf("snapshot /d/x = %q, want x0", got)
+	}
+	if ok, _ := snap.Exists(ctx, "/new"); ok {
+		t.Error("snapshot shows a file created after it")
+	}
+	if v, _ := snap.GetXattr(ctx, "/a", "user.k"); v != "v0" {
+		t.Errorf("snapshot xattr = %q, want v0", v)
+	}
+	if got := readAll(c, "/a"); got != "a1" {
+		t.Errorf("live /a = %q, want a1", got)
+	}
+	if err := snap.WriteFile(ctx, "/a", "no"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("write to snapshot = %v, want ErrReadOnly", err)
+	}
+	if vols, _ := c.ListVolumes(ctx); !slices.Equal(vols, []string{"test"}) {
+		t.Errorf("ListVolumes = %v, want only the live volume", vols)
+	}
+
+	// /k is unchanged until after s2, which saves it; s1 then reads it
+	// through s2, and keeps it when s2 is deleted
+	c.CreateSnapshot(ctx, "s2")
+	c.WriteFile(ctx, "/k", "k1")
+	c.WriteFile(ctx, "/big", "B")
+	if got := readAll(snap, "/k"); got != "k0" {
+		t.Errorf("snapshot /k = %q, want k0", got)
+	}
+	if err := c.DeleteSnapshot(ctx, "s2"); err != nil {
+		t.Fatalf("DeleteSnapshot: %v", err)
+	}
+	if got := readAll(snap, "/k"); got != "k0" {
+		t.Errorf("snapshot /k after deleting s2 = %q, want k0", got)
+	}
+	if snaps, _ := c.Snapshots(ctx); len(snaps) != 1 || snaps[0].Volume != "test@s1" {
+		t.Errorf("Snapshots = %+v, want s1 only", snaps)
+	}
+
+	if err := c.RestoreSnapshot(ctx, "s1"); err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	for path, want := range map[string]string{"/a": "a0", "/big": "0123456789abcdef", "/d/x": "x0", "/k": "k0"} {
+		if got := readAll(c, path); got != want {
+			t.Errorf("restored %s = %q, want %q", path, got, want)
+		}
+	}
+	if ok, _ := c.Exists(ctx, "/new"); ok {
+		t.Error("restore kept a file created after the snapshot")
+	}
+	if v, _ := c.GetXattr(ctx, "/a", "user.k"); v != "v0" {
+		t.Errorf("restored xattr = %q, want v0", v)
+	}
+	// The volume keeps working after a restore
+	if err := c.WriteFile(ctx, "/after", "ok"); err != nil {
+		t.Errorf("write after restore: %v", err)
+	}
+
+	c.SetIdentity(Identity{UID: 1000, GID: 1000})
+	if _, err := c.CreateSnapshot(ctx, ""); !errors.Is(err, ErrNotPermitted) {
+		t.Errorf("snapshot as uid 1000 = %v, want ErrNotPermitted", err)
+	}
+}
+
+func TestClones(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.SetChunkSize(8)
+	c.Mkdir(ctx, "/d", false)
+	c.WriteFile(ctx, "/d/x", "x0")
+	c.WriteFile(ctx, "/a", "a0")
+	c.WriteFile(ctx, "/big", "0123456789abcdef")
+	c.WriteFile(ctx, "/k", "k0")
+
+	if err := c.CloneVolume(ctx, "staging"); err != nil {
+		t.Fatalf("CloneVolume: %v", err)
+	}
+	if err := c.CloneVolume(ctx, "staging"); !errors.Is(err, ErrExist) {
+		t.Errorf("clone onto an existing volume = %v, want ErrExist", err)
+	}
+	clone := NewClientWithBackend(c.Backend(), "staging")
+	if err := clone.Init(ctx); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	clone.SetChunkSize(8)
+	readAll := func(c *Client, path, want string) {
+		t.Helper()
+		got, err := c.ReadFile(ctx, path)
+		if err != nil || got != want {
+			t.Errorf("%s in %s = %q, %v, want %q", path, c.Volume, got, err, want)
+		}
+	}
+
+	// Content is shared until either side changes it
+	if n, _ := c.Backend().Exists(ctx, clone.keys.Data(mustStat(t, c, "/a").Ino)); n != 0 {
+		t.Error("clone copied unchanged content")
+	}
+	readAll(clone, "/big", "0123456789abcdef")
+	if info, _ := clone.VolumeInfo(ctx); info == nil || info.Origin != "test" || info.SharedFiles != 4 || info.Files != 4 {
+		t.Errorf("VolumeInfo = %+v, want 4 of 4 files shared with test", info)
+	}
+
+	clone.WriteFile(ctx, "/a", "a1")
+	c.AppendFile(ctx, "/big", "!")
+	c.Remove(ctx, "/d/x")
+	clone.Remove(ctx, "/k")
+	readAll(c, "/a", "a0")
+	readAll(clone, "/a", "a1")
+	readAll(c, "/big", "0123456789abcdef!")
+	readAll(clone, "/big", "0123456789abcdef")
+	readAll(clone, "/d/x", "x0")
+	readAll(c, "/k", "k0")
+	if info, _ := clone.VolumeInfo(ctx); info == nil || info.SharedFiles != 0 || info.Files != 3 || info.Bytes != 20 {
+		t.Errorf("VolumeInfo = %+v, want 3 files of 20 bytes, none shared", info)
+	}
+
+	// Both volumes allocate the same inode ids from here on
+	c.WriteFile(ctx, "/n", "from test")
+	clone.WriteFile(ctx, "/m", "from staging")
+	if mustStat(t, c, "/n").Ino != mustStat(t, clone, "/m").Ino {
+		t.Fatal("volumes allocated different inode ids")
+	}
+	c.WriteFile(ctx, "/n", "again")
+	readAll(clone, "/m", "from staging")
+
+	// A clone of a clone reads through both
+	c.WriteFile(ctx, "/c", "c0")
+	clone2 := NewClientWithBackend(c.Backend(), "staging2")
+	if err := clone.CloneVolume(ctx, "staging2"); err != nil {
+		t.Fatalf("CloneVolume: %v", err)
+	}
+	readAll(clone2, "/big", "0123456789abcdef")
+	readAll(clone2, "/a", "a1")
+	clone.WriteFile(ctx, "/a", "a2")
+	clone.AppendFile(ctx, "/big", "?")
+	readAll(clone2, "/a", "a1")
+	readAll(clone2, "/big", "0123456789abcdef")
+
+	// Snapshots of a clone save content shared with its origin
+	c.WriteFile(ctx, "/s", "s0")
+	clone3 := NewClientWithBackend(c.Backend(), "staging3")
+	c.CloneVolume(ctx, "staging3")
+	if _, err := clone3.CreateSnapshot(ctx, "before"); err != nil {
+		t.Fatalf("CreateSnapshot: %v", err)
+	}
+	clone3.WriteFile(ctx, "/s", "s1")
+	snap := NewClientWithBackend(c.Backend(), SnapshotVolume("staging3", "before"))
+	readAll(snap, "/s", "s0")
+	readAll(c, "/s", "s0")
+
+	if clones, _ := c.Clones(ctx); !slices.Equal(clones, []string{"staging", "staging3"}) {
+		t.Errorf("Clones = %v", clones)
+	}
+	if info, _ := c.VolumeInfo(ctx); info == nil || info.Origin != "" {
+		t.Errorf("VolumeInfo of the origin = %+v, want no origin", info)
+	}
+}
+
+// lookupBackend records the hashes read with HGet, HGetAll, HKeys and
+// HExists.
+type lookupBackend struct {
+	Backend
+	keys []string
+}
+
+func (b *lookupBackend) HGet(ctx context.Context, key, field string) (string, error) {
+	b.keys = append(b.keys, key)
+	return b.Backend.HGet(ctx, key, field)
+}
+
+func (b *lookupBackend) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	b.keys = append(b.keys, key)
+	return b.Backend.HGetAll(ctx, key)
+}
+
+func (b *lookupBackend) HKeys(ctx context.Context, key string) ([]string, error) {
+	b.keys = append(b.keys, key)
+	return b.Backend.HKeys(ctx, key)
+}
+
+func (b *lookupBackend) HExists(ctx context.Context, key, field string) (bool, error) {
+	b.keys = append(b.keys, key)
+	return b.Backend.HExists(ctx, key, field)
+}
+
+func TestCOWPlainVolume(t *testing.T) {
+	ctx := context.Background()
+	b := &lookupBackend{Backend: NewMemoryBackend()}
+	c := NewClientWithBackend(b, "test")
+	c.Init(ctx)
+	c.SetChunkSize(8)
+	other := NewClientWithBackend(b, "other")
+	other.Init(ctx)
+	other.CreateSnapshot(ctx, "s1")
+
+	b.keys = nil
+	c.WriteFile(ctx, "/f", "0123456789abcdef")
+	c.ReadFile(ctx, "/f")
+	c.Remove(ctx, "/f")
+	for _, key := range b.keys {
+		if key == c.keys.Snapshots() || key == c.keys.Clones() || key == c.keys.Shared() {
+			t.Errorf("volume without snapshots or clones looked up %s", key)
+		}
+	}
+
+	// Sharing stops with the last snapshot
+	c.CreateSnapshot(ctx, "s1")
+	if shares, _ := b.HGet(ctx, c.keys.Super(), "shares"); shares != "1" {
+		t.Errorf("shares = %q after a snapshot, want 1", shares)
+	}
+	c.DeleteSnapshot(ctx, "s1")
+	if shares, _ := b.HGet(ctx, c.keys.Super(), "shares"); shares != "" {
+		t.Errorf("shares = %q after deleting the snapshot, want none", shares)
+	}
+}
+
+func TestCOWChunkedWrite(t *testing.T) {
+	ctx := context.Background()
+	b := &lookupBackend{Backend: NewMemoryBackend()}
+	c := NewClientWithBackend(b, "test")
+	c.Init(ctx)
+	c.SetChunkSize(4)
+	c.WriteFile(ctx, "/f", strings.Repeat("a", 64))
+	c.CreateSnapshot(ctx, "s1")
+
+	b.keys = nil
+	c.WriteFile(ctx, "/f", strings.Repeat("b", 64))
+	if n := strings.Count(strings.Join(b.keys, " "), c.keys.Snapshots()); n != 1 {
+		t.Errorf("overwriting 16 chunks looked up the snapshots %d times, want once", n)
+	}
+	snap := NewClientWithBackend(b, SnapshotVolume("test", "s1"))
+	if got, _ := snap.ReadFile(ctx, "/f"); got != strings.Repeat("a", 64) {
+		t.Errorf("snapshot /f = %q", got)
+	}
+}
+
+func TestCOWReads(t *testing.T) {
+	ctx := context.Background()
+	b := &lookupBackend{Backend: NewMemoryBackend()}
+	c := NewClientWithBackend(b, "test")
+	c.Init(ctx)
+	c.SetChunkSize(4)
+	c.WriteFile(ctx, "/f", strings.Repeat("a", 64))
+	c.CreateSnapshot(ctx, "s1")
+	c.CloneVolume(ctx, "staging")
+	clone := NewClientWithBackend(b, "staging")
+	lookups := func(key string) int {
+		return strings.Count(strings.Join(b.keys, " "), key)
+	}
+
+	// A volume that is not a clone reads its own content
+	b.keys = nil
+	c.ReadFile(ctx, "/f")
+	if n := lookups(c.keys.Shared()); n != 0 {
+		t.Errorf("reading from the origin looked up its shared hash %d times", n)
+	}
+
+	// A clone looks up a shared inode once for all its chunks
+	b.keys = nil
+	if got, _ := clone.ReadFile(ctx, "/f"); got != strings.Repeat("a", 64) {
+		t.Errorf("clone /f = %q", got)
+	}
+	if n := lookups(clone.keys.Shared()); n != 1 {
+		t.Errorf("reading 16 chunks looked up the shared hash %d times, want once", n)
+	}
+	b.keys = nil
+	clone.ReadAt(ctx, "/f", 2, 40)
+	if n := lookups(clone.keys.Shared()); n != 1 {
+		t.Errorf("reading a range looked up the shared hash %d times, want once", n)
+	}
+}
+
+// stallBackend runs stall, once, just before the next conditional write,
+// as if the writer had stalled between planning and applying it.
+type stallBackend struct {
+	Backend
+	stall func()
+}
+
+func (b *stallBackend) run() {
+	if stall := b.stall; stall != nil {
+		b.stall = nil
+		stall()
+	}
+}
+
+func (b *stallBackend) TxIf(ctx context.Context, key, field, value string, fn func(w Writer)) error {
+	b.run()
+	return b.Backend.TxIf(ctx, key, field, value, fn)
+}
+
+func (b *stallBackend) Call(ctx context.Context, fn string, keys []string, args ...interface{}) (interface{}, error) {
+	if fn == "fs_if" {
+		b.run()
+	}
+	return b.Backend.Call(ctx, fn, keys, args...)
+}
+
+func TestCOWStalledWriter(t *testing.T) {
+	for _, functions := range []bool{true, false} {
+		t.Run(fmt.Sprintf("functions=%v", functions), func(t *testing.T) {
+			ctx := context.Background()
+			b := &stallBackend{Backend: NewMemoryBackend()}
+			c := NewClientWithBackend(b, "test")
+			c.Init(ctx)
+			c.functions = functions
+			c.SetChunkSize(4)
+			c.WriteFile(ctx, "/f", "f0")
+			c.WriteFile(ctx, "/big", "01234567")
+
+			// Another client takes a snapshot after c went by the
+			// superblock for a write, and before the write is applied
+			admin := NewClientWithBackend(b, "test")
+			b.stall = func() { admin.CreateSnapshot(ctx, "s1") }
+			if err := c.WriteFile(ctx, "/f", "f1"); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+			b.stall = func() { admin.CreateSnapshot(ctx, "s2") }
+			if err := c.WriteFile(ctx, "/big", "abcdefgh"); err != nil {
+				t.Fatalf("WriteFile(chunked): %v", err)
+			}
+			b.stall = func() { admin.DeleteSnapshot(ctx, "s2") }
+			if err := c.Remove(ctx, "/big"); err != nil {
+				t.Fatalf("Remove: %v", err)
+			}
+
+			for _, tc := range []struct{ volume, path, want string }{
+				{SnapshotVolume("test", "s1"), "/f", "f0"},
+				{SnapshotVolume("test", "s1"), "/big", "01234567"},
+				{"test", "/f", "f1"},
+			} {
+				r := NewClientWithBackend(b, tc.volume)
+				if got, err := r.ReadFile(ctx, tc.path); got != tc.want {
+					t.Errorf("%s %s = %q, %v, want %q", tc.volume, tc.path, got, err, tc.want)
+				}
+			}
+			if ok, _ := c.Exists(ctx, "/big"); ok {
+				t.Error("Remove after a stall left /big")
+			}
+		})
+	}
+}
+
+func TestVolumeLifecycle(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.WriteFile(ctx, "/a", "a0")
+	c.WriteFile(ctx, "/b", "b0")
+	c.CreateSnapshot(ctx, "s1")
+	c.WriteFile(ctx, "/a", "a1")
+	readAll := func(vol, path, want string) {
+		t.Helper()
+		got, err := NewClientWithBackend(c.Backend(), vol).ReadFile(ctx, path)
+		if err != nil || got != want {
+			t.Errorf("%s in %s = %q, %v, want %q", path, vol, got, err, want)
+		}
+	}
+
+	// test -> mid -> leaf, with /b shared all the way down
+	c.CloneVolume(ctx, "mid")
+	mid := NewClientWithBackend(c.Backend(), "mid")
+	mid.WriteFile(ctx, "/c", "c0")
+	mid.CloneVolume(ctx, "leaf")
+
+	if err := c.RenameVolume(ctx, "main"); err != nil {
+		t.Fatalf("RenameVolume: %v", err)
+	}
+	if c.Volume != "main" {
+		t.Errorf("active volume = %q, want main", c.Volume)
+	}
+	readAll("main@s1", "/a", "a0")
+	readAll("mid", "/b", "b0")
+	if snaps, _ := c.Snapshots(ctx); len(snaps) != 1 || snaps[0].Volume != "main@s1" {
+		t.Errorf("Snapshots = %+v, want main@s1", snaps)
+	}
+	if vols, _ := c.ListVolumes(ctx); !slices.Equal(vols, []string{"leaf", "main", "mid"}) {
+		t.Errorf("ListVolumes = %v", vols)
+	}
+
+	// Deleting mid hands leaf over to main, copying only what mid owned
+	if err := mid.DeleteVolume(ctx); err != nil {
+		t.Fatalf("DeleteVolume: %v", err)
+	}
+	readAll("leaf", "/b", "b0")
+	readAll("leaf", "/c", "c0")
+	leaf := NewClientWithBackend(c.Backend(), "leaf")
+	if info, _ := leaf.VolumeInfo(ctx); info == nil || info.Origin != "main" || info.SharedFiles != 2 {
+		t.Errorf("leaf VolumeInfo = %+v, want 2 files shared with main", info)
+	}
+	if clones, _ := c.Clones(ctx); !slices.Equal(clones, []string{"leaf"}) {
+		t.Errorf("Clones = %v, want leaf", clones)
+	}
+	c.WriteFile(ctx, "/b", "b1")
+	readAll("leaf", "/b", "b0")
+	if n, _ := c.Backend().Exists(ctx, mid.keys.Super(), mid.keys.Meta(RootInode)); n != 0 {
+		t.Error("DeleteVolume left keys behind")
+	}
+
+	c.SetDescription(ctx, "production")
+	if info, _ := c.VolumeInfo(ctx); info.Description != "production" || info.Files != 2 || info.Memory == 0 {
+		t.Errorf("VolumeInfo = %+v", info)
+	}
+	if err := c.DeleteVolume(ctx); err != nil {
+		t.Fatalf("DeleteVolume: %v", err)
+	}
+	readAll("leaf", "/a", "a1")
+	readAll("leaf", "/b", "b0")
+	if n, _ := c.Backend().Exists(ctx, c.keys.snapshot("s1").Super()); n != 0 {
+		t.Error("DeleteVolume kept a snapshot")
+	}
+	if err := c.DeleteVolume(ctx); !errors.Is(err, ErrNotExist) {
+		t.Errorf("deleting twice = %v, want ErrNotExist", err)
+	}
+}
+
+// dupScanBackend returns every batch of keys of a Scan twice, as SCAN may,
+// while dup is set.
+type dupScanBackend struct {
+	Backend
+	dup bool
+}
+
+func (b *dupScanBackend) Scan(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	return b.Backend.Scan(ctx, pattern, func(keys []string) error {
+		if err := fn(keys); err != nil || !b.dup {
+			return err
+		}
+		return fn(keys)
+	})
+}
+
+func TestVolumeKeysIsolated(t *testing.T) {
+	ctx := context.Background()
+	b := &dupScanBackend{Backend: NewMemoryBackend()}
+	// Names that are no longer valid, as older volumes may have
+	open := func(volume string) *Client {
+		c := NewClientWithBackend(b, volume)
+		c.Init(ctx)
+		c.WriteFile(ctx, "/f", volume)
+		return c
+	}
+	m, main := open("m*"), open("main")
+	a, ab := open("a"), open("a:b")
+
+	if err := m.DeleteVolume(ctx); err != nil {
+		t.Fatalf("DeleteVolume(m*): %v", err)
+	}
+	if got, err := main.ReadFile(ctx, "/f"); got != "main" {
+		t.Errorf("main after deleting m* = %q, %v", got, err)
+	}
+	if info, _ := a.VolumeInfo(ctx); info == nil || info.Files != 1 {
+		t.Errorf("VolumeInfo(a) = %+v, want its own file only", info)
+	}
+	b.dup = true
+	if err := a.RenameVolume(ctx, "c"); err != nil {
+		t.Fatalf("RenameVolume: %v", err)
+	}
+	b.dup = false
+	if err := a.DeleteVolume(ctx); err != nil {
+		t.Fatalf("DeleteVolume(c): %v", err)
+	}
+	if got, err := ab.ReadFile(ctx, "/f"); got != "a:b" {
+		t.Errorf("a:b after renaming and deleting a = %q, %v", got, err)
+	}
+	if n, _ := b.Exists(ctx, a.keys.Super(), a.keys.Meta(RootInode)); n != 0 {
+		t.Error("DeleteVolume(c) left keys behind")
+	}
+
+	if ValidVolumeName("m*") || ValidVolumeName("a:b") || !ValidVolumeName("main@s1") {
+		t.Error("ValidVolumeName accepts m* or a:b, or rejects main@s1")
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.SetChunkSize(8)
+	c.Mkdir(ctx, "/d/sub", true)
+	c.WriteFile(ctx, "/d/a", "alpha")
+	c.WriteFile(ctx, "/d/sub/big", "0123456789abcdefghij")
+	c.Symlink(ctx, "a", "/d/link")
+	c.SetXattr(ctx, "/d/a", "user.k", "v")
+	c.AddTags(ctx, "/d", "project")
+	c.Chmod(ctx, "/d/a", "600")
+
+	// Another server: a second store, chunked differently
+	other := NewClientWithBackend(NewMemoryBackend(), "backup")
+	if err := other.Init(ctx); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	other.SetChunkSize(6)
+	if err := c.CopyRecursiveTo(ctx, "/d", other, "/"); err != nil {
+		t.Fatalf("CopyRecursiveTo: %v", err)
+	}
+	for path, want := range map[string]string{"/d/a": "alpha", "/d/sub/big": "0123456789abcdefghij"} {
+		if got, err := other.ReadFile(ctx, path); err != nil || got != want {
+			t.Errorf("%s = %q, %v, want %q", path, got, err, want)
+		}
+	}
+	if m := mustStat(t, other, "/d/sub/big"); m.Chunks != 4 || m.ChunkSize != 6 {
+		t.Errorf("big has %d chunks of %d, want 4 of 6", m.Chunks, m.ChunkSize)
+	}
+	if m := mustStat(t, other, "/d/link"); m.Type != TypeSymlink || m.LinkTarget != "a" {
+		t.Errorf("link = %+v, want a symlink to a", m)
+	}
+	if m := mustStat(t, other, "/d/a"); m.Mode != "0600" {
+		t.Errorf("mode = %s, want 0600", m.Mode)
+	}
+	if v, err := other.GetXattr(ctx, "/d/a", "user.k"); err != nil || v != "v" {
+		t.Errorf("xattr = %q, %v, want v", v, err)
+	}
+	if tags, _ := other.Tags(ctx, "/d"); len(tags) != 1 || tags[0] != "project" {
+		t.Errorf("tags = %v, want [project]", tags)
+	}
+
+	// Overwriting in place keeps the destination's inode
+	ino := mustStat(t, other, "/d/sub/big").Ino
+	c.WriteFile(ctx, "/d/sub/big", "small")
+	if err := c.CopyTo(ctx, "/d/sub/big", other, "/d/sub"); err != nil {
+		t.Fatalf("CopyTo: %v", err)
+	}
+	if m := mustStat(t, other, "/d/sub/big"); m.Ino != ino || m.Chunks != 0 {
+		t.Errorf("overwritten big = %+v, want inode %s unchunked", m, ino)
+	}
+	if n, _ := other.Backend().Exists(ctx, other.keys.Chunk(ino, 0)); n != 0 {
+		t.Error("overwrite kept the old chunks")
+	}
+
+	// Another volume of the same store
+	staging := NewClientWithBackend(c.Backend(), "staging")
+	if err := staging.Init(ctx); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if err := c.MoveTo(ctx, "/d", staging, "/moved"); err != nil {
+		t.Fatalf("MoveTo: %v", err)
+	}
+	if got, _ := staging.ReadFile(ctx, "/moved/a"); got != "alpha" {
+		t.Errorf("moved a = %q, want alpha", got)
+	}
+	if ok, _ := c.Exists(ctx, "/d"); ok {
+		t.Error("MoveTo kept the source")
+	}
+	if err := staging.CopyTo(ctx, "/moved", c, "/"); !errors.Is(err, ErrIsDir) {
+		t.Errorf("copying a directory without recursion = %v, want ErrIsDir", err)
+	}
+}
+
+func TestMoveToSameVolume(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.Mkdir(ctx, "/d", false)
+	c.WriteFile(ctx, "/d/f", "data")
+
+	// The same volume through a connection that looks like another store
+	again := NewClientWithBackend(&lookupBackend{Backend: c.Backend()}, "test")
+	if err := c.MoveTo(ctx, "/d", again, "/d/sub"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("moving a directory into itself = %v, want ErrInvalid", err)
+	}
+	if err := c.MoveTo(ctx, "/d/f", again, "/d/f"); err != nil {
+		t.Errorf("moving a file onto itself: %v", err)
+	}
+	if got, err := c.ReadFile(ctx, "/d/f"); got != "data" {
+		t.Errorf("/d/f = %q, %v, want data", got, err)
+	}
+	if super, _ := c.Backend().HGetAll(ctx, c.keys.Super()); super["probe"] != "" {
+		t.Error("MoveTo left its probe in the superblock")
+	}
+
+	// Copies, too, stay within the volume instead of transferring
+	if err := c.CopyTo(ctx, "/d/f", again, "/d/f"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("copying a file onto itself = %v, want ErrInvalid", err)
+	}
+	if err := c.CopyRecursiveTo(ctx, "/d/f", again, "/d/f"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("copying a file onto itself recursively = %v, want ErrInvalid", err)
+	}
+	if got, err := c.ReadFile(ctx, "/d/f"); got != "data" {
+		t.Errorf("/d/f after copying onto itself = %q, %v, want data", got, err)
+	}
+	if err := c.CopyRecursiveTo(ctx, "/d", again, "/d/sub"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("copying a directory into itself = %v, want ErrInvalid", err)
+	}
+	if err := c.CopyTo(ctx, "/d/f", again, "/d/g"); err != nil {
+		t.Fatalf("CopyTo: %v", err)
+	}
+	f, g := mustStat(t, c, "/d/f"), mustStat(t, c, "/d/g")
+	if got, _ := c.ReadFile(ctx, "/d/g"); got != "data" || f.Ino == g.Ino {
+		t.Errorf("/d/g = %q, inode %s, want a copy of /d/f", got, g.Ino)
+	}
+
+	server := func(addr string, db int) Backend {
+		return NewRedisBackend(redis.NewClient(&redis.Options{Addr: addr, DB: db}))
+	}
+	if !sameStore(server("h:6379", 1), server("h:6379", 1)) {
+		t.Error("two connections to the same server and database are different stores")
+	}
+	if sameStore(server("h:6379", 1), server("h:6379", 2)) || sameStore(server("h:6379", 0), server("g:6379", 0)) {
+		t.Error("different databases or servers are the same store")
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.SetChunkSize(8)
+	c.Mkdir(ctx, "/d/sub", true)
+	c.WriteFile(ctx, "/d/a", "alpha")
+	c.WriteFile(ctx, "/d/sub/big", "0123456789abcdefghij")
+	c.Symlink(ctx, "a", "/d/link")
+	c.Link(ctx, "/d/a", "/d/hard")
+	c.SetXattr(ctx, "/d/a", "user.k", "v")
+	c.AddTags(ctx, "/d/sub", "project")
+	c.Chmod(ctx, "/d/a", "600")
+	c.Chmod(ctx, "/d/sub", "1751")
+	c.Chown(ctx, "/d/sub/big", "42:43")
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c.Chtimes(ctx, "/d/sub", mtime, mtime)
+
+	for _, format := range []ArchiveFormat{FormatTar, FormatTarGz, FormatZip} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf strings.Builder
+			if err := c.ExportArchive(ctx, "/d", &buf, format); err != nil {
+				t.Fatalf("ExportArchive: %v", err)
+			}
+			other := newTestClient(t)
+			archive := strings.NewReader(buf.String())
+			if err := other.ImportArchive(ctx, archive, archive.Size(), "/restore", format); err != nil {
+				t.Fatalf("ImportArchive: %v", err)
+			}
+
+			for path, want := range map[string]string{"/restore/d/a": "alpha", "/restore/d/hard": "alpha", "/restore/d/sub/big": "0123456789abcdefghij"} {
+				if got, err := other.ReadFile(ctx, path); err != nil || got != want {
+					t.Errorf("%s = %q, %v, want %q", path, got, err, want)
+				}
+			}
+			if m := mustStat(t, other, "/restore/d/link"); m.Type != TypeSymlink || m.LinkTarget != "a" {
+				t.Errorf("link = %+v, want a symlink to a", m)
+			}
+			if m := mustStat(t, other, "/restore/d/a"); m.Mode != "0600" {
+				t.Errorf("a mode = %s, want 0600", m.Mode)
+			}
+			if m := mustStat(t, other, "/restore/d/sub"); m.Mode != "1751" || m.MTime != mtime.Unix() {
+				t.Errorf("sub = %+v, want mode 1751, mtime %d", m, mtime.Unix())
+			}
+			if m := mustStat(t, other, "/restore/d/sub/big"); m.UID != "42" || m.GID != "43" {
+				t.Errorf("big owner = %s:%s, want 42:43", m.UID, m.GID)
+			}
+			if v, err := other.GetXattr(ctx, "/restore/d/a", "user.k"); err != nil || v != "v" {
+				t.Errorf("xattr = %q, %v, want v", v, err)
+			}
+			if tags, _ := other.Tags(ctx, "/restore/d/sub"); len(tags) != 1 || tags[0] != "project" {
+				t.Errorf("tags = %v, want [project]", tags)
+			}
+			hard := format != FormatZip
+			if a, h := mustStat(t, other, "/restore/d/a"), mustStat(t, other, "/restore/d/hard"); (a.Ino == h.Ino) != hard {
+				t.Errorf("hard link shares inode = %v, want %v", a.Ino == h.Ino, hard)
+			}
+		})
+	}
+
+	// Names that leave the extraction root are skipped
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"../escape", "/abs", "ok"} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+		tw.Write([]byte("x"))
+	}
+	tw.Close()
+	if err := c.ImportArchive(ctx, bytes.NewReader(buf.Bytes()), int64(buf.Len()), "/in", FormatTar); err != nil {
+		t.Fatalf("ImportArchive: %v", err)
+	}
+	entries, _ := c.ReadDir(ctx, "/in")
+	if ok, _ := c.Exists(ctx, "/escape"); ok || len(entries) != 1 {
+		t.Errorf("extracted %v, want only ok", entries)
+	}
+}
+
+// recorder is an observer that records every notification as a line.
+type recorder struct {
+	NopObserver
+	events []string
+	volume string
+	id     Identity
+}
+
+func (r *recorder) add(format string, args ...any) error {
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+	return nil
+}
+
+func (r *recorder) OnFileWrite(ctx context.Context, path, content string) error {
+	return r.add("write %s %d", path, len(content))
+}
+
+func (r *recorder) OnChunkedWrite(ctx context.Context, path string, size int64) error {
+	return r.add("write %s %d", path, size)
+}
+
+func (r *recorder) OnFileRemove(ctx context.Context, path string) error {
+	return r.add("remove %s", path)
+}
+
+func (r *recorder) OnFileMove(ctx context.Context, oldPath, newPath string) error {
+	return r.add("move %s %s", oldPath, newPath)
+}
+
+func (r *recorder) OnMkdir(ctx context.Context, path string) error {
+	return r.add("mkdir %s", path)
+}
+
+func (r *recorder) OnRmdir(ctx context.Context, path string) error {
+	return r.add("rmdir %s", path)
+}
+
+func (r *recorder) OnSymlink(ctx context.Context, path, target string) error {
+	return r.add("symlink %s %s", path, target)
+}
+
+func (r *recorder) OnLink(ctx context.Context, oldPath, newPath string) error {
+	return r.add("link %s %s", oldPath, newPath)
+}
+
+func (r *recorder) OnChmod(ctx context.Context, path, mode string) error {
+	return r.add("chmod %s %s", path, mode)
+}
+
+func (r *recorder) OnChown(ctx context.Context, path, uid, gid string) error {
+	return r.add("chown %s %s:%s", path, uid, gid)
+}
+
+func (r *recorder) OnTagsChange(ctx context.Context, path string, tags []string) error {
+	return r.add("tags %s %s", path, strings.Join(tags, ","))
+}
+
+func (r *recorder) SetVolume(volume string) { r.volume = volume }
+
+func (r *recorder) SetIdentity(id Identity) { r.id = id }
+
+func TestObservers(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.SetChunkSize(4)
+	a, b := &recorder{}, &recorder{}
+	c.AddObserver(a)
+	c.AddObserver(b)
+	if a.volume != "test" {
+		t.Errorf("volume on attach = %q, want test", a.volume)
+	}
+
+	c.Mkdir(ctx, "/d/e", true)
+	c.WriteFile(ctx, "/d/f", "hi")
+	c.WriteFile(ctx, "/d/big", "0123456789")
+	c.Symlink(ctx, "f", "/d/l")
+	c.Link(ctx, "/d/f", "/d/h")
+	c.Chmod(ctx, "/d/f", "600")
+	c.Chown(ctx, "/d/f", ":7")
+	c.Move(ctx, "/d", "/m")
+	c.Rmdir(ctx, "/m/e")
+	c.RemoveRecursive(ctx, "/m")
+
+	want := []string{
+		"mkdir /d",
+		"mkdir /d/e",
+		"write /d/f 2",
+		"write /d/big 10",
+		"symlink /d/l f",
+		"link /d/f /d/h",
+		"chmod /d/f 600",
+		"chown /d/f 0:7",
+		"move /d /m",
+	}
+	if len(a.events) < len(want) || !slices.Equal(a.events[:len(want)], want) {
+		t.Fatalf("events = %q, want prefix %q", a.events, want)
+	}
+	rest := a.events[len(want):]
+	for _, e := range []string{"move /d/f /m/f", "move /d/h /m/h", "move /d/big /m/big", "rmdir /m/e", "remove /m/l", "remove /m/f", "rmdir /m"} {
+		if !slices.Contains(rest, e) {
+			t.Errorf("events %q lack %q", rest, e)
+		}
+	}
+	if rest[len(rest)-1] != "rmdir /m" {
+		t.Errorf("last event = %q, want rmdir /m", rest[len(rest)-1])
+	}
+	if !slices.Equal(a.events, b.events) {
+		t.Errorf("observers disagree:\n%q\n%q", a.events, b.events)
+	}
+
+	c.SetIdentity(Identity{UID: 5, GID: 6})
+	c.SetVolume("other")
+	if a.id.UID != 5 || b.volume != "other" {
+		t.Errorf("identity %v, volume %q not propagated", a.id, b.volume)
+	}
+	c.SetObserver(nil)
+	c.SetVolume("test")
+	c.WriteFile(ctx, "/x", "x")
+	if b.volume != "other" || len(a.events) != len(b.events) {
+		t.Error("detached observers still notified")
+	}
+}
+
+func TestRestoreSnapshotObservers(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.SetChunkSize(4)
+	c.Mkdir(ctx, "/d", false)
+	c.WriteFile(ctx, "/d/x", "x0")
+	c.WriteFile(ctx, "/a", "a0")
+	c.WriteFile(ctx, "/big", "0123456789")
+	c.WriteFile(ctx, "/same", "s")
+	c.AddTags(ctx, "/a", "draft")
+	if _, err := c.CreateSnapshot(ctx, "s1"); err != nil {
+		t.Fatalf("CreateSnapshot: %v", err)
+	}
+
+	c.WriteFile(ctx, "/a", "a11")
+	c.RemoveTags(ctx, "/a", "draft")
+	c.AppendFile(ctx, "/big", "!")
+	c.Chmod(ctx, "/same", "600")
+	c.RemoveRecursive(ctx, "/d")
+	c.Mkdir(ctx, "/n", false)
+	c.WriteFile(ctx, "/n/f", "f")
+
+	rec := &recorder{}
+	c.AddObserver(rec)
+	if err := c.RestoreSnapshot(ctx, "s1"); err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	want := []string{
+		"remove /n/f",
+		"rmdir /n",
+		"write /a 2",
+		"tags /a draft",
+		"write /big 10",
+		"mkdir /d",
+		"write /d/x 2",
+		"chmod /same 0644",
+	}
+	got := slices.Clone(rec.events)
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("events = %q, want %q", rec.events, want)
+	}
+	if i, j := slices.Index(rec.events, "remove /n/f"), slices.Index(rec.events, "rmdir /n"); i > j {
+		t.Errorf("events = %q, want /n/f removed before /n", rec.events)
+	}
+	if i, j := slices.Index(rec.events, "mkdir /d"), slices.Index(rec.events, "write /d/x 2"); i > j {
+		t.Errorf("events = %q, want /d created before /d/x", rec.events)
+	}
+}
+
+func mustStat(t *testing.T, c *Client, path string) *Metadata {
+	t.Helper()
+	meta, err := c.Stat(context.Background(), path)
+	if err != nil || meta == nil {
+		t.Fatalf("Stat(%s) = %v, %v", path, meta, err)
+	}
+	return meta
+}
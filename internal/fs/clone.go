@@ -0,0 +1,131 @@
+package fs
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Clones are writable copies of a volume. Like a snapshot, cloning copies
+// the meta, dir and xattr hashes of the volume and shares file content with
+// it, but content is copied whichever of the two volumes changes it first
+// (see backend_snapshot.go). The inode allocator is copied along, so both
+// volumes go on allocating ids from the same point; the clone tells the
+// inodes it shares from its own by its shared hash. Snapshots, version
+// history and the search index are not part of a clone.
+
+// CloneVolume creates volume dst as a copy-on-write clone of the active
+// volume, which must be live. The new volume is not activated.
+func (c *Client) CloneVolume(ctx context.Context, dst string) error {
+	if c.IsSnapshot() {
+		return pathErr("clone", c.Volume, ErrReadOnly)
+	}
+	if !c.id.IsRoot() {
+		return pathErr("clone", c.Volume, ErrNotPermitted)
+	}
+	if !validName(dst) {
+		return pathErr("clone", dst, ErrInvalid)
+	}
+	to := c.keys.volume(dst)
+	n, err := c.base.Exists(ctx, to.Super(), to.legacyMeta("/"))
+	if err != nil {
+		return pathErr("clone", dst, err)
+	}
+	if n > 0 {
+		return pathErr("clone", dst, ErrExist)
+	}
+
+	// The clone is registered first, so content the volume changes from
+	// here on is copied into it
+	now := time.Now()
+	if _, err := c.base.HSetNX(ctx, c.keys.Clones(), dst, strconv.FormatInt(now.Unix(), 10)); err != nil {
+		return pathErr("clone", dst, err)
+	}
+	err = c.share(ctx, c.keys)
+	if err == nil {
+		err = c.cloneInto(ctx, to, now)
+	}
+	if err != nil {
+		c.base.HDel(ctx, c.keys.Clones(), dst)
+		c.dropKeys(ctx, to)
+		c.unshare(ctx, c.keys)
+		return pathErr("clone", dst, err)
+	}
+	return nil
+}
+
+// cloneInto copies the active volume into to. The superblock goes last, so
+// the clone only opens once it is complete.
+func (c *Client) cloneInto(ctx context.Context, to *KeyGen, now time.Time) error {
+	next, err := c.base.Get(ctx, c.keys.InodeCounter())
+	if err != nil {
+		return err
+	}
+	if next != "" {
+		if err := c.base.Set(ctx, to.InodeCounter(), next); err != nil {
+			return err
+		}
+	}
+	return c.copyVolume(ctx, to, true, map[string]string{
+		"clone_of": c.Volume,
+		"ctime":    strconv.FormatInt(now.Unix(), 10),
+	})
+}
+
+// Clones returns the names of the volumes cloned from the active volume,
+// sorted.
+func (c *Client) Clones(ctx context.Context) ([]string, error) {
+	names, err := c.base.HKeys(ctx, c.keys.Clones())
+	if err != nil {
+		return nil, pathErr("clone", c.Volume, err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// detachClone stops the clone to names from sharing content with the
+// active volume before it is deleted. Content the active volume shares in
+// turn with the volume it was cloned from, origin, stays shared with it,
+// and the clone becomes a clone of origin; the rest is copied.
+func (c *Client) detachClone(ctx context.Context, to *KeyGen, origin string) error {
+	shared, err := c.base.HKeys(ctx, to.Shared())
+	if err != nil {
+		return err
+	}
+	for _, ino := range shared {
+		src, err := sourceOf(ctx, c.base, c.keys, ino)
+		if err != nil {
+			return err
+		}
+		if src != c.keys {
+			continue
+		}
+		m, err := c.base.HGetAll(ctx, to.Meta(ino))
+		if err != nil {
+			return err
+		}
+		if err := copyContent(ctx, c.base, src, to, ino, MetaFromMap(m)); err != nil {
+			return err
+		}
+		if err := c.base.HDel(ctx, to.Shared(), ino); err != nil {
+			return err
+		}
+	}
+
+	// A new cow_gen, so the clone's writes stop going by the old origin
+	if origin == "" {
+		return c.base.Tx(ctx, func(tx Writer) {
+			tx.HDel(to.Super(), "clone_of")
+			tx.HSet(to.Super(), map[string]string{"cow_gen": newCOWGen()})
+		})
+	}
+	ctime, err := c.base.HGet(ctx, c.keys.Clones(), to.Volume)
+	if err != nil {
+		return err
+	}
+	if err := c.base.HSet(ctx, c.keys.volume(origin).Clones(), map[string]string{to.Volume: ctime}); err != nil {
+		return err
+	}
+	return c.base.HSet(ctx, to.Super(), map[string]string{"clone_of": origin, "cow_gen": newCOWGen()})
+}
@@ -0,0 +1,73 @@
+package fs
+
+import (
+	"context"
+	"sort"
+)
+
+// DuEntry is a line of Client.DiskUsage output.
+type DuEntry struct {
+	Path string
+	Size int64 // bytes used by the entry and, for a directory, everything below it
+	Dir  bool
+}
+
+// DiskUsage returns the bytes used by each root and every entry below it,
+// each directory after its contents, in the order du prints them. A file
+// with several hard links is counted once, under the first path that
+// reaches it, across all roots. Directories the client's identity cannot
+// list count as empty.
+func (c *Client) DiskUsage(ctx context.Context, roots ...string) ([]DuEntry, error) {
+	seen := make(map[string]bool)
+	var results []DuEntry
+	for _, root := range roots {
+		root = NormalizePath(root)
+		meta, err := c.Stat(ctx, root)
+		if err != nil {
+			return nil, err
+		}
+		if meta == nil {
+			return nil, pathErr("du", root, ErrNotExist)
+		}
+		if _, err := c.duWalk(ctx, root, meta, seen, &results); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// duWalk appends the usage of path and its descendants to results and
+// returns the total. Inodes in seen have already been counted.
+func (c *Client) duWalk(ctx context.Context, path string, meta *Metadata, seen map[string]bool, results *[]DuEntry) (int64, error) {
+	if meta.Type != TypeDir {
+		if seen[meta.Ino] {
+			return 0, nil
+		}
+		seen[meta.Ino] = true
+		*results = append(*results, DuEntry{Path: path, Size: meta.Size})
+		return meta.Size, nil
+	}
+
+	var total int64
+	if c.id.Can(meta, AccessRead|AccessExec) {
+		children, err := c.readDirIno(ctx, meta.Ino)
+		if err != nil {
+			return 0, err
+		}
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].Name < children[j].Name
+		})
+		for _, child := range children {
+			if child.Meta == nil {
+				continue
+			}
+			size, err := c.duWalk(ctx, JoinPath(path, child.Name), child.Meta, seen, results)
+			if err != nil {
+				return 0, err
+			}
+			total += size
+		}
+	}
+	*results = append(*results, DuEntry{Path: path, Size: total, Dir: true})
+	return total, nil
+}
@@ -0,0 +1,85 @@
+package fs
+
+import (
+	"errors"
+	iofs "io/fs"
+)
+
+// Errno is a POSIX error condition. Its message is the conventional
+// strerror text, and errors.Is matches the io/fs sentinel it corresponds
+// to, if any, so callers can test either ErrNotExist or fs.ErrNotExist.
+type Errno struct {
+	Name string // symbolic name, e.g. "ENOENT"
+	msg  string
+	is   error
+}
+
+func (e *Errno) Error() string { return e.msg }
+
+// Is reports whether target is the io/fs error e corresponds to.
+func (e *Errno) Is(target error) bool {
+	return e.is != nil && target == e.is
+}
+
+// Error conditions reported by Client operations, always wrapped in a
+// *PathError.
+var (
+	ErrNotExist     = &Errno{"ENOENT", "No such file or directory", iofs.ErrNotExist}
+	ErrExist        = &Errno{"EEXIST", "File exists", iofs.ErrExist}
+	ErrPermission   = &Errno{"EACCES", "Permission denied", iofs.ErrPermission}
+	ErrInvalid      = &Errno{"EINVAL", "Invalid argument", iofs.ErrInvalid}
+	ErrNotDir       = &Errno{"ENOTDIR", "Not a directory", nil}
+	ErrIsDir        = &Errno{"EISDIR", "Is a directory", nil}
+	ErrNotEmpty     = &Errno{"ENOTEMPTY", "Directory not empty", nil}
+	ErrLoop         = &Errno{"ELOOP", "Too many levels of symbolic links", nil}
+	ErrBusy         = &Errno{"EBUSY", "Device or resource busy", nil}
+	ErrBadFD        = &Errno{"EBADF", "Bad file descriptor", nil}
+	ErrStale        = &Errno{"ESTALE", "Stale file handle", nil}
+	ErrNoAttr       = &Errno{"ENODATA", "No such attribute", nil}
+	ErrNotPermitted = &Errno{"EPERM", "Operation not permitted", nil}
+	ErrReadOnly     = &Errno{"EROFS", "Read-only file system", nil}
+)
+
+// errAgain reports a conditional write, Backend.TxIf or fs_if, that was
+// not applied because its condition no longer held.
+var errAgain = &Errno{"EAGAIN", "Resource temporarily unavailable", nil}
+
+// errnos maps symbolic names, as returned by the functions library, to
+// their Errno.
+var errnos = map[string]*Errno{}
+
+func init() {
+	for _, e := range []*Errno{
+		ErrNotExist, ErrExist, ErrPermission, ErrInvalid, ErrNotDir,
+		ErrIsDir, ErrNotEmpty, ErrLoop, ErrBusy, ErrBadFD, ErrStale, ErrNoAttr,
+		ErrNotPermitted, ErrReadOnly, errAgain,
+	} {
+		errnos[e.Name] = e
+	}
+}
+
+// PathError records a failed operation on a path, in the style of
+// os.PathError. Op is the command that failed ("mkdir", "cat", ...) and Err
+// is usually one of the Err* conditions, or a Redis error.
+type PathError struct {
+	Op   string
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return e.Op + ": " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *PathError) Unwrap() error { return e.Err }
+
+// pathErr returns a *PathError for op on path. An err that already is a
+// *PathError is returned unchanged, so nested operations do not stack
+// prefixes.
+func pathErr(op, path string, err error) error {
+	var pe *PathError
+	if errors.As(err, &pe) {
+		return err
+	}
+	return &PathError{Op: op, Path: path, Err: err}
+}
@@ -0,0 +1,46 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"testing"
+)
+
+func TestPathErrorIs(t *testing.T) {
+	tests := []struct {
+		err    *Errno
+		target error
+	}{
+		{ErrNotExist, iofs.ErrNotExist},
+		{ErrExist, iofs.ErrExist},
+		{ErrPermission, iofs.ErrPermission},
+		{ErrInvalid, iofs.ErrInvalid},
+		{ErrNotDir, ErrNotDir},
+		{ErrLoop, ErrLoop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Name, func(t *testing.T) {
+			err := fmt.Errorf("wrapped: %w", pathErr("cat", "/a", tt.err))
+			if !errors.Is(err, tt.err) {
+				t.Errorf("errors.Is(%v, %s) = false", err, tt.err.Name)
+			}
+			if !errors.Is(err, tt.target) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tt.target)
+			}
+		})
+	}
+
+	if errors.Is(pathErr("cat", "/a", ErrNotDir), iofs.ErrNotExist) {
+		t.Error("ErrNotDir matched fs.ErrNotExist")
+	}
+}
+
+func TestPathErrorNoStacking(t *testing.T) {
+	inner := pathErr("open", "/a", ErrLoop)
+	err := pathErr("cat", "/b", inner)
+	if got, want := err.Error(), "open: /a: Too many levels of symbolic links"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
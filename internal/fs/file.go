@@ -0,0 +1,313 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+)
+
+// fileBufferSize is the amount of written data a File buffers before it
+// flushes to Redis on its own.
+const fileBufferSize = 1 << 20
+
+// File is an open file handle in the style of os.File. It implements
+// io.Reader, io.Writer, io.Seeker, io.ReaderAt, io.Closer and io/fs.File.
+//
+// Writes are buffered and flushed on Close, when the buffer fills, or
+// before any read or seek that needs to observe them. The handle refers to
+// the file by path, and the context given to OpenFile is used for every
+// operation on it. A File is not safe for concurrent use.
+type File struct {
+	c    *Client
+	ctx  context.Context
+	name string // as passed to OpenFile
+	path string // after symlink resolution
+	flag int
+
+	offset int64
+	wbuf   []byte // pending writes, contiguous from woff
+	woff   int64
+	closed bool
+}
+
+// Open opens the file at path for reading.
+func (c *Client) Open(ctx context.Context, path string) (*File, error) {
+	return c.OpenFile(ctx, path, os.O_RDONLY, 0)
+}
+
+// Create creates or truncates the file at path and opens it for reading
+// and writing.
+func (c *Client) Create(ctx context.Context, path string) (*File, error) {
+	return c.OpenFile(ctx, path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+// OpenFile opens the file at path with the given os.O_* flags. If the file
+// does not exist and os.O_CREATE is set, it is created with mode perm,
+// less the client's umask.
+func (c *Client) OpenFile(ctx context.Context, path string, flag int, perm os.FileMode) (*File, error) {
+	path = NormalizePath(path)
+	name := path
+
+	meta, err := c.Stat(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if meta != nil && meta.Type == TypeSymlink {
+		if path, err = c.ResolveSymlink(ctx, path, 0); err != nil {
+			return nil, err
+		}
+		if meta, err = c.Stat(ctx, path); err != nil {
+			return nil, err
+		}
+	}
+
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if meta != nil && meta.Type == TypeFile {
+		want := AccessRead
+		if flag&os.O_WRONLY != 0 {
+			want = AccessWrite
+		} else if writable {
+			want |= AccessWrite
+		}
+		if err := c.access("open", path, meta, want); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case meta == nil && flag&os.O_CREATE == 0:
+		return nil, pathErr("open", path, ErrNotExist)
+	case meta == nil:
+		if err := c.createFile(ctx, path, c.createMode(perm)); err != nil {
+			return nil, err
+		}
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, pathErr("open", path, ErrExist)
+	case meta.Type == TypeDir && writable:
+		return nil, pathErr("open", path, ErrIsDir)
+	case meta.Type == TypeFile && writable && flag&os.O_TRUNC != 0:
+		if err := c.WriteFile(ctx, path, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return &File{c: c, ctx: ctx, name: name, path: path, flag: flag}, nil
+}
+
+// createFile creates an empty regular file with the given mode.
+func (c *Client) createFile(ctx context.Context, path, mode string) error {
+	parentIno, err := c.lookupDir(ctx, ParentPath(path))
+	if err != nil {
+		return err
+	}
+	if parentIno == "" {
+		return pathErr("open", path, ErrNotExist)
+	}
+	if err := c.accessIno(ctx, "open", path, parentIno, AccessWrite|AccessExec); err != nil {
+		return err
+	}
+
+	ino, err := c.allocInode(ctx)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	empty := ""
+	if err := c.link(ctx, parentIno, BaseName(path), ino, c.own(NewFileMeta(mode, 0)), &empty); err != nil {
+		return pathErr("open", path, err)
+	}
+	c.notifyWrite(ctx, path, empty)
+	return nil
+}
+
+// Name returns the path the file was opened with.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Stat returns the file's FileInfo, including any buffered writes.
+func (f *File) Stat() (iofs.FileInfo, error) {
+	if err := f.flush(); err != nil {
+		return nil, err
+	}
+	meta, err := f.c.StatFile(f.ctx, f.path)
+	if err != nil {
+		return nil, err
+	}
+	return NewFileInfo(BaseName(f.name), meta), nil
+}
+
+// Read reads up to len(p) bytes from the current offset.
+func (f *File) Read(p []byte) (int, error) {
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if err := f.flushAppend(); err != nil {
+		return 0, err
+	}
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt reads len(p) bytes at offset off, returning io.EOF if fewer are
+// available. It does not move the file offset.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if err := f.flush(); err != nil {
+		return 0, err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	data, err := f.c.ReadAt(f.ctx, f.path, off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Write writes p at the current offset, or at the end of the file when the
+// file was opened with os.O_APPEND.
+func (f *File) Write(p []byte) (int, error) {
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+
+	if f.flag&os.O_APPEND != 0 {
+		f.wbuf = append(f.wbuf, p...)
+	} else {
+		if len(f.wbuf) > 0 && f.offset != f.woff+int64(len(f.wbuf)) {
+			if err := f.flush(); err != nil {
+				return 0, err
+			}
+		}
+		if len(f.wbuf) == 0 {
+			f.woff = f.offset
+		}
+		f.wbuf = append(f.wbuf, p...)
+		f.offset += int64(len(p))
+	}
+
+	if len(f.wbuf) >= fileBufferSize {
+		if err := f.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Seek sets the offset for the next Read or Write, interpreted according
+// to whence as in io.Seeker.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check("seek", false); err != nil {
+		return 0, err
+	}
+
+	var base int64
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		if err := f.flushAppend(); err != nil {
+			return 0, err
+		}
+		base = f.offset
+	case io.SeekEnd:
+		info, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		base = info.Size()
+	default:
+		return 0, pathErr("seek", f.path, ErrInvalid)
+	}
+	if base+offset < 0 {
+		return 0, pathErr("seek", f.path, ErrInvalid)
+	}
+	f.offset = base + offset
+	return f.offset, nil
+}
+
+// Sync flushes buffered writes to Redis.
+func (f *File) Sync() error {
+	if err := f.check("sync", false); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+// Close flushes buffered writes and releases the handle.
+func (f *File) Close() error {
+	if f.closed {
+		return pathErr("close", f.path, os.ErrClosed)
+	}
+	err := f.flush()
+	f.closed = true
+	return err
+}
+
+// check validates that the handle is open and, for writes, writable.
+func (f *File) check(op string, write bool) error {
+	if f.closed {
+		return pathErr(op, f.path, os.ErrClosed)
+	}
+	if write && f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return pathErr(op, f.path, ErrBadFD)
+	}
+	if !write && op == "read" && f.flag&os.O_WRONLY != 0 {
+		return pathErr(op, f.path, ErrBadFD)
+	}
+	return nil
+}
+
+// flush writes any buffered data to Redis. The buffer is kept when the
+// write fails, so that a later flush can retry it. After an append, the
+// offset moves to the new end of the file.
+func (f *File) flush() error {
+	if len(f.wbuf) == 0 {
+		return nil
+	}
+	data := string(f.wbuf)
+
+	if f.flag&os.O_APPEND == 0 {
+		if err := f.c.WriteAt(f.ctx, f.path, f.woff, data); err != nil {
+			return err
+		}
+		f.wbuf = f.wbuf[:0]
+		return nil
+	}
+	if err := f.c.AppendFile(f.ctx, f.path, data); err != nil {
+		return err
+	}
+	f.wbuf = f.wbuf[:0]
+	meta, err := f.c.StatFile(f.ctx, f.path)
+	if err != nil {
+		return err
+	}
+	f.offset = meta.Size
+	return nil
+}
+
+// flushAppend flushes pending appends, whose end is the offset of the
+// handle.
+func (f *File) flushAppend() error {
+	if f.flag&os.O_APPEND == 0 {
+		return nil
+	}
+	return f.flush()
+}
+
+var _ interface {
+	io.ReadWriteSeeker
+	io.ReaderAt
+	io.Closer
+} = (*File)(nil)
@@ -0,0 +1,139 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"os"
+	"testing"
+)
+
+func TestFileHandle(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	f, err := c.Create(ctx, "/h")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	io.WriteString(f, "hello, world")
+	f.Seek(7, io.SeekStart)
+	io.WriteString(f, "redis")
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); !errors.Is(err, iofs.ErrClosed) {
+		t.Errorf("second Close = %v, want ErrClosed", err)
+	}
+
+	g, err := c.Open(ctx, "/h")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer g.Close()
+	data, _ := io.ReadAll(g)
+	if string(data) != "hello, redis" {
+		t.Errorf("content = %q, want %q", data, "hello, redis")
+	}
+	if _, err := g.Write([]byte("x")); !errors.Is(err, ErrBadFD) {
+		t.Errorf("Write on read-only handle = %v, want ErrBadFD", err)
+	}
+	buf := make([]byte, 5)
+	if n, err := g.ReadAt(buf, 7); n != 5 || string(buf) != "redis" || err != nil && err != io.EOF {
+		t.Errorf("ReadAt = %d %q %v", n, buf, err)
+	}
+	if info, err := g.Stat(); err != nil || info.Size() != 12 || info.Name() != "h" {
+		t.Errorf("Stat = %v, %v", info, err)
+	}
+}
+
+func TestOpenFileFlags(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.WriteFile(ctx, "/f", "abc")
+	c.Mkdir(ctx, "/d", false)
+
+	a, err := c.OpenFile(ctx, "/f", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("OpenFile append: %v", err)
+	}
+	a.Seek(0, io.SeekStart)
+	io.WriteString(a, "def")
+	a.Close()
+	if got, _ := c.ReadFile(ctx, "/f"); got != "abcdef" {
+		t.Errorf("after append = %q, want abcdef", got)
+	}
+
+	if _, err := c.OpenFile(ctx, "/f", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644); !errors.Is(err, ErrExist) {
+		t.Errorf("O_EXCL on existing file = %v, want ErrExist", err)
+	}
+	if _, err := c.OpenFile(ctx, "/missing", os.O_RDONLY, 0); !errors.Is(err, ErrNotExist) {
+		t.Errorf("open missing = %v, want ErrNotExist", err)
+	}
+	if _, err := c.OpenFile(ctx, "/d", os.O_RDWR, 0); !errors.Is(err, ErrIsDir) {
+		t.Errorf("open dir for writing = %v, want ErrIsDir", err)
+	}
+
+	n, err := c.OpenFile(ctx, "/new", os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatalf("OpenFile create: %v", err)
+	}
+	n.Close()
+	if meta := mustStat(t, c, "/new"); meta.Mode != "0600" || meta.Size != 0 {
+		t.Errorf("created %+v, want mode 0600 and size 0", meta)
+	}
+}
+
+func TestFileAppendOffset(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.WriteFile(ctx, "/f", "abc")
+
+	f, err := c.OpenFile(ctx, "/f", os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer f.Close()
+	io.WriteString(f, "def")
+	if off, err := f.Seek(0, io.SeekCurrent); off != 6 || err != nil {
+		t.Errorf("offset after append = %d, %v, want 6", off, err)
+	}
+	io.WriteString(f, "gh")
+	if n, err := f.Read(make([]byte, 4)); n != 0 || err != io.EOF {
+		t.Errorf("Read after append = %d, %v, want 0, EOF", n, err)
+	}
+	f.Seek(-2, io.SeekCurrent)
+	buf := make([]byte, 2)
+	if n, _ := f.Read(buf); n != 2 || string(buf) != "gh" {
+		t.Errorf("Read back = %q, want gh", buf[:n])
+	}
+}
+
+func TestFileFlushRetry(t *testing.T) {
+	ctx := context.Background()
+	for _, flag := range []int{os.O_WRONLY, os.O_WRONLY | os.O_APPEND} {
+		c := newTestClient(t)
+		c.WriteFile(ctx, "/f", "abc")
+		c.Chown(ctx, "/f", "1000:1000")
+		c.SetIdentity(Identity{UID: 1000, GID: 1000})
+
+		f, err := c.OpenFile(ctx, "/f", flag, 0)
+		if err != nil {
+			t.Fatalf("OpenFile: %v", err)
+		}
+		f.Seek(3, io.SeekStart)
+		io.WriteString(f, "de")
+		c.Chmod(ctx, "/f", "0444")
+		if err := f.Sync(); !errors.Is(err, ErrPermission) {
+			t.Errorf("Sync on read-only file = %v, want ErrPermission", err)
+		}
+		c.Chmod(ctx, "/f", "0644")
+		if err := f.Close(); err != nil {
+			t.Errorf("Close after failed flush: %v", err)
+		}
+		if got, _ := c.ReadFile(ctx, "/f"); got != "abcde" {
+			t.Errorf("flag %#x: content after retry = %q, want abcde", flag, got)
+		}
+	}
+}
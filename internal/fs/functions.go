@@ -0,0 +1,30 @@
+package fs
+
+import (
+	"context"
+	_ "embed"
+)
+
+// functionsLibrary is the Redis Functions library loaded by Init. It holds
+// the atomic check-and-mutate primitives used when the server supports them.
+//
+//go:embed redisfs.lua
+var functionsLibrary string
+
+// loadFunctions installs the functions library through the backend.
+// Servers older than Redis 7, or users without permission to run FUNCTION
+// LOAD, leave the client on the MULTI-based fallback.
+func (c *Client) loadFunctions(ctx context.Context) {
+	c.functions = c.store.LoadFunctions(ctx, functionsLibrary) == nil
+}
+
+// UsesFunctions reports whether mutations run through the server-side
+// functions library rather than client-side checks.
+func (c *Client) UsesFunctions() bool {
+	return c.functions
+}
+
+// fcall invokes a library function. Errno replies come back as *Errno.
+func (c *Client) fcall(ctx context.Context, fn string, keys []string, args ...interface{}) (interface{}, error) {
+	return c.store.Call(ctx, fn, keys, args...)
+}
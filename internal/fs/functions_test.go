@@ -0,0 +1,205 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestFunctionsLibrary(t *testing.T) {
+	var registered []string
+	for _, m := range regexp.MustCompile(`redis\.register_function\('(\w+)'`).FindAllStringSubmatch(functionsLibrary, -1) {
+		registered = append(registered, m[1])
+	}
+	sort.Strings(registered)
+	want := []string{"fs_hardlink", "fs_if", "fs_link", "fs_rename", "fs_unlink", "fs_write"}
+	if !slices.Equal(registered, want) {
+		t.Errorf("library registers %v, want %v", registered, want)
+	}
+
+	// Every errno the library replies with comes back as an *Errno
+	for _, m := range regexp.MustCompile(`errno\('(\w+)'\)`).FindAllStringSubmatch(functionsLibrary, -1) {
+		if _, ok := errnos[m[1]]; !ok {
+			t.Errorf("library replies %s, which is not a known errno", m[1])
+		}
+	}
+}
+
+// newFunctionsFixture returns a memory backend holding a root directory 0
+// with a file f (1, content abc, also linked as i), a directory d (2)
+// holding x, an empty directory e (3), a file h (4) with another link
+// elsewhere, and an entry g (5) whose inode is gone.
+func newFunctionsFixture() *MemoryBackend {
+	ctx := context.Background()
+	m := NewMemoryBackend()
+	m.HSet(ctx, "super", map[string]string{"cow_gen": "b"})
+	m.HSet(ctx, "meta:0", map[string]string{"type": "dir"})
+	m.HSet(ctx, "dir:0", map[string]string{"f": "1", "d": "2", "e": "3", "h": "4", "g": "5", "i": "1"})
+	m.HSet(ctx, "meta:1", map[string]string{"type": "file", "nlink": "2"})
+	m.Set(ctx, "data:1", "abc")
+	m.HSet(ctx, "meta:2", map[string]string{"type": "dir"})
+	m.HSet(ctx, "dir:2", map[string]string{"x": "6"})
+	m.HSet(ctx, "meta:3", map[string]string{"type": "dir"})
+	m.HSet(ctx, "meta:4", map[string]string{"type": "file", "nlink": "2"})
+	m.HSet(ctx, "meta:6", map[string]string{"type": "file"})
+	return m
+}
+
+func TestFunctionReplies(t *testing.T) {
+	rename := func(src, dst, dstIno string) []string {
+		keys := []string{"dir:0", "meta:" + dst, "dir:" + dst, "meta:" + src}
+		if dstIno != "" {
+			keys = append(keys, "meta:"+dstIno, "data:"+dstIno, "dir:"+dstIno, "xattr:"+dstIno)
+		}
+		return keys
+	}
+	inode := func(ino string) []string {
+		return []string{"dir:0", "meta:" + ino, "data:" + ino, "dir:" + ino, "xattr:" + ino}
+	}
+
+	tests := []struct {
+		name string
+		fn   string
+		keys []string
+		args []interface{}
+		want error
+	}{
+		{"link under a missing parent", "fs_link", []string{"meta:9", "dir:9", "meta:7"}, []interface{}{"n", "7", "", "type", "file"}, ErrNotExist},
+		{"link under a file", "fs_link", []string{"meta:1", "dir:1", "meta:7"}, []interface{}{"n", "7", "", "type", "file"}, ErrNotDir},
+		{"link over an entry", "fs_link", []string{"meta:0", "dir:0", "meta:7"}, []interface{}{"f", "7", "", "type", "file"}, ErrExist},
+
+		{"hardlink under a missing parent", "fs_hardlink", []string{"meta:9", "dir:9", "meta:1"}, []interface{}{"n", "1"}, ErrNotExist},
+		{"hardlink under a file", "fs_hardlink", []string{"meta:1", "dir:1", "meta:1"}, []interface{}{"n", "1"}, ErrNotDir},
+		{"hardlink over an entry", "fs_hardlink", []string{"meta:0", "dir:0", "meta:1"}, []interface{}{"f", "1"}, ErrExist},
+		{"hardlink to a missing inode", "fs_hardlink", []string{"meta:0", "dir:0", "meta:9"}, []interface{}{"n", "9"}, ErrNotExist},
+		{"hardlink to a directory", "fs_hardlink", []string{"meta:0", "dir:0", "meta:2"}, []interface{}{"n", "2"}, ErrNotPermitted},
+
+		{"write through a replaced entry", "fs_write", []string{"dir:0", "meta:9", "data:9"}, []interface{}{"f", "9", "set", "x", "0"}, ErrStale},
+		{"write to a removed inode", "fs_write", []string{"dir:0", "meta:5", "data:5"}, []interface{}{"g", "5", "set", "x", "0"}, ErrStale},
+		{"write to a directory", "fs_write", []string{"dir:0", "meta:2", "data:2"}, []interface{}{"d", "2", "set", "x", "0"}, ErrIsDir},
+
+		{"unlink a missing entry", "fs_unlink", inode("1"), []interface{}{"n", "1", "file"}, ErrNotExist},
+		{"rmdir a file", "fs_unlink", inode("1"), []interface{}{"f", "1", "dir"}, ErrNotDir},
+		{"rmdir a non-empty directory", "fs_unlink", inode("2"), []interface{}{"d", "2", "dir"}, ErrNotEmpty},
+		{"unlink a directory", "fs_unlink", inode("3"), []interface{}{"e", "3", "file"}, ErrIsDir},
+
+		{"rename a missing entry", "fs_rename", rename("1", "0", ""), []interface{}{"n", "1", "m", ""}, ErrNotExist},
+		{"rename into a missing directory", "fs_rename", rename("1", "9", ""), []interface{}{"f", "1", "m", ""}, ErrNotExist},
+		{"rename into a file", "fs_rename", rename("1", "1", ""), []interface{}{"f", "1", "m", ""}, ErrNotDir},
+		{"rename over an unexpected entry", "fs_rename", rename("1", "0", ""), []interface{}{"f", "1", "d", ""}, ErrExist},
+		{"rename over a replaced entry", "fs_rename", rename("1", "0", "9"), []interface{}{"f", "1", "e", "9"}, ErrStale},
+		{"rename a file over a directory", "fs_rename", rename("1", "0", "3"), []interface{}{"f", "1", "e", "3"}, ErrIsDir},
+		{"rename over a non-empty directory", "fs_rename", rename("3", "0", "2"), []interface{}{"e", "3", "d", "2"}, ErrNotEmpty},
+		{"rename a directory over a file", "fs_rename", rename("3", "0", "1"), []interface{}{"e", "3", "f", "1"}, ErrNotDir},
+
+		{"guarded write after the field changed", "fs_if", []string{"super", "dir:0", "meta:1", "data:1"}, []interface{}{"cow_gen", "a", "fs_write", "f", "1", "set", "x", "0"}, errAgain},
+		{"guarded write on a missing field", "fs_if", []string{"super", "dir:0", "meta:1", "data:1"}, []interface{}{"shares", "1", "fs_write", "f", "1", "set", "x", "0"}, errAgain},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			m := newFunctionsFixture()
+			before := m.hashes["dir:0"]["f"]
+			if _, err := m.Call(ctx, tt.fn, tt.keys, tt.args...); err != tt.want {
+				t.Errorf("%s = %v, want %v", tt.fn, err, tt.want)
+			}
+			if data, _ := m.Get(ctx, "data:1"); data != "abc" || m.hashes["dir:0"]["f"] != before {
+				t.Errorf("%s changed the volume on failure", tt.fn)
+			}
+		})
+	}
+}
+
+func TestFunctionResults(t *testing.T) {
+	ctx := context.Background()
+
+	m := newFunctionsFixture()
+	guarded := []interface{}{"cow_gen", "b", "fs_write", "f", "1", "append", "de", "7"}
+	if n, err := m.Call(ctx, "fs_if", []string{"super", "dir:0", "meta:1", "data:1"}, guarded...); n != int64(5) || err != nil {
+		t.Errorf("guarded append = %v, %v, want 5", n, err)
+	}
+	if n, _ := m.Call(ctx, "fs_write", []string{"dir:0", "meta:1", "data:1"}, "f", "1", "range", "XY", "8", "1"); n != int64(5) {
+		t.Errorf("range write = %v, want 5", n)
+	}
+	if data, _ := m.Get(ctx, "data:1"); data != "aXYde" || m.hashes["meta:1"]["size"] != "5" || m.hashes["meta:1"]["mtime"] != "8" {
+		t.Errorf("after writes: data %q, meta %v", data, m.hashes["meta:1"])
+	}
+
+	// Dropping one of two links keeps the inode
+	if n, _ := m.Call(ctx, "fs_unlink", []string{"dir:0", "meta:4", "data:4", "dir:4", "xattr:4"}, "h", "4", "file"); n != int64(0) {
+		t.Errorf("unlink of a file with another link = %v, want 0", n)
+	}
+	if m.hashes["meta:4"]["nlink"] != "1" {
+		t.Errorf("nlink after unlink = %q, want 1", m.hashes["meta:4"]["nlink"])
+	}
+
+	// Renaming onto another link of the same inode changes nothing
+	if n, _ := m.Call(ctx, "fs_rename", []string{"dir:0", "meta:0", "dir:0", "meta:1", "meta:1", "data:1", "dir:1", "xattr:1"}, "f", "1", "i", "1"); n != int64(1) {
+		t.Errorf("rename onto the same inode = %v, want 1", n)
+	}
+	if m.hashes["dir:0"]["f"] != "1" || m.hashes["dir:0"]["i"] != "1" {
+		t.Errorf("rename onto the same inode changed the entries: %v", m.hashes["dir:0"])
+	}
+
+	if n, _ := m.Call(ctx, "fs_rename", []string{"dir:0", "meta:0", "dir:0", "meta:3"}, "e", "3", "e2", ""); n != int64(1) {
+		t.Errorf("rename = %v, want 1", n)
+	}
+	if _, ok := m.hashes["dir:0"]["e"]; ok || m.hashes["dir:0"]["e2"] != "3" {
+		t.Errorf("after rename: %v", m.hashes["dir:0"])
+	}
+}
+
+// errorHook answers every command with the error reply reply, without
+// sending it.
+type errorHook struct {
+	reply string
+}
+
+func (h errorHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h errorHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := errors.New(h.reply)
+		cmd.SetErr(err)
+		return err
+	}
+}
+
+func (h errorHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestRedisBackendCallErrno(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  error
+	}{
+		{"ESTALE", ErrStale},
+		{"ERR ENOTEMPTY", ErrNotEmpty},
+		{"EAGAIN", errAgain},
+		{"EPERM", ErrNotPermitted},
+	}
+	for _, tt := range tests {
+		rdb := redis.NewClient(&redis.Options{Addr: "localhost:0"})
+		rdb.AddHook(errorHook{tt.reply})
+		if _, err := NewRedisBackend(rdb).Call(context.Background(), "fs_write", []string{"k"}); err != tt.want {
+			t.Errorf("reply %q = %v, want %v", tt.reply, err, tt.want)
+		}
+	}
+
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:0"})
+	rdb.AddHook(errorHook{"ERR Function not found"})
+	_, err := NewRedisBackend(rdb).Call(context.Background(), "fs_nope", nil)
+	var errno *Errno
+	if err == nil || errors.As(err, &errno) {
+		t.Errorf("unknown reply = %v, want it unchanged", err)
+	}
+}
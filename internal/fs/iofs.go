@@ -0,0 +1,268 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// VolumeFS adapts the active volume of a Client to the standard io/fs
+// interfaces, so it can be used with fs.WalkDir, http.FS, template.ParseFS
+// and friends. Names are unrooted and slash-separated as io/fs requires:
+// "." is the volume root and "a/b" is /a/b. Symlinks are followed except
+// by Lstat, ReadLink and ReadDir.
+type VolumeFS struct {
+	c   *Client
+	ctx context.Context
+}
+
+// NewVolumeFS returns an io/fs view of the client's volume. ctx is used for
+// every Redis call made through it.
+func NewVolumeFS(ctx context.Context, c *Client) *VolumeFS {
+	return &VolumeFS{c: c, ctx: ctx}
+}
+
+var (
+	_ iofs.FS         = (*VolumeFS)(nil)
+	_ iofs.StatFS     = (*VolumeFS)(nil)
+	_ iofs.ReadDirFS  = (*VolumeFS)(nil)
+	_ iofs.ReadFileFS = (*VolumeFS)(nil)
+	_ iofs.GlobFS     = (*VolumeFS)(nil)
+)
+
+// FileInfo describes a filesystem entry. It implements io/fs.FileInfo;
+// Sys returns the underlying *Metadata.
+type FileInfo struct {
+	name string
+	meta *Metadata
+}
+
+// NewFileInfo returns the FileInfo of an entry with the given base name.
+func NewFileInfo(name string, meta *Metadata) *FileInfo {
+	return &FileInfo{name: name, meta: meta}
+}
+
+func (fi *FileInfo) Name() string       { return fi.name }
+func (fi *FileInfo) Size() int64        { return fi.meta.Size }
+func (fi *FileInfo) Mode() os.FileMode  { return fi.meta.FileMode() }
+func (fi *FileInfo) ModTime() time.Time { return time.Unix(fi.meta.MTime, 0) }
+func (fi *FileInfo) IsDir() bool        { return fi.meta.Type == TypeDir }
+func (fi *FileInfo) Sys() any           { return fi.meta }
+
+// abs converts an io/fs name to a volume path.
+func (fsys *VolumeFS) abs(op, name string) (string, error) {
+	if !iofs.ValidPath(name) {
+		return "", fsErr(op, name, ErrInvalid)
+	}
+	if name == "." {
+		return "/", nil
+	}
+	return "/" + name, nil
+}
+
+// resolve returns the volume path and metadata of name, following a final
+// symlink when follow is set.
+func (fsys *VolumeFS) resolve(op, name string, follow bool) (string, *Metadata, error) {
+	p, err := fsys.abs(op, name)
+	if err != nil {
+		return "", nil, err
+	}
+	meta, err := fsys.c.Stat(fsys.ctx, p)
+	if err != nil {
+		return "", nil, fsErr(op, name, err)
+	}
+	if meta != nil && meta.Type == TypeSymlink && follow {
+		if p, err = fsys.c.ResolveSymlink(fsys.ctx, p, 0); err != nil {
+			return "", nil, fsErr(op, name, err)
+		}
+		if meta, err = fsys.c.Stat(fsys.ctx, p); err != nil {
+			return "", nil, fsErr(op, name, err)
+		}
+	}
+	if meta == nil {
+		return "", nil, fsErr(op, name, ErrNotExist)
+	}
+	return p, meta, nil
+}
+
+// Open opens the named file or directory for reading.
+func (fsys *VolumeFS) Open(name string) (iofs.File, error) {
+	p, meta, err := fsys.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Type == TypeDir {
+		return &dirFile{fsys: fsys, path: p, info: NewFileInfo(path.Base(name), meta)}, nil
+	}
+	f, err := fsys.c.OpenFile(fsys.ctx, p, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, fsErr("open", name, err)
+	}
+	f.name = name
+	return f, nil
+}
+
+// Stat returns the FileInfo of the named file, following symlinks.
+func (fsys *VolumeFS) Stat(name string) (iofs.FileInfo, error) {
+	_, meta, err := fsys.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return NewFileInfo(path.Base(name), meta), nil
+}
+
+// Lstat returns the FileInfo of the named file without following symlinks.
+func (fsys *VolumeFS) Lstat(name string) (iofs.FileInfo, error) {
+	_, meta, err := fsys.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return NewFileInfo(path.Base(name), meta), nil
+}
+
+// ReadLink returns the target of the named symlink.
+func (fsys *VolumeFS) ReadLink(name string) (string, error) {
+	_, meta, err := fsys.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if meta.Type != TypeSymlink {
+		return "", fsErr("readlink", name, ErrInvalid)
+	}
+	return meta.LinkTarget, nil
+}
+
+// ReadDir returns the entries of the named directory sorted by name.
+func (fsys *VolumeFS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	_, meta, err := fsys.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Type != TypeDir {
+		return nil, fsErr("readdir", name, ErrNotDir)
+	}
+	entries, err := fsys.readDir(meta)
+	if err != nil {
+		return nil, fsErr("readdir", name, err)
+	}
+	return entries, nil
+}
+
+func (fsys *VolumeFS) readDir(meta *Metadata) ([]iofs.DirEntry, error) {
+	if !fsys.c.id.Can(meta, AccessRead) {
+		return nil, ErrPermission
+	}
+	children, err := fsys.c.readDirIno(fsys.ctx, meta.Ino)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]iofs.DirEntry, 0, len(children))
+	for _, child := range children {
+		if child.Meta == nil {
+			continue
+		}
+		entries = append(entries, iofs.FileInfoToDirEntry(NewFileInfo(child.Name, child.Meta)))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// ReadFile returns the content of the named file.
+func (fsys *VolumeFS) ReadFile(name string) ([]byte, error) {
+	_, meta, err := fsys.resolve("read", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Type == TypeDir {
+		return nil, fsErr("read", name, ErrIsDir)
+	}
+	if !fsys.c.id.Can(meta, AccessRead) {
+		return nil, fsErr("read", name, ErrPermission)
+	}
+	data, err := fsys.c.readContent(fsys.ctx, meta)
+	if err != nil {
+		return nil, fsErr("read", name, err)
+	}
+	fsys.c.touchAtime(fsys.ctx, meta)
+	return []byte(data), nil
+}
+
+// Glob returns the names matching pattern, using io/fs.Glob's ReadDir-based
+// walk (through a wrapper that hides this method to avoid recursion).
+func (fsys *VolumeFS) Glob(pattern string) ([]string, error) {
+	return iofs.Glob(globFS{fsys}, pattern)
+}
+
+type globFS struct{ fsys *VolumeFS }
+
+func (g globFS) Open(name string) (iofs.File, error)          { return g.fsys.Open(name) }
+func (g globFS) Stat(name string) (iofs.FileInfo, error)      { return g.fsys.Stat(name) }
+func (g globFS) ReadDir(name string) ([]iofs.DirEntry, error) { return g.fsys.ReadDir(name) }
+
+// fsErr returns an io/fs PathError for name. A Client *PathError is
+// unwrapped first, since its path is a volume path rather than name.
+func fsErr(op, name string, err error) error {
+	var pe *PathError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	return &iofs.PathError{Op: op, Path: name, Err: err}
+}
+
+// dirFile is an open directory. It implements io/fs.ReadDirFile.
+type dirFile struct {
+	fsys    *VolumeFS
+	path    string
+	info    *FileInfo
+	entries []iofs.DirEntry
+	loaded  bool
+	closed  bool
+}
+
+func (d *dirFile) Stat() (iofs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, fsErr("read", d.path, ErrIsDir)
+}
+
+func (d *dirFile) Close() error {
+	if d.closed {
+		return fsErr("close", d.path, iofs.ErrClosed)
+	}
+	d.closed = true
+	return nil
+}
+
+// ReadDir returns the next n entries, or all remaining ones when n <= 0.
+func (d *dirFile) ReadDir(n int) ([]iofs.DirEntry, error) {
+	if d.closed {
+		return nil, fsErr("readdir", d.path, iofs.ErrClosed)
+	}
+	if !d.loaded {
+		entries, err := d.fsys.readDir(d.info.meta)
+		if err != nil {
+			return nil, fsErr("readdir", d.path, err)
+		}
+		d.entries, d.loaded = entries, true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
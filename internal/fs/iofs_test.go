@@ -0,0 +1,62 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	iofs "io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestVolumeFS(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.SetChunkSize(16)
+	c.Mkdir(ctx, "/dir/sub", true)
+	c.Mkdir(ctx, "/empty", false)
+	c.WriteFile(ctx, "/dir/a.txt", "a")
+	c.WriteFile(ctx, "/dir/sub/b.txt", strings.Repeat("b", 100))
+	c.Symlink(ctx, "/dir/a.txt", "/link")
+
+	fsys := NewVolumeFS(ctx, c)
+	if err := fstest.TestFS(fsys, "dir/a.txt", "dir/sub/b.txt", "empty", "link"); err != nil {
+		t.Fatal(err)
+	}
+	// The same checks below the root, through fs.Sub
+	sub, err := iofs.Sub(fsys, "dir")
+	if err != nil {
+		t.Fatalf("Sub: %v", err)
+	}
+	if err := fstest.TestFS(sub, "a.txt", "sub/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVolumeFSErrors(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.WriteFile(ctx, "/f", "x")
+	c.Symlink(ctx, "f", "/l")
+	fsys := NewVolumeFS(ctx, c)
+
+	if _, err := fsys.Open("/f"); !errors.Is(err, iofs.ErrInvalid) {
+		t.Errorf("Open(/f) = %v, want ErrInvalid", err)
+	}
+	if _, err := fsys.Open("missing"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Errorf("Open(missing) = %v, want ErrNotExist", err)
+	}
+	var pe *iofs.PathError
+	if _, err := fsys.Stat("missing"); !errors.As(err, &pe) || pe.Path != "missing" {
+		t.Errorf("Stat(missing) = %v, want a PathError on the io/fs name", err)
+	}
+	if target, err := fsys.ReadLink("l"); err != nil || target != "f" {
+		t.Errorf("ReadLink(l) = %q, %v", target, err)
+	}
+	if _, err := fsys.ReadLink("f"); !errors.Is(err, iofs.ErrInvalid) {
+		t.Errorf("ReadLink(f) = %v, want ErrInvalid", err)
+	}
+	if info, err := fsys.Lstat("l"); err != nil || info.Mode()&iofs.ModeSymlink == 0 {
+		t.Errorf("Lstat(l) = %v, %v, want a symlink", info, err)
+	}
+}
@@ -1,10 +1,23 @@
 package fs
 
-import "fmt"
+import (
+	"strconv"
+	"strings"
+)
+
+// RootInode is the inode id of every volume's root directory.
+const RootInode = "0"
+
+// LayoutVersion is the on-disk key layout written by this client.
+// Version 1 keyed every entry by its path; version 2 keys entries by inode id.
+const LayoutVersion = 2
 
 // KeyGen generates Redis key names for a given volume.
 type KeyGen struct {
 	Volume string
+	// HashTag wraps the volume name in a cluster hash tag (fs:{main}:...),
+	// so all keys of a volume hash to the same slot.
+	HashTag bool
 }
 
 // NewKeyGen creates a KeyGen for the given volume.
@@ -12,49 +25,216 @@ func NewKeyGen(volume string) *KeyGen {
 	return &KeyGen{Volume: volume}
 }
 
-// Meta returns the metadata key for a path.
-// e.g., fs:main:meta:/configs/prod
-func (k *KeyGen) Meta(path string) string {
-	return fmt.Sprintf("fs:%s:meta:%s", k.Volume, path)
+// volume returns the key generator of another volume, with the same hash
+// tag setting.
+func (k *KeyGen) volume(name string) *KeyGen {
+	return &KeyGen{Volume: name, HashTag: k.HashTag}
+}
+
+// Prefix returns the key prefix shared by all keys of the volume.
+// e.g., fs:main: or fs:{main}:
+func (k *KeyGen) Prefix() string {
+	if k.HashTag {
+		return "fs:{" + k.Volume + "}:"
+	}
+	return "fs:" + k.Volume + ":"
+}
+
+// pattern returns a SCAN pattern matching the keys of the volume whose
+// name after the prefix matches glob, e.g. fs:main:meta:* for meta:*. The
+// prefix is escaped, so it matches literally whatever the volume name.
+func (k *KeyGen) pattern(glob string) string {
+	var b strings.Builder
+	for _, r := range k.Prefix() {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String() + glob
+}
+
+// owns reports whether key, starting with the volume's prefix, is a key of
+// the volume rather than of one whose name extends it past a colon, as
+// fs:a:b:meta:1 of volume a:b does for volume a. Volume names can no longer
+// contain colons, but older volumes may.
+func (k *KeyGen) owns(key string) bool {
+	rest, ok := strings.CutPrefix(key, k.Prefix())
+	if !ok {
+		return false
+	}
+	family, id, _ := strings.Cut(rest, ":")
+	switch family {
+	case "super", "ino", "versioning", "snapshots", "clones", "shared", "events":
+		return rest == family
+	case "meta", "data", "dir", "xattr":
+		// By inode, or by path in the legacy layout
+		return isInode(id) || strings.HasPrefix(id, "/")
+	case "chunk":
+		ino, n, _ := strings.Cut(id, ":")
+		// Or <ino>:<gen>:<n> once an overwrite replaced the chunks
+		if gen, rest, ok := strings.Cut(n, ":"); ok {
+			if gen == "" {
+				return false
+			}
+			n = rest
+		}
+		return isInode(ino) && isInode(n)
+	case "hist", "rev":
+		return strings.HasPrefix(id, "/")
+	case "idx":
+		return strings.HasPrefix(id, "/") || id == "__schema_ver__"
+	}
+	return false
+}
+
+// isInode reports whether id is an inode id, or a chunk number.
+func isInode(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Meta returns the metadata key for an inode.
+// e.g., fs:main:meta:42
+func (k *KeyGen) Meta(ino string) string {
+	return k.Prefix() + "meta:" + ino
+}
+
+// Data returns the data key for an inode.
+// e.g., fs:main:data:42
+func (k *KeyGen) Data(ino string) string {
+	return k.Prefix() + "data:" + ino
+}
+
+// Chunk returns the key of the n-th content chunk of a chunked file.
+// e.g., fs:main:chunk:42:0
+func (k *KeyGen) Chunk(ino string, n int64) string {
+	return k.Prefix() + "chunk:" + ino + ":" + strconv.FormatInt(n, 10)
+}
+
+// Dir returns the directory hash key for an inode, mapping child names to inode ids.
+// e.g., fs:main:dir:7
+func (k *KeyGen) Dir(ino string) string {
+	return k.Prefix() + "dir:" + ino
 }
 
-// Data returns the data key for a path.
-// e.g., fs:main:data:/configs/prod/app.conf
-func (k *KeyGen) Data(path string) string {
-	return fmt.Sprintf("fs:%s:data:%s", k.Volume, path)
+// Xattr returns the extended attributes key for an inode.
+// e.g., fs:main:xattr:42
+func (k *KeyGen) Xattr(ino string) string {
+	return k.Prefix() + "xattr:" + ino
 }
 
-// Dir returns the directory set key for a path.
-// e.g., fs:main:dir:/configs/prod
-func (k *KeyGen) Dir(path string) string {
-	return fmt.Sprintf("fs:%s:dir:%s", k.Volume, path)
+// Versioning returns the hash of versioning policies, keyed by directory.
+// e.g., fs:main:versioning
+func (k *KeyGen) Versioning() string {
+	return k.Prefix() + "versioning"
 }
 
-// Xattr returns the extended attributes key for a path.
-// e.g., fs:main:xattr:/configs/prod/app.conf
-func (k *KeyGen) Xattr(path string) string {
-	return fmt.Sprintf("fs:%s:xattr:%s", k.Volume, path)
+// History returns the hash listing the recorded revisions of a file by
+// number. Like index keys, history is keyed by path, so it outlives the file.
+// e.g., fs:main:hist:/docs/a.txt
+func (k *KeyGen) History(path string) string {
+	return k.Prefix() + "hist:" + path
+}
+
+// Revision returns the key holding the content of a revision of a file.
+// e.g., fs:main:rev:/docs/a.txt:3
+func (k *KeyGen) Revision(path string, rev int64) string {
+	return k.Prefix() + "rev:" + path + ":" + strconv.FormatInt(rev, 10)
+}
+
+// Super returns the volume superblock key (layout version, creation time).
+// e.g., fs:main:super
+func (k *KeyGen) Super() string {
+	return k.Prefix() + "super"
+}
+
+// Snapshots returns the hash of the volume's snapshots, mapping each name
+// to its creation time in nanoseconds.
+// e.g., fs:main:snapshots
+func (k *KeyGen) Snapshots() string {
+	return k.Prefix() + "snapshots"
+}
+
+// Clones returns the hash of the volumes cloned from this one, mapping
+// each name to its creation time.
+// e.g., fs:main:clones
+func (k *KeyGen) Clones() string {
+	return k.Prefix() + "clones"
+}
+
+// Shared returns the hash of the inodes of a cloned volume whose content
+// is still read from the volume it was cloned from.
+// e.g., fs:staging:shared
+func (k *KeyGen) Shared() string {
+	return k.Prefix() + "shared"
+}
+
+// Events returns the stream of the volume's change feed.
+// e.g., fs:main:events
+func (k *KeyGen) Events() string {
+	return k.Prefix() + "events"
+}
+
+// InodeCounter returns the key used to allocate inode ids.
+// e.g., fs:main:ino
+func (k *KeyGen) InodeCounter() string {
+	return k.Prefix() + "ino"
 }
 
 // Idx returns the index key for a path.
 // e.g., fs:main:idx:/configs/prod/app.conf
 func (k *KeyGen) Idx(path string) string {
-	return fmt.Sprintf("fs:%s:idx:%s", k.Volume, path)
+	return k.Prefix() + "idx:" + path
 }
 
 // IdxPrefix returns the prefix for all index keys in this volume.
 // e.g., fs:main:idx:
 func (k *KeyGen) IdxPrefix() string {
-	return fmt.Sprintf("fs:%s:idx:", k.Volume)
+	return k.Prefix() + "idx:"
 }
 
 // IdxSchemaVersion returns the key storing the index schema version.
 func (k *KeyGen) IdxSchemaVersion() string {
-	return fmt.Sprintf("fs:%s:idx:__schema_ver__", k.Volume)
+	return k.Prefix() + "idx:__schema_ver__"
 }
 
 // VolumeRootPattern returns a SCAN pattern to discover all volumes.
-// Matches fs:*:meta:/ to find volume root metadata keys.
+// Matches fs:*:super to find volume superblocks, with or without hash tags.
 func VolumeRootPattern() string {
+	return "fs:*:super"
+}
+
+// LegacyVolumeRootPattern returns a SCAN pattern matching the root metadata
+// keys of volumes still using the path-keyed (version 1) layout.
+func LegacyVolumeRootPattern() string {
 	return "fs:*:meta:/"
 }
+
+// VolumeFromKey extracts the volume name from a key such as fs:main:super
+// or fs:{main}:super. Returns "" if the key is not a volume key.
+func VolumeFromKey(key string) string {
+	rest, ok := strings.CutPrefix(key, "fs:")
+	if !ok {
+		return ""
+	}
+	if strings.HasPrefix(rest, "{") {
+		end := strings.Index(rest, "}:")
+		if end < 0 {
+			return ""
+		}
+		return rest[1:end]
+	}
+	vol, _, ok := strings.Cut(rest, ":")
+	if !ok {
+		return ""
+	}
+	return vol
+}
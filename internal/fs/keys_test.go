@@ -0,0 +1,77 @@
+package fs
+
+import "testing"
+
+func TestKeyGenHashTag(t *testing.T) {
+	plain := NewKeyGen("main")
+	tagged := &KeyGen{Volume: "main", HashTag: true}
+
+	tests := []struct {
+		got, want string
+	}{
+		{plain.Meta("42"), "fs:main:meta:42"},
+		{tagged.Meta("42"), "fs:{main}:meta:42"},
+		{tagged.Dir(RootInode), "fs:{main}:dir:0"},
+		{tagged.Super(), "fs:{main}:super"},
+		{tagged.IdxPrefix(), "fs:{main}:idx:"},
+		{tagged.Idx("/a.txt"), "fs:{main}:idx:/a.txt"},
+		{tagged.Events(), "fs:{main}:events"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %q, want %q", tt.got, tt.want)
+		}
+	}
+}
+
+func TestVolumeFromKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"fs:main:super", "main"},
+		{"fs:{main}:super", "main"},
+		{"fs:work:meta:/", "work"},
+		{"fs:{a:b}:super", "a:b"},
+		{"fs:{broken:super", ""},
+		{"other:main:super", ""},
+		{"fs:", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := VolumeFromKey(tt.key); got != tt.want {
+				t.Errorf("VolumeFromKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyGenOwns(t *testing.T) {
+	k := NewKeyGen("a")
+	if got := NewKeyGen("m*").pattern("meta:*"); got != `fs:m\*:meta:*` {
+		t.Errorf("pattern = %q", got)
+	}
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"fs:a:super", true},
+		{"fs:a:meta:42", true},
+		{"fs:a:chunk:42:3", true},
+		{"fs:a:chunk:42:lq3x9:3", true},
+		{"fs:a:chunk:42::3", false},
+		{"fs:a:meta:/docs", true},
+		{"fs:a:hist:/docs/a.txt", true},
+		{"fs:a:idx:__schema_ver__", true},
+		{"fs:a:b:super", false},
+		{"fs:a:b:meta:42", false},
+		{"fs:a:meta:meta:42", false},
+		{"fs:a:super:x", false},
+		{"fs:ab:super", false},
+	}
+	for _, tt := range tests {
+		if got := k.owns(tt.key); got != tt.want {
+			t.Errorf("owns(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package fs
 
 import (
 	"fmt"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,6 +19,7 @@ const (
 
 // Metadata holds the filesystem metadata for an entry.
 type Metadata struct {
+	Ino        string // inode id; derived from the key, not stored in the hash
 	Type       EntryType
 	Mode       string
 	UID        string
@@ -26,6 +29,11 @@ type Metadata struct {
 	MTime      int64 // modification time
 	ATime      int64 // access time
 	LinkTarget string
+	Chunks     int64  // number of content chunks; 0 when stored in a single data key
+	ChunkSize  int64  // size of each chunk (the last may be shorter)
+	ChunkGen   string // generation of the chunk keys; changes when an overwrite replaces them
+	Nlink      int64  // number of directory entries referring to the inode
+	Tags       []string
 }
 
 // NewDirMeta creates metadata for a new directory.
@@ -39,6 +47,7 @@ func NewDirMeta(mode string) *Metadata {
 		Mode:  mode,
 		UID:   "0",
 		GID:   "0",
+		Nlink: 1,
 		CTime: now,
 		MTime: now,
 		ATime: now,
@@ -57,6 +66,7 @@ func NewFileMeta(mode string, size int64) *Metadata {
 		UID:   "0",
 		GID:   "0",
 		Size:  size,
+		Nlink: 1,
 		CTime: now,
 		MTime: now,
 		ATime: now,
@@ -71,6 +81,7 @@ func NewSymlinkMeta(target string) *Metadata {
 		Mode:       "0777",
 		UID:        "0",
 		GID:        "0",
+		Nlink:      1,
 		CTime:      now,
 		MTime:      now,
 		ATime:      now,
@@ -79,8 +90,8 @@ func NewSymlinkMeta(target string) *Metadata {
 }
 
 // ToMap converts metadata to a map for HSET.
-func (m *Metadata) ToMap() map[string]interface{} {
-	result := map[string]interface{}{
+func (m *Metadata) ToMap() map[string]string {
+	result := map[string]string{
 		"type":  string(m.Type),
 		"mode":  m.Mode,
 		"uid":   m.UID,
@@ -93,6 +104,20 @@ func (m *Metadata) ToMap() map[string]interface{} {
 	if m.LinkTarget != "" {
 		result["link_target"] = m.LinkTarget
 	}
+	if m.Chunks > 0 {
+		result["chunks"] = strconv.FormatInt(m.Chunks, 10)
+		result["chunk_size"] = strconv.FormatInt(m.ChunkSize, 10)
+		if m.ChunkGen != "" {
+			result["chunk_gen"] = m.ChunkGen
+		}
+	}
+	// A single link is the default and is not stored
+	if m.Nlink > 1 {
+		result["nlink"] = strconv.FormatInt(m.Nlink, 10)
+	}
+	if len(m.Tags) > 0 {
+		result["tags"] = strings.Join(m.Tags, ",")
+	}
 	return result
 }
 
@@ -105,6 +130,16 @@ func MetaFromMap(m map[string]string) *Metadata {
 	ctime, _ := strconv.ParseInt(m["ctime"], 10, 64)
 	mtime, _ := strconv.ParseInt(m["mtime"], 10, 64)
 	atime, _ := strconv.ParseInt(m["atime"], 10, 64)
+	chunks, _ := strconv.ParseInt(m["chunks"], 10, 64)
+	chunkSize, _ := strconv.ParseInt(m["chunk_size"], 10, 64)
+	nlink, _ := strconv.ParseInt(m["nlink"], 10, 64)
+	if nlink < 1 {
+		nlink = 1
+	}
+	var tags []string
+	if m["tags"] != "" {
+		tags = strings.Split(m["tags"], ",")
+	}
 
 	return &Metadata{
 		Type:       EntryType(m["type"]),
@@ -116,6 +151,11 @@ func MetaFromMap(m map[string]string) *Metadata {
 		MTime:      mtime,
 		ATime:      atime,
 		LinkTarget: m["link_target"],
+		Chunks:     chunks,
+		ChunkSize:  chunkSize,
+		ChunkGen:   m["chunk_gen"],
+		Nlink:      nlink,
+		Tags:       tags,
 	}
 }
 
@@ -132,6 +172,28 @@ func FormatSize(size int64) string {
 	return fmt.Sprintf("%d", size)
 }
 
+// FileMode maps the entry type and octal mode string to os.FileMode bits.
+func (m *Metadata) FileMode() os.FileMode {
+	bits, _ := strconv.ParseUint(m.Mode, 8, 32)
+	mode := os.FileMode(bits) & os.ModePerm
+	if bits&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	switch m.Type {
+	case TypeDir:
+		mode |= os.ModeDir
+	case TypeSymlink:
+		mode |= os.ModeSymlink
+	}
+	return mode
+}
+
 // ModeString returns a POSIX-style mode string like "drwxr-xr-x".
 func (m *Metadata) ModeString() string {
 	var prefix byte
@@ -0,0 +1,31 @@
+package fs
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFileMode(t *testing.T) {
+	tests := []struct {
+		typ  EntryType
+		mode string
+		want os.FileMode
+	}{
+		{TypeFile, "0644", 0644},
+		{TypeDir, "0755", os.ModeDir | 0755},
+		{TypeSymlink, "0777", os.ModeSymlink | 0777},
+		{TypeFile, "4755", os.ModeSetuid | 0755},
+		{TypeDir, "1777", os.ModeDir | os.ModeSticky | 0777},
+		{TypeFile, "2750", os.ModeSetgid | 0750},
+		{TypeFile, "bogus", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.typ)+"/"+tt.mode, func(t *testing.T) {
+			m := &Metadata{Type: tt.typ, Mode: tt.mode}
+			if got := m.FileMode(); got != tt.want {
+				t.Errorf("FileMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
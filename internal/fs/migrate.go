@@ -0,0 +1,139 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Legacy (layout version 1) keys address every entry by its full path,
+// e.g. fs:main:meta:/configs/prod, and directory sets hold child names.
+// They predate the hash tag layout and are only read during migration.
+
+func (k *KeyGen) legacyMeta(path string) string {
+	return fmt.Sprintf("fs:%s:meta:%s", k.Volume, path)
+}
+
+func (k *KeyGen) legacyData(path string) string {
+	return fmt.Sprintf("fs:%s:data:%s", k.Volume, path)
+}
+
+func (k *KeyGen) legacyDir(path string) string {
+	return fmt.Sprintf("fs:%s:dir:%s", k.Volume, path)
+}
+
+func (k *KeyGen) legacyXattr(path string) string {
+	return fmt.Sprintf("fs:%s:xattr:%s", k.Volume, path)
+}
+
+// legacyFamilies are the per-path key families of the version 1 layout.
+var legacyFamilies = []string{"meta", "data", "dir", "xattr"}
+
+// migrateLegacy converts a path-keyed volume to the inode layout.
+//
+// New keys are written first, then the superblock is stamped with the new
+// layout version, and only then are the legacy keys deleted. Legacy keys
+// always contain a '/' right after the family prefix, so they never collide
+// with inode keys and a cleanup interrupted halfway is finished on the next run.
+func (c *Client) migrateLegacy(ctx context.Context) error {
+	layout, err := c.store.HGet(ctx, c.keys.Super(), "layout")
+	if err != nil {
+		return err
+	}
+
+	legacyRoot, err := c.store.Exists(ctx, c.keys.legacyMeta("/"))
+	if err != nil {
+		return err
+	}
+	if legacyRoot == 0 {
+		return nil
+	}
+
+	if layout == "" {
+		if _, err := c.migrateEntry(ctx, "/"); err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+		err := c.store.HSet(ctx, c.keys.Super(), map[string]string{"layout": strconv.Itoa(LayoutVersion)})
+		if err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+	}
+
+	return c.deleteLegacyKeys(ctx)
+}
+
+// migrateEntry copies the legacy entry at path (and its descendants) into
+// freshly allocated inodes, returning the inode id assigned to path.
+func (c *Client) migrateEntry(ctx context.Context, path string) (string, error) {
+	m, err := c.store.HGetAll(ctx, c.keys.legacyMeta(path))
+	if err != nil {
+		return "", err
+	}
+	if len(m) == 0 {
+		return "", nil
+	}
+
+	ino := RootInode
+	if path != "/" {
+		if ino, err = c.allocInode(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	// Children are migrated first; this entry's keys are then written in one
+	// transaction
+	entries := map[string]string{}
+	data := ""
+	switch EntryType(m["type"]) {
+	case TypeDir:
+		children, err := c.store.SMembers(ctx, c.keys.legacyDir(path))
+		if err != nil {
+			return "", err
+		}
+		for _, child := range children {
+			childIno, err := c.migrateEntry(ctx, JoinPath(path, child))
+			if err != nil {
+				return "", err
+			}
+			if childIno != "" {
+				entries[child] = childIno
+			}
+		}
+	case TypeFile:
+		if data, err = c.store.Get(ctx, c.keys.legacyData(path)); err != nil {
+			return "", err
+		}
+	}
+
+	xattrs, err := c.store.HGetAll(ctx, c.keys.legacyXattr(path))
+	if err != nil {
+		return "", err
+	}
+
+	err = c.store.Tx(ctx, func(tx Writer) {
+		tx.HSet(c.keys.Meta(ino), m)
+		tx.HSet(c.keys.Dir(ino), entries)
+		if EntryType(m["type"]) == TypeFile {
+			tx.Set(c.keys.Data(ino), data)
+		}
+		tx.HSet(c.keys.Xattr(ino), xattrs)
+	})
+	if err != nil {
+		return "", err
+	}
+	return ino, nil
+}
+
+// deleteLegacyKeys removes every version 1 key of the volume.
+func (c *Client) deleteLegacyKeys(ctx context.Context) error {
+	for _, family := range legacyFamilies {
+		pattern := fmt.Sprintf("fs:%s:%s:/*", c.keys.Volume, family)
+		err := c.store.Scan(ctx, pattern, func(keys []string) error {
+			return c.store.Del(ctx, keys...)
+		})
+		if err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+	}
+	return nil
+}
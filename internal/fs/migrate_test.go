@@ -0,0 +1,116 @@
+package fs
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+)
+
+// seedLegacy writes a path-keyed (layout version 1) volume named test:
+//
+//	/docs/readme     "hello" with xattr user.k=v, mode 0640, uid 7
+//	/docs/sub/deep   "deep"
+//	/docs/link       symlink to readme
+//	/empty/
+func seedLegacy(m *MemoryBackend) {
+	k := NewKeyGen("test")
+	dir := func(path string, children ...string) {
+		m.hashes[k.legacyMeta(path)] = NewDirMeta("0755").ToMap()
+		m.sets[k.legacyDir(path)] = children
+	}
+	file := func(path, content string) *Metadata {
+		meta := NewFileMeta("0644", int64(len(content)))
+		m.hashes[k.legacyMeta(path)] = meta.ToMap()
+		m.strings[k.legacyData(path)] = content
+		return meta
+	}
+
+	dir("/", "docs", "empty")
+	dir("/docs", "readme", "sub", "link")
+	dir("/docs/sub", "deep")
+	dir("/empty")
+	readme := file("/docs/readme", "hello")
+	readme.Mode, readme.UID = "0640", "7"
+	m.hashes[k.legacyMeta("/docs/readme")] = readme.ToMap()
+	m.hashes[k.legacyXattr("/docs/readme")] = map[string]string{"user.k": "v"}
+	file("/docs/sub/deep", "deep")
+	m.hashes[k.legacyMeta("/docs/link")] = NewSymlinkMeta("readme").ToMap()
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBackend()
+	seedLegacy(b)
+	c := NewClientWithBackend(b, "test")
+	if exists, _ := c.VolumeExists(ctx); !exists {
+		t.Fatal("legacy volume not found")
+	}
+	if err := c.Init(ctx); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	var legacy []string
+	for _, family := range legacyFamilies {
+		b.Scan(ctx, "fs:test:"+family+":/*", func(keys []string) error {
+			legacy = append(legacy, keys...)
+			return nil
+		})
+	}
+	if len(legacy) > 0 {
+		t.Errorf("legacy keys left: %v", legacy)
+	}
+	if layout, _ := b.HGet(ctx, c.keys.Super(), "layout"); layout != "2" {
+		t.Errorf("layout = %q, want 2", layout)
+	}
+
+	// A second Init finds nothing to migrate and changes nothing
+	strs, hashes := maps.Clone(b.strings), make(map[string]map[string]string)
+	for k, h := range b.hashes {
+		hashes[k] = maps.Clone(h)
+	}
+	if err := c.Init(ctx); err != nil {
+		t.Fatalf("second Init: %v", err)
+	}
+	if !maps.Equal(strs, b.strings) || !maps.EqualFunc(hashes, b.hashes, maps.Equal) {
+		t.Error("second Init changed the volume")
+	}
+
+	for path, want := range map[string][]string{
+		"/":         {"docs", "empty"},
+		"/docs":     {"link", "readme", "sub"},
+		"/docs/sub": {"deep"},
+		"/empty":    nil,
+	} {
+		names, err := c.ReadDir(ctx, path)
+		slices.Sort(names)
+		if err != nil || !slices.Equal(names, want) {
+			t.Errorf("ReadDir(%s) = %v, %v, want %v", path, names, err, want)
+		}
+	}
+	for path, want := range map[string]string{"/docs/readme": "hello", "/docs/sub/deep": "deep", "/docs/link": "hello"} {
+		if got, err := c.ReadFile(ctx, path); err != nil || got != want {
+			t.Errorf("ReadFile(%s) = %q, %v, want %q", path, got, err, want)
+		}
+	}
+	if target, _ := c.Readlink(ctx, "/docs/link"); target != "readme" {
+		t.Errorf("Readlink = %q, want readme", target)
+	}
+	if v, _ := c.GetXattr(ctx, "/docs/readme", "user.k"); v != "v" {
+		t.Errorf("xattr user.k = %q, want v", v)
+	}
+	if meta := mustStat(t, c, "/docs/readme"); meta.Mode != "0640" || meta.UID != "7" || meta.Size != 5 {
+		t.Errorf("readme meta = %+v", meta)
+	}
+	if meta := mustStat(t, c, "/"); meta.Ino != RootInode {
+		t.Errorf("root inode = %s, want %s", meta.Ino, RootInode)
+	}
+
+	// New entries get inodes past the migrated ones
+	if err := c.WriteFile(ctx, "/new", "x"); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if got, _ := c.ReadFile(ctx, "/docs/sub/deep"); got != "deep" {
+		t.Errorf("deep after write = %q", got)
+	}
+}
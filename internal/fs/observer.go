@@ -4,8 +4,85 @@ import "context"
 
 // FileObserver receives notifications when files are mutated.
 // Implementations can use this to maintain search indexes, caches, etc.
+// Paths are absolute, with the final element not resolved. Moving a
+// directory reports the directory, then every file that moved with it;
+// removing one recursively reports each entry as it goes. Embed
+// NopObserver to implement only some of the methods.
 type FileObserver interface {
 	OnFileWrite(ctx context.Context, path, content string) error
 	OnFileRemove(ctx context.Context, path string) error
 	OnFileMove(ctx context.Context, oldPath, newPath string) error
+	// OnChunkedWrite reports a write to a file stored in chunks, whose
+	// content is too large to pass along.
+	OnChunkedWrite(ctx context.Context, path string, size int64) error
+	OnMkdir(ctx context.Context, path string) error
+	OnRmdir(ctx context.Context, path string) error
+	OnSymlink(ctx context.Context, path, target string) error
+	// OnLink reports newPath created as a hard link to the file at
+	// oldPath; both now share content.
+	OnLink(ctx context.Context, oldPath, newPath string) error
+	// OnChmod and OnChown get the mode, or the owner, after the change.
+	OnChmod(ctx context.Context, path, mode string) error
+	OnChown(ctx context.Context, path, uid, gid string) error
+}
+
+// TagObserver is implemented by observers that also track tags. tags is
+// the full, sorted set of tags of path after the change.
+type TagObserver interface {
+	OnTagsChange(ctx context.Context, path string, tags []string) error
+}
+
+// VolumeObserver is implemented by observers that keep per-volume state.
+// The client tells them when it switches volumes.
+type VolumeObserver interface {
+	SetVolume(volume string)
+}
+
+// IdentityObserver is implemented by observers that record who made a
+// change. The client tells them which user it acts as.
+type IdentityObserver interface {
+	SetIdentity(id Identity)
+}
+
+// NopObserver is a FileObserver that ignores every notification.
+type NopObserver struct{}
+
+func (NopObserver) OnFileWrite(ctx context.Context, path, content string) error {
+	return nil
+}
+
+func (NopObserver) OnFileRemove(ctx context.Context, path string) error {
+	return nil
+}
+
+func (NopObserver) OnFileMove(ctx context.Context, oldPath, newPath string) error {
+	return nil
+}
+
+func (NopObserver) OnChunkedWrite(ctx context.Context, path string, size int64) error {
+	return nil
+}
+
+func (NopObserver) OnMkdir(ctx context.Context, path string) error {
+	return nil
+}
+
+func (NopObserver) OnRmdir(ctx context.Context, path string) error {
+	return nil
+}
+
+func (NopObserver) OnSymlink(ctx context.Context, path, target string) error {
+	return nil
+}
+
+func (NopObserver) OnLink(ctx context.Context, oldPath, newPath string) error {
+	return nil
+}
+
+func (NopObserver) OnChmod(ctx context.Context, path, mode string) error {
+	return nil
+}
+
+func (NopObserver) OnChown(ctx context.Context, path, uid, gid string) error {
+	return nil
 }
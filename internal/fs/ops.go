@@ -0,0 +1,201 @@
+package fs
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Entry mutation primitives. Callers resolve inodes and check preconditions
+// first so they can report precise errors; each primitive then applies the
+// change either through the server-side functions library, which re-checks
+// everything atomically, or through a MULTI pipeline on older servers.
+
+// link creates the entry name -> ino in directory parentIno with the given
+// metadata. When data is non-nil, it is stored as the file content.
+func (c *Client) link(ctx context.Context, parentIno, name, ino string, meta *Metadata, data *string) error {
+	if c.functions {
+		keys := []string{c.keys.Meta(parentIno), c.keys.Dir(parentIno), c.keys.Meta(ino)}
+		content := ""
+		if data != nil {
+			keys = append(keys, c.keys.Data(ino))
+			content = *data
+		}
+		args := []interface{}{name, ino, content}
+		for k, v := range meta.ToMap() {
+			args = append(args, k, v)
+		}
+		_, err := c.fcall(ctx, "fs_link", keys, args...)
+		return err
+	}
+
+	return c.store.Tx(ctx, func(tx Writer) {
+		if data != nil {
+			tx.Set(c.keys.Data(ino), *data)
+		}
+		tx.HSet(c.keys.Meta(ino), meta.ToMap())
+		tx.HSet(c.keys.Dir(parentIno), map[string]string{name: ino})
+	})
+}
+
+// hardlink adds the entry name -> meta.Ino in directory parentIno and
+// raises the inode's link count.
+func (c *Client) hardlink(ctx context.Context, parentIno, name string, meta *Metadata) error {
+	if c.functions {
+		keys := []string{c.keys.Meta(parentIno), c.keys.Dir(parentIno), c.keys.Meta(meta.Ino)}
+		_, err := c.fcall(ctx, "fs_hardlink", keys, name, meta.Ino)
+		return err
+	}
+
+	return c.store.Tx(ctx, func(tx Writer) {
+		tx.HSet(c.keys.Meta(meta.Ino), map[string]string{"nlink": strconv.FormatInt(meta.Nlink+1, 10)})
+		tx.HSet(c.keys.Dir(parentIno), map[string]string{name: meta.Ino})
+	})
+}
+
+// writeData replaces (or, with appendMode, extends) the content of the file
+// entry name -> ino in parentIno, updating size and mtime. Returns the new size.
+func (c *Client) writeData(ctx context.Context, parentIno, name, ino, content string, appendMode bool) (int64, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	if c.functions {
+		mode := "set"
+		if appendMode {
+			mode = "append"
+		}
+		keys := []string{c.keys.Dir(parentIno), c.keys.Meta(ino), c.keys.Data(ino)}
+		res, err := c.fcall(ctx, "fs_write", keys, name, ino, mode, content, now)
+		if err != nil {
+			return 0, err
+		}
+		size, _ := res.(int64)
+		return size, nil
+	}
+
+	if !appendMode {
+		err := c.store.Tx(ctx, func(tx Writer) {
+			tx.Set(c.keys.Data(ino), content)
+			tx.HSet(c.keys.Meta(ino), map[string]string{"size": strconv.Itoa(len(content)), "mtime": now})
+		})
+		return int64(len(content)), err
+	}
+
+	size, err := c.store.Append(ctx, c.keys.Data(ino), content)
+	if err != nil {
+		return 0, err
+	}
+	err = c.store.HSet(ctx, c.keys.Meta(ino), map[string]string{"size": strconv.FormatInt(size, 10), "mtime": now})
+	return size, err
+}
+
+// writeRange overwrites content at offset in the file entry name -> ino,
+// zero-filling any gap past the end. Returns the new size.
+func (c *Client) writeRange(ctx context.Context, parentIno, name, ino string, offset int64, content string) (int64, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	if c.functions {
+		keys := []string{c.keys.Dir(parentIno), c.keys.Meta(ino), c.keys.Data(ino)}
+		res, err := c.fcall(ctx, "fs_write", keys, name, ino, "range", content, now, offset)
+		if err != nil {
+			return 0, err
+		}
+		size, _ := res.(int64)
+		return size, nil
+	}
+
+	size, err := c.store.SetRange(ctx, c.keys.Data(ino), offset, content)
+	if err != nil {
+		return 0, err
+	}
+	err = c.store.HSet(ctx, c.keys.Meta(ino), map[string]string{"size": strconv.FormatInt(size, 10), "mtime": now})
+	return size, err
+}
+
+// unlink removes the entry name -> meta.Ino from parentIno together with the
+// inode's keys, unless other links to the inode remain. Directories must be
+// empty.
+func (c *Client) unlink(ctx context.Context, parentIno, name string, meta *Metadata) error {
+	ino := meta.Ino
+	if c.functions {
+		kind := "file"
+		if meta.Type == TypeDir {
+			kind = "dir"
+		}
+		keys := []string{
+			c.keys.Dir(parentIno),
+			c.keys.Meta(ino), c.keys.Data(ino), c.keys.Dir(ino), c.keys.Xattr(ino),
+		}
+		res, err := c.fcall(ctx, "fs_unlink", keys, name, ino, kind)
+		if err != nil || res == int64(0) {
+			return err
+		}
+		return c.dropChunks(ctx, chunkID(ino, meta.ChunkGen), 0, meta.Chunks)
+	}
+
+	if meta.Nlink > 1 {
+		return c.store.Tx(ctx, func(tx Writer) {
+			tx.HSet(c.keys.Meta(ino), map[string]string{"nlink": strconv.FormatInt(meta.Nlink-1, 10)})
+			tx.HDel(c.keys.Dir(parentIno), name)
+		})
+	}
+	err := c.store.Tx(ctx, func(tx Writer) {
+		tx.Del(c.keys.Meta(ino), c.keys.Data(ino), c.keys.Dir(ino), c.keys.Xattr(ino))
+		tx.HDel(c.keys.Dir(parentIno), name)
+	})
+	if err != nil {
+		return err
+	}
+	// Chunks are unreachable once the inode is gone
+	return c.dropChunks(ctx, chunkID(ino, meta.ChunkGen), 0, meta.Chunks)
+}
+
+// rename moves the entry srcName (srcMeta) from srcParentIno to dstName in
+// dstParentIno. dstMeta is the entry being replaced, or nil; it loses a
+// link, and its keys are deleted with the last one.
+func (c *Client) rename(ctx context.Context, srcParentIno, srcName string, srcMeta *Metadata, dstParentIno, dstName string, dstMeta *Metadata) error {
+	if c.functions {
+		keys := []string{
+			c.keys.Dir(srcParentIno),
+			c.keys.Meta(dstParentIno), c.keys.Dir(dstParentIno),
+			c.keys.Meta(srcMeta.Ino),
+		}
+		dstIno := ""
+		if dstMeta != nil {
+			dstIno = dstMeta.Ino
+			keys = append(keys,
+				c.keys.Meta(dstIno), c.keys.Data(dstIno), c.keys.Dir(dstIno), c.keys.Xattr(dstIno))
+		}
+		res, err := c.fcall(ctx, "fs_rename", keys, srcName, srcMeta.Ino, dstName, dstIno)
+		if err != nil || res == int64(0) || dstMeta == nil {
+			return err
+		}
+		return c.dropChunks(ctx, chunkID(dstIno, dstMeta.ChunkGen), 0, dstMeta.Chunks)
+	}
+
+	err := c.store.Tx(ctx, func(tx Writer) {
+		tx.HDel(c.keys.Dir(srcParentIno), srcName)
+		tx.HSet(c.keys.Dir(dstParentIno), map[string]string{dstName: srcMeta.Ino})
+		if dstMeta == nil {
+			return
+		}
+		ino := dstMeta.Ino
+		if dstMeta.Nlink > 1 {
+			tx.HSet(c.keys.Meta(ino), map[string]string{"nlink": strconv.FormatInt(dstMeta.Nlink-1, 10)})
+		} else {
+			tx.Del(c.keys.Meta(ino), c.keys.Data(ino), c.keys.Dir(ino), c.keys.Xattr(ino))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return c.dropReplaced(ctx, dstMeta)
+}
+
+// dropReplaced deletes the chunks of an entry replaced by rename, unless it
+// had other links.
+func (c *Client) dropReplaced(ctx context.Context, dstMeta *Metadata) error {
+	if dstMeta == nil || dstMeta.Nlink > 1 {
+		return nil
+	}
+	return c.dropChunks(ctx, chunkID(dstMeta.Ino, dstMeta.ChunkGen), 0, dstMeta.Chunks)
+}
@@ -0,0 +1,153 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// DefaultUmask is the umask of a new Client, giving directories mode 0755
+// and files 0644.
+const DefaultUmask os.FileMode = 0022
+
+// Access bits for Identity.Can, as in access(2).
+const (
+	AccessExec  = 1
+	AccessWrite = 2
+	AccessRead  = 4
+)
+
+// Identity is the user a Client acts as. Permission checks follow POSIX:
+// uid 0 bypasses them, the owner of an entry is checked against its user
+// bits, members of its group against the group bits, and everyone else
+// against the other bits.
+//
+// Checks are made by the client, so they protect shared volumes from
+// mistakes rather than from hostile users; use Redis ACLs for that.
+type Identity struct {
+	UID int
+	GID int
+}
+
+// Superuser is the root identity, the default for a new Client.
+var Superuser = Identity{}
+
+// String formats the identity like id(1).
+func (id Identity) String() string {
+	return fmt.Sprintf("uid=%d gid=%d", id.UID, id.GID)
+}
+
+// IsRoot reports whether the identity bypasses permission checks.
+func (id Identity) IsRoot() bool {
+	return id.UID == 0
+}
+
+// Can reports whether the identity may access meta with the requested
+// Access bits.
+func (id Identity) Can(meta *Metadata, want int) bool {
+	if id.IsRoot() {
+		return true
+	}
+	perm := int(meta.FileMode().Perm())
+	switch {
+	case meta.UID == strconv.Itoa(id.UID):
+		perm >>= 6
+	case meta.GID == strconv.Itoa(id.GID):
+		perm >>= 3
+	}
+	return perm&want == want
+}
+
+// owns reports whether the identity owns meta or is root.
+func (id Identity) owns(meta *Metadata) bool {
+	return id.IsRoot() || meta.UID == strconv.Itoa(id.UID)
+}
+
+// ParseUmask parses an octal umask such as "022".
+func ParseUmask(s string) (os.FileMode, error) {
+	bits, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || bits > 0777 {
+		return 0, pathErr("umask", s, ErrInvalid)
+	}
+	return os.FileMode(bits), nil
+}
+
+// SetIdentity changes the user the client acts as. Observers that
+// implement IdentityObserver are told.
+func (c *Client) SetIdentity(id Identity) {
+	c.id = id
+	for _, obs := range c.observers {
+		if io, ok := obs.(IdentityObserver); ok {
+			io.SetIdentity(id)
+		}
+	}
+}
+
+// Identity returns the user the client acts as.
+func (c *Client) Identity() Identity {
+	return c.id
+}
+
+// SetUmask sets the permission bits cleared from the mode of new entries.
+func (c *Client) SetUmask(mask os.FileMode) {
+	c.umask = mask & os.ModePerm
+}
+
+// Umask returns the permission bits cleared from the mode of new entries.
+func (c *Client) Umask() os.FileMode {
+	return c.umask
+}
+
+// createMode returns the octal mode string of a new entry requesting perm.
+func (c *Client) createMode(perm os.FileMode) string {
+	return fmt.Sprintf("%04o", perm.Perm()&^c.umask)
+}
+
+// own stamps a new entry with the client's identity.
+func (c *Client) own(meta *Metadata) *Metadata {
+	meta.UID = strconv.Itoa(c.id.UID)
+	meta.GID = strconv.Itoa(c.id.GID)
+	return meta
+}
+
+// access checks the requested access bits against meta.
+func (c *Client) access(op, path string, meta *Metadata, want int) error {
+	if c.id.Can(meta, want) {
+		return nil
+	}
+	return pathErr(op, path, ErrPermission)
+}
+
+// accessIno is access for an inode whose metadata is not yet loaded. It
+// only reads the metadata when the check can fail.
+func (c *Client) accessIno(ctx context.Context, op, path, ino string, want int) error {
+	if c.id.IsRoot() {
+		return nil
+	}
+	meta, err := c.statIno(ctx, ino)
+	if err != nil || meta == nil {
+		return err
+	}
+	return c.access(op, path, meta, want)
+}
+
+// canUnlink checks that meta, at path, may be removed from the directory
+// parentIno: the directory must be writable and searchable and, when its
+// sticky bit is set, owned by the caller or holding an entry they own.
+func (c *Client) canUnlink(ctx context.Context, op, path, parentIno string, meta *Metadata) error {
+	if c.id.IsRoot() {
+		return nil
+	}
+	parent, err := c.statIno(ctx, parentIno)
+	if err != nil || parent == nil {
+		return err
+	}
+	if err := c.access(op, path, parent, AccessWrite|AccessExec); err != nil {
+		return err
+	}
+	if parent.FileMode()&os.ModeSticky != 0 && !c.id.owns(parent) && !c.id.owns(meta) {
+		return pathErr(op, path, ErrPermission)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadAt(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.WriteFile(ctx, "/f", "hello, world")
+	c.Mkdir(ctx, "/d", false)
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, 5, "hello"},
+		{7, -1, "world"},
+		{7, 100, "world"},
+		{3, 0, ""},
+		{12, 5, ""},
+		{40, -1, ""},
+	}
+	for _, tt := range tests {
+		got, err := c.ReadAt(ctx, "/f", tt.offset, tt.length)
+		if err != nil || got != tt.want {
+			t.Errorf("ReadAt(%d, %d) = %q, %v, want %q", tt.offset, tt.length, got, err, tt.want)
+		}
+	}
+
+	if _, err := c.ReadAt(ctx, "/f", -1, 2); !errors.Is(err, ErrInvalid) {
+		t.Errorf("negative offset = %v, want ErrInvalid", err)
+	}
+	if _, err := c.ReadAt(ctx, "/missing", 0, 2); !errors.Is(err, ErrNotExist) {
+		t.Errorf("missing file = %v, want ErrNotExist", err)
+	}
+	if _, err := c.ReadAt(ctx, "/d", 0, 2); !errors.Is(err, ErrIsDir) {
+		t.Errorf("directory = %v, want ErrIsDir", err)
+	}
+}
+
+func TestWriteAt(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.WriteFile(ctx, "/f", "hello, world")
+	c.Mkdir(ctx, "/d", false)
+	before := mustStat(t, c, "/f")
+
+	// Writing inside the file keeps its size
+	if err := c.WriteAt(ctx, "/f", 7, "redis"); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	if got, _ := c.ReadFile(ctx, "/f"); got != "hello, redis" {
+		t.Errorf("content = %q, want %q", got, "hello, redis")
+	}
+	if meta := mustStat(t, c, "/f"); meta.Size != 12 || meta.MTime < before.MTime {
+		t.Errorf("meta = %+v, want size 12", meta)
+	}
+
+	// Writing past the end zero-fills the gap
+	c.WriteAt(ctx, "/f", 14, "!")
+	if got, _ := c.ReadFile(ctx, "/f"); got != "hello, redis\x00\x00!" {
+		t.Errorf("content = %q", got)
+	}
+	if meta := mustStat(t, c, "/f"); meta.Size != 15 {
+		t.Errorf("size = %d, want 15", meta.Size)
+	}
+
+	// A missing file is created
+	if err := c.WriteAt(ctx, "/new", 2, "x"); err != nil {
+		t.Fatalf("WriteAt new file: %v", err)
+	}
+	if got, _ := c.ReadFile(ctx, "/new"); got != "\x00\x00x" {
+		t.Errorf("new file = %q", got)
+	}
+
+	if err := c.WriteAt(ctx, "/f", -1, "x"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("negative offset = %v, want ErrInvalid", err)
+	}
+	if err := c.WriteAt(ctx, "/d", 0, "x"); !errors.Is(err, ErrIsDir) {
+		t.Errorf("directory = %v, want ErrIsDir", err)
+	}
+}
+
+func TestChunkedRangeIO(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	c.SetChunkSize(4)
+
+	// Growing a small file past the threshold moves it into chunks
+	c.WriteFile(ctx, "/f", "abc")
+	if err := c.WriteAt(ctx, "/f", 2, "XYZW"); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	if got := chunkContents(t, c, "/f"); !slices.Equal(got, []string{"abXY", "ZW"}) {
+		t.Errorf("chunks = %q", got)
+	}
+
+	// A write that spans chunks patches each of them
+	c.WriteFile(ctx, "/g", "0123456789ab")
+	if err := c.WriteAt(ctx, "/g", 3, "-----"); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	if got := chunkContents(t, c, "/g"); !slices.Equal(got, []string{"012-", "----", "89ab"}) {
+		t.Errorf("chunks = %q", got)
+	}
+	if got, _ := c.ReadAt(ctx, "/g", 2, 8); got != "2-----89" {
+		t.Errorf("ReadAt across chunks = %q", got)
+	}
+	if got, _ := c.ReadAt(ctx, "/g", 10, -1); got != "ab" {
+		t.Errorf("ReadAt of the tail = %q, want ab", got)
+	}
+
+	// Writing far past the end pads the chunks in between
+	if err := c.WriteAt(ctx, "/g", 18, "!"); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	want := "012-----89ab" + strings.Repeat("\x00", 6) + "!"
+	if got, _ := c.ReadFile(ctx, "/g"); got != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+	if meta := mustStat(t, c, "/g"); meta.Size != 19 || meta.Chunks != 5 {
+		t.Errorf("meta = %+v, want size 19 in 5 chunks", meta)
+	}
+}
@@ -0,0 +1,226 @@
+#!lua name=redisfs
+
+-- Server-side filesystem primitives for redis-fs-cli.
+--
+-- Each function re-checks the preconditions the client already looked at and
+-- applies the mutation in the same atomic call, closing the window between a
+-- client-side EXISTS/type check and the MULTI that follows it. Inode ids are
+-- allocated by the client, so every key a function touches is declared.
+--
+-- Failures are returned as errors whose first word is a POSIX errno name.
+
+local function errno(name)
+  return redis.error_reply(name)
+end
+
+local function entry_is(dir_key, name, ino)
+  local cur = redis.call('HGET', dir_key, name)
+  if ino == '' then
+    return cur == false
+  end
+  return cur == ino
+end
+
+-- fs_link creates a new directory entry.
+-- KEYS: parent meta, parent dir, child meta [, child data]
+-- ARGV: name, ino, content, field, value, ...
+local function fs_link(keys, args)
+  local ptype = redis.call('HGET', keys[1], 'type')
+  if not ptype then
+    return errno('ENOENT')
+  end
+  if ptype ~= 'dir' then
+    return errno('ENOTDIR')
+  end
+  if redis.call('HEXISTS', keys[2], args[1]) == 1 then
+    return errno('EEXIST')
+  end
+
+  redis.call('HSET', keys[3], unpack(args, 4))
+  if keys[4] then
+    redis.call('SET', keys[4], args[3])
+  end
+  redis.call('HSET', keys[2], args[1], args[2])
+  return 1
+end
+
+-- drop_link removes one link to an inode. It returns true when other links
+-- remain, leaving the inode's keys in place.
+local function drop_link(meta_key)
+  local n = tonumber(redis.call('HGET', meta_key, 'nlink')) or 1
+  if n > 1 then
+    redis.call('HSET', meta_key, 'nlink', n - 1)
+    return true
+  end
+  return false
+end
+
+-- fs_hardlink adds a directory entry for an existing inode.
+-- KEYS: parent meta, parent dir, target meta
+-- ARGV: name, ino
+local function fs_hardlink(keys, args)
+  local ptype = redis.call('HGET', keys[1], 'type')
+  if not ptype then
+    return errno('ENOENT')
+  end
+  if ptype ~= 'dir' then
+    return errno('ENOTDIR')
+  end
+  if redis.call('HEXISTS', keys[2], args[1]) == 1 then
+    return errno('EEXIST')
+  end
+  local t = redis.call('HGET', keys[3], 'type')
+  if not t then
+    return errno('ENOENT')
+  end
+  if t == 'dir' then
+    return errno('EPERM')
+  end
+
+  local n = tonumber(redis.call('HGET', keys[3], 'nlink')) or 1
+  redis.call('HSET', keys[3], 'nlink', n + 1)
+  redis.call('HSET', keys[2], args[1], args[2])
+  return n + 1
+end
+
+-- fs_write replaces, appends to or overwrites a range of an existing file.
+-- KEYS: parent dir, meta, data
+-- ARGV: name, ino, 'set' | 'append' | 'range', content, mtime [, offset]
+local function fs_write(keys, args)
+  if not entry_is(keys[1], args[1], args[2]) then
+    return errno('ESTALE')
+  end
+  local t = redis.call('HGET', keys[2], 'type')
+  if not t then
+    return errno('ESTALE')
+  end
+  if t == 'dir' then
+    return errno('EISDIR')
+  end
+
+  if args[3] == 'append' then
+    redis.call('APPEND', keys[3], args[4])
+  elseif args[3] == 'range' then
+    redis.call('SETRANGE', keys[3], tonumber(args[6]), args[4])
+  else
+    redis.call('SET', keys[3], args[4])
+  end
+  local size = redis.call('STRLEN', keys[3])
+  redis.call('HSET', keys[2], 'size', size, 'mtime', args[5])
+  return size
+end
+
+-- fs_unlink removes a file, symlink or empty directory. The inode's keys
+-- are deleted with its last link; returns 0 when other links remain.
+-- KEYS: parent dir, meta, data, dir, xattr
+-- ARGV: name, ino, 'dir' | 'file'
+local function fs_unlink(keys, args)
+  if not entry_is(keys[1], args[1], args[2]) then
+    return errno('ENOENT')
+  end
+  local t = redis.call('HGET', keys[2], 'type')
+  if args[3] == 'dir' then
+    if t ~= 'dir' then
+      return errno('ENOTDIR')
+    end
+    if redis.call('HLEN', keys[4]) > 0 then
+      return errno('ENOTEMPTY')
+    end
+  elseif t == 'dir' then
+    return errno('EISDIR')
+  end
+
+  redis.call('HDEL', keys[1], args[1])
+  if t ~= 'dir' and drop_link(keys[2]) then
+    return 0
+  end
+  redis.call('DEL', keys[2], keys[3], keys[4], keys[5])
+  return 1
+end
+
+-- fs_rename moves an entry between directories, replacing the destination.
+-- Returns 0 when the replaced entry had other links and was kept.
+-- KEYS: src parent dir, dst parent meta, dst parent dir, src meta
+--       [, dst meta, dst data, dst dir, dst xattr]
+-- ARGV: src name, src ino, dst name, dst ino ('' when the destination is new)
+local function fs_rename(keys, args)
+  if not entry_is(keys[1], args[1], args[2]) then
+    return errno('ENOENT')
+  end
+  local ptype = redis.call('HGET', keys[2], 'type')
+  if not ptype then
+    return errno('ENOENT')
+  end
+  if ptype ~= 'dir' then
+    return errno('ENOTDIR')
+  end
+  if not entry_is(keys[3], args[3], args[4]) then
+    if args[4] == '' then
+      return errno('EEXIST')
+    end
+    return errno('ESTALE')
+  end
+  if args[4] == args[2] then
+    -- Both names are links to the same inode: nothing to do, as rename(2)
+    return 1
+  end
+
+  local kept = false
+  if args[4] ~= '' then
+    local stype = redis.call('HGET', keys[4], 'type')
+    local dtype = redis.call('HGET', keys[5], 'type')
+    if dtype == 'dir' then
+      if stype ~= 'dir' then
+        return errno('EISDIR')
+      end
+      if redis.call('HLEN', keys[7]) > 0 then
+        return errno('ENOTEMPTY')
+      end
+    elseif stype == 'dir' then
+      return errno('ENOTDIR')
+    end
+    kept = drop_link(keys[5])
+    if not kept then
+      redis.call('DEL', keys[5], keys[6], keys[7], keys[8])
+    end
+  end
+
+  redis.call('HDEL', keys[1], args[1])
+  redis.call('HSET', keys[3], args[3], args[2])
+  if kept then
+    return 0
+  end
+  return 1
+end
+
+local guarded = {
+  fs_link = fs_link,
+  fs_hardlink = fs_hardlink,
+  fs_write = fs_write,
+  fs_unlink = fs_unlink,
+  fs_rename = fs_rename,
+}
+
+-- fs_if runs another of the functions only while a hash field still holds
+-- a value, '' standing for a missing field. Writes to the content of a
+-- volume check its copy-on-write generation this way.
+-- KEYS: hash, then the keys of the function
+-- ARGV: field, value, function name, then the arguments of the function
+local function fs_if(keys, args)
+  local cur = redis.call('HGET', keys[1], args[1]) or ''
+  if cur ~= args[2] then
+    return errno('EAGAIN')
+  end
+  local fn = guarded[args[3]]
+  if not fn then
+    return errno('EINVAL')
+  end
+  return fn({unpack(keys, 2)}, {unpack(args, 4)})
+end
+
+redis.register_function('fs_link', fs_link)
+redis.register_function('fs_hardlink', fs_hardlink)
+redis.register_function('fs_write', fs_write)
+redis.register_function('fs_unlink', fs_unlink)
+redis.register_function('fs_rename', fs_rename)
+redis.register_function('fs_if', fs_if)
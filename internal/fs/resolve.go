@@ -0,0 +1,135 @@
+package fs
+
+import (
+	"context"
+	"strings"
+)
+
+// Path resolution. Every path a Client method takes is resolved by walk,
+// which follows symlinks wherever they appear in a directory position, so
+// /link/file reaches file inside the link's target. Whether a symlink in
+// the final position is followed depends on the operation, as on POSIX:
+// cat and chmod follow it, rm and mv act on the link itself.
+
+// walk resolves path one component at a time, from the root. A symlink met
+// in a directory position, or in the final position when follow is set, is
+// replaced by its target and the walk restarts from the result; more than
+// maxSymlinkDepth replacements, counting the links already followed, is a
+// loop. walk returns the resolved path and the inode of its final entry, or
+// "" when a component does not exist. Search permission is checked on every
+// directory passed through.
+func (c *Client) walk(ctx context.Context, path string, follow bool, links int) (string, string, error) {
+	path = NormalizePath(path)
+	for {
+		names := splitPath(path)
+		ino := RootInode
+		next := ""
+		for i, name := range names {
+			if err := c.accessIno(ctx, "lookup", path, ino, AccessExec); err != nil {
+				return path, "", err
+			}
+			child, err := c.store.HGet(ctx, c.keys.Dir(ino), name)
+			if err != nil {
+				return path, "", err
+			}
+			if child == "" {
+				// Symlinks have no entries; the parent may be one
+				if i > 0 {
+					if next, err = c.expandLink(ctx, ino, names[:i], names[i:]); err != nil {
+						return path, "", err
+					}
+				}
+				if next == "" {
+					return path, "", nil
+				}
+				break
+			}
+			ino = child
+		}
+
+		if next == "" && follow && len(names) > 0 {
+			var err error
+			if next, err = c.expandLink(ctx, ino, names, nil); err != nil {
+				return path, "", err
+			}
+		}
+		if next == "" {
+			return path, ino, nil
+		}
+
+		if links++; links > maxSymlinkDepth {
+			return path, "", pathErr("lookup", path, ErrLoop)
+		}
+		path = next
+	}
+}
+
+// expandLink returns the path that results from replacing the entry at
+// prefix, inode ino, with its target when it is a symlink, followed by
+// rest. It returns "" when ino is not a symlink.
+func (c *Client) expandLink(ctx context.Context, ino string, prefix, rest []string) (string, error) {
+	meta, err := c.statIno(ctx, ino)
+	if err != nil || meta == nil || meta.Type != TypeSymlink {
+		return "", err
+	}
+	dir := "/" + strings.Join(prefix[:len(prefix)-1], "/")
+	target := ResolvePath(dir, meta.LinkTarget)
+	return NormalizePath(target + "/" + strings.Join(rest, "/")), nil
+}
+
+// splitPath returns the components of a normalized path.
+func splitPath(path string) []string {
+	if path == "/" {
+		return nil
+	}
+	return strings.Split(path[1:], "/")
+}
+
+// canonical returns path with symlinks in directory positions resolved,
+// leaving a final symlink in place. Observers and path comparisons use it
+// so that a file reached through a link has one name.
+func (c *Client) canonical(ctx context.Context, path string) (string, error) {
+	resolved, _, err := c.walk(ctx, path, false, 0)
+	return resolved, err
+}
+
+// StatFollow is Stat, but follows a final symlink to the entry it points
+// to. Returns nil, nil if the path, or the link's target, does not exist.
+func (c *Client) StatFollow(ctx context.Context, path string) (*Metadata, error) {
+	_, ino, err := c.walk(ctx, path, true, 0)
+	if err != nil {
+		return nil, pathErr("stat", path, err)
+	}
+	if ino == "" {
+		return nil, nil
+	}
+	return c.statIno(ctx, ino)
+}
+
+// Realpath returns the absolute path of the entry path refers to, with
+// every symlink resolved, like realpath(1). The entry must exist.
+func (c *Client) Realpath(ctx context.Context, path string) (string, error) {
+	resolved, ino, err := c.walk(ctx, path, true, 0)
+	if err != nil {
+		return "", pathErr("realpath", path, err)
+	}
+	if ino == "" {
+		return "", pathErr("realpath", path, ErrNotExist)
+	}
+	return resolved, nil
+}
+
+// Readlink returns the target of the symlink at path, as stored.
+func (c *Client) Readlink(ctx context.Context, path string) (string, error) {
+	meta, err := c.Stat(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if meta == nil {
+		return "", pathErr("readlink", path, ErrNotExist)
+	}
+	if meta.Type != TypeSymlink {
+		return "", pathErr("readlink", path, ErrInvalid)
+	}
+	return meta.LinkTarget, nil
+}
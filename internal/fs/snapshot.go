@@ -0,0 +1,543 @@
+package fs
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Snapshots are read-only, point-in-time copies of a volume, opened as
+// volumes of their own named volume@snapshot. Taking one copies the meta,
+// dir and xattr hashes of the volume; file content is shared with the live
+// volume and only copied when the live volume changes it (see
+// backend_snapshot.go), so a snapshot costs memory in proportion to the
+// metadata and to what changed since. Taking, deleting and restoring
+// snapshots is not atomic with writes made at the same time by other
+// clients, and is restricted to root.
+
+// Snapshot describes a snapshot of a volume.
+type Snapshot struct {
+	Name    string
+	Volume  string // volume name to open the snapshot with, e.g. main@2026-10-01
+	Created int64  // unix seconds
+
+	created int64 // unix nanoseconds, which order snapshots
+}
+
+// SnapshotVolume returns the volume name of snapshot name of volume, e.g.
+// main@2026-10-01.
+func SnapshotVolume(volume, name string) string {
+	return volume + "@" + name
+}
+
+// SplitSnapshotVolume splits the volume name of a snapshot into the name
+// of its volume and of the snapshot. ok is false for a live volume.
+func SplitSnapshotVolume(volume string) (base, name string, ok bool) {
+	return strings.Cut(volume, "@")
+}
+
+// validName reports whether name can name a volume or a snapshot:
+// non-empty, without characters that are special in volume names, keys or
+// SCAN patterns.
+func validName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "@:{}*?[]\\/ \t\n")
+}
+
+// ValidVolumeName reports whether volume can name a new volume, or the
+// snapshot of one as volume@snapshot.
+func ValidVolumeName(volume string) bool {
+	if base, name, ok := SplitSnapshotVolume(volume); ok {
+		return validName(base) && validName(name)
+	}
+	return validName(volume)
+}
+
+// IsSnapshot reports whether the active volume is a snapshot, which is
+// read-only.
+func (c *Client) IsSnapshot() bool {
+	_, _, ok := SplitSnapshotVolume(c.Volume)
+	return ok
+}
+
+// bind sets the store the client uses for its active volume.
+func (c *Client) bind() {
+	if base, name, ok := SplitSnapshotVolume(c.Volume); ok {
+		c.store = &snapshotBackend{
+			Backend: c.base,
+			keys:    c.keys,
+			live:    c.keys.volume(base),
+			name:    name,
+		}
+		return
+	}
+	c.store = &cowBackend{Backend: c.base, keys: c.keys}
+}
+
+// liveKeys returns the key generator of the live volume: the active one, or
+// the one the active snapshot was taken of.
+func (c *Client) liveKeys() *KeyGen {
+	if base, _, ok := SplitSnapshotVolume(c.Volume); ok {
+		return c.keys.volume(base)
+	}
+	return c.keys
+}
+
+// loadSnapshots returns the snapshots of the volume live names, oldest
+// first.
+func loadSnapshots(ctx context.Context, store Backend, live *KeyGen) ([]Snapshot, error) {
+	fields, err := store.HGetAll(ctx, live.Snapshots())
+	if err != nil {
+		return nil, err
+	}
+	snaps := make([]Snapshot, 0, len(fields))
+	for name, v := range fields {
+		ns, _ := strconv.ParseInt(v, 10, 64)
+		snaps = append(snaps, Snapshot{
+			Name:    name,
+			Volume:  SnapshotVolume(live.Volume, name),
+			Created: ns / int64(time.Second),
+			created: ns,
+		})
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].created < snaps[j].created
+	})
+	return snaps, nil
+}
+
+// Snapshots returns the snapshots of the active volume, or of the volume
+// the active snapshot was taken of, oldest first.
+func (c *Client) Snapshots(ctx context.Context) ([]Snapshot, error) {
+	snaps, err := loadSnapshots(ctx, c.base, c.liveKeys())
+	if err != nil {
+		return nil, pathErr("snapshot", c.Volume, err)
+	}
+	return snaps, nil
+}
+
+// snapshotAdmin checks that the client may manage the snapshots of the
+// active volume.
+func (c *Client) snapshotAdmin() error {
+	if c.IsSnapshot() {
+		return pathErr("snapshot", c.Volume, ErrReadOnly)
+	}
+	if !c.id.IsRoot() {
+		return pathErr("snapshot", c.Volume, ErrNotPermitted)
+	}
+	return nil
+}
+
+// CreateSnapshot takes a snapshot of the active volume. An empty name
+// defaults to the current date, e.g. 2026-10-01, with a -2, -3, ... suffix
+// when a snapshot already has that name.
+func (c *Client) CreateSnapshot(ctx context.Context, name string) (*Snapshot, error) {
+	if err := c.snapshotAdmin(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	created := strconv.FormatInt(now.UnixNano(), 10)
+
+	if name == "" {
+		date := now.Format("2006-01-02")
+		name = date
+		for n := 2; ; n++ {
+			ok, err := c.base.HSetNX(ctx, c.keys.Snapshots(), name, created)
+			if err != nil {
+				return nil, pathErr("snapshot", name, err)
+			}
+			if ok {
+				break
+			}
+			name = date + "-" + strconv.Itoa(n)
+		}
+	} else {
+		if !validName(name) {
+			return nil, pathErr("snapshot", name, ErrInvalid)
+		}
+		ok, err := c.base.HSetNX(ctx, c.keys.Snapshots(), name, created)
+		if err != nil {
+			return nil, pathErr("snapshot", name, err)
+		}
+		if !ok {
+			return nil, pathErr("snapshot", name, ErrExist)
+		}
+	}
+
+	// The snapshot is registered first, so content the live volume changes
+	// from here on is saved into it
+	snap := c.keys.snapshot(name)
+	err := c.share(ctx, c.keys)
+	if err == nil {
+		err = c.copySnapshot(ctx, snap, now)
+	}
+	if err != nil {
+		c.base.HDel(ctx, c.keys.Snapshots(), name)
+		c.dropKeys(ctx, snap)
+		c.unshare(ctx, c.keys)
+		return nil, pathErr("snapshot", name, err)
+	}
+	return &Snapshot{Name: name, Volume: snap.Volume, Created: now.Unix(), created: now.UnixNano()}, nil
+}
+
+// copySnapshot copies the metadata of the active volume into snap. The
+// superblock goes last, so the snapshot only opens once it is complete.
+func (c *Client) copySnapshot(ctx context.Context, snap *KeyGen, now time.Time) error {
+	return c.copyVolume(ctx, snap, false, map[string]string{
+		"snapshot_of": c.Volume,
+		"ctime":       strconv.FormatInt(now.Unix(), 10),
+	})
+}
+
+// copyVolume copies the meta, dir and xattr hashes of the active volume
+// into the volume to names, listing the inodes with content in its shared
+// hash when shared is set, and then its superblock with fields super
+// replaced.
+func (c *Client) copyVolume(ctx context.Context, to *KeyGen, shared bool, super map[string]string) error {
+	for _, kind := range []string{"meta:", "dir:", "xattr:"} {
+		err := c.scanVolume(ctx, c.keys, kind+"*", func(keys []string) error {
+			hashes, err := c.base.HGetAllMulti(ctx, keys)
+			if err != nil {
+				return err
+			}
+			return c.base.Pipeline(ctx, func(w Writer) {
+				for i, key := range keys {
+					if len(hashes[i]) == 0 {
+						continue
+					}
+					rest := strings.TrimPrefix(key, c.keys.Prefix())
+					w.HSet(to.Prefix()+rest, hashes[i])
+					if shared && kind == "meta:" && hashes[i]["type"] != string(TypeDir) {
+						w.HSet(to.Shared(), map[string]string{strings.TrimPrefix(rest, kind): "1"})
+					}
+				}
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	fields, err := c.base.HGetAll(ctx, c.keys.Super())
+	if err != nil {
+		return err
+	}
+	if fields == nil {
+		fields = make(map[string]string)
+	}
+	for k, v := range super {
+		fields[k] = v
+	}
+	delete(fields, "shares")
+	delete(fields, "cow_gen")
+	return c.base.HSet(ctx, to.Super(), fields)
+}
+
+// share marks the volume k names as sharing content with snapshots or
+// clones, and changes its cow_gen, so that content writes planned without
+// the snapshot or clone just registered fail and are planned again.
+func (c *Client) share(ctx context.Context, k *KeyGen) error {
+	return c.base.HSet(ctx, k.Super(), map[string]string{"shares": "1", "cow_gen": newCOWGen()})
+}
+
+// unshare changes the cow_gen of the volume k names after a snapshot or
+// clone of it is deleted, and removes its mark once it has neither left.
+func (c *Client) unshare(ctx context.Context, k *KeyGen) error {
+	left := false
+	for _, key := range []string{k.Snapshots(), k.Clones()} {
+		n, err := c.base.HLen(ctx, key)
+		if err != nil {
+			return err
+		}
+		left = left || n > 0
+	}
+	return c.base.Tx(ctx, func(tx Writer) {
+		if !left {
+			tx.HDel(k.Super(), "shares")
+		}
+		tx.HSet(k.Super(), map[string]string{"cow_gen": newCOWGen()})
+	})
+}
+
+// findSnapshot returns the snapshots of the active volume and the index of
+// the one called name.
+func (c *Client) findSnapshot(ctx context.Context, name string) ([]Snapshot, int, error) {
+	snaps, err := loadSnapshots(ctx, c.base, c.keys)
+	if err != nil {
+		return nil, 0, pathErr("snapshot", name, err)
+	}
+	for i, s := range snaps {
+		if s.Name == name {
+			return snaps, i, nil
+		}
+	}
+	return nil, 0, pathErr("snapshot", name, ErrNotExist)
+}
+
+// DeleteSnapshot deletes snapshot name of the active volume. Content it
+// saved that the next older snapshot still shares is handed down to it.
+func (c *Client) DeleteSnapshot(ctx context.Context, name string) error {
+	if err := c.snapshotAdmin(); err != nil {
+		return err
+	}
+	snaps, i, err := c.findSnapshot(ctx, name)
+	if err != nil {
+		return err
+	}
+	// Unregistered first: the live volume saves into the next newest
+	// snapshot from now on, which is the older one when this is the newest
+	if err := c.base.HDel(ctx, c.keys.Snapshots(), name); err != nil {
+		return pathErr("snapshot", name, err)
+	}
+
+	snap := c.keys.snapshot(name)
+	if i > 0 {
+		older := c.keys.snapshot(snaps[i-1].Name)
+		if err := c.handDown(ctx, snap, older); err != nil {
+			return pathErr("snapshot", name, err)
+		}
+	}
+	if err := c.dropKeys(ctx, snap); err != nil {
+		return pathErr("snapshot", name, err)
+	}
+	if err := c.unshare(ctx, c.keys); err != nil {
+		return pathErr("snapshot", name, err)
+	}
+	return nil
+}
+
+// handDown copies the content snap saved into older, for the inodes older
+// shares with it.
+func (c *Client) handDown(ctx context.Context, snap, older *KeyGen) error {
+	return c.scanVolume(ctx, snap, "meta:*", func(keys []string) error {
+		hashes, err := c.base.HGetAllMulti(ctx, keys)
+		if err != nil {
+			return err
+		}
+		for i, key := range keys {
+			if hashes[i]["cow"] != "1" {
+				continue
+			}
+			ino := strings.TrimPrefix(key, snap.Prefix()+"meta:")
+			m, err := c.base.HGetAll(ctx, older.Meta(ino))
+			if err != nil {
+				return err
+			}
+			if len(m) == 0 || m["cow"] == "1" {
+				continue
+			}
+			if err := copyContent(ctx, c.base, snap, older, ino, MetaFromMap(m)); err != nil {
+				return err
+			}
+			if err := c.base.HSet(ctx, older.Meta(ino), map[string]string{"cow": "1"}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RestoreSnapshot rolls the active volume back to snapshot name. Newer
+// snapshots keep their own state, and the snapshot itself is kept. File
+// content the live volume still shares with the snapshot is not copied.
+// Observers are told of every entry the restore removed, created or
+// changed, as if it had been done by hand.
+func (c *Client) RestoreSnapshot(ctx context.Context, name string) error {
+	if err := c.snapshotAdmin(); err != nil {
+		return err
+	}
+	snaps, i, err := c.findSnapshot(ctx, name)
+	if err != nil {
+		return err
+	}
+	snap := c.keys.snapshot(name)
+
+	var before []FindEntry
+	if len(c.observers) > 0 {
+		if before, err = c.Find(ctx, "/", "", ""); err != nil {
+			return pathErr("snapshot", name, err)
+		}
+	}
+
+	wanted, err := c.scanMeta(ctx, snap)
+	if err != nil {
+		return pathErr("snapshot", name, err)
+	}
+	current, err := c.scanMeta(ctx, c.keys)
+	if err != nil {
+		return pathErr("snapshot", name, err)
+	}
+
+	rewritten := make(map[string]bool)
+	for ino, m := range wanted {
+		copied, err := c.restoreInode(ctx, snaps, i, ino, m, current[ino])
+		if err != nil {
+			return pathErr("snapshot", name, err)
+		}
+		rewritten[ino] = copied
+	}
+	for ino, m := range current {
+		if _, ok := wanted[ino]; ok {
+			continue
+		}
+		// Through c.store, so newer snapshots keep the content
+		meta := MetaFromMap(m)
+		err := c.store.Del(ctx, c.keys.Meta(ino), c.keys.Data(ino), c.keys.Dir(ino), c.keys.Xattr(ino))
+		if err == nil {
+			err = c.dropChunks(ctx, chunkID(ino, meta.ChunkGen), 0, meta.Chunks)
+		}
+		if err != nil {
+			return pathErr("snapshot", name, err)
+		}
+	}
+
+	if len(c.observers) > 0 {
+		if err := c.notifyRestore(ctx, before, rewritten); err != nil {
+			return pathErr("snapshot", name, err)
+		}
+	}
+	return nil
+}
+
+// notifyRestore tells the observers how a restore changed the tree, given
+// the entries before it and the inodes whose content it copied back.
+// Entries gone, or replaced by another inode, are removed deepest first;
+// new entries are then created parents first, and entries kept report
+// what changed in their content, mode, owner and tags.
+func (c *Client) notifyRestore(ctx context.Context, before []FindEntry, rewritten map[string]bool) error {
+	after, err := c.Find(ctx, "/", "", "")
+	if err != nil {
+		return err
+	}
+	old := make(map[string]*Metadata, len(before))
+	for _, e := range before {
+		old[e.Path] = e.Meta
+	}
+	kept := make(map[string]bool, len(after))
+	for _, e := range after {
+		if m := old[e.Path]; m != nil && m.Ino == e.Meta.Ino && m.Type == e.Meta.Type {
+			kept[e.Path] = true
+		}
+	}
+
+	for i := len(before) - 1; i >= 0; i-- {
+		e := before[i]
+		if kept[e.Path] {
+			continue
+		}
+		if e.Meta.Type == TypeDir {
+			c.notifyRmdir(ctx, e.Path)
+		} else {
+			c.notifyRemove(ctx, e.Path)
+		}
+	}
+
+	for _, e := range after {
+		if e.Path == "/" {
+			continue
+		}
+		m, prev := e.Meta, old[e.Path]
+		if !kept[e.Path] {
+			prev = nil
+		}
+		switch {
+		case m.Type == TypeDir && prev == nil:
+			c.notifyMkdir(ctx, e.Path)
+		case m.Type == TypeSymlink && prev == nil:
+			c.notifySymlink(ctx, e.Path, m.LinkTarget)
+		case m.Type == TypeFile && (prev == nil || rewritten[m.Ino]):
+			if m.Chunks > 0 {
+				c.notifyChunked(ctx, e.Path)
+			} else {
+				content, err := c.store.Get(ctx, c.keys.Data(m.Ino))
+				if err != nil {
+					return err
+				}
+				c.notifyWrite(ctx, e.Path, content)
+			}
+		}
+		if prev != nil && prev.Mode != m.Mode {
+			c.notifyChmod(ctx, e.Path, m.Mode)
+		}
+		if prev != nil && (prev.UID != m.UID || prev.GID != m.GID) {
+			c.notifyChown(ctx, e.Path, m.UID, m.GID)
+		}
+		if prev == nil && len(m.Tags) > 0 || prev != nil && !slices.Equal(prev.Tags, m.Tags) {
+			c.notifyTags(ctx, e.Path, m.Tags)
+		}
+	}
+	return nil
+}
+
+// restoreInode puts inode ino back in the state snapshot snaps[i] has it
+// in, where m is its meta there, and cur its current meta, if any. It
+// reports whether the file content had to be copied back.
+func (c *Client) restoreInode(ctx context.Context, snaps []Snapshot, i int, ino string, m, cur map[string]string) (bool, error) {
+	snap := c.keys.snapshot(snaps[i].Name)
+	copied := false
+	if m["type"] == string(TypeFile) {
+		holder, err := contentHolder(ctx, c.base, c.keys, snaps, i, ino)
+		if err != nil {
+			return false, err
+		}
+		if holder != c.keys || cur == nil {
+			if cur != nil {
+				if err := c.store.Del(ctx, c.keys.Data(ino)); err != nil {
+					return false, err
+				}
+				old := MetaFromMap(cur)
+				if err := c.dropChunks(ctx, chunkID(ino, old.ChunkGen), 0, old.Chunks); err != nil {
+					return false, err
+				}
+			}
+			if err := copyContent(ctx, c.base, holder, c.keys, ino, MetaFromMap(m)); err != nil {
+				return false, err
+			}
+			// Its own now, if it was shared with the volume it was cloned from
+			if err := c.base.HDel(ctx, c.keys.Shared(), ino); err != nil {
+				return false, err
+			}
+			copied = true
+		}
+	}
+
+	dir, err := c.base.HGetAll(ctx, snap.Dir(ino))
+	if err != nil {
+		return false, err
+	}
+	xattrs, err := c.base.HGetAll(ctx, snap.Xattr(ino))
+	if err != nil {
+		return false, err
+	}
+	delete(m, "cow")
+	return copied, c.store.Tx(ctx, func(tx Writer) {
+		tx.Del(c.keys.Meta(ino), c.keys.Dir(ino), c.keys.Xattr(ino))
+		tx.HSet(c.keys.Meta(ino), m)
+		if len(dir) > 0 {
+			tx.HSet(c.keys.Dir(ino), dir)
+		}
+		if len(xattrs) > 0 {
+			tx.HSet(c.keys.Xattr(ino), xattrs)
+		}
+	})
+}
+
+// scanMeta returns the meta hash of every inode of the volume k names.
+func (c *Client) scanMeta(ctx context.Context, k *KeyGen) (map[string]map[string]string, error) {
+	metas := make(map[string]map[string]string)
+	err := c.scanVolume(ctx, k, "meta:*", func(keys []string) error {
+		hashes, err := c.base.HGetAllMulti(ctx, keys)
+		if err != nil {
+			return err
+		}
+		for i, key := range keys {
+			if len(hashes[i]) > 0 {
+				metas[strings.TrimPrefix(key, k.Prefix()+"meta:")] = hashes[i]
+			}
+		}
+		return nil
+	})
+	return metas, err
+}
@@ -0,0 +1,97 @@
+package fs
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// Tags are labels attached to any entry, kept sorted in the "tags" field of
+// its meta hash. Being metadata, they are copied by cp and follow the entry
+// through mv.
+
+// validTag reports whether tag can be stored: non-empty, without commas
+// (the field separator) or surrounding whitespace.
+func validTag(tag string) bool {
+	return tag != "" && !strings.Contains(tag, ",") && strings.TrimSpace(tag) == tag
+}
+
+// Tags returns the tags of path, sorted.
+func (c *Client) Tags(ctx context.Context, path string) ([]string, error) {
+	path = NormalizePath(path)
+	meta, err := c.Stat(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, pathErr("tag", path, ErrNotExist)
+	}
+	return meta.Tags, nil
+}
+
+// AddTags attaches tags to path. Tags it already has are ignored.
+func (c *Client) AddTags(ctx context.Context, path string, tags ...string) error {
+	return c.updateTags(ctx, path, func(cur []string) []string {
+		return append(cur, tags...)
+	}, tags)
+}
+
+// RemoveTags detaches tags from path. Tags it does not have are ignored.
+func (c *Client) RemoveTags(ctx context.Context, path string, tags ...string) error {
+	return c.updateTags(ctx, path, func(cur []string) []string {
+		return slices.DeleteFunc(cur, func(t string) bool {
+			return slices.Contains(tags, t)
+		})
+	}, tags)
+}
+
+// updateTags rewrites the tags of path with fn and tells the observer.
+func (c *Client) updateTags(ctx context.Context, path string, fn func([]string) []string, tags []string) error {
+	path = NormalizePath(path)
+	for _, t := range tags {
+		if !validTag(t) {
+			return pathErr("tag", t, ErrInvalid)
+		}
+	}
+
+	meta, err := c.Stat(ctx, path)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		return pathErr("tag", path, ErrNotExist)
+	}
+	if err := c.access("tag", path, meta, AccessWrite); err != nil {
+		return err
+	}
+
+	updated := fn(slices.Clone(meta.Tags))
+	slices.Sort(updated)
+	updated = slices.Compact(updated)
+	if slices.Equal(updated, meta.Tags) {
+		return nil
+	}
+
+	if len(updated) == 0 {
+		err = c.store.HDel(ctx, c.keys.Meta(meta.Ino), "tags")
+	} else {
+		err = c.store.HSet(ctx, c.keys.Meta(meta.Ino), map[string]string{"tags": strings.Join(updated, ",")})
+	}
+	if err != nil {
+		return pathErr("tag", path, err)
+	}
+	if meta.Type == TypeFile {
+		c.notifyTags(ctx, path, updated)
+	}
+	return nil
+}
+
+// hasTags reports whether meta carries every tag in tags.
+func hasTags(meta *Metadata, tags []string) bool {
+	for _, t := range tags {
+		if !slices.Contains(meta.Tags, t) {
+			return false
+		}
+	}
+	return true
+}
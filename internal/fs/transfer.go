@@ -0,0 +1,368 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transfers copy entries from the client's volume to another client, which
+// may have another volume active or be connected to another server. The
+// copy is made the way CopyFile makes it: it belongs to the destination
+// client's user, its mode is masked by that client's umask, and it keeps
+// the tags and extended attributes of the source. File content is streamed
+// chunkBatch chunks at a time, reading and writing each batch in one round
+// trip, and chunked by the destination client's chunk size.
+
+// sameVolume reports whether to operates on the same volume of the same
+// store as c, even through another connection to the same server.
+func (c *Client) sameVolume(to *Client) bool {
+	return c.keys.Prefix() == to.keys.Prefix() && sameStore(c.base, to.base)
+}
+
+// probeVolume reports whether to reaches the volume of c through a
+// connection sameVolume cannot tell apart, such as another address of the
+// same server, by marking the superblock through c and looking for the
+// mark through to.
+func (c *Client) probeVolume(ctx context.Context, to *Client) (bool, error) {
+	if c.keys.Prefix() != to.keys.Prefix() {
+		return false, nil
+	}
+	mark := strconv.FormatInt(time.Now().UnixNano(), 36)
+	if err := c.base.HSet(ctx, c.keys.Super(), map[string]string{"probe": mark}); err != nil {
+		return false, err
+	}
+	defer c.base.HDel(ctx, c.keys.Super(), "probe")
+	got, err := to.base.HGet(ctx, to.keys.Super(), "probe")
+	return got == mark, err
+}
+
+// isVolume reports whether to operates on the volume of c, telling apart
+// connections sameVolume cannot with probeVolume. Copies and moves within
+// one volume must not take the transfer path, which would copy a path onto
+// itself or a directory into itself.
+func (c *Client) isVolume(ctx context.Context, op, src string, to *Client) (bool, error) {
+	if c.sameVolume(to) {
+		return true, nil
+	}
+	same, err := c.probeVolume(ctx, to)
+	if err != nil {
+		return false, pathErr(op, NormalizePath(src), err)
+	}
+	return same, nil
+}
+
+// CopyTo copies the file at src to dst on client to.
+func (c *Client) CopyTo(ctx context.Context, src string, to *Client, dst string) error {
+	same, err := c.isVolume(ctx, "cp", src, to)
+	if err != nil {
+		return err
+	}
+	if same {
+		return c.CopyFile(ctx, src, dst)
+	}
+	src = NormalizePath(src)
+	srcMeta, err := c.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+	if srcMeta == nil {
+		return pathErr("cp", src, ErrNotExist)
+	}
+	if srcMeta.Type == TypeDir {
+		return pathErr("cp", src, ErrIsDir)
+	}
+	return c.transferEntry(ctx, "cp", src, srcMeta, to, NormalizePath(dst))
+}
+
+// CopyRecursiveTo copies a file or directory recursively to dst on
+// client to.
+func (c *Client) CopyRecursiveTo(ctx context.Context, src string, to *Client, dst string) error {
+	same, err := c.isVolume(ctx, "cp", src, to)
+	if err != nil {
+		return err
+	}
+	if same {
+		return c.CopyRecursive(ctx, src, dst)
+	}
+	src, err = c.canonical(ctx, src)
+	if err != nil {
+		return err
+	}
+	if dst, err = to.canonical(ctx, dst); err != nil {
+		return err
+	}
+	srcMeta, err := c.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+	if srcMeta == nil {
+		return pathErr("cp", src, ErrNotExist)
+	}
+	return c.transferTree(ctx, "cp", src, srcMeta, to, dst)
+}
+
+// MoveTo moves a file or directory to dst on client to. Across volumes
+// this is a recursive copy, after which the source is removed.
+func (c *Client) MoveTo(ctx context.Context, src string, to *Client, dst string) error {
+	if c.sameVolume(to) {
+		return c.Move(ctx, src, dst)
+	}
+	src, err := c.canonical(ctx, src)
+	if err != nil {
+		return err
+	}
+	if dst, err = to.canonical(ctx, dst); err != nil {
+		return err
+	}
+	srcMeta, err := c.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+	if srcMeta == nil {
+		return pathErr("mv", src, ErrNotExist)
+	}
+	if src == "/" {
+		return pathErr("mv", src, ErrBusy)
+	}
+	if c.IsSnapshot() {
+		return pathErr("mv", src, ErrReadOnly)
+	}
+	srcParentIno, err := c.lookup(ctx, ParentPath(src))
+	if err != nil {
+		return err
+	}
+	if err := c.canUnlink(ctx, "mv", src, srcParentIno, srcMeta); err != nil {
+		return err
+	}
+
+	// Copying and then removing the source would lose it if it were the
+	// destination, or contained it; Move rejects that
+	same, err := c.isVolume(ctx, "mv", src, to)
+	if err != nil {
+		return err
+	}
+	if same {
+		return c.Move(ctx, src, dst)
+	}
+
+	if err := c.transferTree(ctx, "mv", src, srcMeta, to, dst); err != nil {
+		return err
+	}
+	return c.RemoveRecursive(ctx, src)
+}
+
+// transferTree copies the entry src, whose metadata is srcMeta, and
+// everything below it to dst on client to.
+func (c *Client) transferTree(ctx context.Context, op, src string, srcMeta *Metadata, to *Client, dst string) error {
+	if srcMeta.Type != TypeDir {
+		return c.transferEntry(ctx, op, src, srcMeta, to, dst)
+	}
+
+	// Listed before dst is created, so a copy into the source tree, on a
+	// second connection to the same volume, does not copy itself
+	children, err := c.ReadDirWithMeta(ctx, src)
+	if err != nil {
+		return err
+	}
+	dst, _, err = to.destination(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+	if err := to.Mkdir(ctx, dst, true); err != nil {
+		return err
+	}
+	dstIno, err := to.lookup(ctx, dst)
+	if err != nil {
+		return err
+	}
+	if err := c.transferXattrs(ctx, srcMeta.Ino, to, dstIno); err != nil {
+		return pathErr(op, dst, err)
+	}
+	if len(srcMeta.Tags) > 0 {
+		if err := to.store.HSet(ctx, to.keys.Meta(dstIno), map[string]string{"tags": strings.Join(srcMeta.Tags, ",")}); err != nil {
+			return pathErr(op, dst, err)
+		}
+	}
+
+	for _, child := range children {
+		if child.Meta == nil {
+			continue
+		}
+		srcChild := JoinPath(src, child.Name)
+		dstChild := JoinPath(dst, child.Name)
+		if err := c.transferTree(ctx, op, srcChild, child.Meta, to, dstChild); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transferEntry copies the file or symlink src, whose metadata is srcMeta,
+// to dst on client to, creating it or overwriting it in place.
+func (c *Client) transferEntry(ctx context.Context, op, src string, srcMeta *Metadata, to *Client, dst string) error {
+	dst, dstMeta, err := to.destination(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+	if dstMeta != nil && dstMeta.Type == TypeDir {
+		return pathErr(op, dst, ErrIsDir)
+	}
+	if err := c.access(op, src, srcMeta, AccessRead); err != nil {
+		return err
+	}
+
+	dstParentIno, err := to.lookupDir(ctx, ParentPath(dst))
+	if err != nil {
+		return err
+	}
+	if dstParentIno == "" {
+		return pathErr(op, dst, ErrNotExist)
+	}
+	if dstMeta != nil {
+		err = to.access(op, dst, dstMeta, AccessWrite)
+	} else {
+		err = to.accessIno(ctx, op, dst, dstParentIno, AccessWrite|AccessExec)
+	}
+	if err != nil {
+		return err
+	}
+
+	if srcMeta.Type != TypeFile {
+		return c.transferInto(ctx, op, src, srcMeta, to, dstParentIno, dst, dstMeta)
+	}
+	return to.versionedWrite(ctx, op, dst, dstMeta, func() error {
+		return c.transferInto(ctx, op, src, srcMeta, to, dstParentIno, dst, dstMeta)
+	})
+}
+
+// transferInto copies the file or symlink src, whose metadata is srcMeta,
+// to dst on client to, creating it in dstParentIno or overwriting dstMeta
+// in place.
+func (c *Client) transferInto(ctx context.Context, op, src string, srcMeta *Metadata, to *Client, dstParentIno, dst string, dstMeta *Metadata) error {
+	now := time.Now().Unix()
+	newMeta := *srcMeta
+	to.own(&newMeta)
+	newMeta.Mode = to.createMode(srcMeta.FileMode())
+	newMeta.CTime = now
+	newMeta.MTime = now
+	newMeta.ATime = now
+	newMeta.Chunks, newMeta.ChunkSize, newMeta.ChunkGen = 0, 0, ""
+	newMeta.Nlink = 1
+	if dstMeta != nil {
+		newMeta.Nlink = dstMeta.Nlink
+	}
+
+	ino := ""
+	var err error
+	if dstMeta != nil {
+		ino = dstMeta.Ino
+	} else if ino, err = to.allocInode(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Chunks are written first; a new entry stays invisible until linked,
+	// and an existing one keeps its content until its metadata switches to
+	// a new chunk generation
+	if dstMeta != nil {
+		newMeta.ChunkGen = newChunkGen()
+	}
+	id := chunkID(ino, newMeta.ChunkGen)
+	var data *string
+	if srcMeta.Type == TypeFile {
+		if to.needsChunks(srcMeta.Size) {
+			n, err := c.transferChunks(ctx, srcMeta, to, id)
+			if err != nil {
+				to.dropChunks(ctx, id, 0, chunkCount(srcMeta.Size, to.chunkSize))
+				return pathErr(op, dst, err)
+			}
+			newMeta.Chunks, newMeta.ChunkSize = n, to.chunkSize
+		} else {
+			content, err := c.readContent(ctx, srcMeta)
+			if err != nil {
+				return pathErr(op, src, err)
+			}
+			data = &content
+		}
+	}
+
+	if dstMeta == nil {
+		if err := to.link(ctx, dstParentIno, BaseName(dst), ino, &newMeta, data); err != nil {
+			to.dropChunks(ctx, id, 0, newMeta.Chunks)
+			return pathErr(op, dst, err)
+		}
+	} else {
+		// Overwrite the existing destination in place, keeping its inode
+		err := to.store.Tx(ctx, func(tx Writer) {
+			tx.Del(to.keys.Meta(ino), to.keys.Data(ino))
+			if data != nil {
+				tx.Set(to.keys.Data(ino), *data)
+			}
+			tx.HSet(to.keys.Meta(ino), newMeta.ToMap())
+		})
+		if err != nil {
+			to.dropChunks(ctx, id, 0, newMeta.Chunks)
+			return pathErr(op, dst, err)
+		}
+		if err := to.dropChunks(ctx, chunkID(ino, dstMeta.ChunkGen), 0, dstMeta.Chunks); err != nil {
+			return pathErr(op, dst, err)
+		}
+	}
+	if err := c.transferXattrs(ctx, srcMeta.Ino, to, ino); err != nil {
+		return pathErr(op, dst, err)
+	}
+
+	c.touchAtime(ctx, srcMeta)
+	switch {
+	case srcMeta.Type != TypeFile:
+	case data != nil:
+		to.notifyWrite(ctx, dst, *data)
+	default:
+		to.notifyChunked(ctx, dst)
+	}
+	if len(newMeta.Tags) > 0 || (dstMeta != nil && len(dstMeta.Tags) > 0) {
+		to.notifyTags(ctx, dst, newMeta.Tags)
+	}
+	return nil
+}
+
+// transferChunks streams the content of the file src into chunks under the
+// chunk id id on client to, chunked by to's chunk size. Returns the number
+// of chunks written.
+func (c *Client) transferChunks(ctx context.Context, src *Metadata, to *Client, id string) (int64, error) {
+	window := chunkBatch * to.chunkSize
+	var n int64
+	for off := int64(0); off < src.Size; off += window {
+		data, err := c.readRange(ctx, src, off, min(off+window, src.Size))
+		if err != nil {
+			return 0, err
+		}
+		k, err := to.writeChunks(ctx, id, n, data, to.chunkSize)
+		if err != nil {
+			return 0, err
+		}
+		n += k
+	}
+	return n, nil
+}
+
+// chunkCount returns the number of chunks of size cs content of the given
+// size takes.
+func chunkCount(size, cs int64) int64 {
+	return (size + cs - 1) / cs
+}
+
+// transferXattrs replaces the extended attributes of dstIno on client to
+// with those of srcIno.
+func (c *Client) transferXattrs(ctx context.Context, srcIno string, to *Client, dstIno string) error {
+	attrs, err := c.store.HGetAll(ctx, c.keys.Xattr(srcIno))
+	if err != nil {
+		return err
+	}
+	return to.store.Tx(ctx, func(tx Writer) {
+		tx.Del(to.keys.Xattr(dstIno))
+		tx.HSet(to.keys.Xattr(dstIno), attrs)
+	})
+}
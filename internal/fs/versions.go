@@ -0,0 +1,422 @@
+package fs
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version history. Versioning is opt-in per directory, or for the whole
+// volume by enabling it on /. Every change to the content of a file below
+// such a directory records a revision with the file's content, size, time
+// and author: writes, whole or at an offset, appends, restores, copies and
+// moves onto the file, and its removal. Revisions are kept by path in the
+// hist and rev keys, so the history of a removed file outlives it and the
+// file can be restored. History belongs to the path a file was written at:
+// mv does not carry it along. Revisions past the policy's age are dropped
+// when the file is next written, and when its history is read.
+
+// VersionPolicy says which revisions of each file to keep.
+type VersionPolicy struct {
+	Keep   int           // revisions kept per file; 0 turns versioning off
+	MaxAge time.Duration // revisions older than this are dropped; 0 keeps them regardless of age
+}
+
+func (p VersionPolicy) encode() string {
+	return strconv.Itoa(p.Keep) + "," + strconv.FormatInt(int64(p.MaxAge/time.Second), 10)
+}
+
+func parseVersionPolicy(s string) VersionPolicy {
+	keep, age, _ := strings.Cut(s, ",")
+	var p VersionPolicy
+	p.Keep, _ = strconv.Atoi(keep)
+	secs, _ := strconv.ParseInt(age, 10, 64)
+	p.MaxAge = time.Duration(secs) * time.Second
+	return p
+}
+
+// Version is one recorded revision of a file.
+type Version struct {
+	Rev    int64
+	Time   int64 // unix seconds
+	Size   int64
+	Author string // uid of the writer
+	Op     string // write, append, cp, mv, restore or rm
+}
+
+// Deleted reports whether the revision records the removal of the file,
+// and so has no content.
+func (v Version) Deleted() bool {
+	return v.Op == "rm"
+}
+
+func (v Version) encode() string {
+	return strconv.FormatInt(v.Time, 10) + " " + strconv.FormatInt(v.Size, 10) + " " + v.Author + " " + v.Op
+}
+
+func parseVersion(rev, s string) (Version, bool) {
+	f := strings.Fields(s)
+	n, err := strconv.ParseInt(rev, 10, 64)
+	if err != nil || len(f) != 4 {
+		return Version{}, false
+	}
+	v := Version{Rev: n, Author: f[2], Op: f[3]}
+	v.Time, _ = strconv.ParseInt(f[0], 10, 64)
+	v.Size, _ = strconv.ParseInt(f[1], 10, 64)
+	return v, true
+}
+
+// --- Policies ---
+
+// SetVersioning sets the versioning policy of the directory dir, which
+// applies to every file below it unless a subdirectory sets its own. A
+// policy with Keep 0 turns versioning off for the subtree.
+func (c *Client) SetVersioning(ctx context.Context, dir string, p VersionPolicy) error {
+	if p.Keep < 0 || p.MaxAge < 0 {
+		return pathErr("versioning", dir, ErrInvalid)
+	}
+	dir, err := c.versioningDir(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if err := c.store.HSet(ctx, c.keys.Versioning(), map[string]string{dir: p.encode()}); err != nil {
+		return pathErr("versioning", dir, err)
+	}
+	return nil
+}
+
+// ClearVersioning removes the policy set on dir, which then inherits the
+// policy of its parent.
+func (c *Client) ClearVersioning(ctx context.Context, dir string) error {
+	dir, err := c.versioningDir(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if err := c.store.HDel(ctx, c.keys.Versioning(), dir); err != nil {
+		return pathErr("versioning", dir, err)
+	}
+	return nil
+}
+
+// versioningDir resolves the directory a policy is set on and checks the
+// client may change it.
+func (c *Client) versioningDir(ctx context.Context, dir string) (string, error) {
+	dir, ino, err := c.walk(ctx, dir, true, 0)
+	if err != nil {
+		return "", err
+	}
+	if ino == "" {
+		return "", pathErr("versioning", dir, ErrNotExist)
+	}
+	meta, err := c.statIno(ctx, ino)
+	if err != nil {
+		return "", err
+	}
+	if meta == nil {
+		return "", pathErr("versioning", dir, ErrNotExist)
+	}
+	if meta.Type != TypeDir {
+		return "", pathErr("versioning", dir, ErrNotDir)
+	}
+	if err := c.access("versioning", dir, meta, AccessWrite); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// VersioningPolicies returns every policy set in the volume, by directory.
+func (c *Client) VersioningPolicies(ctx context.Context) (map[string]VersionPolicy, error) {
+	fields, err := c.store.HGetAll(ctx, c.keys.Versioning())
+	if err != nil {
+		return nil, err
+	}
+	policies := make(map[string]VersionPolicy, len(fields))
+	for dir, s := range fields {
+		policies[dir] = parseVersionPolicy(s)
+	}
+	return policies, nil
+}
+
+// VersioningFor returns the policy in effect for path and the directory it
+// is set on, or "" when versioning was never enabled above path.
+func (c *Client) VersioningFor(ctx context.Context, path string) (VersionPolicy, string, error) {
+	path, _, err := c.walk(ctx, path, true, 0)
+	if err != nil {
+		return VersionPolicy{}, "", err
+	}
+	policies, err := c.VersioningPolicies(ctx)
+	if err != nil {
+		return VersionPolicy{}, "", err
+	}
+	p, dir := policyFor(policies, path)
+	return p, dir, nil
+}
+
+// policyFor returns the policy of the nearest ancestor of path that has
+// one, and that ancestor.
+func policyFor(policies map[string]VersionPolicy, path string) (VersionPolicy, string) {
+	for dir := path; ; dir = ParentPath(dir) {
+		if p, ok := policies[dir]; ok {
+			return p, dir
+		}
+		if dir == "/" {
+			return VersionPolicy{}, ""
+		}
+	}
+}
+
+// versioning returns the policy that applies to the file at path, a
+// resolved path, or nil when its writes are not versioned.
+func (c *Client) versioning(ctx context.Context, path string) (*VersionPolicy, error) {
+	policies, err := c.VersioningPolicies(ctx)
+	if err != nil || len(policies) == 0 {
+		return nil, err
+	}
+	return enabledPolicy(policies, path), nil
+}
+
+// enabledPolicy is policyFor, returning nil when versioning is off.
+func enabledPolicy(policies map[string]VersionPolicy, path string) *VersionPolicy {
+	p, _ := policyFor(policies, path)
+	if p.Keep == 0 {
+		return nil
+	}
+	return &p
+}
+
+// --- Recording ---
+
+// seedHistory records the current content of the file meta at path as its
+// first revision, when versioning applies to the file but it has no history
+// yet, so a file written before versioning was enabled survives its next
+// change.
+func (c *Client) seedHistory(ctx context.Context, path string, meta *Metadata, p *VersionPolicy) error {
+	if p == nil || meta == nil || meta.Type != TypeFile {
+		return nil
+	}
+	n, err := c.store.HLen(ctx, c.keys.History(path))
+	if err != nil || n > 0 {
+		return err
+	}
+	content, err := c.readContent(ctx, meta)
+	if err != nil {
+		return err
+	}
+	v := Version{Time: meta.MTime, Size: meta.Size, Author: meta.UID, Op: "write"}
+	return c.addVersion(ctx, path, v, &content)
+}
+
+// versionedWrite runs write, which changes the content of the file at
+// path, a resolved path whose entry is meta or nil when write creates it,
+// and records the content it leaves as a revision op when the file is
+// versioned.
+func (c *Client) versionedWrite(ctx context.Context, op, path string, meta *Metadata, write func() error) error {
+	policy, err := c.versioning(ctx, path)
+	if err != nil {
+		return pathErr(op, path, err)
+	}
+	if err := c.seedHistory(ctx, path, meta, policy); err != nil {
+		return pathErr(op, path, err)
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	if policy == nil {
+		return nil
+	}
+	after, err := c.Stat(ctx, path)
+	if err != nil || after == nil || after.Type != TypeFile {
+		return err
+	}
+	content, err := c.readContent(ctx, after)
+	if err == nil {
+		err = c.recordVersion(ctx, path, op, &content, policy)
+	}
+	if err != nil {
+		return pathErr(op, path, err)
+	}
+	return nil
+}
+
+// recordVersion records a revision of the file at path with content, or a
+// removal when content is nil, then drops the revisions p no longer keeps.
+func (c *Client) recordVersion(ctx context.Context, path, op string, content *string, p *VersionPolicy) error {
+	if p == nil {
+		return nil
+	}
+	v := Version{Time: time.Now().Unix(), Author: strconv.Itoa(c.id.UID), Op: op}
+	if content != nil {
+		v.Size = int64(len(*content))
+	}
+	if err := c.addVersion(ctx, path, v, content); err != nil {
+		return err
+	}
+	return c.pruneHistory(ctx, path, p)
+}
+
+// addVersion appends v to the history of path, numbering it after the
+// newest revision.
+func (c *Client) addVersion(ctx context.Context, path string, v Version, content *string) error {
+	revs, err := c.store.HKeys(ctx, c.keys.History(path))
+	if err != nil {
+		return err
+	}
+	v.Rev = 1
+	for _, r := range revs {
+		if n, _ := strconv.ParseInt(r, 10, 64); n >= v.Rev {
+			v.Rev = n + 1
+		}
+	}
+	for {
+		// Claim the number; another client may have just taken it
+		ok, err := c.store.HSetNX(ctx, c.keys.History(path), strconv.FormatInt(v.Rev, 10), v.encode())
+		if err != nil {
+			return err
+		}
+		if ok {
+			break
+		}
+		v.Rev++
+	}
+	if content == nil {
+		return nil
+	}
+	return c.store.Set(ctx, c.keys.Revision(path, v.Rev), *content)
+}
+
+// pruneHistory drops the revisions of path beyond p's count and age limits.
+// The newest revision is always kept.
+func (c *Client) pruneHistory(ctx context.Context, path string, p *VersionPolicy) error {
+	versions, err := c.history(ctx, path)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-p.MaxAge).Unix()
+	var drop []Version
+	for i, v := range versions[:max(len(versions)-1, 0)] {
+		if len(versions)-i > p.Keep || (p.MaxAge > 0 && v.Time < cutoff) {
+			drop = append(drop, v)
+		}
+	}
+	if len(drop) == 0 {
+		return nil
+	}
+	return c.store.Tx(ctx, func(tx Writer) {
+		for _, v := range drop {
+			tx.HDel(c.keys.History(path), strconv.FormatInt(v.Rev, 10))
+			tx.Del(c.keys.Revision(path, v.Rev))
+		}
+	})
+}
+
+// --- Reading and restoring ---
+
+// History returns the recorded revisions of the file at path, oldest
+// first. The file need not exist any more.
+func (c *Client) History(ctx context.Context, path string) ([]Version, error) {
+	path, err := c.historyPath(ctx, "history", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.expireHistory(ctx, path); err != nil {
+		return nil, pathErr("history", path, err)
+	}
+	versions, err := c.history(ctx, path)
+	if err != nil {
+		return nil, pathErr("history", path, err)
+	}
+	return versions, nil
+}
+
+// expireHistory drops the revisions of path its policy no longer keeps,
+// so the history of a file that is not written any more still ages. It
+// does nothing on a read-only volume or connection.
+func (c *Client) expireHistory(ctx context.Context, path string) error {
+	if c.readOnly || c.IsSnapshot() {
+		return nil
+	}
+	policy, err := c.versioning(ctx, path)
+	if err != nil || policy == nil {
+		return err
+	}
+	return c.pruneHistory(ctx, path, policy)
+}
+
+func (c *Client) history(ctx context.Context, path string) ([]Version, error) {
+	fields, err := c.store.HGetAll(ctx, c.keys.History(path))
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]Version, 0, len(fields))
+	for rev, s := range fields {
+		if v, ok := parseVersion(rev, s); ok {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Rev < versions[j].Rev
+	})
+	return versions, nil
+}
+
+// ReadVersion returns the content of revision rev of the file at path.
+func (c *Client) ReadVersion(ctx context.Context, path string, rev int64) (string, error) {
+	path, err := c.historyPath(ctx, "show", path)
+	if err != nil {
+		return "", err
+	}
+	return c.readVersion(ctx, "show", path, rev)
+}
+
+func (c *Client) readVersion(ctx context.Context, op, path string, rev int64) (string, error) {
+	if err := c.expireHistory(ctx, path); err != nil {
+		return "", pathErr(op, path, err)
+	}
+	s, err := c.store.HGet(ctx, c.keys.History(path), strconv.FormatInt(rev, 10))
+	if err != nil {
+		return "", pathErr(op, path, err)
+	}
+	v, ok := parseVersion(strconv.FormatInt(rev, 10), s)
+	if !ok || v.Deleted() {
+		return "", pathErr(op, path+"@"+strconv.FormatInt(rev, 10), ErrNotExist)
+	}
+	content, err := c.store.Get(ctx, c.keys.Revision(path, rev))
+	if err != nil {
+		return "", pathErr(op, path, err)
+	}
+	return content, nil
+}
+
+// RestoreVersion makes revision rev the content of the file at path,
+// recreating the file if it was removed. The restore is itself recorded as
+// a new revision.
+func (c *Client) RestoreVersion(ctx context.Context, path string, rev int64) error {
+	path, err := c.historyPath(ctx, "restore", path)
+	if err != nil {
+		return err
+	}
+	content, err := c.readVersion(ctx, "restore", path, rev)
+	if err != nil {
+		return err
+	}
+	return c.writeFile(ctx, path, content, "restore")
+}
+
+// historyPath resolves the path whose history an operation reads, checking
+// read access to the file when it still exists.
+func (c *Client) historyPath(ctx context.Context, op, path string) (string, error) {
+	path, ino, err := c.walk(ctx, path, true, 0)
+	if err != nil || ino == "" {
+		return path, err
+	}
+	meta, err := c.statIno(ctx, ino)
+	if err != nil || meta == nil {
+		return path, err
+	}
+	if meta.Type == TypeDir {
+		return "", pathErr(op, path, ErrIsDir)
+	}
+	return path, c.access(op, path, meta, AccessRead)
+}
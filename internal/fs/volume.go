@@ -0,0 +1,300 @@
+package fs
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// VolumeInfo describes a volume: its superblock fields, what it holds and
+// what that costs in Redis.
+type VolumeInfo struct {
+	Name        string
+	Description string
+	Created     int64 // unix seconds, 0 when unknown
+
+	Files, Dirs, Symlinks int64
+	Bytes                 int64 // total size of the files
+
+	Keys   int64 // Redis keys of the volume, not counting its snapshots
+	Memory int64 // bytes of memory those keys use
+
+	// Origin is the volume a clone was cloned from. SharedFiles and
+	// SharedBytes count the files whose content is still read from it.
+	Origin                   string
+	SharedFiles, SharedBytes int64
+}
+
+// volumeAdmin checks that the client may delete, rename or describe the
+// active volume.
+func (c *Client) volumeAdmin(ctx context.Context, op string) error {
+	if c.IsSnapshot() {
+		return pathErr(op, c.Volume, ErrReadOnly)
+	}
+	if !c.id.IsRoot() {
+		return pathErr(op, c.Volume, ErrNotPermitted)
+	}
+	exists, err := c.VolumeExists(ctx)
+	if err != nil {
+		return pathErr(op, c.Volume, err)
+	}
+	if !exists {
+		return pathErr(op, c.Volume, ErrNotExist)
+	}
+	return nil
+}
+
+// VolumeInfo returns statistics about the active volume, scanning all of
+// its keys.
+func (c *Client) VolumeInfo(ctx context.Context) (*VolumeInfo, error) {
+	super, err := c.base.HGetAll(ctx, c.keys.Super())
+	if err != nil {
+		return nil, pathErr("info", c.Volume, err)
+	}
+	info := &VolumeInfo{
+		Name:        c.Volume,
+		Description: super["description"],
+		Origin:      super["clone_of"],
+	}
+	info.Created, _ = strconv.ParseInt(super["ctime"], 10, 64)
+
+	shared, err := c.base.HKeys(ctx, c.keys.Shared())
+	if err != nil {
+		return nil, pathErr("info", c.Volume, err)
+	}
+	isShared := make(map[string]bool, len(shared))
+	for _, ino := range shared {
+		isShared[ino] = true
+	}
+
+	metaPrefix := c.keys.Prefix() + "meta:"
+	err = c.scanVolume(ctx, c.keys, "*", func(keys []string) error {
+		mem, err := c.base.MemoryUsage(ctx, keys)
+		if err != nil {
+			return err
+		}
+		info.Keys += int64(len(keys))
+		info.Memory += mem
+
+		var metas []string
+		for _, key := range keys {
+			if strings.HasPrefix(key, metaPrefix) {
+				metas = append(metas, key)
+			}
+		}
+		hashes, err := c.base.HGetAllMulti(ctx, metas)
+		if err != nil {
+			return err
+		}
+		for i, h := range hashes {
+			switch EntryType(h["type"]) {
+			case TypeDir:
+				info.Dirs++
+			case TypeSymlink:
+				info.Symlinks++
+			case TypeFile:
+				size := MetaFromMap(h).Size
+				info.Files++
+				info.Bytes += size
+				if isShared[strings.TrimPrefix(metas[i], metaPrefix)] {
+					info.SharedFiles++
+					info.SharedBytes += size
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, pathErr("info", c.Volume, err)
+	}
+	return info, nil
+}
+
+// SetDescription sets the free-form description of the active volume, or
+// removes it when description is empty.
+func (c *Client) SetDescription(ctx context.Context, description string) error {
+	if err := c.volumeAdmin(ctx, "describe"); err != nil {
+		return err
+	}
+	var err error
+	if description == "" {
+		err = c.base.HDel(ctx, c.keys.Super(), "description")
+	} else {
+		err = c.base.HSet(ctx, c.keys.Super(), map[string]string{"description": description})
+	}
+	if err != nil {
+		return pathErr("describe", c.Volume, err)
+	}
+	return nil
+}
+
+// DeleteVolume deletes the active volume with all its keys and snapshots.
+// Its clones get their own copy of the content they still share with it,
+// or share it with the volume it was cloned from instead. The client keeps
+// the volume active, as an empty, uninitialized volume.
+func (c *Client) DeleteVolume(ctx context.Context) error {
+	if err := c.volumeAdmin(ctx, "delete"); err != nil {
+		return err
+	}
+	if err := c.deleteVolume(ctx); err != nil {
+		return pathErr("delete", c.Volume, err)
+	}
+	return nil
+}
+
+func (c *Client) deleteVolume(ctx context.Context) error {
+	origin, err := c.base.HGet(ctx, c.keys.Super(), "clone_of")
+	if err != nil {
+		return err
+	}
+	clones, err := c.base.HKeys(ctx, c.keys.Clones())
+	if err != nil {
+		return err
+	}
+	for _, name := range clones {
+		if err := c.detachClone(ctx, c.keys.volume(name), origin); err != nil {
+			return err
+		}
+	}
+	if origin != "" {
+		if err := c.base.HDel(ctx, c.keys.volume(origin).Clones(), c.Volume); err != nil {
+			return err
+		}
+		if err := c.unshare(ctx, c.keys.volume(origin)); err != nil {
+			return err
+		}
+	}
+
+	snaps, err := loadSnapshots(ctx, c.base, c.keys)
+	if err != nil {
+		return err
+	}
+	for _, s := range snaps {
+		if err := c.dropKeys(ctx, c.keys.snapshot(s.Name)); err != nil {
+			return err
+		}
+	}
+	// The superblock goes first, so the volume is no longer listed
+	if err := c.base.Del(ctx, c.keys.Super()); err != nil {
+		return err
+	}
+	return c.dropKeys(ctx, c.keys)
+}
+
+// RenameVolume renames the active volume with its snapshots to name, and
+// makes name the active volume.
+func (c *Client) RenameVolume(ctx context.Context, name string) error {
+	if err := c.volumeAdmin(ctx, "rename"); err != nil {
+		return err
+	}
+	if !validName(name) {
+		return pathErr("rename", name, ErrInvalid)
+	}
+	to := c.keys.volume(name)
+	n, err := c.base.Exists(ctx, to.Super(), to.legacyMeta("/"))
+	if err != nil {
+		return pathErr("rename", name, err)
+	}
+	if n > 0 {
+		return pathErr("rename", name, ErrExist)
+	}
+	if err := c.renameVolume(ctx, to); err != nil {
+		return pathErr("rename", c.Volume, err)
+	}
+	c.SetVolume(name)
+	return nil
+}
+
+func (c *Client) renameVolume(ctx context.Context, to *KeyGen) error {
+	snaps, err := loadSnapshots(ctx, c.base, c.keys)
+	if err != nil {
+		return err
+	}
+	for _, s := range snaps {
+		snap := c.keys.snapshot(s.Name)
+		if err := c.renameKeys(ctx, snap, to.snapshot(s.Name)); err != nil {
+			return err
+		}
+		if err := c.base.HSet(ctx, to.snapshot(s.Name).Super(), map[string]string{"snapshot_of": to.Volume}); err != nil {
+			return err
+		}
+	}
+	if err := c.renameKeys(ctx, c.keys, to); err != nil {
+		return err
+	}
+
+	clones, err := c.base.HKeys(ctx, to.Clones())
+	if err != nil {
+		return err
+	}
+	for _, name := range clones {
+		if err := c.base.HSet(ctx, c.keys.volume(name).Super(), map[string]string{"clone_of": to.Volume}); err != nil {
+			return err
+		}
+	}
+	origin, err := c.base.HGet(ctx, to.Super(), "clone_of")
+	if err != nil || origin == "" {
+		return err
+	}
+	registry := c.keys.volume(origin).Clones()
+	ctime, err := c.base.HGet(ctx, registry, c.Volume)
+	if err != nil {
+		return err
+	}
+	if err := c.base.HSet(ctx, registry, map[string]string{to.Volume: ctime}); err != nil {
+		return err
+	}
+	return c.base.HDel(ctx, registry, c.Volume)
+}
+
+// renameKeys moves every key of the volume from names to the volume to
+// names. The superblock goes last, so the volume only opens under its new
+// name once it is complete.
+func (c *Client) renameKeys(ctx context.Context, from, to *KeyGen) error {
+	err := c.scanVolume(ctx, from, "*", func(keys []string) error {
+		for _, key := range keys {
+			if key == from.Super() {
+				continue
+			}
+			err := c.base.Rename(ctx, key, to.Prefix()+strings.TrimPrefix(key, from.Prefix()))
+			// SCAN may return a key again after it was moved
+			if err != nil && err != ErrNotExist {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = c.base.Rename(ctx, from.Super(), to.Super())
+	if err == ErrNotExist {
+		// Still on the legacy layout
+		return nil
+	}
+	return err
+}
+
+// scanVolume calls fn with each batch of keys of the volume k names whose
+// name after the prefix matches glob, e.g. meta:*.
+func (c *Client) scanVolume(ctx context.Context, k *KeyGen, glob string, fn func(keys []string) error) error {
+	return c.base.Scan(ctx, k.pattern(glob), func(keys []string) error {
+		var own []string
+		for _, key := range keys {
+			if k.owns(key) {
+				own = append(own, key)
+			}
+		}
+		if len(own) == 0 {
+			return nil
+		}
+		return fn(own)
+	})
+}
+
+// dropKeys deletes every key of the volume k names.
+func (c *Client) dropKeys(ctx context.Context, k *KeyGen) error {
+	return c.scanVolume(ctx, k, "*", func(keys []string) error {
+		return c.base.Del(ctx, keys...)
+	})
+}
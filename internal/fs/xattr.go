@@ -0,0 +1,116 @@
+package fs
+
+import (
+	"context"
+)
+
+// Extended attributes are kept per inode in the xattr hash, as name/value
+// pairs. They belong to the entry itself: symlinks are not followed, and
+// the hash is deleted with the inode.
+
+// GetXattr returns the value of the extended attribute name of path.
+func (c *Client) GetXattr(ctx context.Context, path, name string) (string, error) {
+	if name == "" {
+		return "", pathErr("getfattr", path, ErrInvalid)
+	}
+	meta, err := c.xattrEntry(ctx, "getfattr", path, AccessRead)
+	if err != nil {
+		return "", err
+	}
+	value, err := c.store.HGet(ctx, c.keys.Xattr(meta.Ino), name)
+	if err != nil {
+		return "", pathErr("getfattr", path, err)
+	}
+	if value == "" {
+		// An empty value is stored, so tell it apart from a missing one
+		ok, err := c.store.HExists(ctx, c.keys.Xattr(meta.Ino), name)
+		if err != nil {
+			return "", pathErr("getfattr", path, err)
+		}
+		if !ok {
+			return "", pathErr("getfattr", path, ErrNoAttr)
+		}
+	}
+	return value, nil
+}
+
+// SetXattr sets the extended attribute name of path to value, creating or
+// replacing it.
+func (c *Client) SetXattr(ctx context.Context, path, name, value string) error {
+	if name == "" {
+		return pathErr("setfattr", path, ErrInvalid)
+	}
+	meta, err := c.xattrEntry(ctx, "setfattr", path, AccessWrite)
+	if err != nil {
+		return err
+	}
+	if err := c.store.HSet(ctx, c.keys.Xattr(meta.Ino), map[string]string{name: value}); err != nil {
+		return pathErr("setfattr", path, err)
+	}
+	return nil
+}
+
+// RemoveXattr removes the extended attribute name of path.
+func (c *Client) RemoveXattr(ctx context.Context, path, name string) error {
+	if name == "" {
+		return pathErr("setfattr", path, ErrInvalid)
+	}
+	meta, err := c.xattrEntry(ctx, "setfattr", path, AccessWrite)
+	if err != nil {
+		return err
+	}
+	ok, err := c.store.HExists(ctx, c.keys.Xattr(meta.Ino), name)
+	if err != nil {
+		return pathErr("setfattr", path, err)
+	}
+	if !ok {
+		return pathErr("setfattr", path, ErrNoAttr)
+	}
+	if err := c.store.HDel(ctx, c.keys.Xattr(meta.Ino), name); err != nil {
+		return pathErr("setfattr", path, err)
+	}
+	return nil
+}
+
+// ListXattr returns every extended attribute of path, by name.
+func (c *Client) ListXattr(ctx context.Context, path string) (map[string]string, error) {
+	meta, err := c.xattrEntry(ctx, "listxattr", path, AccessRead)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := c.store.HGetAll(ctx, c.keys.Xattr(meta.Ino))
+	if err != nil {
+		return nil, pathErr("listxattr", path, err)
+	}
+	return attrs, nil
+}
+
+// xattrEntry resolves path for an xattr operation and checks the requested
+// access to the entry.
+func (c *Client) xattrEntry(ctx context.Context, op, path string, want int) (*Metadata, error) {
+	path = NormalizePath(path)
+	meta, err := c.Stat(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, pathErr(op, path, ErrNotExist)
+	}
+	if err := c.access(op, path, meta, want); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// copyXattrs replaces the extended attributes of dstIno with those of
+// srcIno.
+func (c *Client) copyXattrs(ctx context.Context, srcIno, dstIno string) error {
+	attrs, err := c.store.HGetAll(ctx, c.keys.Xattr(srcIno))
+	if err != nil {
+		return err
+	}
+	return c.store.Tx(ctx, func(tx Writer) {
+		tx.Del(c.keys.Xattr(dstIno))
+		tx.HSet(c.keys.Xattr(dstIno), attrs)
+	})
+}
@@ -141,6 +141,7 @@ func (f *Formatter) PrintLsLong(entries []fs.DirEntry, showAll bool) {
 			if e.Meta != nil {
 				entry["type"] = string(e.Meta.Type)
 				entry["mode"] = e.Meta.Mode
+				entry["nlink"] = e.Meta.Nlink
 				entry["uid"] = e.Meta.UID
 				entry["gid"] = e.Meta.GID
 				entry["size"] = e.Meta.Size
@@ -157,15 +158,16 @@ func (f *Formatter) PrintLsLong(entries []fs.DirEntry, showAll bool) {
 			continue
 		}
 		if e.Meta == nil {
-			fmt.Fprintf(f.Writer, "?????????? ? ? ? ? %s\n", e.Name)
+			fmt.Fprintf(f.Writer, "?????????? ? ? ? ? ? %s\n", e.Name)
 			continue
 		}
 		name := f.FormatEntryName(e.Name, e.Meta.Type)
 		if e.Meta.Type == fs.TypeSymlink && e.Meta.LinkTarget != "" {
 			name = name + " -> " + e.Meta.LinkTarget
 		}
-		fmt.Fprintf(f.Writer, "%s %s %s %6s %s %s\n",
+		fmt.Fprintf(f.Writer, "%s %2d %s %s %6s %s %s\n",
 			e.Meta.ModeString(),
+			e.Meta.Nlink,
 			e.Meta.UID,
 			e.Meta.GID,
 			fs.FormatSize(e.Meta.Size),
@@ -177,13 +179,16 @@ func (f *Formatter) PrintLsLong(entries []fs.DirEntry, showAll bool) {
 
 // --- stat output ---
 
-// PrintStat prints file/directory metadata.
-func (f *Formatter) PrintStat(path string, meta *fs.Metadata) {
+// PrintStat prints file/directory metadata. Extended attributes are only
+// included in JSON output.
+func (f *Formatter) PrintStat(path string, meta *fs.Metadata, xattrs map[string]string) {
 	if f.JSON {
 		result := map[string]interface{}{
 			"path":  path,
+			"inode": meta.Ino,
 			"type":  string(meta.Type),
 			"mode":  meta.Mode,
+			"nlink": meta.Nlink,
 			"uid":   meta.UID,
 			"gid":   meta.GID,
 			"size":  meta.Size,
@@ -194,20 +199,37 @@ func (f *Formatter) PrintStat(path string, meta *fs.Metadata) {
 		if meta.LinkTarget != "" {
 			result["link_target"] = meta.LinkTarget
 		}
+		if meta.Type == fs.TypeFile {
+			result["chunks"] = meta.Chunks
+		}
+		if len(meta.Tags) > 0 {
+			result["tags"] = meta.Tags
+		}
+		if len(xattrs) > 0 {
+			result["xattrs"] = xattrs
+		}
 		f.PrintJSON(result)
 		return
 	}
 
 	fmt.Fprintf(f.Writer, "  File: %s\n", path)
 	fmt.Fprintf(f.Writer, "  Type: %s\n", meta.Type)
+	fmt.Fprintf(f.Writer, " Inode: %s\n", meta.Ino)
 	fmt.Fprintf(f.Writer, "  Mode: %s (%s)\n", meta.ModeString(), meta.Mode)
+	fmt.Fprintf(f.Writer, " Links: %d\n", meta.Nlink)
 	fmt.Fprintf(f.Writer, "   UID: %s\n", meta.UID)
 	fmt.Fprintf(f.Writer, "   GID: %s\n", meta.GID)
 	fmt.Fprintf(f.Writer, "  Size: %d\n", meta.Size)
+	if meta.Chunks > 0 {
+		fmt.Fprintf(f.Writer, "Chunks: %d (%d bytes each)\n", meta.Chunks, meta.ChunkSize)
+	}
 	fmt.Fprintf(f.Writer, " CTime: %s\n", fs.FormatTime(meta.CTime))
 	fmt.Fprintf(f.Writer, " MTime: %s\n", fs.FormatTime(meta.MTime))
 	fmt.Fprintf(f.Writer, " ATime: %s\n", fs.FormatTime(meta.ATime))
 	if meta.LinkTarget != "" {
 		fmt.Fprintf(f.Writer, "  Link: %s\n", meta.LinkTarget)
 	}
+	if len(meta.Tags) > 0 {
+		fmt.Fprintf(f.Writer, "  Tags: %s\n", strings.Join(meta.Tags, ", "))
+	}
 }
@@ -8,7 +8,7 @@ import (
 
 // DetectSearch checks if Redis search (FT.*) commands are available.
 // Returns true for Redis 8.0+ (built-in) or older Redis with RediSearch module.
-func DetectSearch(ctx context.Context, rdb *redis.Client) bool {
+func DetectSearch(ctx context.Context, rdb redis.UniversalClient) bool {
 	_, err := rdb.Do(ctx, "FT._LIST").Result()
 	return err == nil
 }
@@ -9,12 +9,13 @@ import (
 
 // IndexManager handles FT index lifecycle (create, drop, info).
 type IndexManager struct {
-	rdb    *redis.Client
-	volume string
+	rdb      redis.UniversalClient
+	volume   string
+	hashTags bool
 }
 
 // NewIndexManager creates a new IndexManager for the given volume.
-func NewIndexManager(rdb *redis.Client, volume string) *IndexManager {
+func NewIndexManager(rdb redis.UniversalClient, volume string) *IndexManager {
 	return &IndexManager{rdb: rdb, volume: volume}
 }
 
@@ -25,6 +26,9 @@ func (m *IndexManager) IndexName() string {
 
 // IdxPrefix returns the key prefix for index HASH keys.
 func (m *IndexManager) IdxPrefix() string {
+	if m.hashTags {
+		return fmt.Sprintf("fs:{%s}:idx:", m.volume)
+	}
 	return fmt.Sprintf("fs:%s:idx:", m.volume)
 }
 
@@ -41,6 +45,7 @@ func (m *IndexManager) CreateIndex(ctx context.Context, withVector bool, dim int
 		"filename", "TEXT", "WEIGHT", "0.5",
 		"mtime", "NUMERIC", "SORTABLE",
 		"size", "NUMERIC", "SORTABLE",
+		"tags", "TAG", "SEPARATOR", ",",
 	}
 
 	if withVector {
@@ -89,23 +94,47 @@ func (m *IndexManager) IndexInfo(ctx context.Context) (map[string]interface{}, e
 	return parseInfoResult(result), nil
 }
 
-// EnsureIndex creates the index if it doesn't already exist.
+// EnsureIndex creates the index if it doesn't already exist. An existing
+// index created before tags were indexed gains the tags field.
 func (m *IndexManager) EnsureIndex(ctx context.Context, withVector bool, dim int) error {
 	exists, err := m.IndexExists(ctx)
 	if err != nil {
 		return err
 	}
 	if exists {
-		return nil
+		return m.ensureTagsField(ctx)
 	}
 	return m.CreateIndex(ctx, withVector, dim)
 }
 
+// ensureTagsField adds the tags field to an index that lacks it.
+func (m *IndexManager) ensureTagsField(ctx context.Context) error {
+	info, err := m.IndexInfo(ctx)
+	if err != nil {
+		return err
+	}
+	attrs, ok := info["attributes"].([]interface{})
+	if !ok || hasAttribute(attrs, "tags") {
+		return nil
+	}
+	_, err = m.rdb.Do(ctx, "FT.ALTER", m.IndexName(), "SCHEMA", "ADD", "tags", "TAG", "SEPARATOR", ",").Result()
+	if err != nil {
+		return fmt.Errorf("FT.ALTER: %w", err)
+	}
+	return nil
+}
+
 // SetVolume updates the volume for this manager.
 func (m *IndexManager) SetVolume(volume string) {
 	m.volume = volume
 }
 
+// SetHashTags switches index keys to the cluster hash tag layout
+// (fs:{vol}:idx:...), matching fs.Client.SetHashTags.
+func (m *IndexManager) SetHashTags(enabled bool) {
+	m.hashTags = enabled
+}
+
 func isIndexNotFoundError(err error) bool {
 	if err == nil {
 		return false
@@ -114,6 +143,17 @@ func isIndexNotFoundError(err error) bool {
 	return msg == "Unknown index name" || msg == "Unknown Index name"
 }
 
+// hasAttribute reports whether the FT.INFO attribute list declares the
+// field name. Each attribute is a flat key-value list.
+func hasAttribute(attrs []interface{}, name string) bool {
+	for _, a := range attrs {
+		if parseInfoResult(a)["identifier"] == name {
+			return true
+		}
+	}
+	return false
+}
+
 // parseInfoResult converts FT.INFO result (flat key-value list) into a map.
 func parseInfoResult(result interface{}) map[string]interface{} {
 	info := make(map[string]interface{})
@@ -16,15 +16,15 @@ import (
 // Indexer maintains the search index in sync with file mutations.
 // It implements fs.FileObserver.
 type Indexer struct {
-	rdb       *redis.Client
-	mgr       *IndexManager
-	volume    string
-	embedder  *embedding.Client
-	embedDim  int
+	rdb      redis.UniversalClient
+	mgr      *IndexManager
+	volume   string
+	embedder *embedding.Client
+	embedDim int
 }
 
 // NewIndexer creates a new Indexer for the given volume.
-func NewIndexer(rdb *redis.Client, volume string) *Indexer {
+func NewIndexer(rdb redis.UniversalClient, volume string) *Indexer {
 	return &Indexer{
 		rdb:    rdb,
 		mgr:    NewIndexManager(rdb, volume),
@@ -44,6 +44,11 @@ func (idx *Indexer) SetVolume(volume string) {
 	idx.mgr.SetVolume(volume)
 }
 
+// SetHashTags switches index keys to the cluster hash tag layout.
+func (idx *Indexer) SetHashTags(enabled bool) {
+	idx.mgr.SetHashTags(enabled)
+}
+
 // Manager returns the underlying IndexManager.
 func (idx *Indexer) Manager() *IndexManager {
 	return idx.mgr
@@ -96,6 +101,17 @@ func (idx *Indexer) OnFileRemove(ctx context.Context, filePath string) error {
 
 // OnFileMove updates the index when a file is moved.
 func (idx *Indexer) OnFileMove(ctx context.Context, oldPath, newPath string) error {
+	return idx.copyEntry(ctx, oldPath, newPath, true)
+}
+
+// OnLink indexes a new hard link with the content of the file it links to.
+func (idx *Indexer) OnLink(ctx context.Context, oldPath, newPath string) error {
+	return idx.copyEntry(ctx, oldPath, newPath, false)
+}
+
+// copyEntry indexes newPath with the content and tags indexed for oldPath,
+// dropping oldPath when move is set.
+func (idx *Indexer) copyEntry(ctx context.Context, oldPath, newPath string, move bool) error {
 	oldKey := idx.idxKey(oldPath)
 	newKey := idx.idxKey(newPath)
 
@@ -105,28 +121,35 @@ func (idx *Indexer) OnFileMove(ctx context.Context, oldPath, newPath string) err
 		return nil
 	}
 
-	// Get old content and re-index at new path
-	content, err := idx.rdb.HGet(ctx, oldKey, "content").Result()
+	// Get old content and tags and re-index at new path
+	vals, err := idx.rdb.HMGet(ctx, oldKey, "content", "tags").Result()
 	if err != nil {
 		return nil
 	}
-
-	pipe := idx.rdb.TxPipeline()
-	pipe.Del(ctx, oldKey)
-	pipe.HSet(ctx, newKey, map[string]interface{}{
+	content, _ := vals[0].(string)
+	fields := map[string]interface{}{
 		"content":  content,
 		"path":     newPath,
 		"dir":      parentDir(newPath),
 		"filename": path.Base(newPath),
 		"mtime":    strconv.FormatInt(time.Now().Unix(), 10),
 		"size":     strconv.Itoa(len(content)),
-	})
+	}
+	if tags, ok := vals[1].(string); ok && tags != "" {
+		fields["tags"] = tags
+	}
+
+	pipe := idx.rdb.TxPipeline()
+	if move {
+		pipe.Del(ctx, oldKey)
+	}
+	pipe.HSet(ctx, newKey, fields)
 	_, err = pipe.Exec(ctx)
 	if err != nil {
 		return err
 	}
 
-	// Re-embed at new path asynchronously
+	// Embed at the new path asynchronously
 	if idx.embedder != nil {
 		go idx.asyncEmbed(newPath, content)
 	}
@@ -134,6 +157,48 @@ func (idx *Indexer) OnFileMove(ctx context.Context, oldPath, newPath string) err
 	return nil
 }
 
+// OnChunkedWrite drops a file that grew too large to index.
+func (idx *Indexer) OnChunkedWrite(ctx context.Context, filePath string, size int64) error {
+	return idx.OnFileRemove(ctx, filePath)
+}
+
+// OnMkdir, OnRmdir, OnSymlink, OnChmod and OnChown leave the index alone:
+// it holds regular files only, and removing a directory reports its files.
+
+func (idx *Indexer) OnMkdir(ctx context.Context, dirPath string) error {
+	return nil
+}
+
+func (idx *Indexer) OnRmdir(ctx context.Context, dirPath string) error {
+	return nil
+}
+
+func (idx *Indexer) OnSymlink(ctx context.Context, linkPath, target string) error {
+	return nil
+}
+
+func (idx *Indexer) OnChmod(ctx context.Context, filePath, mode string) error {
+	return nil
+}
+
+func (idx *Indexer) OnChown(ctx context.Context, filePath, uid, gid string) error {
+	return nil
+}
+
+// OnTagsChange records the tags of an indexed file. Files that are not
+// indexed are left alone; reindex picks up their tags.
+func (idx *Indexer) OnTagsChange(ctx context.Context, filePath string, tags []string) error {
+	key := idx.idxKey(filePath)
+	exists, err := idx.rdb.Exists(ctx, key).Result()
+	if err != nil || exists == 0 {
+		return nil
+	}
+	if len(tags) == 0 {
+		return idx.rdb.HDel(ctx, key, "tags").Err()
+	}
+	return idx.rdb.HSet(ctx, key, "tags", strings.Join(tags, ",")).Err()
+}
+
 // IndexFile indexes a single file with the given content and metadata.
 // Used by reindex for bulk indexing.
 func (idx *Indexer) IndexFile(ctx context.Context, filePath, content string, mtime int64, size int64) error {
@@ -213,7 +278,7 @@ func (idx *Indexer) asyncEmbed(filePath, content string) {
 }
 
 func (idx *Indexer) idxKey(filePath string) string {
-	return fmt.Sprintf("fs:%s:idx:%s", idx.volume, filePath)
+	return idx.mgr.IdxPrefix() + filePath
 }
 
 func parentDir(filePath string) string {
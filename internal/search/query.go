@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/rowantrollope/redis-fs-cli/internal/embedding"
@@ -45,14 +46,10 @@ func EscapeQuery(s string) string {
 	return result
 }
 
-// SearchFullText performs a full-text search using FT.SEARCH.
-func SearchFullText(ctx context.Context, rdb *redis.Client, indexName, pattern, dirFilter string, limit int) ([]SearchResult, error) {
-	query := EscapeQuery(pattern)
-
-	if dirFilter != "" && dirFilter != "/" {
-		escapedDir := strings.ReplaceAll(dirFilter, "/", "\\/")
-		query = fmt.Sprintf("@dir:{%s*} %s", escapedDir, query)
-	}
+// SearchFullText performs a full-text search using FT.SEARCH, restricted
+// to files carrying every tag in tags.
+func SearchFullText(ctx context.Context, rdb redis.UniversalClient, indexName, pattern, dirFilter string, limit int, tags ...string) ([]SearchResult, error) {
+	query := fullTextQuery(pattern, dirFilter, tags)
 
 	args := []interface{}{
 		"FT.SEARCH", indexName, query,
@@ -68,40 +65,39 @@ func SearchFullText(ctx context.Context, rdb *redis.Client, indexName, pattern,
 	return parseSearchResults(result)
 }
 
+// fullTextQuery builds the query for a full-text search, with the
+// directory and tag filters ahead of the terms.
+func fullTextQuery(pattern, dirFilter string, tags []string) string {
+	var filters []string
+	if dirFilter != "" && dirFilter != "/" {
+		escapedDir := strings.ReplaceAll(dirFilter, "/", "\\/")
+		filters = append(filters, fmt.Sprintf("@dir:{%s*}", escapedDir))
+	}
+	for _, tag := range tags {
+		filters = append(filters, fmt.Sprintf("@tags:{%s}", EscapeTag(tag)))
+	}
+	return strings.Join(append(filters, EscapeQuery(pattern)), " ")
+}
+
 // HybridSearchOptions controls hybrid vector + full-text search.
 type HybridSearchOptions struct {
 	QueryText   string    // text to embed for vector search
 	QueryVector []float32 // pre-computed query embedding
 	TextFilter  string    // optional full-text filter terms
 	DirFilter   string    // optional directory filter
+	Tags        []string  // optional tags, all of which must match
 	TopK        int       // number of results to return
 }
 
 // SearchHybrid performs a hybrid search combining vector KNN with optional
 // full-text filtering and directory scoping.
-func SearchHybrid(ctx context.Context, rdb *redis.Client, indexName string, opts HybridSearchOptions) ([]SearchResult, error) {
+func SearchHybrid(ctx context.Context, rdb redis.UniversalClient, indexName string, opts HybridSearchOptions) ([]SearchResult, error) {
 	if opts.TopK <= 0 {
 		opts.TopK = 10
 	}
 
-	// Build the pre-filter query
-	preFilter := "*"
-	var filters []string
-
-	if opts.DirFilter != "" && opts.DirFilter != "/" {
-		escapedDir := strings.ReplaceAll(opts.DirFilter, "/", "\\/")
-		filters = append(filters, fmt.Sprintf("@dir:{%s*}", escapedDir))
-	}
-
-	if opts.TextFilter != "" {
-		filters = append(filters, EscapeQuery(opts.TextFilter))
-	}
-
-	if len(filters) > 0 {
-		preFilter = "(" + strings.Join(filters, " ") + ")"
-	}
-
 	// Build KNN query
+	preFilter := hybridPreFilter(opts)
 	query := fmt.Sprintf("%s=>[KNN %d @embedding $vec AS vector_score]",
 		preFilter, opts.TopK)
 
@@ -124,6 +120,42 @@ func SearchHybrid(ctx context.Context, rdb *redis.Client, indexName string, opts
 	return parseSearchResultsWithScore(result)
 }
 
+// hybridPreFilter builds the query that narrows the KNN candidates.
+func hybridPreFilter(opts HybridSearchOptions) string {
+	var filters []string
+
+	if opts.DirFilter != "" && opts.DirFilter != "/" {
+		escapedDir := strings.ReplaceAll(opts.DirFilter, "/", "\\/")
+		filters = append(filters, fmt.Sprintf("@dir:{%s*}", escapedDir))
+	}
+
+	for _, tag := range opts.Tags {
+		filters = append(filters, fmt.Sprintf("@tags:{%s}", EscapeTag(tag)))
+	}
+
+	if opts.TextFilter != "" {
+		filters = append(filters, EscapeQuery(opts.TextFilter))
+	}
+
+	if len(filters) == 0 {
+		return "*"
+	}
+	return "(" + strings.Join(filters, " ") + ")"
+}
+
+// EscapeTag escapes a value for use inside a TAG query ({...}), where
+// punctuation and spaces must be backslash-escaped.
+func EscapeTag(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 func parseSearchResults(result interface{}) ([]SearchResult, error) {
 	slice, ok := result.([]interface{})
 	if !ok || len(slice) < 1 {
@@ -55,3 +55,45 @@ func TestEscapeQuery(t *testing.T) {
 		}
 	}
 }
+
+func TestHybridPreFilter(t *testing.T) {
+	tests := []struct {
+		opts HybridSearchOptions
+		want string
+	}{
+		{HybridSearchOptions{}, "*"},
+		{HybridSearchOptions{DirFilter: "/"}, "*"},
+		{HybridSearchOptions{DirFilter: "/docs"}, "(@dir:{\\/docs*})"},
+		{HybridSearchOptions{Tags: []string{"draft"}}, "(@tags:{draft})"},
+		{HybridSearchOptions{Tags: []string{"q1-2024", "team a"}}, "(@tags:{q1\\-2024} @tags:{team\\ a})"},
+		{HybridSearchOptions{DirFilter: "/docs", Tags: []string{"draft"}, TextFilter: "redis"}, "(@dir:{\\/docs*} @tags:{draft} redis)"},
+	}
+
+	for _, tt := range tests {
+		got := hybridPreFilter(tt.opts)
+		if got != tt.want {
+			t.Errorf("hybridPreFilter(%+v) = %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestFullTextQuery(t *testing.T) {
+	tests := []struct {
+		pattern, dir string
+		tags         []string
+		want         string
+	}{
+		{"redis", "", nil, "redis"},
+		{"redis", "/", nil, "redis"},
+		{"redis", "/docs", nil, "@dir:{\\/docs*} redis"},
+		{"redis", "", []string{"draft"}, "@tags:{draft} redis"},
+		{"a.b", "/docs", []string{"q1-2024", "team a"}, "@dir:{\\/docs*} @tags:{q1\\-2024} @tags:{team\\ a} a\\.b"},
+	}
+
+	for _, tt := range tests {
+		got := fullTextQuery(tt.pattern, tt.dir, tt.tags)
+		if got != tt.want {
+			t.Errorf("fullTextQuery(%q, %q, %q) = %q, want %q", tt.pattern, tt.dir, tt.tags, got, tt.want)
+		}
+	}
+}
@@ -20,13 +20,14 @@ type FileEntry struct {
 	Content string
 	MTime   int64
 	Size    int64
+	Tags    []string
 }
 
 // FileWalker is a function that walks the filesystem and returns files.
 type FileWalker func(ctx context.Context, root string) ([]FileEntry, error)
 
 // Reindex rebuilds the index for all files under root.
-func Reindex(ctx context.Context, rdb *redis.Client, indexer *Indexer, walker FileWalker, opts ReindexOptions) (int, error) {
+func Reindex(ctx context.Context, rdb redis.UniversalClient, indexer *Indexer, walker FileWalker, opts ReindexOptions) (int, error) {
 	mgr := indexer.Manager()
 
 	if opts.Root == "" {
@@ -64,7 +65,11 @@ func Reindex(ctx context.Context, rdb *redis.Client, indexer *Indexer, walker Fi
 
 	indexed := 0
 	for _, f := range files {
-		if err := indexer.IndexFile(ctx, f.Path, f.Content, f.MTime, f.Size); err != nil {
+		err := indexer.IndexFile(ctx, f.Path, f.Content, f.MTime, f.Size)
+		if err == nil {
+			err = indexer.OnTagsChange(ctx, f.Path, f.Tags)
+		}
+		if err != nil {
 			// Log but continue
 			if opts.Progress != nil {
 				opts.Progress(indexed, fmt.Sprintf("error: %s: %v", f.Path, err))
@@ -82,7 +87,7 @@ func Reindex(ctx context.Context, rdb *redis.Client, indexer *Indexer, walker Fi
 
 // ReindexWithVector is like Reindex but creates the index with vector support
 // and generates embeddings for each file using the indexer's embedding client.
-func ReindexWithVector(ctx context.Context, rdb *redis.Client, indexer *Indexer, walker FileWalker, opts ReindexOptions, dim int) (int, error) {
+func ReindexWithVector(ctx context.Context, rdb redis.UniversalClient, indexer *Indexer, walker FileWalker, opts ReindexOptions, dim int) (int, error) {
 	mgr := indexer.Manager()
 
 	if opts.Root == "" {
@@ -116,7 +121,11 @@ func ReindexWithVector(ctx context.Context, rdb *redis.Client, indexer *Indexer,
 
 	indexed := 0
 	for _, f := range files {
-		if err := indexer.IndexFileWithEmbedding(ctx, f.Path, f.Content); err != nil {
+		err := indexer.IndexFileWithEmbedding(ctx, f.Path, f.Content)
+		if err == nil {
+			err = indexer.OnTagsChange(ctx, f.Path, f.Tags)
+		}
+		if err != nil {
 			if opts.Progress != nil {
 				opts.Progress(indexed, fmt.Sprintf("error: %s: %v", f.Path, err))
 			}
@@ -131,15 +140,30 @@ func ReindexWithVector(ctx context.Context, rdb *redis.Client, indexer *Indexer,
 	return indexed, nil
 }
 
-func cleanIdxKeys(ctx context.Context, rdb *redis.Client, prefix string) error {
+// cleanIdxKeys deletes every key under prefix. On a cluster each master is
+// scanned, and keys are deleted one per DEL so no command spans slots.
+func cleanIdxKeys(ctx context.Context, rdb redis.UniversalClient, prefix string) error {
+	if cluster, ok := rdb.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return cleanNodeIdxKeys(ctx, node, rdb, prefix)
+		})
+	}
+	return cleanNodeIdxKeys(ctx, rdb, rdb, prefix)
+}
+
+func cleanNodeIdxKeys(ctx context.Context, node redis.Cmdable, rdb redis.UniversalClient, prefix string) error {
 	var cursor uint64
 	for {
-		keys, nextCursor, err := rdb.Scan(ctx, cursor, prefix+"*", 100).Result()
+		keys, nextCursor, err := node.Scan(ctx, cursor, prefix+"*", 100).Result()
 		if err != nil {
 			return err
 		}
 		if len(keys) > 0 {
-			rdb.Del(ctx, keys...)
+			pipe := rdb.Pipeline()
+			for _, key := range keys {
+				pipe.Del(ctx, key)
+			}
+			pipe.Exec(ctx)
 		}
 		cursor = nextCursor
 		if cursor == 0 {
@@ -0,0 +1,196 @@
+package redisfs
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/api.txt")
+
+// apiTypes maps every exported type of the package to its reflect.Type.
+// Most are aliases of internal types, so their methods and fields would
+// change with any internal refactor; TestAPI pins them.
+var apiTypes = map[string]reflect.Type{
+	"ArchiveFormat":       reflect.TypeFor[ArchiveFormat](),
+	"Backend":             reflect.TypeFor[Backend](),
+	"Client":              reflect.TypeFor[Client](),
+	"DirEntry":            reflect.TypeFor[DirEntry](),
+	"DuEntry":             reflect.TypeFor[DuEntry](),
+	"Embedder":            reflect.TypeFor[Embedder](),
+	"EmbeddingConfig":     reflect.TypeFor[EmbeddingConfig](),
+	"EntryType":           reflect.TypeFor[EntryType](),
+	"Errno":               reflect.TypeFor[Errno](),
+	"EventStream":         reflect.TypeFor[EventStream](),
+	"File":                reflect.TypeFor[File](),
+	"FileInfo":            reflect.TypeFor[FileInfo](),
+	"FileObserver":        reflect.TypeFor[FileObserver](),
+	"FindEntry":           reflect.TypeFor[FindEntry](),
+	"FindOptions":         reflect.TypeFor[FindOptions](),
+	"HybridSearchOptions": reflect.TypeFor[HybridSearchOptions](),
+	"Identity":            reflect.TypeFor[Identity](),
+	"IdentityObserver":    reflect.TypeFor[IdentityObserver](),
+	"IndexManager":        reflect.TypeFor[IndexManager](),
+	"Indexer":             reflect.TypeFor[Indexer](),
+	"KeyGen":              reflect.TypeFor[KeyGen](),
+	"KeyRange":            reflect.TypeFor[KeyRange](),
+	"MemoryBackend":       reflect.TypeFor[MemoryBackend](),
+	"Metadata":            reflect.TypeFor[Metadata](),
+	"NopObserver":         reflect.TypeFor[NopObserver](),
+	"Options":             reflect.TypeFor[Options](),
+	"PathError":           reflect.TypeFor[PathError](),
+	"RedisBackend":        reflect.TypeFor[RedisBackend](),
+	"SearchResult":        reflect.TypeFor[SearchResult](),
+	"Snapshot":            reflect.TypeFor[Snapshot](),
+	"TagObserver":         reflect.TypeFor[TagObserver](),
+	"TreeEntry":           reflect.TypeFor[TreeEntry](),
+	"Version":             reflect.TypeFor[Version](),
+	"VersionPolicy":       reflect.TypeFor[VersionPolicy](),
+	"VolumeFS":            reflect.TypeFor[VolumeFS](),
+	"VolumeInfo":          reflect.TypeFor[VolumeInfo](),
+	"VolumeObserver":      reflect.TypeFor[VolumeObserver](),
+	"Writer":              reflect.TypeFor[Writer](),
+}
+
+// TestAPI compares the exported API, including the methods and fields of
+// aliased types, with testdata/api.txt. After an intended change, run
+//
+//	go test ./pkg/redisfs -run TestAPI -update
+//
+// and review the diff of the file.
+func TestAPI(t *testing.T) {
+	got, names := describeAPI(t)
+	for _, name := range names {
+		if _, ok := apiTypes[name]; !ok {
+			t.Errorf("type %s is missing from apiTypes", name)
+		}
+	}
+
+	if *update {
+		if err := os.WriteFile("testdata/api.txt", []byte(strings.Join(got, "\n")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	data, err := os.ReadFile("testdata/api.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for _, line := range want {
+		if !slices.Contains(got, line) {
+			t.Errorf("removed: %s", line)
+		}
+	}
+	for _, line := range got {
+		if !slices.Contains(want, line) {
+			t.Errorf("added: %s", line)
+		}
+	}
+}
+
+// describeAPI returns one sorted line per exported declaration, method and
+// field, and the names of the exported types.
+func describeAPI(t *testing.T) (lines, types []string) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := func(n ast.Node) string {
+		var buf bytes.Buffer
+		printer.Fprint(&buf, fset, n)
+		return buf.String()
+	}
+
+	for _, f := range pkgs["redisfs"].Files {
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Name.IsExported() && d.Recv == nil {
+					sig := strings.TrimPrefix(node(d.Type), "func")
+					lines = append(lines, "func "+d.Name.Name+sig)
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						if s.Name.IsExported() {
+							types = append(types, s.Name.Name)
+						}
+					case *ast.ValueSpec:
+						for _, name := range s.Names {
+							if name.IsExported() {
+								lines = append(lines, d.Tok.String()+" "+name.Name)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for _, name := range types {
+		typ := apiTypes[name]
+		if typ == nil {
+			continue
+		}
+		lines = append(lines, "type "+name+" "+typ.Kind().String())
+		methods := reflect.PointerTo(typ)
+		if typ.Kind() == reflect.Interface {
+			methods = typ
+		}
+		for i := range methods.NumMethod() {
+			m := methods.Method(i)
+			lines = append(lines, fmt.Sprintf("method %s.%s%s", name, m.Name, signature(m.Type, typ.Kind() != reflect.Interface)))
+		}
+		if typ.Kind() == reflect.Struct {
+			for i := range typ.NumField() {
+				if f := typ.Field(i); f.IsExported() {
+					lines = append(lines, fmt.Sprintf("field %s.%s %s", name, f.Name, f.Type))
+				}
+			}
+		}
+	}
+	slices.Sort(lines)
+	return lines, types
+}
+
+// signature formats a method's parameters and results, leaving out the
+// receiver when the function type includes it.
+func signature(fn reflect.Type, recv bool) string {
+	var in, out []string
+	for i := range fn.NumIn() {
+		if i == 0 && recv {
+			continue
+		}
+		if fn.IsVariadic() && i == fn.NumIn()-1 {
+			in = append(in, "..."+fn.In(i).Elem().String())
+		} else {
+			in = append(in, fn.In(i).String())
+		}
+	}
+	for i := range fn.NumOut() {
+		out = append(out, fn.Out(i).String())
+	}
+	sig := "(" + strings.Join(in, ", ") + ")"
+	switch len(out) {
+	case 0:
+	case 1:
+		sig += " " + out[0]
+	default:
+		sig += " (" + strings.Join(out, ", ") + ")"
+	}
+	return sig
+}
@@ -0,0 +1,32 @@
+package redisfs
+
+import "github.com/rowantrollope/redis-fs-cli/internal/fs"
+
+// PathError records a failed operation on a path. Use errors.Is with the
+// Err* values below, or with the io/fs sentinels, to branch on the cause:
+//
+//	if errors.Is(err, redisfs.ErrNotExist) { ... }
+//	if errors.Is(err, fs.ErrNotExist) { ... } // same result
+type PathError = fs.PathError
+
+// Errno is a POSIX error condition carried by a PathError.
+type Errno = fs.Errno
+
+// Error conditions. ErrNotExist, ErrExist, ErrPermission and ErrInvalid
+// also match their io/fs counterparts.
+var (
+	ErrNotExist     = fs.ErrNotExist
+	ErrExist        = fs.ErrExist
+	ErrPermission   = fs.ErrPermission
+	ErrInvalid      = fs.ErrInvalid
+	ErrNotDir       = fs.ErrNotDir
+	ErrIsDir        = fs.ErrIsDir
+	ErrNotEmpty     = fs.ErrNotEmpty
+	ErrLoop         = fs.ErrLoop
+	ErrBusy         = fs.ErrBusy
+	ErrBadFD        = fs.ErrBadFD
+	ErrStale        = fs.ErrStale
+	ErrNoAttr       = fs.ErrNoAttr
+	ErrNotPermitted = fs.ErrNotPermitted
+	ErrReadOnly     = fs.ErrReadOnly
+)
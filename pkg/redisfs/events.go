@@ -0,0 +1,18 @@
+package redisfs
+
+import (
+	"github.com/redis/go-redis/v9"
+	"github.com/rowantrollope/redis-fs-cli/internal/events"
+)
+
+// EventStream publishes a volume's mutations to the Redis stream
+// fs:<volume>:events; it is a FileObserver.
+type EventStream = events.Stream
+
+// DefaultEventsMaxLen is the default number of events a stream keeps.
+const DefaultEventsMaxLen = events.DefaultMaxLen
+
+// NewEventStream returns an EventStream for volume.
+func NewEventStream(rdb redis.UniversalClient, volume string) *EventStream {
+	return events.NewStream(rdb, volume)
+}
@@ -0,0 +1,259 @@
+// Package redisfs is the public Go API of redis-fs-cli: a POSIX-like
+// filesystem stored in Redis, with optional full-text and vector search.
+//
+// The types are aliases of the ones the CLI itself uses, so the tool and
+// the library share one implementation:
+//
+//	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	c, err := redisfs.New(ctx, rdb, redisfs.Options{Volume: "main"})
+//	if err != nil {
+//		return err
+//	}
+//	err = c.WriteFile(ctx, "/notes/todo.txt", "buy milk\n")
+//
+// A Client operates on one volume at a time (see Client.SetVolume). Paths
+// are absolute and slash-separated. Besides the string-based calls, a
+// Client offers os.File-style handles (Client.Open, Client.Create) and an
+// io/fs view of the volume (NewVolumeFS).
+//
+// Volumes normally live in Redis, but NewWithBackend accepts any Backend;
+// a MemoryBackend gives a working filesystem without a server, which is
+// handy in tests.
+package redisfs
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rowantrollope/redis-fs-cli/internal/fs"
+)
+
+// Filesystem types. Their methods and fields are part of this package's
+// API even though they are declared in internal/fs; testdata/api.txt pins
+// them, so a change there shows up as a failing TestAPI.
+type (
+	// Client provides filesystem operations on a volume.
+	Client = fs.Client
+	// Metadata holds the metadata of a file, directory or symlink.
+	Metadata = fs.Metadata
+	// EntryType is the type of a filesystem entry.
+	EntryType = fs.EntryType
+	// DirEntry is a directory listing entry with metadata.
+	DirEntry = fs.DirEntry
+	// FindEntry is a result of Client.Find.
+	FindEntry = fs.FindEntry
+	// FindOptions selects the entries of Client.FindWith.
+	FindOptions = fs.FindOptions
+	// DuEntry is a result of Client.DiskUsage.
+	DuEntry = fs.DuEntry
+	// VersionPolicy says which revisions of each file versioning keeps.
+	VersionPolicy = fs.VersionPolicy
+	// Version is a recorded revision of a file, from Client.History.
+	Version = fs.Version
+	// VolumeInfo describes a volume, from Client.VolumeInfo.
+	VolumeInfo = fs.VolumeInfo
+	// Snapshot describes a snapshot of a volume, from Client.Snapshots.
+	Snapshot = fs.Snapshot
+	// TreeEntry is a node of Client.Tree.
+	TreeEntry = fs.TreeEntry
+	// File is an open file handle in the style of os.File.
+	File = fs.File
+	// FileInfo implements io/fs.FileInfo for an entry.
+	FileInfo = fs.FileInfo
+	// VolumeFS implements io/fs.FS and friends over a volume.
+	VolumeFS = fs.VolumeFS
+	// FileObserver receives notifications of file mutations.
+	FileObserver = fs.FileObserver
+	// TagObserver is implemented by observers that track file tags.
+	TagObserver = fs.TagObserver
+	// VolumeObserver is implemented by observers told of volume switches.
+	VolumeObserver = fs.VolumeObserver
+	// IdentityObserver is implemented by observers told the client's user.
+	IdentityObserver = fs.IdentityObserver
+	// NopObserver ignores every notification; embed it in observers.
+	NopObserver = fs.NopObserver
+	// KeyGen generates the Redis key names of a volume.
+	KeyGen = fs.KeyGen
+	// ArchiveFormat is the format of Client.ExportArchive and
+	// Client.ImportArchive.
+	ArchiveFormat = fs.ArchiveFormat
+
+	// Identity is the user a Client acts as for permission checks.
+	Identity = fs.Identity
+
+	// Backend is the key-value store a Client keeps its volumes in.
+	Backend = fs.Backend
+	// Writer queues writes for Backend.Tx and Backend.Pipeline.
+	Writer = fs.Writer
+	// KeyRange is a byte range of a string key.
+	KeyRange = fs.KeyRange
+	// RedisBackend stores volumes in Redis.
+	RedisBackend = fs.RedisBackend
+	// MemoryBackend stores volumes in process memory, for tests and
+	// throwaway filesystems.
+	MemoryBackend = fs.MemoryBackend
+)
+
+// NewRedisBackend returns a Backend on any go-redis client.
+func NewRedisBackend(rdb redis.UniversalClient) *RedisBackend {
+	return fs.NewRedisBackend(rdb)
+}
+
+// NewMemoryBackend returns an empty in-memory Backend.
+func NewMemoryBackend() *MemoryBackend {
+	return fs.NewMemoryBackend()
+}
+
+// Entry types.
+const (
+	TypeDir     = fs.TypeDir
+	TypeFile    = fs.TypeFile
+	TypeSymlink = fs.TypeSymlink
+)
+
+// Archive formats.
+const (
+	FormatTar   = fs.FormatTar
+	FormatTarGz = fs.FormatTarGz
+	FormatZip   = fs.FormatZip
+)
+
+// ParseArchiveFormat parses tar, tar.gz (or tgz) or zip.
+func ParseArchiveFormat(s string) (ArchiveFormat, error) {
+	return fs.ParseArchiveFormat(s)
+}
+
+// DefaultVolume is the volume used when Options.Volume is empty.
+const DefaultVolume = "main"
+
+// DefaultChunkSize is the default size above which files are chunked.
+const DefaultChunkSize = fs.DefaultChunkSize
+
+// DefaultUmask is the umask of a new Client; change it with
+// Client.SetUmask.
+const DefaultUmask = fs.DefaultUmask
+
+// ParseUmask parses an octal umask such as "022".
+func ParseUmask(s string) (os.FileMode, error) {
+	return fs.ParseUmask(s)
+}
+
+// SnapshotVolume returns the volume name that opens snapshot name of
+// volume read-only, e.g. main@2026-10-01.
+func SnapshotVolume(volume, name string) string {
+	return fs.SnapshotVolume(volume, name)
+}
+
+// Options configures a Client created by New.
+type Options struct {
+	// Volume is the volume to open; DefaultVolume if empty. Names cannot
+	// contain whitespace or any of @:{}*?[]\/, but for the @ that opens a
+	// snapshot.
+	Volume string
+
+	// HashTags stores keys as fs:{volume}:..., keeping a volume in one
+	// cluster slot. Always on for a *redis.ClusterClient.
+	HashTags bool
+
+	// ChunkSize is the size above which files are stored in chunks.
+	// Zero means DefaultChunkSize; a negative value disables chunking.
+	ChunkSize int64
+
+	// Search keeps the volume's search index in sync with file mutations.
+	// Requires Redis 8+ or RediSearch; see DetectSearch.
+	Search bool
+
+	// Embedding, when set together with Search, also stores a vector
+	// embedding of every indexed file.
+	Embedding *EmbeddingConfig
+
+	// Identity is the user permission checks are made for. The zero
+	// value is root, which bypasses them.
+	Identity Identity
+
+	// ReadOnly returns a client for replicas: the volume is not
+	// initialized, no index is maintained and reads do not update atime.
+	ReadOnly bool
+
+	// Events publishes every mutation to the volume's change stream,
+	// fs:<volume>:events; see EventStream. Requires a Redis backend.
+	Events bool
+
+	// EventsMaxLen is about how many events the stream keeps. Zero means
+	// DefaultEventsMaxLen.
+	EventsMaxLen int64
+}
+
+// New returns a Client for opts.Volume on rdb. Unless opts.ReadOnly is
+// set, the volume is created if missing (or migrated from an older key
+// layout) and the server-side functions library is loaded. An invalid
+// volume name fails with ErrInvalid.
+func New(ctx context.Context, rdb redis.UniversalClient, opts Options) (*Client, error) {
+	return NewWithBackend(ctx, NewRedisBackend(rdb), opts)
+}
+
+// NewWithBackend is like New for any Backend, such as a MemoryBackend.
+// Search needs a RedisBackend.
+func NewWithBackend(ctx context.Context, b Backend, opts Options) (*Client, error) {
+	volume := opts.Volume
+	if volume == "" {
+		volume = DefaultVolume
+	}
+	if !fs.ValidVolumeName(volume) {
+		return nil, &PathError{Op: "open", Path: volume, Err: ErrInvalid}
+	}
+	var rdb redis.UniversalClient
+	if rb, ok := b.(*RedisBackend); ok {
+		rdb = rb.Client()
+	}
+	if opts.Search && rdb == nil {
+		return nil, errors.New("redisfs: search requires a Redis backend")
+	}
+	if opts.Events && rdb == nil {
+		return nil, errors.New("redisfs: events require a Redis backend")
+	}
+	_, cluster := rdb.(*redis.ClusterClient)
+	hashTags := opts.HashTags || cluster
+
+	c := fs.NewClientWithBackend(b, volume)
+	c.SetHashTags(hashTags)
+	c.SetIdentity(opts.Identity)
+	switch {
+	case opts.ChunkSize > 0:
+		c.SetChunkSize(opts.ChunkSize)
+	case opts.ChunkSize < 0:
+		c.SetChunkSize(0)
+	}
+
+	if opts.ReadOnly {
+		c.SetReadOnly(true)
+		return c, nil
+	}
+
+	if opts.Search {
+		indexer := NewIndexer(rdb, volume)
+		indexer.SetHashTags(hashTags)
+		if opts.Embedding != nil && opts.Embedding.IsConfigured() {
+			indexer.SetEmbedder(NewEmbedder(opts.Embedding), opts.Embedding.Dim)
+		}
+		c.AddObserver(indexer)
+	}
+	if opts.Events {
+		stream := NewEventStream(rdb, volume)
+		stream.SetHashTags(hashTags)
+		stream.SetMaxLen(opts.EventsMaxLen)
+		c.AddObserver(stream)
+	}
+
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewVolumeFS returns an io/fs view of the client's active volume.
+func NewVolumeFS(ctx context.Context, c *Client) *VolumeFS {
+	return fs.NewVolumeFS(ctx, c)
+}
@@ -0,0 +1,56 @@
+package redisfs
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rowantrollope/redis-fs-cli/internal/embedding"
+	"github.com/rowantrollope/redis-fs-cli/internal/search"
+)
+
+// Search types.
+type (
+	// Indexer keeps a volume's search index in sync; it is a FileObserver.
+	Indexer = search.Indexer
+	// IndexManager creates, drops and inspects a volume's FT index.
+	IndexManager = search.IndexManager
+	// SearchResult is a single search hit.
+	SearchResult = search.SearchResult
+	// HybridSearchOptions configures SearchHybrid.
+	HybridSearchOptions = search.HybridSearchOptions
+	// Embedder computes vector embeddings through an OpenAI-compatible API.
+	Embedder = embedding.Client
+	// EmbeddingConfig configures an Embedder.
+	EmbeddingConfig = embedding.Config
+)
+
+// DetectSearch reports whether the server supports FT.* search commands.
+func DetectSearch(ctx context.Context, rdb redis.UniversalClient) bool {
+	return search.DetectSearch(ctx, rdb)
+}
+
+// NewIndexer returns an Indexer for volume.
+func NewIndexer(rdb redis.UniversalClient, volume string) *Indexer {
+	return search.NewIndexer(rdb, volume)
+}
+
+// NewIndexManager returns an IndexManager for volume.
+func NewIndexManager(rdb redis.UniversalClient, volume string) *IndexManager {
+	return search.NewIndexManager(rdb, volume)
+}
+
+// NewEmbedder returns an Embedder for cfg.
+func NewEmbedder(cfg *EmbeddingConfig) *Embedder {
+	return embedding.NewClient(cfg)
+}
+
+// SearchFullText runs a full-text query against indexName, optionally
+// restricted to files under dirFilter that carry every tag in tags.
+func SearchFullText(ctx context.Context, rdb redis.UniversalClient, indexName, pattern, dirFilter string, limit int, tags ...string) ([]SearchResult, error) {
+	return search.SearchFullText(ctx, rdb, indexName, pattern, dirFilter, limit, tags...)
+}
+
+// SearchHybrid runs a vector KNN query with optional text and directory filters.
+func SearchHybrid(ctx context.Context, rdb redis.UniversalClient, indexName string, opts HybridSearchOptions) ([]SearchResult, error) {
+	return search.SearchHybrid(ctx, rdb, indexName, opts)
+}